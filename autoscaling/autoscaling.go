@@ -0,0 +1,625 @@
+package autoscaling
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+)
+
+// refreshPollInterval is how often instance
+// refreshes are polled while waiting for them.
+const refreshPollInterval = 15 * time.Second
+
+// defaultLaunchTemplateVersion is the launch template
+// version used when none is specified.
+const defaultLaunchTemplateVersion = "$Latest"
+
+// Connection provides a connection
+// to AWS Auto Scaling.
+//
+// **Attributes:**
+//
+// Client: the Auto Scaling client
+// Session: the AWS session from which the client is derived
+type Connection struct {
+	Client  autoscalingiface.AutoScalingAPI
+	Session *session.Session
+}
+
+// GroupParams provides information
+// about an Auto Scaling group.
+//
+// **Attributes:**
+//
+// Name: the name of the group
+// LaunchTemplateID: the ID of the launch template, takes precedence over LaunchTemplateName
+// LaunchTemplateName: the name of the launch template
+// LaunchTemplateVersion: the launch template version, defaults to $Latest
+// MinSize: the minimum number of instances
+// MaxSize: the maximum number of instances
+// DesiredCapacity: the desired number of instances, MinSize if zero
+// SubnetIDs: the IDs of the subnets to launch instances in
+// TargetGroupARNs: the ARNs of the load balancer target groups to register instances with
+// HealthCheckType: the health check type, EC2 or ELB
+// HealthCheckGracePeriod: the seconds to wait before checking the health of new instances
+// Tags: the tags to apply to the group and propagate to its instances
+type GroupParams struct {
+	Name                   string
+	LaunchTemplateID       string
+	LaunchTemplateName     string
+	LaunchTemplateVersion  string
+	MinSize                int64
+	MaxSize                int64
+	DesiredCapacity        int64
+	SubnetIDs              []string
+	TargetGroupARNs        []string
+	HealthCheckType        string
+	HealthCheckGracePeriod int64
+	Tags                   map[string]string
+}
+
+// GroupUpdateParams provides the changes to
+// make to an Auto Scaling group. Nil, empty or zero
+// fields are left unchanged.
+//
+// **Attributes:**
+//
+// Name: the name of the group
+// LaunchTemplateID: the ID of the launch template, takes precedence over LaunchTemplateName
+// LaunchTemplateName: the name of the launch template
+// LaunchTemplateVersion: the launch template version, defaults to $Latest
+// MinSize: the minimum number of instances
+// MaxSize: the maximum number of instances
+// DesiredCapacity: the desired number of instances
+// SubnetIDs: the IDs of the subnets to launch instances in
+// HealthCheckType: the health check type, EC2 or ELB
+// HealthCheckGracePeriod: the seconds to wait before checking the health of new instances
+// Tags: the tags to add to or update on the group and propagate to its instances
+type GroupUpdateParams struct {
+	Name                   string
+	LaunchTemplateID       string
+	LaunchTemplateName     string
+	LaunchTemplateVersion  string
+	MinSize                *int64
+	MaxSize                *int64
+	DesiredCapacity        *int64
+	SubnetIDs              []string
+	HealthCheckType        string
+	HealthCheckGracePeriod int64
+	Tags                   map[string]string
+}
+
+// RefreshPreferences provides the preferences
+// of an instance refresh.
+//
+// **Attributes:**
+//
+// MinHealthyPercentage: the percentage of capacity that must stay healthy, defaults to 90
+// InstanceWarmup: the seconds until a new instance is considered healthy
+// SkipMatching: whether to skip instances already using the desired launch template
+// AutoRollback: whether to roll back if the refresh fails
+type RefreshPreferences struct {
+	MinHealthyPercentage int64
+	InstanceWarmup       int64
+	SkipMatching         bool
+	AutoRollback         bool
+}
+
+// Instance provides information about an
+// instance in an Auto Scaling group.
+//
+// **Attributes:**
+//
+// ID: the ID of the instance
+// LifecycleState: the lifecycle state, such as Pending, InService or Terminating
+// HealthStatus: the health status, Healthy or Unhealthy
+// AvailabilityZone: the availability zone of the instance
+// InstanceType: the instance type
+// LaunchTemplateVersion: the launch template version the instance was launched from
+// ProtectedFromScaleIn: whether the instance is protected from scale in
+type Instance struct {
+	ID                    string
+	LifecycleState        string
+	HealthStatus          string
+	AvailabilityZone      string
+	InstanceType          string
+	LaunchTemplateVersion string
+	ProtectedFromScaleIn  bool
+}
+
+// createClient creates a new AWS session
+// and Auto Scaling client.
+func createClient() (autoscalingiface.AutoScalingAPI, *session.Session) {
+	sess := session.Must(session.NewSessionWithOptions(
+		session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		}))
+
+	return autoscaling.New(sess), sess
+}
+
+// CreateConnection creates a new connection
+// to AWS Auto Scaling.
+//
+// **Returns:**
+//
+// Connection: a new connection to AWS Auto Scaling
+func CreateConnection() Connection {
+	connection := Connection{}
+	connection.Client, connection.Session = createClient()
+
+	return connection
+}
+
+// CreateGroup creates an Auto Scaling group from a launch template.
+//
+// **Parameters:**
+//
+// params: the parameters of the group
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to create the group
+func (c *Connection) CreateGroup(params GroupParams) error {
+	if params.Name == "" {
+		return errors.New("a group name is required")
+	}
+	if params.MaxSize < params.MinSize {
+		return fmt.Errorf("MaxSize (%d) must not be less than MinSize (%d)", params.MaxSize, params.MinSize)
+	}
+
+	launchTemplate, err := launchTemplateSpecification(params.LaunchTemplateID, params.LaunchTemplateName, params.LaunchTemplateVersion)
+	if err != nil {
+		return err
+	}
+
+	desired := params.DesiredCapacity
+	if desired == 0 {
+		desired = params.MinSize
+	}
+
+	input := &autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(params.Name),
+		LaunchTemplate:       launchTemplate,
+		MinSize:              aws.Int64(params.MinSize),
+		MaxSize:              aws.Int64(params.MaxSize),
+		DesiredCapacity:      aws.Int64(desired),
+		VPCZoneIdentifier:    vpcZoneIdentifier(params.SubnetIDs),
+		Tags:                 groupTags(params.Name, params.Tags),
+	}
+	if len(params.TargetGroupARNs) > 0 {
+		input.TargetGroupARNs = aws.StringSlice(params.TargetGroupARNs)
+	}
+	if params.HealthCheckType != "" {
+		input.HealthCheckType = aws.String(params.HealthCheckType)
+	}
+	if params.HealthCheckGracePeriod != 0 {
+		input.HealthCheckGracePeriod = aws.Int64(params.HealthCheckGracePeriod)
+	}
+
+	if _, err := c.Client.CreateAutoScalingGroup(input); err != nil {
+		return fmt.Errorf("error creating auto scaling group %s: %v", params.Name, err)
+	}
+
+	return nil
+}
+
+// UpdateGroup updates the launch template, sizes, subnets and health
+// check settings of an Auto Scaling group. Only the fields that are
+// set are changed, so an update of the launch template leaves the
+// sizes of the group alone. Instances are not replaced; use
+// StartInstanceRefresh for that.
+//
+// **Parameters:**
+//
+// params: the changes to make to the group
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to update the group
+func (c *Connection) UpdateGroup(params GroupUpdateParams) error {
+	if params.Name == "" {
+		return errors.New("a group name is required")
+	}
+	if params.MinSize != nil && params.MaxSize != nil && *params.MaxSize < *params.MinSize {
+		return fmt.Errorf("MaxSize (%d) must not be less than MinSize (%d)", *params.MaxSize, *params.MinSize)
+	}
+
+	input := &autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(params.Name),
+		MinSize:              params.MinSize,
+		MaxSize:              params.MaxSize,
+		DesiredCapacity:      params.DesiredCapacity,
+		VPCZoneIdentifier:    vpcZoneIdentifier(params.SubnetIDs),
+	}
+	if params.LaunchTemplateID != "" || params.LaunchTemplateName != "" {
+		launchTemplate, err := launchTemplateSpecification(params.LaunchTemplateID, params.LaunchTemplateName, params.LaunchTemplateVersion)
+		if err != nil {
+			return err
+		}
+		input.LaunchTemplate = launchTemplate
+	}
+	if params.HealthCheckType != "" {
+		input.HealthCheckType = aws.String(params.HealthCheckType)
+	}
+	if params.HealthCheckGracePeriod != 0 {
+		input.HealthCheckGracePeriod = aws.Int64(params.HealthCheckGracePeriod)
+	}
+
+	if _, err := c.Client.UpdateAutoScalingGroup(input); err != nil {
+		return fmt.Errorf("error updating auto scaling group %s: %v", params.Name, err)
+	}
+
+	if len(params.Tags) > 0 {
+		if _, err := c.Client.CreateOrUpdateTags(&autoscaling.CreateOrUpdateTagsInput{
+			Tags: groupTags(params.Name, params.Tags),
+		}); err != nil {
+			return fmt.Errorf("error tagging auto scaling group %s: %v", params.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteGroup deletes an Auto Scaling group and waits for it to be
+// deleted. Unless force is set, the group must have no instances.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// force: whether to terminate the group's instances along with it
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to delete the group
+func (c *Connection) DeleteGroup(name string, force bool) error {
+	if _, err := c.Client.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(name),
+		ForceDelete:          aws.Bool(force),
+	}); err != nil {
+		return fmt.Errorf("error deleting auto scaling group %s: %v", name, err)
+	}
+
+	if err := c.Client.WaitUntilGroupNotExists(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(name)},
+	}); err != nil {
+		return fmt.Errorf("error waiting for auto scaling group %s to be deleted: %v", name, err)
+	}
+
+	return nil
+}
+
+// GetGroup retrieves the Auto Scaling group with the provided name.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// **Returns:**
+//
+// *autoscaling.Group: the group
+//
+// error: an error if the group does not exist or could not be described
+func (c *Connection) GetGroup(name string) (*autoscaling.Group, error) {
+	result, err := c.Client.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(name)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing auto scaling group %s: %v", name, err)
+	}
+
+	if len(result.AutoScalingGroups) == 0 {
+		return nil, fmt.Errorf("auto scaling group %s does not exist", name)
+	}
+
+	return result.AutoScalingGroups[0], nil
+}
+
+// SetDesiredCapacity sets the desired capacity of an Auto Scaling group.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// capacity: the desired number of instances
+//
+// honorCooldown: whether to wait for the group's cooldown period to end
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to set the capacity
+func (c *Connection) SetDesiredCapacity(name string, capacity int64, honorCooldown bool) error {
+	if _, err := c.Client.SetDesiredCapacity(&autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String(name),
+		DesiredCapacity:      aws.Int64(capacity),
+		HonorCooldown:        aws.Bool(honorCooldown),
+	}); err != nil {
+		return fmt.Errorf("error setting desired capacity of %s to %d: %v", name, capacity, err)
+	}
+
+	return nil
+}
+
+// StartInstanceRefresh starts replacing the instances of an Auto
+// Scaling group with instances from its current launch template.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// prefs: the preferences of the refresh
+//
+// **Returns:**
+//
+// string: the ID of the instance refresh
+//
+// error: an error if any issue occurs while trying to start the refresh
+func (c *Connection) StartInstanceRefresh(name string, prefs RefreshPreferences) (string, error) {
+	preferences := &autoscaling.RefreshPreferences{
+		SkipMatching: aws.Bool(prefs.SkipMatching),
+		AutoRollback: aws.Bool(prefs.AutoRollback),
+	}
+	if prefs.MinHealthyPercentage != 0 {
+		preferences.MinHealthyPercentage = aws.Int64(prefs.MinHealthyPercentage)
+	}
+	if prefs.InstanceWarmup != 0 {
+		preferences.InstanceWarmup = aws.Int64(prefs.InstanceWarmup)
+	}
+
+	result, err := c.Client.StartInstanceRefresh(&autoscaling.StartInstanceRefreshInput{
+		AutoScalingGroupName: aws.String(name),
+		Preferences:          preferences,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error starting instance refresh of %s: %v", name, err)
+	}
+
+	return aws.StringValue(result.InstanceRefreshId), nil
+}
+
+// GetInstanceRefresh retrieves an instance refresh of an Auto Scaling group.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// refreshID: the ID of the instance refresh
+//
+// **Returns:**
+//
+// *autoscaling.InstanceRefresh: the instance refresh
+//
+// error: an error if the refresh does not exist or could not be described
+func (c *Connection) GetInstanceRefresh(name, refreshID string) (*autoscaling.InstanceRefresh, error) {
+	result, err := c.Client.DescribeInstanceRefreshes(&autoscaling.DescribeInstanceRefreshesInput{
+		AutoScalingGroupName: aws.String(name),
+		InstanceRefreshIds:   []*string{aws.String(refreshID)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing instance refresh %s of %s: %v", refreshID, name, err)
+	}
+
+	if len(result.InstanceRefreshes) == 0 {
+		return nil, fmt.Errorf("instance refresh %s of %s does not exist", refreshID, name)
+	}
+
+	return result.InstanceRefreshes[0], nil
+}
+
+// WaitForInstanceRefresh waits for an instance refresh to finish,
+// calling progress, if not nil, each time the refresh is polled.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// refreshID: the ID of the instance refresh
+//
+// timeout: how long to wait before giving up
+//
+// progress: the function called with the refresh each time it is polled
+//
+// **Returns:**
+//
+// *autoscaling.InstanceRefresh: the finished instance refresh
+//
+// error: an error if the refresh did not succeed or did not finish before the timeout
+func (c *Connection) WaitForInstanceRefresh(name, refreshID string, timeout time.Duration, progress func(*autoscaling.InstanceRefresh)) (*autoscaling.InstanceRefresh, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		refresh, err := c.GetInstanceRefresh(name, refreshID)
+		if err != nil {
+			return nil, err
+		}
+
+		if progress != nil {
+			progress(refresh)
+		}
+
+		switch status := aws.StringValue(refresh.Status); status {
+		case autoscaling.InstanceRefreshStatusSuccessful:
+			return refresh, nil
+		case autoscaling.InstanceRefreshStatusFailed,
+			autoscaling.InstanceRefreshStatusCancelled,
+			autoscaling.InstanceRefreshStatusRollbackFailed,
+			autoscaling.InstanceRefreshStatusRollbackSuccessful:
+			return refresh, fmt.Errorf("instance refresh %s of %s finished with status %s: %s",
+				refreshID, name, status, aws.StringValue(refresh.StatusReason))
+		}
+
+		if time.Now().After(deadline) {
+			return refresh, fmt.Errorf("timed out waiting for instance refresh %s of %s", refreshID, name)
+		}
+
+		time.Sleep(refreshPollInterval)
+	}
+}
+
+// CancelInstanceRefresh cancels the running instance
+// refresh of an Auto Scaling group.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to cancel the refresh
+func (c *Connection) CancelInstanceRefresh(name string) error {
+	if _, err := c.Client.CancelInstanceRefresh(&autoscaling.CancelInstanceRefreshInput{
+		AutoScalingGroupName: aws.String(name),
+	}); err != nil {
+		return fmt.Errorf("error cancelling instance refresh of %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// SuspendProcesses suspends scaling processes of an Auto Scaling group,
+// such as Launch, Terminate or HealthCheck.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// processes: the processes to suspend, all of them if none are provided
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to suspend the processes
+func (c *Connection) SuspendProcesses(name string, processes ...string) error {
+	input := &autoscaling.ScalingProcessQuery{AutoScalingGroupName: aws.String(name)}
+	if len(processes) > 0 {
+		input.ScalingProcesses = aws.StringSlice(processes)
+	}
+
+	if _, err := c.Client.SuspendProcesses(input); err != nil {
+		return fmt.Errorf("error suspending processes of %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// ResumeProcesses resumes suspended scaling
+// processes of an Auto Scaling group.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// processes: the processes to resume, all of them if none are provided
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to resume the processes
+func (c *Connection) ResumeProcesses(name string, processes ...string) error {
+	input := &autoscaling.ScalingProcessQuery{AutoScalingGroupName: aws.String(name)}
+	if len(processes) > 0 {
+		input.ScalingProcesses = aws.StringSlice(processes)
+	}
+
+	if _, err := c.Client.ResumeProcesses(input); err != nil {
+		return fmt.Errorf("error resuming processes of %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// ListInstances lists the instances of an Auto
+// Scaling group with their lifecycle states.
+//
+// **Parameters:**
+//
+// name: the name of the group
+//
+// **Returns:**
+//
+// []Instance: the instances of the group, sorted by ID
+//
+// error: an error if any issue occurs while trying to list the instances
+func (c *Connection) ListInstances(name string) ([]Instance, error) {
+	group, err := c.GetGroup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0, len(group.Instances))
+	for _, instance := range group.Instances {
+		summary := Instance{
+			ID:                   aws.StringValue(instance.InstanceId),
+			LifecycleState:       aws.StringValue(instance.LifecycleState),
+			HealthStatus:         aws.StringValue(instance.HealthStatus),
+			AvailabilityZone:     aws.StringValue(instance.AvailabilityZone),
+			InstanceType:         aws.StringValue(instance.InstanceType),
+			ProtectedFromScaleIn: aws.BoolValue(instance.ProtectedFromScaleIn),
+		}
+		if instance.LaunchTemplate != nil {
+			summary.LaunchTemplateVersion = aws.StringValue(instance.LaunchTemplate.Version)
+		}
+		instances = append(instances, summary)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+
+	return instances, nil
+}
+
+func launchTemplateSpecification(id, name, version string) (*autoscaling.LaunchTemplateSpecification, error) {
+	if version == "" {
+		version = defaultLaunchTemplateVersion
+	}
+
+	switch {
+	case id != "":
+		return &autoscaling.LaunchTemplateSpecification{
+			LaunchTemplateId: aws.String(id),
+			Version:          aws.String(version),
+		}, nil
+	case name != "":
+		return &autoscaling.LaunchTemplateSpecification{
+			LaunchTemplateName: aws.String(name),
+			Version:            aws.String(version),
+		}, nil
+	}
+
+	return nil, errors.New("a launch template ID or name is required")
+}
+
+func vpcZoneIdentifier(subnetIDs []string) *string {
+	if len(subnetIDs) == 0 {
+		return nil
+	}
+
+	return aws.String(strings.Join(subnetIDs, ","))
+}
+
+func groupTags(name string, tags map[string]string) []*autoscaling.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*autoscaling.Tag, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &autoscaling.Tag{
+			Key:               aws.String(key),
+			Value:             aws.String(tags[key]),
+			PropagateAtLaunch: aws.Bool(true),
+			ResourceId:        aws.String(name),
+			ResourceType:      aws.String("auto-scaling-group"),
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,265 @@
+package autoscaling_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	asgutils "github.com/l50/awsutils/autoscaling"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAutoScalingClient records the inputs of the calls it
+// receives and answers describe calls with canned results.
+type fakeAutoScalingClient struct {
+	autoscalingiface.AutoScalingAPI
+
+	groups    []*autoscaling.Group
+	refreshes []*autoscaling.InstanceRefresh
+
+	created   *autoscaling.CreateAutoScalingGroupInput
+	updated   *autoscaling.UpdateAutoScalingGroupInput
+	tagged    *autoscaling.CreateOrUpdateTagsInput
+	suspended *autoscaling.ScalingProcessQuery
+	started   *autoscaling.StartInstanceRefreshInput
+}
+
+func (f *fakeAutoScalingClient) CreateAutoScalingGroup(input *autoscaling.CreateAutoScalingGroupInput) (*autoscaling.CreateAutoScalingGroupOutput, error) {
+	f.created = input
+	return &autoscaling.CreateAutoScalingGroupOutput{}, nil
+}
+
+func (f *fakeAutoScalingClient) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	f.updated = input
+	return &autoscaling.UpdateAutoScalingGroupOutput{}, nil
+}
+
+func (f *fakeAutoScalingClient) CreateOrUpdateTags(input *autoscaling.CreateOrUpdateTagsInput) (*autoscaling.CreateOrUpdateTagsOutput, error) {
+	f.tagged = input
+	return &autoscaling.CreateOrUpdateTagsOutput{}, nil
+}
+
+func (f *fakeAutoScalingClient) SuspendProcesses(input *autoscaling.ScalingProcessQuery) (*autoscaling.SuspendProcessesOutput, error) {
+	f.suspended = input
+	return &autoscaling.SuspendProcessesOutput{}, nil
+}
+
+func (f *fakeAutoScalingClient) StartInstanceRefresh(input *autoscaling.StartInstanceRefreshInput) (*autoscaling.StartInstanceRefreshOutput, error) {
+	f.started = input
+	return &autoscaling.StartInstanceRefreshOutput{InstanceRefreshId: aws.String("refresh-1")}, nil
+}
+
+func (f *fakeAutoScalingClient) DescribeAutoScalingGroups(*autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: f.groups}, nil
+}
+
+func (f *fakeAutoScalingClient) DescribeInstanceRefreshes(*autoscaling.DescribeInstanceRefreshesInput) (*autoscaling.DescribeInstanceRefreshesOutput, error) {
+	refresh := f.refreshes[0]
+	if len(f.refreshes) > 1 {
+		f.refreshes = f.refreshes[1:]
+	}
+	return &autoscaling.DescribeInstanceRefreshesOutput{InstanceRefreshes: []*autoscaling.InstanceRefresh{refresh}}, nil
+}
+
+func TestCreateGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  asgutils.GroupParams
+		wantErr bool
+	}{
+		{
+			name: "valid group",
+			params: asgutils.GroupParams{
+				Name:             "web",
+				LaunchTemplateID: "lt-1",
+				MinSize:          2,
+				MaxSize:          4,
+				SubnetIDs:        []string{"subnet-1", "subnet-2"},
+				TargetGroupARNs:  []string{"arn:aws:elasticloadbalancing:tg/web"},
+				HealthCheckType:  "ELB",
+				Tags:             map[string]string{"Env": "prod"},
+			},
+		},
+		{
+			name:    "missing launch template",
+			params:  asgutils.GroupParams{Name: "web", MinSize: 1, MaxSize: 1},
+			wantErr: true,
+		},
+		{
+			name:    "max smaller than min",
+			params:  asgutils.GroupParams{Name: "web", LaunchTemplateName: "web", MinSize: 2, MaxSize: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeAutoScalingClient{}
+			c := asgutils.Connection{Client: fake}
+
+			err := c.CreateGroup(tc.params)
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, fake.created)
+				return
+			}
+			require.NoError(t, err)
+
+			input := fake.created
+			assert.Equal(t, "lt-1", aws.StringValue(input.LaunchTemplate.LaunchTemplateId))
+			assert.Equal(t, "$Latest", aws.StringValue(input.LaunchTemplate.Version))
+			assert.Equal(t, int64(2), aws.Int64Value(input.DesiredCapacity))
+			assert.Equal(t, "subnet-1,subnet-2", aws.StringValue(input.VPCZoneIdentifier))
+			assert.Equal(t, "ELB", aws.StringValue(input.HealthCheckType))
+			require.Len(t, input.Tags, 1)
+			assert.True(t, aws.BoolValue(input.Tags[0].PropagateAtLaunch))
+		})
+	}
+}
+
+func TestUpdateGroup(t *testing.T) {
+	t.Run("launch template only", func(t *testing.T) {
+		fake := &fakeAutoScalingClient{}
+		c := asgutils.Connection{Client: fake}
+
+		require.NoError(t, c.UpdateGroup(asgutils.GroupUpdateParams{
+			Name:                  "web",
+			LaunchTemplateName:    "web",
+			LaunchTemplateVersion: "3",
+			Tags:                  map[string]string{"Version": "3"},
+		}))
+
+		assert.Equal(t, "3", aws.StringValue(fake.updated.LaunchTemplate.Version))
+		// The sizes of the group are left alone.
+		assert.Nil(t, fake.updated.MinSize)
+		assert.Nil(t, fake.updated.MaxSize)
+		assert.Nil(t, fake.updated.DesiredCapacity)
+		assert.Nil(t, fake.updated.VPCZoneIdentifier)
+		require.NotNil(t, fake.tagged)
+		assert.Equal(t, "web", aws.StringValue(fake.tagged.Tags[0].ResourceId))
+	})
+
+	t.Run("sizes and subnets", func(t *testing.T) {
+		fake := &fakeAutoScalingClient{}
+		c := asgutils.Connection{Client: fake}
+
+		require.NoError(t, c.UpdateGroup(asgutils.GroupUpdateParams{
+			Name:            "web",
+			MinSize:         aws.Int64(0),
+			MaxSize:         aws.Int64(4),
+			DesiredCapacity: aws.Int64(0),
+			SubnetIDs:       []string{"subnet-1", "subnet-2"},
+		}))
+
+		assert.Equal(t, int64(0), aws.Int64Value(fake.updated.MinSize))
+		assert.Equal(t, int64(4), aws.Int64Value(fake.updated.MaxSize))
+		require.NotNil(t, fake.updated.DesiredCapacity)
+		assert.Equal(t, int64(0), *fake.updated.DesiredCapacity)
+		assert.Equal(t, "subnet-1,subnet-2", aws.StringValue(fake.updated.VPCZoneIdentifier))
+		assert.Nil(t, fake.updated.LaunchTemplate)
+		assert.Nil(t, fake.tagged)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		fake := &fakeAutoScalingClient{}
+		c := asgutils.Connection{Client: fake}
+
+		assert.Error(t, c.UpdateGroup(asgutils.GroupUpdateParams{MaxSize: aws.Int64(1)}))
+		assert.Error(t, c.UpdateGroup(asgutils.GroupUpdateParams{Name: "web", MinSize: aws.Int64(2), MaxSize: aws.Int64(1)}))
+		assert.Nil(t, fake.updated)
+	})
+}
+
+func TestSuspendProcesses(t *testing.T) {
+	fake := &fakeAutoScalingClient{}
+	c := asgutils.Connection{Client: fake}
+
+	require.NoError(t, c.SuspendProcesses("web"))
+	assert.Nil(t, fake.suspended.ScalingProcesses)
+
+	require.NoError(t, c.SuspendProcesses("web", "Launch", "Terminate"))
+	assert.Equal(t, []string{"Launch", "Terminate"}, aws.StringValueSlice(fake.suspended.ScalingProcesses))
+}
+
+func TestListInstances(t *testing.T) {
+	fake := &fakeAutoScalingClient{
+		groups: []*autoscaling.Group{{
+			AutoScalingGroupName: aws.String("web"),
+			Instances: []*autoscaling.Instance{
+				{
+					InstanceId:     aws.String("i-2"),
+					LifecycleState: aws.String("Pending"),
+					HealthStatus:   aws.String("Healthy"),
+				},
+				{
+					InstanceId:           aws.String("i-1"),
+					LifecycleState:       aws.String("InService"),
+					HealthStatus:         aws.String("Healthy"),
+					ProtectedFromScaleIn: aws.Bool(true),
+					LaunchTemplate:       &autoscaling.LaunchTemplateSpecification{Version: aws.String("3")},
+				},
+			},
+		}},
+	}
+	c := asgutils.Connection{Client: fake}
+
+	instances, err := c.ListInstances("web")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, asgutils.Instance{
+		ID:                    "i-1",
+		LifecycleState:        "InService",
+		HealthStatus:          "Healthy",
+		LaunchTemplateVersion: "3",
+		ProtectedFromScaleIn:  true,
+	}, instances[0])
+	assert.Equal(t, "Pending", instances[1].LifecycleState)
+
+	_, err = (&asgutils.Connection{Client: &fakeAutoScalingClient{}}).ListInstances("missing")
+	assert.Error(t, err)
+}
+
+func TestInstanceRefresh(t *testing.T) {
+	t.Run("successful", func(t *testing.T) {
+		fake := &fakeAutoScalingClient{
+			refreshes: []*autoscaling.InstanceRefresh{{
+				InstanceRefreshId:  aws.String("refresh-1"),
+				Status:             aws.String(autoscaling.InstanceRefreshStatusSuccessful),
+				PercentageComplete: aws.Int64(100),
+			}},
+		}
+		c := asgutils.Connection{Client: fake}
+
+		id, err := c.StartInstanceRefresh("web", asgutils.RefreshPreferences{MinHealthyPercentage: 50, SkipMatching: true})
+		require.NoError(t, err)
+		assert.Equal(t, "refresh-1", id)
+		assert.Equal(t, int64(50), aws.Int64Value(fake.started.Preferences.MinHealthyPercentage))
+		assert.True(t, aws.BoolValue(fake.started.Preferences.SkipMatching))
+
+		var polled []int64
+		refresh, err := c.WaitForInstanceRefresh("web", id, time.Minute, func(r *autoscaling.InstanceRefresh) {
+			polled = append(polled, aws.Int64Value(r.PercentageComplete))
+		})
+		require.NoError(t, err)
+		assert.Equal(t, autoscaling.InstanceRefreshStatusSuccessful, aws.StringValue(refresh.Status))
+		assert.Equal(t, []int64{100}, polled)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		fake := &fakeAutoScalingClient{
+			refreshes: []*autoscaling.InstanceRefresh{{
+				InstanceRefreshId: aws.String("refresh-1"),
+				Status:            aws.String(autoscaling.InstanceRefreshStatusFailed),
+				StatusReason:      aws.String("instances failed health checks"),
+			}},
+		}
+		c := asgutils.Connection{Client: fake}
+
+		_, err := c.WaitForInstanceRefresh("web", "refresh-1", time.Minute, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "instances failed health checks")
+	})
+}
@@ -12,6 +12,10 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 )
 
+// volumeDeviceName is the device name of the
+// volume attached by CreateInstance.
+const volumeDeviceName = "/dev/sdh"
+
 // Connection provides a connection
 // to AWS EC2.
 //
@@ -37,7 +41,9 @@ type Connection struct {
 // KeyName: the name of the key pair to use
 // SubnetID: the ID of the subnet to use
 // VolumeSize: the size of the volume to use
+// VolumeType: the EBS volume type to use (e.g. gp3), defaults to the AMI's volume type
 // InstanceName: the name of the instance to use
+// DryRun: whether to only check permissions and parameters without launching
 type Params struct {
 	AssociatePublicIPAddress bool
 	ImageID                  string
@@ -49,7 +55,9 @@ type Params struct {
 	KeyName                  string
 	SubnetID                 string
 	VolumeSize               int64
+	VolumeType               string
 	InstanceName             string
+	DryRun                   bool
 }
 
 // AMIInfo provides information
@@ -117,16 +125,7 @@ func IsEC2Instance() bool {
 //
 // error: an error if any issue occurs while trying to create the instance
 func (c *Connection) CreateInstance(ec2Params Params) (*ec2.Reservation, error) {
-	input := &ec2.RunInstancesInput{
-		BlockDeviceMappings: c.getBlockDeviceMappings(ec2Params),
-		IamInstanceProfile:  c.getIAMInstanceProfile(ec2Params),
-		ImageId:             aws.String(ec2Params.ImageID),
-		InstanceType:        aws.String(ec2Params.InstanceType),
-		MinCount:            aws.Int64(int64(ec2Params.MinCount)),
-		MaxCount:            aws.Int64(int64(ec2Params.MaxCount)),
-		NetworkInterfaces:   c.getNetworkInterfaces(ec2Params),
-		TagSpecifications:   c.getTagSpecifications(ec2Params),
-	}
+	input := c.getRunInstancesInput(ec2Params)
 
 	result, err := c.Client.RunInstances(input)
 	if err != nil {
@@ -308,7 +307,8 @@ func (c *Connection) GetRegion() (string, error) {
 	return *region, nil
 }
 
-// GetInstances retrieves all instances matching the provided filters.
+// GetInstances retrieves all instances matching the provided filters,
+// following every page of DescribeInstances results.
 //
 // **Parameters:**
 //
@@ -324,14 +324,15 @@ func (c *Connection) GetInstances(filters []*ec2.Filter) ([]*ec2.Instance, error
 		Filters: filters,
 	}
 
-	result, err := c.Client.DescribeInstances(input)
-	if err != nil {
-		return nil, err
-	}
-
 	var instances []*ec2.Instance
-	for _, reservation := range result.Reservations {
-		instances = append(instances, reservation.Instances...)
+	if err := c.Client.DescribeInstancesPages(input,
+		func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+			for _, reservation := range page.Reservations {
+				instances = append(instances, reservation.Instances...)
+			}
+			return true
+		}); err != nil {
+		return nil, err
 	}
 
 	return instances, nil
@@ -591,6 +592,7 @@ func (c *Connection) CreateSecurityGroup(groupName, description, vpcID string) (
 }
 
 // DestroySecurityGroup destroys the security group with the provided ID.
+// Use ForceDestroySecurityGroup to remove references to the group first.
 //
 // **Parameters:**
 //
@@ -624,18 +626,56 @@ func (c *Connection) checkResourceExistence(resourceName, resourceID string) err
 		}
 		_, err := c.Client.DescribeVpcs(input)
 		return err
+	case "security-group":
+		input := &ec2.DescribeSecurityGroupsInput{
+			GroupIds: []*string{aws.String(resourceID)},
+		}
+		_, err := c.Client.DescribeSecurityGroups(input)
+		return err
+	case "key-pair":
+		input := &ec2.DescribeKeyPairsInput{
+			KeyNames: []*string{aws.String(resourceID)},
+		}
+		_, err := c.Client.DescribeKeyPairs(input)
+		return err
 	default:
 		return errors.New("unsupported resource type")
 	}
 }
 
+func (c *Connection) getRunInstancesInput(ec2Params Params) *ec2.RunInstancesInput {
+	input := &ec2.RunInstancesInput{
+		BlockDeviceMappings: c.getBlockDeviceMappings(ec2Params),
+		DryRun:              aws.Bool(ec2Params.DryRun),
+		IamInstanceProfile:  c.getIAMInstanceProfile(ec2Params),
+		ImageId:             aws.String(ec2Params.ImageID),
+		InstanceType:        aws.String(ec2Params.InstanceType),
+		MinCount:            aws.Int64(int64(ec2Params.MinCount)),
+		MaxCount:            aws.Int64(int64(ec2Params.MaxCount)),
+		NetworkInterfaces:   c.getNetworkInterfaces(ec2Params),
+		TagSpecifications:   c.getTagSpecifications(ec2Params),
+	}
+
+	if ec2Params.KeyName != "" {
+		input.KeyName = aws.String(ec2Params.KeyName)
+	}
+
+	return input
+}
+
 func (c *Connection) getBlockDeviceMappings(ec2Params Params) []*ec2.BlockDeviceMapping {
+	ebs := &ec2.EbsBlockDevice{
+		VolumeSize: aws.Int64(ec2Params.VolumeSize),
+	}
+
+	if ec2Params.VolumeType != "" {
+		ebs.VolumeType = aws.String(ec2Params.VolumeType)
+	}
+
 	return []*ec2.BlockDeviceMapping{
 		{
-			DeviceName: aws.String("/dev/sdh"),
-			Ebs: &ec2.EbsBlockDevice{
-				VolumeSize: aws.Int64(ec2Params.VolumeSize),
-			},
+			DeviceName: aws.String(volumeDeviceName),
+			Ebs:        ebs,
 		},
 	}
 }
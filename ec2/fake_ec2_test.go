@@ -0,0 +1,115 @@
+package ec2_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEC2Error is an error response returned by the fake EC2 endpoint.
+type fakeEC2Error struct {
+	Code    string
+	Message string
+}
+
+// fakeEC2 answers EC2 query API actions with canned XML
+// bodies and records every request it receives.
+type fakeEC2 struct {
+	responses map[string]string
+	errs      map[string]fakeEC2Error
+
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+// newFakeEC2Connection starts a fake EC2 endpoint that answers actions
+// with the XML bodies in responses (keyed by action) or the errors in
+// errs, and returns a connection that talks to it. A request for a
+// later page is answered with the body keyed by "action/NextToken".
+func newFakeEC2Connection(t *testing.T, responses map[string]string, errs map[string]fakeEC2Error) *ec2utils.Connection {
+	c, _ := startFakeEC2(t, responses, errs)
+	return c
+}
+
+func startFakeEC2(t *testing.T, responses map[string]string, errs map[string]fakeEC2Error) (*ec2utils.Connection, *fakeEC2) {
+	t.Helper()
+
+	fake := &fakeEC2{responses: responses, errs: errs}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	return &ec2utils.Connection{Client: ec2.New(sess)}, fake
+}
+
+func (f *fakeEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	action := r.Form.Get("Action")
+
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Form)
+	f.mu.Unlock()
+
+	// EC2 rejects filters with more than 200 values.
+	for i := 1; r.Form.Get(fmt.Sprintf("Filter.%d.Name", i)) != ""; i++ {
+		if r.Form.Get(fmt.Sprintf("Filter.%d.Value.201", i)) != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<Response><Errors><Error><Code>FilterLimitExceeded</Code><Message>too many filter values</Message></Error></Errors><RequestID>req</RequestID></Response>")
+			return
+		}
+	}
+
+	if e, ok := f.errs[action]; ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors><RequestID>req</RequestID></Response>", e.Code, e.Message)
+		return
+	}
+
+	key := action
+	if token := r.Form.Get("NextToken"); token != "" {
+		key += "/" + token
+	}
+
+	body, ok := f.responses[key]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "<Response><Errors><Error><Code>UnsupportedOperation</Code><Message>%s</Message></Error></Errors><RequestID>req</RequestID></Response>", key)
+		return
+	}
+	fmt.Fprintf(w, "<%sResponse>%s</%sResponse>", action, body, action)
+}
+
+// requestsFor returns the recorded requests for the provided action.
+func (f *fakeEC2) requestsFor(action string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matched []url.Values
+	for _, req := range f.requests {
+		if req.Get("Action") == action {
+			matched = append(matched, req)
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,664 @@
+package ec2
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// DefaultFlowLogFormat is the format of version 2 flow log records,
+// used by AWS when no custom format is specified.
+const DefaultFlowLogFormat = "${version} ${account-id} ${interface-id} ${srcaddr} ${dstaddr} " +
+	"${srcport} ${dstport} ${protocol} ${packets} ${bytes} ${start} ${end} ${action} ${log-status}"
+
+// Flow log destination types.
+const (
+	FlowLogDestinationS3             = "s3"
+	FlowLogDestinationCloudWatchLogs = "cloud-watch-logs"
+)
+
+// flowLogFields lists every field available in version 2
+// to 5 flow log records.
+var flowLogFields = map[string]bool{
+	"version": true, "account-id": true, "interface-id": true, "srcaddr": true,
+	"dstaddr": true, "srcport": true, "dstport": true, "protocol": true,
+	"packets": true, "bytes": true, "start": true, "end": true, "action": true,
+	"log-status": true, "vpc-id": true, "subnet-id": true, "instance-id": true,
+	"tcp-flags": true, "type": true, "pkt-srcaddr": true, "pkt-dstaddr": true,
+	"region": true, "az-id": true, "sublocation-type": true, "sublocation-id": true,
+	"pkt-src-aws-service": true, "pkt-dst-aws-service": true,
+	"flow-direction": true, "traffic-path": true,
+}
+
+var flowLogFieldPattern = regexp.MustCompile(`\$\{([a-z0-9-]+)\}`)
+
+// FlowLogParams provides information
+// about VPC flow logs to enable.
+//
+// **Attributes:**
+//
+// VPCID: the ID of the VPC to enable flow logs for
+// DestinationType: where to deliver the logs, s3 or cloud-watch-logs
+// Destination: the S3 bucket ARN (optionally with a prefix), or the
+// CloudWatch Logs log group name or ARN
+// DeliverLogsRoleARN: the IAM role used to deliver logs, required for CloudWatch Logs
+// TrafficType: the traffic to log, ALL, ACCEPT or REJECT, defaults to ALL
+// Format: a custom log format, defaults to DefaultFlowLogFormat
+// MaxAggregationInterval: the aggregation interval in seconds, 60 or 600
+type FlowLogParams struct {
+	VPCID                  string
+	DestinationType        string
+	Destination            string
+	DeliverLogsRoleARN     string
+	TrafficType            string
+	Format                 string
+	MaxAggregationInterval int64
+}
+
+// FlowLogRecord provides a single parsed flow log record.
+// Fields that are absent from the format or reported as "-"
+// are left at their zero value.
+//
+// **Attributes:**
+//
+// Version: the flow log version
+// AccountID: the account ID of the interface owner
+// InterfaceID: the ID of the network interface
+// SrcAddr: the source address
+// DstAddr: the destination address
+// SrcPort: the source port
+// DstPort: the destination port
+// Protocol: the IANA protocol number
+// Packets: the number of packets transferred
+// Bytes: the number of bytes transferred
+// Start: the start of the aggregation window
+// End: the end of the aggregation window
+// Action: ACCEPT or REJECT
+// LogStatus: OK, NODATA or SKIPDATA
+// Fields: every field of the record keyed by field name
+type FlowLogRecord struct {
+	Version     int
+	AccountID   string
+	InterfaceID string
+	SrcAddr     string
+	DstAddr     string
+	SrcPort     int
+	DstPort     int
+	Protocol    int
+	Packets     int64
+	Bytes       int64
+	Start       time.Time
+	End         time.Time
+	Action      string
+	LogStatus   string
+	Fields      map[string]string
+}
+
+// FlowLogParser parses flow log records
+// of a given format.
+type FlowLogParser struct {
+	fields []string
+}
+
+// TalkerStat provides the traffic sent by a single address.
+//
+// **Attributes:**
+//
+// Address: the source address
+// Bytes: the number of bytes sent
+// Packets: the number of packets sent
+// Flows: the number of flow records
+type TalkerStat struct {
+	Address string
+	Bytes   int64
+	Packets int64
+	Flows   int
+}
+
+// RejectedStat provides the rejected attempts
+// of a single connection.
+//
+// **Attributes:**
+//
+// SrcAddr: the source address
+// DstAddr: the destination address
+// DstPort: the destination port
+// Protocol: the IANA protocol number
+// Flows: the number of rejected flow records
+type RejectedStat struct {
+	SrcAddr  string
+	DstAddr  string
+	DstPort  int
+	Protocol int
+	Flows    int
+}
+
+// PortStat provides the traffic sent to a single
+// destination port.
+//
+// **Attributes:**
+//
+// Port: the destination port
+// Protocol: the IANA protocol number
+// Bytes: the number of bytes transferred
+// Packets: the number of packets transferred
+// Flows: the number of flow records
+type PortStat struct {
+	Port     int
+	Protocol int
+	Bytes    int64
+	Packets  int64
+	Flows    int
+}
+
+// FlowLogSummary provides aggregated flow log statistics.
+//
+// **Attributes:**
+//
+// Records: the number of records analyzed
+// Skipped: the number of NODATA or SKIPDATA records skipped
+// TopTalkers: the source addresses that sent the most bytes
+// Rejected: the connections with the most rejected flows
+// Ports: the destination ports that received the most bytes
+type FlowLogSummary struct {
+	Records    int
+	Skipped    int
+	TopTalkers []TalkerStat
+	Rejected   []RejectedStat
+	Ports      []PortStat
+}
+
+// FlowLogAnalyzer aggregates flow log records.
+type FlowLogAnalyzer struct {
+	records  int
+	skipped  int
+	talkers  map[string]*TalkerStat
+	rejected map[string]*RejectedStat
+	ports    map[string]*PortStat
+}
+
+// EnableFlowLogs enables flow logs for the VPC in the provided parameters.
+//
+// **Parameters:**
+//
+// params: the parameters to use
+//
+// **Returns:**
+//
+// string: the ID of the created flow log
+//
+// error: an error if any issue occurs while trying to enable the flow logs
+func (c *Connection) EnableFlowLogs(params FlowLogParams) (string, error) {
+	trafficType := params.TrafficType
+	if trafficType == "" {
+		trafficType = ec2.TrafficTypeAll
+	}
+
+	input := &ec2.CreateFlowLogsInput{
+		ResourceIds:        []*string{aws.String(params.VPCID)},
+		ResourceType:       aws.String(ec2.FlowLogsResourceTypeVpc),
+		TrafficType:        aws.String(trafficType),
+		LogDestinationType: aws.String(params.DestinationType),
+	}
+
+	switch params.DestinationType {
+	case FlowLogDestinationS3:
+		input.LogDestination = aws.String(params.Destination)
+	case FlowLogDestinationCloudWatchLogs:
+		if params.DeliverLogsRoleARN == "" {
+			return "", errors.New("a delivery role is required for CloudWatch Logs flow logs")
+		}
+		input.DeliverLogsPermissionArn = aws.String(params.DeliverLogsRoleARN)
+		if strings.HasPrefix(params.Destination, "arn:") {
+			input.LogDestination = aws.String(params.Destination)
+		} else {
+			input.LogGroupName = aws.String(params.Destination)
+		}
+	default:
+		return "", fmt.Errorf("unsupported flow log destination type: %s", params.DestinationType)
+	}
+
+	if params.Format != "" {
+		if _, err := NewFlowLogParser(params.Format); err != nil {
+			return "", err
+		}
+		input.LogFormat = aws.String(params.Format)
+	}
+
+	if params.MaxAggregationInterval != 0 {
+		input.MaxAggregationInterval = aws.Int64(params.MaxAggregationInterval)
+	}
+
+	result, err := c.Client.CreateFlowLogs(input)
+	if err != nil {
+		return "", fmt.Errorf("error creating flow logs for %s: %v", params.VPCID, err)
+	}
+
+	if len(result.Unsuccessful) > 0 {
+		item := result.Unsuccessful[0]
+		return "", fmt.Errorf("error creating flow logs for %s: %s", aws.StringValue(item.ResourceId), aws.StringValue(item.Error.Message))
+	}
+
+	if len(result.FlowLogIds) == 0 {
+		return "", fmt.Errorf("no flow log was created for %s", params.VPCID)
+	}
+
+	return aws.StringValue(result.FlowLogIds[0]), nil
+}
+
+// DeleteFlowLogs deletes the flow logs with the provided IDs.
+//
+// **Parameters:**
+//
+// flowLogIDs: the IDs of the flow logs to delete
+//
+// **Returns:**
+//
+// error: an error if any flow log could not be deleted
+func (c *Connection) DeleteFlowLogs(flowLogIDs ...string) error {
+	result, err := c.Client.DeleteFlowLogs(&ec2.DeleteFlowLogsInput{
+		FlowLogIds: aws.StringSlice(flowLogIDs),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting flow logs: %v", err)
+	}
+
+	if len(result.Unsuccessful) > 0 {
+		item := result.Unsuccessful[0]
+		return fmt.Errorf("error deleting flow log %s: %s", aws.StringValue(item.ResourceId), aws.StringValue(item.Error.Message))
+	}
+
+	return nil
+}
+
+// NewFlowLogParser creates a parser for records in the provided
+// format, such as "${version} ${srcaddr} ${dstaddr}".
+//
+// **Parameters:**
+//
+// format: the flow log format, DefaultFlowLogFormat if empty
+//
+// **Returns:**
+//
+// *FlowLogParser: a parser for the format
+//
+// error: an error if the format contains no or unknown fields
+func NewFlowLogParser(format string) (*FlowLogParser, error) {
+	if format == "" {
+		format = DefaultFlowLogFormat
+	}
+
+	var fields []string
+	for _, match := range flowLogFieldPattern.FindAllStringSubmatch(format, -1) {
+		if !flowLogFields[match[1]] {
+			return nil, fmt.Errorf("unknown flow log field: %s", match[1])
+		}
+		fields = append(fields, match[1])
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields found in flow log format %q", format)
+	}
+
+	return &FlowLogParser{fields: fields}, nil
+}
+
+// ParseLine parses a single flow log record.
+//
+// **Parameters:**
+//
+// line: the record to parse
+//
+// **Returns:**
+//
+// FlowLogRecord: the parsed record
+//
+// error: an error if the record does not match the parser's format
+func (p *FlowLogParser) ParseLine(line string) (FlowLogRecord, error) {
+	values := strings.Fields(line)
+	if len(values) != len(p.fields) {
+		return FlowLogRecord{}, fmt.Errorf("expected %d fields, got %d", len(p.fields), len(values))
+	}
+
+	record := FlowLogRecord{Fields: make(map[string]string, len(values))}
+	for i, field := range p.fields {
+		value := values[i]
+		record.Fields[field] = value
+		if value == "-" {
+			continue
+		}
+
+		var err error
+		switch field {
+		case "version":
+			record.Version, err = strconv.Atoi(value)
+		case "account-id":
+			record.AccountID = value
+		case "interface-id":
+			record.InterfaceID = value
+		case "srcaddr":
+			record.SrcAddr = value
+		case "dstaddr":
+			record.DstAddr = value
+		case "srcport":
+			record.SrcPort, err = strconv.Atoi(value)
+		case "dstport":
+			record.DstPort, err = strconv.Atoi(value)
+		case "protocol":
+			record.Protocol, err = strconv.Atoi(value)
+		case "packets":
+			record.Packets, err = strconv.ParseInt(value, 10, 64)
+		case "bytes":
+			record.Bytes, err = strconv.ParseInt(value, 10, 64)
+		case "start":
+			record.Start, err = parseUnixTime(value)
+		case "end":
+			record.End, err = parseUnixTime(value)
+		case "action":
+			record.Action = value
+		case "log-status":
+			record.LogStatus = value
+		}
+
+		if err != nil {
+			return FlowLogRecord{}, fmt.Errorf("invalid %s value %q: %v", field, value, err)
+		}
+	}
+
+	return record, nil
+}
+
+// Parse reads flow log records from r and calls fn for each one.
+// If the first line is a header of field names, as written to S3,
+// it replaces the parser's format for the rest of the input.
+//
+// **Parameters:**
+//
+// r: the reader to parse records from
+//
+// fn: the function called for each record
+//
+// **Returns:**
+//
+// error: an error if a record could not be parsed or fn returned an error
+func (p *FlowLogParser) Parse(r io.Reader, fn func(FlowLogRecord) error) error {
+	parser := p
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if lineNum == 1 {
+			if fields, ok := parseFlowLogHeader(line); ok {
+				parser = &FlowLogParser{fields: fields}
+				continue
+			}
+		}
+
+		record, err := parser.ParseLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ParseFile reads flow log records from the file at path, which
+// may be plain text or gzip compressed, and calls fn for each one.
+//
+// **Parameters:**
+//
+// path: the path of the flow log file
+//
+// fn: the function called for each record
+//
+// **Returns:**
+//
+// error: an error if the file could not be read or parsed
+func (p *FlowLogParser) ParseFile(path string, fn func(FlowLogRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(2)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	var r io.Reader = reader
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("error opening gzip file %s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if err := p.Parse(r, fn); err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// NewFlowLogAnalyzer creates an empty flow log analyzer.
+//
+// **Returns:**
+//
+// *FlowLogAnalyzer: a new flow log analyzer
+func NewFlowLogAnalyzer() *FlowLogAnalyzer {
+	return &FlowLogAnalyzer{
+		talkers:  make(map[string]*TalkerStat),
+		rejected: make(map[string]*RejectedStat),
+		ports:    make(map[string]*PortStat),
+	}
+}
+
+// Add aggregates the provided record. Records without
+// data (NODATA or SKIPDATA) are counted as skipped.
+//
+// **Parameters:**
+//
+// record: the record to aggregate
+//
+// **Returns:**
+//
+// error: always nil, so Add can be passed directly to Parse
+func (a *FlowLogAnalyzer) Add(record FlowLogRecord) error {
+	if record.LogStatus == "NODATA" || record.LogStatus == "SKIPDATA" {
+		a.skipped++
+		return nil
+	}
+	a.records++
+
+	if record.SrcAddr != "" {
+		talker, ok := a.talkers[record.SrcAddr]
+		if !ok {
+			talker = &TalkerStat{Address: record.SrcAddr}
+			a.talkers[record.SrcAddr] = talker
+		}
+		talker.Bytes += record.Bytes
+		talker.Packets += record.Packets
+		talker.Flows++
+	}
+
+	portKey := fmt.Sprintf("%d/%d", record.DstPort, record.Protocol)
+	port, ok := a.ports[portKey]
+	if !ok {
+		port = &PortStat{Port: record.DstPort, Protocol: record.Protocol}
+		a.ports[portKey] = port
+	}
+	port.Bytes += record.Bytes
+	port.Packets += record.Packets
+	port.Flows++
+
+	if record.Action == "REJECT" {
+		key := fmt.Sprintf("%s>%s:%d/%d", record.SrcAddr, record.DstAddr, record.DstPort, record.Protocol)
+		rejected, ok := a.rejected[key]
+		if !ok {
+			rejected = &RejectedStat{
+				SrcAddr:  record.SrcAddr,
+				DstAddr:  record.DstAddr,
+				DstPort:  record.DstPort,
+				Protocol: record.Protocol,
+			}
+			a.rejected[key] = rejected
+		}
+		rejected.Flows++
+	}
+
+	return nil
+}
+
+// Summary returns the aggregated statistics, keeping
+// the topN entries of each ranking.
+//
+// **Parameters:**
+//
+// topN: the number of entries to keep in each ranking, all if zero or less
+//
+// **Returns:**
+//
+// FlowLogSummary: the aggregated statistics
+func (a *FlowLogAnalyzer) Summary(topN int) FlowLogSummary {
+	summary := FlowLogSummary{Records: a.records, Skipped: a.skipped}
+
+	for _, talker := range a.talkers {
+		summary.TopTalkers = append(summary.TopTalkers, *talker)
+	}
+	sort.Slice(summary.TopTalkers, func(i, j int) bool {
+		x, y := summary.TopTalkers[i], summary.TopTalkers[j]
+		if x.Bytes != y.Bytes {
+			return x.Bytes > y.Bytes
+		}
+		return x.Address < y.Address
+	})
+
+	for _, rejected := range a.rejected {
+		summary.Rejected = append(summary.Rejected, *rejected)
+	}
+	sort.Slice(summary.Rejected, func(i, j int) bool {
+		x, y := summary.Rejected[i], summary.Rejected[j]
+		if x.Flows != y.Flows {
+			return x.Flows > y.Flows
+		}
+		if x.SrcAddr != y.SrcAddr {
+			return x.SrcAddr < y.SrcAddr
+		}
+		if x.DstAddr != y.DstAddr {
+			return x.DstAddr < y.DstAddr
+		}
+		if x.DstPort != y.DstPort {
+			return x.DstPort < y.DstPort
+		}
+		return x.Protocol < y.Protocol
+	})
+
+	for _, port := range a.ports {
+		summary.Ports = append(summary.Ports, *port)
+	}
+	sort.Slice(summary.Ports, func(i, j int) bool {
+		x, y := summary.Ports[i], summary.Ports[j]
+		if x.Bytes != y.Bytes {
+			return x.Bytes > y.Bytes
+		}
+		if x.Port != y.Port {
+			return x.Port < y.Port
+		}
+		return x.Protocol < y.Protocol
+	})
+
+	if topN > 0 {
+		if len(summary.TopTalkers) > topN {
+			summary.TopTalkers = summary.TopTalkers[:topN]
+		}
+		if len(summary.Rejected) > topN {
+			summary.Rejected = summary.Rejected[:topN]
+		}
+		if len(summary.Ports) > topN {
+			summary.Ports = summary.Ports[:topN]
+		}
+	}
+
+	return summary
+}
+
+// AnalyzeFlowLogFiles parses and aggregates the flow log files
+// at the provided paths.
+//
+// **Parameters:**
+//
+// format: the flow log format, DefaultFlowLogFormat if empty
+//
+// topN: the number of entries to keep in each ranking, all if zero or less
+//
+// paths: the paths of the flow log files, plain or gzip compressed
+//
+// **Returns:**
+//
+// FlowLogSummary: the aggregated statistics
+//
+// error: an error if any file could not be read or parsed
+func AnalyzeFlowLogFiles(format string, topN int, paths ...string) (FlowLogSummary, error) {
+	parser, err := NewFlowLogParser(format)
+	if err != nil {
+		return FlowLogSummary{}, err
+	}
+
+	analyzer := NewFlowLogAnalyzer()
+	for _, path := range paths {
+		if err := parser.ParseFile(path, analyzer.Add); err != nil {
+			return FlowLogSummary{}, err
+		}
+	}
+
+	return analyzer.Summary(topN), nil
+}
+
+// parseFlowLogHeader reports whether line is a header of
+// flow log field names and returns the fields if so.
+func parseFlowLogHeader(line string) ([]string, bool) {
+	fields := strings.Fields(line)
+	for _, field := range fields {
+		if !flowLogFields[field] {
+			return nil, false
+		}
+	}
+
+	return fields, len(fields) > 0
+}
+
+func parseUnixTime(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
@@ -0,0 +1,223 @@
+package ec2_test
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const defaultFlowLogs = `version account-id interface-id srcaddr dstaddr srcport dstport protocol packets bytes start end action log-status
+2 123456789012 eni-1 10.0.0.1 10.0.1.5 49152 443 6 10 5000 1620000000 1620000060 ACCEPT OK
+2 123456789012 eni-1 10.0.0.2 10.0.1.5 49153 443 6 4 1000 1620000000 1620000060 ACCEPT OK
+2 123456789012 eni-1 10.0.0.1 10.0.1.5 49154 22 6 1 40 1620000000 1620000060 REJECT OK
+2 123456789012 eni-1 10.0.0.1 10.0.1.5 49155 22 6 1 40 1620000060 1620000120 REJECT OK
+2 123456789012 eni-1 - - - - - - - 1620000000 1620000060 - NODATA
+`
+
+func writeFlowLogFile(t *testing.T, name, content string, compress bool) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	if compress {
+		gz := gzip.NewWriter(file)
+		_, err = gz.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+		return path
+	}
+
+	_, err = file.WriteString(content)
+	require.NoError(t, err)
+	return path
+}
+
+func TestFlowLogParserParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		line    string
+		want    ec2utils.FlowLogRecord
+		wantErr bool
+	}{
+		{
+			name: "default format",
+			line: "2 123456789012 eni-1 10.0.0.1 10.0.1.5 49152 443 6 10 5000 1620000000 1620000060 ACCEPT OK",
+			want: ec2utils.FlowLogRecord{
+				Version: 2, AccountID: "123456789012", InterfaceID: "eni-1",
+				SrcAddr: "10.0.0.1", DstAddr: "10.0.1.5", SrcPort: 49152, DstPort: 443,
+				Protocol: 6, Packets: 10, Bytes: 5000,
+				Start:  time.Unix(1620000000, 0).UTC(),
+				End:    time.Unix(1620000060, 0).UTC(),
+				Action: "ACCEPT", LogStatus: "OK",
+			},
+		},
+		{
+			name:   "custom v5 format",
+			format: "${version} ${vpc-id} ${srcaddr} ${dstaddr} ${dstport} ${protocol} ${bytes} ${action} ${flow-direction}",
+			line:   "5 vpc-1 10.0.0.1 10.0.1.5 443 6 5000 ACCEPT ingress",
+			want: ec2utils.FlowLogRecord{
+				Version: 5, SrcAddr: "10.0.0.1", DstAddr: "10.0.1.5",
+				DstPort: 443, Protocol: 6, Bytes: 5000, Action: "ACCEPT",
+			},
+		},
+		{
+			name:    "wrong number of fields",
+			line:    "2 123456789012 eni-1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			line:    "2 123456789012 eni-1 10.0.0.1 10.0.1.5 x 443 6 10 5000 1620000000 1620000060 ACCEPT OK",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parser, err := ec2utils.NewFlowLogParser(tc.format)
+			require.NoError(t, err)
+
+			got, err := parser.ParseLine(tc.line)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			got.Fields = nil
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNewFlowLogParserUnknownField(t *testing.T) {
+	_, err := ec2utils.NewFlowLogParser("${version} ${bogus}")
+	assert.Error(t, err)
+}
+
+func TestParseFlowLogsCustomHeader(t *testing.T) {
+	parser, err := ec2utils.NewFlowLogParser("")
+	require.NoError(t, err)
+
+	input := "version vpc-id srcaddr dstaddr dstport protocol bytes action\n" +
+		"3 vpc-1 10.0.0.1 10.0.1.5 443 6 100 ACCEPT\n"
+
+	var records []ec2utils.FlowLogRecord
+	require.NoError(t, parser.Parse(strings.NewReader(input), func(record ec2utils.FlowLogRecord) error {
+		records = append(records, record)
+		return nil
+	}))
+
+	require.Len(t, records, 1)
+	assert.Equal(t, "vpc-1", records[0].Fields["vpc-id"])
+	assert.Equal(t, int64(100), records[0].Bytes)
+}
+
+func TestAnalyzeFlowLogFiles(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		path := writeFlowLogFile(t, "flows.log", defaultFlowLogs, compress)
+
+		summary, err := ec2utils.AnalyzeFlowLogFiles("", 10, path)
+		require.NoError(t, err)
+
+		assert.Equal(t, 4, summary.Records)
+		assert.Equal(t, 1, summary.Skipped)
+
+		require.Len(t, summary.TopTalkers, 2)
+		assert.Equal(t, ec2utils.TalkerStat{Address: "10.0.0.1", Bytes: 5080, Packets: 12, Flows: 3}, summary.TopTalkers[0])
+
+		require.Len(t, summary.Rejected, 1)
+		assert.Equal(t, ec2utils.RejectedStat{SrcAddr: "10.0.0.1", DstAddr: "10.0.1.5", DstPort: 22, Protocol: 6, Flows: 2}, summary.Rejected[0])
+
+		require.Len(t, summary.Ports, 2)
+		assert.Equal(t, ec2utils.PortStat{Port: 443, Protocol: 6, Bytes: 6000, Packets: 14, Flows: 2}, summary.Ports[0])
+	}
+}
+
+func TestEnableFlowLogs(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"CreateFlowLogs": "<flowLogIdSet><item>fl-123</item></flowLogIdSet><unsuccessful/>",
+	}, nil)
+
+	t.Run("s3 destination", func(t *testing.T) {
+		id, err := c.EnableFlowLogs(ec2utils.FlowLogParams{
+			VPCID:           "vpc-1",
+			DestinationType: ec2utils.FlowLogDestinationS3,
+			Destination:     "arn:aws:s3:::flow-logs/prefix",
+			Format:          "${srcaddr} ${dstaddr} ${bytes}",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "fl-123", id)
+
+		req := fake.requestsFor("CreateFlowLogs")[0]
+		assert.Equal(t, "vpc-1", req.Get("ResourceId.1"))
+		assert.Equal(t, "ALL", req.Get("TrafficType"))
+		assert.Equal(t, "arn:aws:s3:::flow-logs/prefix", req.Get("LogDestination"))
+		assert.Equal(t, "${srcaddr} ${dstaddr} ${bytes}", req.Get("LogFormat"))
+	})
+
+	t.Run("cloudwatch logs destination", func(t *testing.T) {
+		_, err := c.EnableFlowLogs(ec2utils.FlowLogParams{
+			VPCID:              "vpc-1",
+			DestinationType:    ec2utils.FlowLogDestinationCloudWatchLogs,
+			Destination:        "flow-logs",
+			DeliverLogsRoleARN: "arn:aws:iam::123456789012:role/flow-logs",
+		})
+		require.NoError(t, err)
+
+		reqs := fake.requestsFor("CreateFlowLogs")
+		req := reqs[len(reqs)-1]
+		assert.Equal(t, "flow-logs", req.Get("LogGroupName"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/flow-logs", req.Get("DeliverLogsPermissionArn"))
+	})
+
+	t.Run("cloudwatch logs without role", func(t *testing.T) {
+		_, err := c.EnableFlowLogs(ec2utils.FlowLogParams{
+			VPCID:           "vpc-1",
+			DestinationType: ec2utils.FlowLogDestinationCloudWatchLogs,
+			Destination:     "flow-logs",
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestFlowLogAnalyzerRejectedOrder(t *testing.T) {
+	const rejectedFlowLogs = `version account-id interface-id srcaddr dstaddr srcport dstport protocol packets bytes start end action log-status
+2 123456789012 eni-1 10.0.0.1 10.0.1.6 49152 22 6 1 40 1620000000 1620000060 REJECT OK
+2 123456789012 eni-1 10.0.0.1 10.0.1.5 49152 80 6 1 40 1620000000 1620000060 REJECT OK
+2 123456789012 eni-1 10.0.0.1 10.0.1.5 49152 22 17 1 40 1620000000 1620000060 REJECT OK
+2 123456789012 eni-1 10.0.0.1 10.0.1.5 49152 22 6 1 40 1620000000 1620000060 REJECT OK
+2 123456789012 eni-1 10.0.0.0 10.0.1.9 49152 22 6 1 40 1620000000 1620000060 REJECT OK
+2 123456789012 eni-1 10.0.0.9 10.0.1.5 49152 22 6 1 40 1620000000 1620000060 REJECT OK
+2 123456789012 eni-1 10.0.0.9 10.0.1.5 49153 22 6 1 40 1620000060 1620000120 REJECT OK
+`
+	want := []ec2utils.RejectedStat{
+		{SrcAddr: "10.0.0.9", DstAddr: "10.0.1.5", DstPort: 22, Protocol: 6, Flows: 2},
+		{SrcAddr: "10.0.0.0", DstAddr: "10.0.1.9", DstPort: 22, Protocol: 6, Flows: 1},
+		{SrcAddr: "10.0.0.1", DstAddr: "10.0.1.5", DstPort: 22, Protocol: 6, Flows: 1},
+		{SrcAddr: "10.0.0.1", DstAddr: "10.0.1.5", DstPort: 22, Protocol: 17, Flows: 1},
+		{SrcAddr: "10.0.0.1", DstAddr: "10.0.1.5", DstPort: 80, Protocol: 6, Flows: 1},
+		{SrcAddr: "10.0.0.1", DstAddr: "10.0.1.6", DstPort: 22, Protocol: 6, Flows: 1},
+	}
+
+	path := writeFlowLogFile(t, "rejected.log", rejectedFlowLogs, false)
+
+	// Connections with the same number of rejected flows are
+	// ordered by their flow key, whatever the map iteration order.
+	for i := 0; i < 20; i++ {
+		summary, err := ec2utils.AnalyzeFlowLogFiles("", 0, path)
+		require.NoError(t, err)
+		assert.Equal(t, want, summary.Rejected)
+	}
+}
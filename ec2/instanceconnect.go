@@ -0,0 +1,239 @@
+package ec2
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+)
+
+// instanceConnectKeyLifetime is how long a public key pushed with
+// EC2 Instance Connect remains usable.
+const instanceConnectKeyLifetime = 60 * time.Second
+
+// InstanceConnect provides access to EC2 instances by pushing
+// one-time SSH public keys with EC2 Instance Connect, as an
+// alternative to SSM when its agent is unavailable.
+//
+// **Attributes:**
+//
+// Client: the EC2 Instance Connect client
+// EC2: the EC2 connection used to resolve instance addresses
+type InstanceConnect struct {
+	Client *ec2instanceconnect.EC2InstanceConnect
+	EC2    *Connection
+}
+
+// NewInstanceConnect creates an EC2 Instance Connect client
+// that uses the same configuration as the connection.
+//
+// **Returns:**
+//
+// *InstanceConnect: the EC2 Instance Connect client
+//
+// error: an error if any issue occurs while trying to create the client
+func (c *Connection) NewInstanceConnect() (*InstanceConnect, error) {
+	sess, err := session.NewSession(c.Client.Config.Copy())
+	if err != nil {
+		return nil, fmt.Errorf("error creating session: %v", err)
+	}
+
+	return &InstanceConnect{
+		Client: ec2instanceconnect.New(sess),
+		EC2:    c,
+	}, nil
+}
+
+// SendSSHPublicKey pushes an SSH public key to the instance
+// with the provided ID. The key can be used to authenticate
+// as osUser for 60 seconds.
+//
+// **Parameters:**
+//
+// instanceID: the ID of the instance
+//
+// osUser: the OS user the key is authorized for
+//
+// publicKey: the public key in authorized_keys format
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to push the key
+func (ic *InstanceConnect) SendSSHPublicKey(instanceID, osUser string, publicKey []byte) error {
+	result, err := ic.Client.SendSSHPublicKey(&ec2instanceconnect.SendSSHPublicKeyInput{
+		InstanceId:     aws.String(instanceID),
+		InstanceOSUser: aws.String(osUser),
+		SSHPublicKey:   aws.String(string(publicKey)),
+	})
+	if err != nil {
+		return fmt.Errorf("error sending ssh public key to %s: %v", instanceID, err)
+	}
+
+	if !aws.BoolValue(result.Success) {
+		return fmt.Errorf("ssh public key was not accepted by %s", instanceID)
+	}
+
+	return nil
+}
+
+// SendSerialConsoleSSHPublicKey pushes an SSH public key for access
+// to the serial console of the instance with the provided ID. The
+// key can be used for 60 seconds.
+//
+// **Parameters:**
+//
+// instanceID: the ID of the instance
+//
+// serialPort: the serial port to access, 0 for the first one
+//
+// publicKey: the public key in authorized_keys format
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to push the key
+func (ic *InstanceConnect) SendSerialConsoleSSHPublicKey(instanceID string, serialPort int64, publicKey []byte) error {
+	result, err := ic.Client.SendSerialConsoleSSHPublicKey(&ec2instanceconnect.SendSerialConsoleSSHPublicKeyInput{
+		InstanceId:   aws.String(instanceID),
+		SerialPort:   aws.Int64(serialPort),
+		SSHPublicKey: aws.String(string(publicKey)),
+	})
+	if err != nil {
+		return fmt.Errorf("error sending serial console ssh public key to %s: %v", instanceID, err)
+	}
+
+	if !aws.BoolValue(result.Success) {
+		return fmt.Errorf("serial console ssh public key was not accepted by %s", instanceID)
+	}
+
+	return nil
+}
+
+// ConnectSSH generates an ephemeral key pair, pushes its public key to
+// the instance with the provided ID and connects with it. The SSH port
+// is waited for before the key is pushed, so that the connection is
+// made within the 60 seconds the key is valid. params.PrivateKey is
+// ignored.
+//
+// **Parameters:**
+//
+// instanceID: the ID of the instance to connect to
+//
+// params: the parameters to use for the connection
+//
+// **Returns:**
+//
+// *SSHClient: the SSH connection to the instance
+//
+// error: an error if any issue occurs while trying to connect to the instance
+func (ic *InstanceConnect) ConnectSSH(instanceID string, params SSHParams) (*SSHClient, error) {
+	address, err := ic.EC2.GetInstanceAddress(instanceID, params.UsePrivateIP)
+	if err != nil {
+		return nil, err
+	}
+
+	port := params.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	address = net.JoinHostPort(address, strconv.Itoa(port))
+
+	timeout := params.Timeout
+	if timeout == 0 {
+		timeout = defaultSSHTimeout
+	}
+	if err := WaitForPort(address, timeout); err != nil {
+		return nil, err
+	}
+
+	return ic.connectWithEphemeralKey(address, params, func(publicKey []byte) error {
+		return ic.SendSSHPublicKey(instanceID, params.User, publicKey)
+	})
+}
+
+// ConnectSerialConsole generates an ephemeral key pair, pushes its public
+// key for the serial console of the instance with the provided ID and
+// connects to the regional serial console endpoint. Only params.Timeout,
+// params.HostKeyCallback and params.InsecureSkipHostKeyCheck are used. The returned client supports
+// interactive shell sessions rather than commands.
+//
+// **Parameters:**
+//
+// instanceID: the ID of the instance to connect to
+//
+// serialPort: the serial port to access, 0 for the first one
+//
+// params: the parameters to use for the connection
+//
+// **Returns:**
+//
+// *SSHClient: the SSH connection to the serial console
+//
+// error: an error if any issue occurs while trying to connect to the serial console
+func (ic *InstanceConnect) ConnectSerialConsole(instanceID string, serialPort int64, params SSHParams) (*SSHClient, error) {
+	region := aws.StringValue(ic.Client.Config.Region)
+	if region == "" {
+		return nil, fmt.Errorf("no region configured for the serial console endpoint")
+	}
+
+	address := net.JoinHostPort(SerialConsoleHost(region), strconv.Itoa(defaultSSHPort))
+	consoleParams := SSHParams{
+		User:                     fmt.Sprintf("%s.port%d", instanceID, serialPort),
+		Timeout:                  params.Timeout,
+		HostKeyCallback:          params.HostKeyCallback,
+		InsecureSkipHostKeyCheck: params.InsecureSkipHostKeyCheck,
+	}
+
+	return ic.connectWithEphemeralKey(address, consoleParams, func(publicKey []byte) error {
+		return ic.SendSerialConsoleSSHPublicKey(instanceID, serialPort, publicKey)
+	})
+}
+
+// SerialConsoleHost returns the host name of the EC2
+// serial console endpoint of the provided region.
+//
+// **Parameters:**
+//
+// region: the region of the instance
+//
+// **Returns:**
+//
+// string: the host name of the serial console endpoint
+func SerialConsoleHost(region string) string {
+	return fmt.Sprintf("serial-console.ec2-instance-connect.%s.aws", region)
+}
+
+// connectWithEphemeralKey generates a key pair, pushes its public
+// key with push and connects to address before the key expires.
+func (ic *InstanceConnect) connectWithEphemeralKey(address string, params SSHParams, push func([]byte) error) (*SSHClient, error) {
+	// The host key settings are checked before a key is pushed.
+	if _, err := params.hostKeyCallback(); err != nil {
+		return nil, err
+	}
+
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeED25519)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := push(publicKey); err != nil {
+		return nil, err
+	}
+	pushed := time.Now()
+
+	params.PrivateKey = privateKey
+	params.Timeout = instanceConnectKeyLifetime
+
+	client, err := NewSSHClient(address, params)
+	if err != nil {
+		if time.Since(pushed) >= instanceConnectKeyLifetime {
+			return nil, fmt.Errorf("pushed key expired before connecting to %s: %v", address, err)
+		}
+		return nil, err
+	}
+
+	return client, nil
+}
@@ -0,0 +1,111 @@
+package ec2_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeInstanceConnect starts a fake EC2 Instance Connect endpoint
+// that passes every pushed key to push and reports success.
+func newFakeInstanceConnect(t *testing.T, ec2Conn *ec2utils.Connection, push func(action string, body map[string]interface{})) *ec2utils.InstanceConnect {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		target := r.Header.Get("X-Amz-Target")
+		push(target[strings.LastIndex(target, ".")+1:], body)
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_, _ = w.Write([]byte(`{"RequestId":"req-1","Success":true}`))
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	return &ec2utils.InstanceConnect{
+		Client: ec2instanceconnect.New(sess),
+		EC2:    ec2Conn,
+	}
+}
+
+func TestInstanceConnectSSH(t *testing.T) {
+	srv := newTestSSHServer(t, nil)
+	_, port, err := net.SplitHostPort(srv.listener.Addr().String())
+	require.NoError(t, err)
+	sshPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	ec2Conn := newFakeEC2Connection(t, map[string]string{
+		"DescribeInstances": `<reservationSet><item><instancesSet><item>
+<instanceId>i-0123456789</instanceId><ipAddress>127.0.0.1</ipAddress>
+</item></instancesSet></item></reservationSet>`,
+	}, nil)
+
+	var pushed []map[string]interface{}
+	ic := newFakeInstanceConnect(t, ec2Conn, func(action string, body map[string]interface{}) {
+		assert.Equal(t, "SendSSHPublicKey", action)
+		pushed = append(pushed, body)
+		assert.NoError(t, srv.authorize([]byte(body["SSHPublicKey"].(string))))
+	})
+
+	client, err := ic.ConnectSSH("i-0123456789", ec2utils.SSHParams{
+		User:                     "ec2-user",
+		Port:                     sshPort,
+		Timeout:                  5 * time.Second,
+		InsecureSkipHostKeyCheck: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.Len(t, pushed, 1)
+	assert.Equal(t, "i-0123456789", pushed[0]["InstanceId"])
+	assert.Equal(t, "ec2-user", pushed[0]["InstanceOSUser"])
+
+	out, err := client.RunCommand("echo connected")
+	require.NoError(t, err)
+	assert.Equal(t, "connected\n", out)
+}
+
+func TestSendSerialConsoleSSHPublicKey(t *testing.T) {
+	var action string
+	var body map[string]interface{}
+	ic := newFakeInstanceConnect(t, nil, func(a string, b map[string]interface{}) {
+		action, body = a, b
+	})
+
+	_, pub, err := ec2utils.GenerateKeyPair(ec2utils.KeyTypeED25519)
+	require.NoError(t, err)
+
+	require.NoError(t, ic.SendSerialConsoleSSHPublicKey("i-0123456789", 0, pub))
+	assert.Equal(t, "SendSerialConsoleSSHPublicKey", action)
+	assert.Equal(t, "i-0123456789", body["InstanceId"])
+	assert.Equal(t, float64(0), body["SerialPort"])
+	assert.Equal(t, string(pub), body["SSHPublicKey"])
+
+	assert.Equal(t, "serial-console.ec2-instance-connect.us-west-1.aws", ec2utils.SerialConsoleHost("us-west-1"))
+}
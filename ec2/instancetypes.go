@@ -0,0 +1,348 @@
+package ec2
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// maxDescribeInstanceTypes is the maximum number of instance
+// types accepted by a single DescribeInstanceTypes call.
+const maxDescribeInstanceTypes = 100
+
+// InstanceTypeInfo provides the specifications
+// of an EC2 instance type.
+//
+// **Attributes:**
+//
+// Type: the name of the instance type
+// VCPUs: the default number of vCPUs
+// MemoryMiB: the memory size in MiB
+// Architectures: the supported CPU architectures (e.g. x86_64, arm64)
+// NetworkPerformance: the network performance description
+// CurrentGeneration: whether the type is a current generation type
+type InstanceTypeInfo struct {
+	Type               string
+	VCPUs              int64
+	MemoryMiB          int64
+	Architectures      []string
+	NetworkPerformance string
+	CurrentGeneration  bool
+}
+
+// InstanceTypeConstraints describes the requirements
+// an instance type must satisfy to be selected.
+//
+// **Attributes:**
+//
+// MinVCPUs: the minimum number of vCPUs
+// MinMemoryMiB: the minimum memory size in MiB
+// Architecture: the required CPU architecture (amd64 and x86_64 are equivalent)
+// AvailabilityZone: an optional availability zone the type must be offered in
+// ImageID: an optional AMI the type must be compatible with
+// HourlyPrices: optional hourly prices keyed by instance type, used to rank
+// candidates. Without prices, candidates are ranked by size, not cost.
+type InstanceTypeConstraints struct {
+	MinVCPUs         int64
+	MinMemoryMiB     int64
+	Architecture     string
+	AvailabilityZone string
+	ImageID          string
+	HourlyPrices     map[string]float64
+}
+
+// ListInstanceTypeOfferings lists the instance types
+// offered in the provided availability zone.
+// The availability zone is required.
+//
+// **Parameters:**
+//
+// availabilityZone: the availability zone to use
+//
+// **Returns:**
+//
+// []string: the instance types offered in the availability zone
+//
+// error: an error if any issue occurs while trying to list the offerings
+func (c *Connection) ListInstanceTypeOfferings(availabilityZone string) ([]string, error) {
+	if availabilityZone == "" {
+		return nil, errors.New("availability zone is required")
+	}
+
+	input := &ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(ec2.LocationTypeAvailabilityZone),
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("location"),
+				Values: []*string{aws.String(availabilityZone)},
+			},
+		},
+	}
+
+	var types []string
+	if err := c.Client.DescribeInstanceTypeOfferingsPages(input,
+		func(page *ec2.DescribeInstanceTypeOfferingsOutput, _ bool) bool {
+			for _, offering := range page.InstanceTypeOfferings {
+				types = append(types, aws.StringValue(offering.InstanceType))
+			}
+			return true
+		}); err != nil {
+		return nil, fmt.Errorf("error describing instance type offerings in %s: %v", availabilityZone, err)
+	}
+	sort.Strings(types)
+
+	return types, nil
+}
+
+// DescribeInstanceTypes retrieves the specifications
+// of the provided instance types.
+//
+// **Parameters:**
+//
+// instanceTypes: the instance types to describe
+//
+// **Returns:**
+//
+// []InstanceTypeInfo: the specifications of the instance types
+//
+// error: an error if any issue occurs while trying to describe the instance types
+func (c *Connection) DescribeInstanceTypes(instanceTypes []string) ([]InstanceTypeInfo, error) {
+	var infos []InstanceTypeInfo
+	for _, batch := range batchIDs(instanceTypes, maxDescribeInstanceTypes) {
+		input := &ec2.DescribeInstanceTypesInput{
+			InstanceTypes: aws.StringSlice(batch),
+		}
+
+		if err := c.Client.DescribeInstanceTypesPages(input,
+			func(page *ec2.DescribeInstanceTypesOutput, _ bool) bool {
+				for _, info := range page.InstanceTypes {
+					infos = append(infos, newInstanceTypeInfo(info))
+				}
+				return true
+			}); err != nil {
+			return nil, fmt.Errorf("error describing instance types: %v", err)
+		}
+	}
+
+	return infos, nil
+}
+
+// ListInstanceTypes lists the specifications of every
+// instance type offered in the provided availability zone,
+// or in the connection's region if no zone is provided.
+//
+// **Parameters:**
+//
+// availabilityZone: the availability zone to use, optional
+//
+// **Returns:**
+//
+// []InstanceTypeInfo: the specifications of the offered instance types
+//
+// error: an error if any issue occurs while trying to list the instance types
+func (c *Connection) ListInstanceTypes(availabilityZone string) ([]InstanceTypeInfo, error) {
+	if availabilityZone == "" {
+		var infos []InstanceTypeInfo
+		if err := c.Client.DescribeInstanceTypesPages(&ec2.DescribeInstanceTypesInput{},
+			func(page *ec2.DescribeInstanceTypesOutput, _ bool) bool {
+				for _, info := range page.InstanceTypes {
+					infos = append(infos, newInstanceTypeInfo(info))
+				}
+				return true
+			}); err != nil {
+			return nil, fmt.Errorf("error describing instance types: %v", err)
+		}
+
+		return infos, nil
+	}
+
+	offered, err := c.ListInstanceTypeOfferings(availabilityZone)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.DescribeInstanceTypes(offered)
+}
+
+// SelectInstanceType picks the cheapest instance type from candidates
+// that satisfies the provided constraints. Candidates with a known
+// hourly price are ranked by price. Without prices, "cheapest" is only
+// a heuristic: the type with the fewest vCPUs, then least memory, is
+// selected, which is not necessarily the least expensive one.
+//
+// **Parameters:**
+//
+// candidates: the instance types to choose from
+//
+// constraints: the requirements the instance type must satisfy
+//
+// **Returns:**
+//
+// InstanceTypeInfo: the selected instance type
+//
+// error: an error if no candidate satisfies the constraints
+func SelectInstanceType(candidates []InstanceTypeInfo, constraints InstanceTypeConstraints) (InstanceTypeInfo, error) {
+	arch := normalizeArchitecture(constraints.Architecture)
+
+	var fits []InstanceTypeInfo
+	for _, candidate := range candidates {
+		if candidate.VCPUs < constraints.MinVCPUs || candidate.MemoryMiB < constraints.MinMemoryMiB {
+			continue
+		}
+		if arch != "" && !containsString(candidate.Architectures, arch) {
+			continue
+		}
+		fits = append(fits, candidate)
+	}
+
+	if len(fits) == 0 {
+		return InstanceTypeInfo{}, errors.New("no instance type satisfies the provided constraints")
+	}
+
+	sort.SliceStable(fits, func(i, j int) bool {
+		pi, iKnown := constraints.HourlyPrices[fits[i].Type]
+		pj, jKnown := constraints.HourlyPrices[fits[j].Type]
+		switch {
+		case iKnown && jKnown && pi != pj:
+			return pi < pj
+		case iKnown != jKnown:
+			return iKnown
+		case fits[i].VCPUs != fits[j].VCPUs:
+			return fits[i].VCPUs < fits[j].VCPUs
+		case fits[i].MemoryMiB != fits[j].MemoryMiB:
+			return fits[i].MemoryMiB < fits[j].MemoryMiB
+		default:
+			return fits[i].Type < fits[j].Type
+		}
+	})
+
+	return fits[0], nil
+}
+
+// ChooseInstanceType selects the cheapest instance type that satisfies
+// the constraints, from the types offered in their availability zone or,
+// if no zone is set, in the connection's region. If an ImageID is
+// provided, the AMI's architecture is used as the required architecture.
+// Without HourlyPrices, "cheapest" is the vCPU and memory heuristic of
+// SelectInstanceType.
+//
+// **Parameters:**
+//
+// constraints: the requirements the instance type must satisfy
+//
+// **Returns:**
+//
+// InstanceTypeInfo: the selected instance type
+//
+// error: an error if any issue occurs or no instance type satisfies the constraints
+func (c *Connection) ChooseInstanceType(constraints InstanceTypeConstraints) (InstanceTypeInfo, error) {
+	if constraints.ImageID != "" {
+		imageArch, err := c.getImageArchitecture(constraints.ImageID)
+		if err != nil {
+			return InstanceTypeInfo{}, err
+		}
+
+		if constraints.Architecture != "" && normalizeArchitecture(constraints.Architecture) != imageArch {
+			return InstanceTypeInfo{}, fmt.Errorf("image %s is %s, not %s", constraints.ImageID, imageArch, constraints.Architecture)
+		}
+		constraints.Architecture = imageArch
+	}
+
+	candidates, err := c.ListInstanceTypes(constraints.AvailabilityZone)
+	if err != nil {
+		return InstanceTypeInfo{}, err
+	}
+
+	return SelectInstanceType(candidates, constraints)
+}
+
+// CheckInstanceTypeCompatibility checks whether the provided
+// instance type can run the provided AMI.
+//
+// **Parameters:**
+//
+// instanceType: the instance type to check
+//
+// imageID: the ID of the AMI to check
+//
+// **Returns:**
+//
+// error: an error if the instance type and AMI are incompatible or
+// any issue occurs while trying to check them
+func (c *Connection) CheckInstanceTypeCompatibility(instanceType, imageID string) error {
+	imageArch, err := c.getImageArchitecture(imageID)
+	if err != nil {
+		return err
+	}
+
+	infos, err := c.DescribeInstanceTypes([]string{instanceType})
+	if err != nil {
+		return err
+	}
+
+	if len(infos) == 0 {
+		return fmt.Errorf("instance type %s does not exist", instanceType)
+	}
+
+	if !containsString(infos[0].Architectures, imageArch) {
+		return fmt.Errorf("instance type %s does not support the %s architecture of image %s", instanceType, imageArch, imageID)
+	}
+
+	return nil
+}
+
+func (c *Connection) getImageArchitecture(imageID string) (string, error) {
+	result, err := c.Client.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageID)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error describing image %s: %v", imageID, err)
+	}
+
+	if len(result.Images) == 0 {
+		return "", fmt.Errorf("image %s does not exist", imageID)
+	}
+
+	return aws.StringValue(result.Images[0].Architecture), nil
+}
+
+func newInstanceTypeInfo(info *ec2.InstanceTypeInfo) InstanceTypeInfo {
+	result := InstanceTypeInfo{
+		Type:              aws.StringValue(info.InstanceType),
+		CurrentGeneration: aws.BoolValue(info.CurrentGeneration),
+	}
+
+	if info.VCpuInfo != nil {
+		result.VCPUs = aws.Int64Value(info.VCpuInfo.DefaultVCpus)
+	}
+
+	if info.MemoryInfo != nil {
+		result.MemoryMiB = aws.Int64Value(info.MemoryInfo.SizeInMiB)
+	}
+
+	if info.ProcessorInfo != nil {
+		result.Architectures = aws.StringValueSlice(info.ProcessorInfo.SupportedArchitectures)
+	}
+
+	if info.NetworkInfo != nil {
+		result.NetworkPerformance = aws.StringValue(info.NetworkInfo.NetworkPerformance)
+	}
+
+	return result
+}
+
+// normalizeArchitecture maps distro architecture names,
+// as used by GetLatestAMI, to EC2 architecture names.
+func normalizeArchitecture(arch string) string {
+	switch arch {
+	case "amd64":
+		return ec2.ArchitectureTypeX8664
+	case "aarch64":
+		return ec2.ArchitectureTypeArm64
+	default:
+		return arch
+	}
+}
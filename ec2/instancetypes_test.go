@@ -0,0 +1,140 @@
+package ec2_test
+
+import (
+	"fmt"
+	"testing"
+
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectInstanceType(t *testing.T) {
+	candidates := []ec2utils.InstanceTypeInfo{
+		{Type: "t3.large", VCPUs: 2, MemoryMiB: 8192, Architectures: []string{"x86_64"}},
+		{Type: "t3.micro", VCPUs: 2, MemoryMiB: 1024, Architectures: []string{"x86_64"}},
+		{Type: "t4g.micro", VCPUs: 2, MemoryMiB: 1024, Architectures: []string{"arm64"}},
+		{Type: "m5.xlarge", VCPUs: 4, MemoryMiB: 16384, Architectures: []string{"x86_64"}},
+	}
+
+	tests := []struct {
+		name        string
+		constraints ec2utils.InstanceTypeConstraints
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "smallest amd64 fit without prices",
+			constraints: ec2utils.InstanceTypeConstraints{MinVCPUs: 2, Architecture: "amd64"},
+			want:        "t3.micro",
+		},
+		{
+			name:        "arm64 only",
+			constraints: ec2utils.InstanceTypeConstraints{Architecture: "arm64"},
+			want:        "t4g.micro",
+		},
+		{
+			name:        "memory constraint",
+			constraints: ec2utils.InstanceTypeConstraints{MinMemoryMiB: 4096},
+			want:        "t3.large",
+		},
+		{
+			name: "prices take precedence",
+			constraints: ec2utils.InstanceTypeConstraints{
+				MinVCPUs:     2,
+				Architecture: "x86_64",
+				HourlyPrices: map[string]float64{"t3.micro": 0.0104, "m5.xlarge": 0.0050},
+			},
+			want: "m5.xlarge",
+		},
+		{
+			name:        "nothing fits",
+			constraints: ec2utils.InstanceTypeConstraints{MinVCPUs: 64},
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ec2utils.SelectInstanceType(candidates, tc.constraints)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got.Type)
+		})
+	}
+}
+
+// instanceTypeItem returns a DescribeInstanceTypes response item.
+func instanceTypeItem(instanceType string, vcpus, memoryMiB int, arch string) string {
+	return fmt.Sprintf(`<item><instanceType>%s</instanceType>
+		<vCpuInfo><defaultVCpus>%d</defaultVCpus></vCpuInfo>
+		<memoryInfo><sizeInMiB>%d</sizeInMiB></memoryInfo>
+		<processorInfo><supportedArchitectures><item>%s</item></supportedArchitectures></processorInfo>
+	</item>`, instanceType, vcpus, memoryMiB, arch)
+}
+
+func TestChooseInstanceType(t *testing.T) {
+	responses := map[string]string{
+		"DescribeInstanceTypeOfferings": `<instanceTypeOfferingSet>
+			<item><instanceType>t3.large</instanceType><locationType>availability-zone</locationType><location>us-west-1a</location></item>
+			<item><instanceType>t4g.small</instanceType><locationType>availability-zone</locationType><location>us-west-1a</location></item>
+		</instanceTypeOfferingSet><nextToken>offerings-2</nextToken>`,
+		"DescribeInstanceTypeOfferings/offerings-2": `<instanceTypeOfferingSet>
+			<item><instanceType>t4g.medium</instanceType><locationType>availability-zone</locationType><location>us-west-1a</location></item>
+		</instanceTypeOfferingSet>`,
+		"DescribeInstanceTypes": `<instanceTypeSet>` +
+			instanceTypeItem("t3.large", 2, 8192, "x86_64") +
+			instanceTypeItem("t4g.small", 2, 2048, "arm64") +
+			`</instanceTypeSet><nextToken>types-2</nextToken>`,
+		"DescribeInstanceTypes/types-2": `<instanceTypeSet>` +
+			instanceTypeItem("t4g.medium", 2, 4096, "arm64") +
+			instanceTypeItem("t3.micro", 2, 1024, "x86_64") +
+			`</instanceTypeSet>`,
+		"DescribeImages": `<imagesSet><item><imageId>ami-arm</imageId><architecture>arm64</architecture></item></imagesSet>`,
+	}
+
+	t.Run("offered in the availability zone", func(t *testing.T) {
+		c, fake := startFakeEC2(t, responses, nil)
+
+		got, err := c.ChooseInstanceType(ec2utils.InstanceTypeConstraints{
+			MinMemoryMiB:     3072,
+			AvailabilityZone: "us-west-1a",
+			ImageID:          "ami-arm",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "t4g.medium", got.Type)
+
+		offerings := fake.requestsFor("DescribeInstanceTypeOfferings")
+		require.Len(t, offerings, 2)
+		assert.Equal(t, "availability-zone", offerings[0].Get("LocationType"))
+		assert.Equal(t, "us-west-1a", offerings[0].Get("Filter.1.Value.1"))
+
+		// Only the offered types are described, across every page.
+		describes := fake.requestsFor("DescribeInstanceTypes")
+		require.Len(t, describes, 2)
+		assert.Equal(t, []string{"t3.large", "t4g.medium", "t4g.small"}, formValues(describes[0], "InstanceType"))
+	})
+
+	t.Run("any type in the region", func(t *testing.T) {
+		c, fake := startFakeEC2(t, responses, nil)
+
+		got, err := c.ChooseInstanceType(ec2utils.InstanceTypeConstraints{Architecture: "amd64"})
+		require.NoError(t, err)
+		assert.Equal(t, "t3.micro", got.Type)
+
+		assert.Empty(t, fake.requestsFor("DescribeInstanceTypeOfferings"))
+		describes := fake.requestsFor("DescribeInstanceTypes")
+		require.Len(t, describes, 2)
+		assert.Empty(t, formValues(describes[0], "InstanceType"))
+	})
+
+	t.Run("image architecture conflict", func(t *testing.T) {
+		c := newFakeEC2Connection(t, responses, nil)
+
+		_, err := c.ChooseInstanceType(ec2utils.InstanceTypeConstraints{Architecture: "x86_64", ImageID: "ami-arm"})
+		assert.ErrorContains(t, err, "image ami-arm is arm64")
+	})
+}
@@ -0,0 +1,262 @@
+package ec2
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// defaultInventoryWorkers is the number of regions
+// inventoried concurrently when no worker count is given.
+const defaultInventoryWorkers = 4
+
+// RegionInventory provides the resources
+// found in a single region.
+//
+// **Attributes:**
+//
+// Region: the region that was inventoried
+// Instances: the instances in the region
+// VPCs: the VPCs in the region
+// SecurityGroups: the security groups in the region
+// Volumes: the EBS volumes in the region
+// Err: the errors encountered while inventorying the region, if any.
+// Resources that could still be described are kept when another
+// resource type fails.
+type RegionInventory struct {
+	Region         string
+	Instances      []Instance
+	VPCs           []*ec2.Vpc
+	SecurityGroups []*ec2.SecurityGroup
+	Volumes        []*ec2.Volume
+	Err            error
+}
+
+// Inventory provides the resources found
+// across multiple regions.
+//
+// **Attributes:**
+//
+// Regions: the inventory of each region, keyed by region name
+type Inventory struct {
+	Regions map[string]*RegionInventory
+}
+
+// ForRegion creates a new connection to AWS EC2 in the
+// provided region, reusing the configuration and credentials
+// of the current connection. The new session shares the HTTP
+// client of the current connection, which creating a session may
+// modify, so ForRegion must not be called concurrently.
+//
+// **Parameters:**
+//
+// region: the region to connect to
+//
+// **Returns:**
+//
+// *Connection: a connection to AWS EC2 in the provided region
+//
+// error: an error if any issue occurs while trying to create the connection
+func (c *Connection) ForRegion(region string) (*Connection, error) {
+	sess, err := session.NewSession(c.Client.Config.Copy(&aws.Config{
+		Region: aws.String(region),
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("error creating session for region %s: %v", region, err)
+	}
+
+	return &Connection{Client: ec2.New(sess)}, nil
+}
+
+// ListEnabledRegions lists the regions that are enabled
+// for the current account.
+//
+// **Returns:**
+//
+// []string: the names of the enabled regions
+//
+// error: an error if any issue occurs while trying to list the regions
+func (c *Connection) ListEnabledRegions() ([]string, error) {
+	result, err := c.Client.DescribeRegions(&ec2.DescribeRegionsInput{
+		AllRegions: aws.Bool(false),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing regions: %v", err)
+	}
+
+	regions := make([]string, 0, len(result.Regions))
+	for _, region := range result.Regions {
+		regions = append(regions, aws.StringValue(region.RegionName))
+	}
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// GetInventory collects the instances, VPCs, security groups and
+// volumes of every enabled region. Regions are inventoried
+// concurrently and an error in one region is recorded in its
+// RegionInventory without affecting the others.
+//
+// **Parameters:**
+//
+// workers: the number of regions to inventory concurrently, defaults to 4
+//
+// **Returns:**
+//
+// *Inventory: the inventory of every enabled region
+//
+// error: an error if the enabled regions could not be listed
+func (c *Connection) GetInventory(workers int) (*Inventory, error) {
+	regions, err := c.ListEnabledRegions()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetRegionsInventory(regions, workers), nil
+}
+
+// GetRegionsInventory collects the instances, VPCs, security groups
+// and volumes of the provided regions concurrently. A failure to
+// describe one resource type is recorded in the RegionInventory
+// and the other resource types are still collected.
+//
+// **Parameters:**
+//
+// regions: the regions to inventory
+//
+// workers: the number of regions to inventory concurrently, defaults to 4
+//
+// **Returns:**
+//
+// *Inventory: the inventory of the provided regions
+func (c *Connection) GetRegionsInventory(regions []string, workers int) *Inventory {
+	if workers <= 0 {
+		workers = defaultInventoryWorkers
+	}
+
+	inventory := &Inventory{Regions: make(map[string]*RegionInventory, len(regions))}
+
+	// Sessions are created before the workers start, since
+	// creating them concurrently races on the shared HTTP client.
+	conns := make(map[string]*Connection, len(regions))
+	for _, region := range regions {
+		conn, err := c.ForRegion(region)
+		if err != nil {
+			inventory.Regions[region] = &RegionInventory{Region: region, Err: err}
+			continue
+		}
+		conns[region] = conn
+	}
+
+	regionCh := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for region := range regionCh {
+				regionInventory := conns[region].inventoryRegion(region)
+				mu.Lock()
+				inventory.Regions[region] = regionInventory
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for region := range conns {
+		regionCh <- region
+	}
+	close(regionCh)
+	wg.Wait()
+
+	return inventory
+}
+
+// RunningInstances returns every running instance
+// found in the inventory, keyed by region.
+//
+// **Returns:**
+//
+// map[string][]Instance: the running instances of each region
+func (i *Inventory) RunningInstances() map[string][]Instance {
+	running := make(map[string][]Instance)
+	for region, regionInventory := range i.Regions {
+		for _, instance := range regionInventory.Instances {
+			if instance.State == ec2.InstanceStateNameRunning {
+				running[region] = append(running[region], instance)
+			}
+		}
+	}
+
+	return running
+}
+
+// Errors returns the error encountered in each region
+// that could not be fully inventoried.
+//
+// **Returns:**
+//
+// map[string]error: the errors keyed by region
+func (i *Inventory) Errors() map[string]error {
+	errs := make(map[string]error)
+	for region, regionInventory := range i.Regions {
+		if regionInventory.Err != nil {
+			errs[region] = regionInventory.Err
+		}
+	}
+
+	return errs
+}
+
+func (c *Connection) inventoryRegion(region string) *RegionInventory {
+	regionInventory := &RegionInventory{Region: region}
+	var errs []error
+
+	if err := c.Client.DescribeInstancesPages(&ec2.DescribeInstancesInput{},
+		func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					regionInventory.Instances = append(regionInventory.Instances, SummarizeInstance(instance))
+				}
+			}
+			return true
+		}); err != nil {
+		errs = append(errs, fmt.Errorf("error describing instances in %s: %v", region, err))
+	}
+
+	if err := c.Client.DescribeVpcsPages(&ec2.DescribeVpcsInput{},
+		func(page *ec2.DescribeVpcsOutput, _ bool) bool {
+			regionInventory.VPCs = append(regionInventory.VPCs, page.Vpcs...)
+			return true
+		}); err != nil {
+		errs = append(errs, fmt.Errorf("error describing VPCs in %s: %v", region, err))
+	}
+
+	if err := c.Client.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{},
+		func(page *ec2.DescribeSecurityGroupsOutput, _ bool) bool {
+			regionInventory.SecurityGroups = append(regionInventory.SecurityGroups, page.SecurityGroups...)
+			return true
+		}); err != nil {
+		errs = append(errs, fmt.Errorf("error describing security groups in %s: %v", region, err))
+	}
+
+	if err := c.Client.DescribeVolumesPages(&ec2.DescribeVolumesInput{},
+		func(page *ec2.DescribeVolumesOutput, _ bool) bool {
+			regionInventory.Volumes = append(regionInventory.Volumes, page.Volumes...)
+			return true
+		}); err != nil {
+		errs = append(errs, fmt.Errorf("error describing volumes in %s: %v", region, err))
+	}
+
+	regionInventory.Err = errors.Join(errs...)
+
+	return regionInventory
+}
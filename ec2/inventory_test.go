@@ -0,0 +1,82 @@
+package ec2_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRegionsInventoryIsolatesErrors(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-1"),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	c := &ec2utils.Connection{Client: ec2.New(sess)}
+
+	regions := []string{"us-east-1", "us-west-1", "eu-west-1"}
+	inventory := c.GetRegionsInventory(regions, 2)
+
+	assert.Len(t, inventory.Regions, len(regions))
+	for _, region := range regions {
+		assert.Equal(t, region, inventory.Regions[region].Region)
+		assert.Error(t, inventory.Regions[region].Err)
+	}
+	assert.Len(t, inventory.Errors(), len(regions))
+}
+
+func TestGetRegionsInventoryKeepsPartialResults(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"DescribeVpcs":           `<vpcSet><item><vpcId>vpc-1</vpcId></item></vpcSet>`,
+		"DescribeSecurityGroups": `<securityGroupInfo><item><groupId>sg-1</groupId></item></securityGroupInfo>`,
+		"DescribeVolumes":        `<volumeSet><item><volumeId>vol-1</volumeId></item></volumeSet>`,
+	}, map[string]fakeEC2Error{
+		"DescribeInstances": {Code: "UnauthorizedOperation", Message: "denied"},
+	})
+
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1", "ap-south-1"}
+	inventory := c.GetRegionsInventory(regions, 4)
+
+	require.Len(t, inventory.Regions, len(regions))
+	for _, region := range regions {
+		regionInventory := inventory.Regions[region]
+		assert.ErrorContains(t, regionInventory.Err, "error describing instances in "+region)
+		assert.NotContains(t, regionInventory.Err.Error(), "VPCs")
+		assert.Empty(t, regionInventory.Instances)
+		assert.Len(t, regionInventory.VPCs, 1)
+		assert.Len(t, regionInventory.SecurityGroups, 1)
+		assert.Len(t, regionInventory.Volumes, 1)
+	}
+	assert.Len(t, fake.requestsFor("DescribeVolumes"), len(regions))
+}
+
+func TestInventoryRunningInstances(t *testing.T) {
+	inventory := &ec2utils.Inventory{
+		Regions: map[string]*ec2utils.RegionInventory{
+			"us-east-1": {
+				Region: "us-east-1",
+				Instances: []ec2utils.Instance{
+					{ID: "i-1", State: "running"},
+					{ID: "i-2", State: "stopped"},
+				},
+			},
+			"us-west-1": {
+				Region:    "us-west-1",
+				Instances: []ec2utils.Instance{{ID: "i-3", State: "terminated"}},
+			},
+		},
+	}
+
+	running := inventory.RunningInstances()
+	assert.Equal(t, map[string][]ec2utils.Instance{
+		"us-east-1": {{ID: "i-1", State: "running"}},
+	}, running)
+}
@@ -0,0 +1,243 @@
+package ec2
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// KeyTypeED25519 is the ED25519 key pair type.
+	KeyTypeED25519 = "ed25519"
+	// KeyTypeRSA is the RSA key pair type.
+	KeyTypeRSA = "rsa"
+)
+
+// rsaKeyBits is the size used when generating RSA keys locally.
+const rsaKeyBits = 4096
+
+// KeyPair provides information
+// about an EC2 key pair.
+//
+// **Attributes:**
+//
+// Name: the name of the key pair
+// ID: the ID of the key pair
+// Fingerprint: the fingerprint of the key pair
+// Type: the type of the key pair (rsa or ed25519)
+// PrivateKey: the PEM encoded private key, only set when the key was generated
+// PublicKey: the public key in authorized_keys format, only set when the key was generated locally
+type KeyPair struct {
+	Name        string
+	ID          string
+	Fingerprint string
+	Type        string
+	PrivateKey  []byte
+	PublicKey   []byte
+}
+
+// CreateKeyPair creates a new key pair with the provided name and type.
+// The key is generated by AWS and the private key material is returned.
+//
+// **Parameters:**
+//
+// keyName: the name of the key pair to create
+//
+// keyType: the type of the key pair to create (rsa or ed25519)
+//
+// **Returns:**
+//
+// *KeyPair: the created key pair, including its private key
+//
+// error: an error if any issue occurs while trying to create the key pair
+func (c *Connection) CreateKeyPair(keyName, keyType string) (*KeyPair, error) {
+	if err := validateKeyType(keyType); err != nil {
+		return nil, err
+	}
+
+	input := &ec2.CreateKeyPairInput{
+		KeyName:   aws.String(keyName),
+		KeyType:   aws.String(keyType),
+		KeyFormat: aws.String(ec2.KeyFormatPem),
+	}
+
+	result, err := c.Client.CreateKeyPair(input)
+	if err != nil {
+		return nil, fmt.Errorf("error creating key pair %s: %v", keyName, err)
+	}
+
+	return &KeyPair{
+		Name:        aws.StringValue(result.KeyName),
+		ID:          aws.StringValue(result.KeyPairId),
+		Fingerprint: aws.StringValue(result.KeyFingerprint),
+		Type:        keyType,
+		PrivateKey:  []byte(aws.StringValue(result.KeyMaterial)),
+	}, nil
+}
+
+// ImportKeyPair imports the provided public key into EC2
+// under the provided name.
+//
+// **Parameters:**
+//
+// keyName: the name of the key pair to create
+//
+// publicKey: the public key in authorized_keys format
+//
+// **Returns:**
+//
+// *KeyPair: the imported key pair
+//
+// error: an error if any issue occurs while trying to import the key pair
+func (c *Connection) ImportKeyPair(keyName string, publicKey []byte) (*KeyPair, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key: %v", err)
+	}
+
+	input := &ec2.ImportKeyPairInput{
+		KeyName:           aws.String(keyName),
+		PublicKeyMaterial: publicKey,
+	}
+
+	result, err := c.Client.ImportKeyPair(input)
+	if err != nil {
+		return nil, fmt.Errorf("error importing key pair %s: %v", keyName, err)
+	}
+
+	return &KeyPair{
+		Name:        aws.StringValue(result.KeyName),
+		ID:          aws.StringValue(result.KeyPairId),
+		Fingerprint: aws.StringValue(result.KeyFingerprint),
+		Type:        sshKeyType(pub),
+		PublicKey:   publicKey,
+	}, nil
+}
+
+// GenerateAndImportKeyPair generates a key pair locally and
+// imports its public key into EC2, so the private key never
+// leaves the local machine.
+//
+// **Parameters:**
+//
+// keyName: the name of the key pair to create
+//
+// keyType: the type of the key pair to generate (rsa or ed25519)
+//
+// **Returns:**
+//
+// *KeyPair: the imported key pair, including its private key
+//
+// error: an error if any issue occurs while trying to generate or import the key pair
+func (c *Connection) GenerateAndImportKeyPair(keyName, keyType string) (*KeyPair, error) {
+	privateKey, publicKey, err := GenerateKeyPair(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPair, err := c.ImportKeyPair(keyName, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyPair.PrivateKey = privateKey
+
+	return keyPair, nil
+}
+
+// DeleteKeyPair deletes the key pair with the provided name.
+//
+// **Parameters:**
+//
+// keyName: the name of the key pair to delete
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to delete the key pair
+func (c *Connection) DeleteKeyPair(keyName string) error {
+	input := &ec2.DeleteKeyPairInput{
+		KeyName: aws.String(keyName),
+	}
+
+	if _, err := c.Client.DeleteKeyPair(input); err != nil {
+		return fmt.Errorf("error deleting key pair %s: %v", keyName, err)
+	}
+
+	return nil
+}
+
+// GenerateKeyPair generates a new SSH key pair locally.
+//
+// **Parameters:**
+//
+// keyType: the type of the key pair to generate (rsa or ed25519)
+//
+// **Returns:**
+//
+// []byte: the PEM encoded private key
+//
+// []byte: the public key in authorized_keys format
+//
+// error: an error if any issue occurs while trying to generate the key pair
+func GenerateKeyPair(keyType string) ([]byte, []byte, error) {
+	if err := validateKeyType(keyType); err != nil {
+		return nil, nil, err
+	}
+
+	var publicKey interface{}
+	var block *pem.Block
+
+	switch keyType {
+	case KeyTypeED25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error generating ed25519 key: %v", err)
+		}
+		publicKey = pub
+
+		block, err = ssh.MarshalPrivateKey(priv, "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("error encoding ed25519 key: %v", err)
+		}
+	case KeyTypeRSA:
+		priv, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error generating rsa key: %v", err)
+		}
+		publicKey = &priv.PublicKey
+
+		block = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(priv),
+		}
+	}
+
+	sshPub, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating ssh public key: %v", err)
+	}
+
+	return pem.EncodeToMemory(block), ssh.MarshalAuthorizedKey(sshPub), nil
+}
+
+func validateKeyType(keyType string) error {
+	if keyType != KeyTypeED25519 && keyType != KeyTypeRSA {
+		return fmt.Errorf("unsupported key type: %s", keyType)
+	}
+
+	return nil
+}
+
+func sshKeyType(pub ssh.PublicKey) string {
+	if pub.Type() == ssh.KeyAlgoED25519 {
+		return KeyTypeED25519
+	}
+
+	return KeyTypeRSA
+}
@@ -0,0 +1,504 @@
+package ec2
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// defaultACLRuleNumber is the number of the implicit deny-all
+// entry that ends every network ACL.
+const defaultACLRuleNumber = 32767
+
+// defaultIPv6ACLRuleNumber is the number of the implicit deny-all
+// entry for ::/0 that ends network ACLs of IPv6-enabled VPCs.
+const defaultIPv6ACLRuleNumber = 32768
+
+// Issues reported by AuditNetworkACL.
+const (
+	NACLIssueAllowAll         = "allow-all"
+	NACLIssueShadowed         = "shadowed"
+	NACLIssueEphemeralBlocked = "ephemeral-blocked"
+)
+
+// NetworkACLEntry provides information
+// about a network ACL entry to create or replace.
+//
+// **Attributes:**
+//
+// RuleNumber: the rule number, entries are evaluated in ascending order
+// Egress: whether the entry applies to outbound traffic
+// Protocol: the protocol, tcp, udp, icmp, all or a protocol number
+// Action: allow or deny
+// CIDRBlock: the IPv4 or IPv6 CIDR block the entry applies to
+// FromPort: the first port of the range, for tcp and udp
+// ToPort: the last port of the range, for tcp and udp
+type NetworkACLEntry struct {
+	RuleNumber int64
+	Egress     bool
+	Protocol   string
+	Action     string
+	CIDRBlock  string
+	FromPort   int64
+	ToPort     int64
+}
+
+// NetworkACLFinding provides a problem
+// found while auditing a network ACL.
+//
+// **Attributes:**
+//
+// NetworkACLID: the ID of the network ACL
+// RuleNumber: the number of the entry with the problem
+// Egress: whether the entry applies to outbound traffic
+// Issue: the kind of problem, allow-all, shadowed or ephemeral-blocked
+// Detail: a description of the problem
+type NetworkACLFinding struct {
+	NetworkACLID string
+	RuleNumber   int64
+	Egress       bool
+	Issue        string
+	Detail       string
+}
+
+// ListNetworkACLs lists the network ACLs of a VPC.
+//
+// **Parameters:**
+//
+// vpcID: the ID of the VPC, or an empty string for every VPC
+//
+// **Returns:**
+//
+// []*ec2.NetworkAcl: the network ACLs
+//
+// error: an error if any issue occurs while trying to list the network ACLs
+func (c *Connection) ListNetworkACLs(vpcID string) ([]*ec2.NetworkAcl, error) {
+	input := &ec2.DescribeNetworkAclsInput{}
+	if vpcID != "" {
+		input.Filters = []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(vpcID)},
+			},
+		}
+	}
+
+	var acls []*ec2.NetworkAcl
+	if err := c.Client.DescribeNetworkAclsPages(input, func(page *ec2.DescribeNetworkAclsOutput, _ bool) bool {
+		acls = append(acls, page.NetworkAcls...)
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("error listing network ACLs: %v", err)
+	}
+
+	return acls, nil
+}
+
+// CreateNetworkACL creates a network ACL in a VPC. New network
+// ACLs deny all traffic until entries are added.
+//
+// **Parameters:**
+//
+// vpcID: the ID of the VPC
+//
+// **Returns:**
+//
+// string: the ID of the created network ACL
+//
+// error: an error if any issue occurs while trying to create the network ACL
+func (c *Connection) CreateNetworkACL(vpcID string) (string, error) {
+	result, err := c.Client.CreateNetworkAcl(&ec2.CreateNetworkAclInput{
+		VpcId: aws.String(vpcID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating network ACL in %s: %v", vpcID, err)
+	}
+
+	return aws.StringValue(result.NetworkAcl.NetworkAclId), nil
+}
+
+// DeleteNetworkACL deletes a network ACL, which must
+// not be associated with any subnet.
+//
+// **Parameters:**
+//
+// aclID: the ID of the network ACL
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to delete the network ACL
+func (c *Connection) DeleteNetworkACL(aclID string) error {
+	if _, err := c.Client.DeleteNetworkAcl(&ec2.DeleteNetworkAclInput{
+		NetworkAclId: aws.String(aclID),
+	}); err != nil {
+		return fmt.Errorf("error deleting network ACL %s: %v", aclID, err)
+	}
+
+	return nil
+}
+
+// CreateNetworkACLEntry adds an entry to a network ACL.
+//
+// **Parameters:**
+//
+// aclID: the ID of the network ACL
+//
+// entry: the entry to add
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to add the entry
+func (c *Connection) CreateNetworkACLEntry(aclID string, entry NetworkACLEntry) error {
+	input, err := entry.createInput(aclID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.Client.CreateNetworkAclEntry(input); err != nil {
+		return fmt.Errorf("error creating rule %d in network ACL %s: %v", entry.RuleNumber, aclID, err)
+	}
+
+	return nil
+}
+
+// ReplaceNetworkACLEntry replaces the entry of a network ACL
+// with the same rule number and direction.
+//
+// **Parameters:**
+//
+// aclID: the ID of the network ACL
+//
+// entry: the replacement entry
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to replace the entry
+func (c *Connection) ReplaceNetworkACLEntry(aclID string, entry NetworkACLEntry) error {
+	input, err := entry.createInput(aclID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.Client.ReplaceNetworkAclEntry(&ec2.ReplaceNetworkAclEntryInput{
+		NetworkAclId:  input.NetworkAclId,
+		RuleNumber:    input.RuleNumber,
+		Egress:        input.Egress,
+		Protocol:      input.Protocol,
+		RuleAction:    input.RuleAction,
+		CidrBlock:     input.CidrBlock,
+		Ipv6CidrBlock: input.Ipv6CidrBlock,
+		PortRange:     input.PortRange,
+	}); err != nil {
+		return fmt.Errorf("error replacing rule %d in network ACL %s: %v", entry.RuleNumber, aclID, err)
+	}
+
+	return nil
+}
+
+// DeleteNetworkACLEntry deletes an entry from a network ACL.
+//
+// **Parameters:**
+//
+// aclID: the ID of the network ACL
+//
+// ruleNumber: the rule number of the entry
+//
+// egress: whether the entry applies to outbound traffic
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to delete the entry
+func (c *Connection) DeleteNetworkACLEntry(aclID string, ruleNumber int64, egress bool) error {
+	if _, err := c.Client.DeleteNetworkAclEntry(&ec2.DeleteNetworkAclEntryInput{
+		NetworkAclId: aws.String(aclID),
+		RuleNumber:   aws.Int64(ruleNumber),
+		Egress:       aws.Bool(egress),
+	}); err != nil {
+		return fmt.Errorf("error deleting rule %d from network ACL %s: %v", ruleNumber, aclID, err)
+	}
+
+	return nil
+}
+
+// AssociateNetworkACL associates a network ACL with a subnet,
+// replacing the subnet's current association.
+//
+// **Parameters:**
+//
+// aclID: the ID of the network ACL
+//
+// subnetID: the ID of the subnet
+//
+// **Returns:**
+//
+// string: the ID of the new association
+//
+// error: an error if any issue occurs while trying to associate the network ACL
+func (c *Connection) AssociateNetworkACL(aclID, subnetID string) (string, error) {
+	result, err := c.Client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("association.subnet-id"),
+				Values: []*string{aws.String(subnetID)},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error describing network ACL of subnet %s: %v", subnetID, err)
+	}
+
+	var associationID string
+	for _, acl := range result.NetworkAcls {
+		for _, association := range acl.Associations {
+			if aws.StringValue(association.SubnetId) == subnetID {
+				associationID = aws.StringValue(association.NetworkAclAssociationId)
+			}
+		}
+	}
+	if associationID == "" {
+		return "", fmt.Errorf("no network ACL association found for subnet %s", subnetID)
+	}
+
+	replaced, err := c.Client.ReplaceNetworkAclAssociation(&ec2.ReplaceNetworkAclAssociationInput{
+		AssociationId: aws.String(associationID),
+		NetworkAclId:  aws.String(aclID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error associating network ACL %s with subnet %s: %v", aclID, subnetID, err)
+	}
+
+	return aws.StringValue(replaced.NewAssociationId), nil
+}
+
+// AuditNetworkACLs audits the network ACLs of a VPC.
+//
+// **Parameters:**
+//
+// vpcID: the ID of the VPC, or an empty string for every VPC
+//
+// **Returns:**
+//
+// []NetworkACLFinding: the problems found
+//
+// error: an error if any issue occurs while trying to list the network ACLs
+func (c *Connection) AuditNetworkACLs(vpcID string) ([]NetworkACLFinding, error) {
+	acls, err := c.ListNetworkACLs(vpcID)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []NetworkACLFinding
+	for _, acl := range acls {
+		findings = append(findings, AuditNetworkACL(acl)...)
+	}
+
+	return findings, nil
+}
+
+// AuditNetworkACL checks a network ACL for entries that allow all
+// traffic from anywhere, entries that can never match because a
+// lower-numbered entry already covers them, and allowed traffic
+// whose return traffic on ephemeral ports is blocked.
+//
+// **Parameters:**
+//
+// acl: the network ACL to audit
+//
+// **Returns:**
+//
+// []NetworkACLFinding: the problems found
+func AuditNetworkACL(acl *ec2.NetworkAcl) []NetworkACLFinding {
+	aclID := aws.StringValue(acl.NetworkAclId)
+
+	var findings []NetworkACLFinding
+	for _, egress := range []bool{false, true} {
+		direction := "inbound"
+		if egress {
+			direction = "outbound"
+		}
+
+		entries := sortedACLEntries(acl, egress)
+		for i, entry := range entries {
+			ruleNumber := aws.Int64Value(entry.RuleNumber)
+			if ruleNumber == defaultACLRuleNumber || ruleNumber == defaultIPv6ACLRuleNumber {
+				continue
+			}
+			cidr := aclEntryCIDR(entry)
+
+			if isAllowAllEntry(entry) {
+				findings = append(findings, NetworkACLFinding{
+					NetworkACLID: aclID,
+					RuleNumber:   ruleNumber,
+					Egress:       egress,
+					Issue:        NACLIssueAllowAll,
+					Detail:       fmt.Sprintf("rule %d allows all %s traffic for %s", ruleNumber, direction, cidr),
+				})
+			}
+
+			for _, earlier := range entries[:i] {
+				if aclEntryCovers(earlier, entry) {
+					findings = append(findings, NetworkACLFinding{
+						NetworkACLID: aclID,
+						RuleNumber:   ruleNumber,
+						Egress:       egress,
+						Issue:        NACLIssueShadowed,
+						Detail: fmt.Sprintf("rule %d (%s %s %s) is shadowed by rule %d (%s %s %s)",
+							ruleNumber, aws.StringValue(entry.RuleAction), describeACLEntry(entry), cidr,
+							aws.Int64Value(earlier.RuleNumber), aws.StringValue(earlier.RuleAction),
+							describeACLEntry(earlier), aclEntryCIDR(earlier)),
+					})
+					break
+				}
+			}
+
+			if finding, ok := checkEphemeralReturn(acl, entry); ok {
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	return findings
+}
+
+// checkEphemeralReturn checks that the return traffic of an allow
+// entry, on the ephemeral port range, is allowed in the other direction.
+func checkEphemeralReturn(acl *ec2.NetworkAcl, entry *ec2.NetworkAclEntry) (NetworkACLFinding, bool) {
+	if aws.StringValue(entry.RuleAction) != ec2.RuleActionAllow {
+		return NetworkACLFinding{}, false
+	}
+
+	proto, err := normalizeProtocol(aws.StringValue(entry.Protocol))
+	if err != nil || (proto != "-1" && proto != "6" && proto != "17") {
+		return NetworkACLFinding{}, false
+	}
+	if proto == "-1" {
+		proto = "6"
+	}
+
+	_, network, err := net.ParseCIDR(aclEntryCIDR(entry))
+	if err != nil {
+		return NetworkACLFinding{}, false
+	}
+
+	egress := aws.BoolValue(entry.Egress)
+	decision := evaluateNetworkACL(acl, !egress, network.IP, proto, ephemeralPortStart, ephemeralPortEnd)
+	if decision.allowed {
+		return NetworkACLFinding{}, false
+	}
+
+	returnDirection := "outbound"
+	if egress {
+		returnDirection = "inbound"
+	}
+	detail := fmt.Sprintf("rule %d allows %s %s, but %s return traffic on %s is denied",
+		aws.Int64Value(entry.RuleNumber), describeACLEntry(entry), network, returnDirection,
+		describeTraffic(proto, ephemeralPortStart, ephemeralPortEnd))
+	if decision.entry != nil {
+		detail += fmt.Sprintf(" by rule %d", aws.Int64Value(decision.entry.RuleNumber))
+	}
+
+	return NetworkACLFinding{
+		NetworkACLID: aws.StringValue(acl.NetworkAclId),
+		RuleNumber:   aws.Int64Value(entry.RuleNumber),
+		Egress:       egress,
+		Issue:        NACLIssueEphemeralBlocked,
+		Detail:       detail,
+	}, true
+}
+
+// createInput validates the entry and converts it to the input
+// used to create it in the network ACL with the provided ID.
+func (e NetworkACLEntry) createInput(aclID string) (*ec2.CreateNetworkAclEntryInput, error) {
+	if e.RuleNumber < 1 || e.RuleNumber >= defaultACLRuleNumber {
+		return nil, fmt.Errorf("rule number must be between 1 and %d, got %d", defaultACLRuleNumber-1, e.RuleNumber)
+	}
+	if e.Action != ec2.RuleActionAllow && e.Action != ec2.RuleActionDeny {
+		return nil, fmt.Errorf("rule action must be allow or deny, got %q", e.Action)
+	}
+
+	proto, err := normalizeProtocol(e.Protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := net.ParseCIDR(e.CIDRBlock); err != nil {
+		return nil, fmt.Errorf("invalid CIDR block %q: %v", e.CIDRBlock, err)
+	}
+
+	input := &ec2.CreateNetworkAclEntryInput{
+		NetworkAclId: aws.String(aclID),
+		RuleNumber:   aws.Int64(e.RuleNumber),
+		Egress:       aws.Bool(e.Egress),
+		Protocol:     aws.String(proto),
+		RuleAction:   aws.String(e.Action),
+	}
+	if strings.Contains(e.CIDRBlock, ":") {
+		input.Ipv6CidrBlock = aws.String(e.CIDRBlock)
+	} else {
+		input.CidrBlock = aws.String(e.CIDRBlock)
+	}
+	if proto == "6" || proto == "17" {
+		input.PortRange = &ec2.PortRange{From: aws.Int64(e.FromPort), To: aws.Int64(e.ToPort)}
+	}
+
+	return input, nil
+}
+
+func isAllowAllEntry(entry *ec2.NetworkAclEntry) bool {
+	cidr := aclEntryCIDR(entry)
+	return aws.StringValue(entry.RuleAction) == ec2.RuleActionAllow &&
+		aws.StringValue(entry.Protocol) == "-1" &&
+		(cidr == "0.0.0.0/0" || cidr == "::/0")
+}
+
+// aclEntryCovers reports whether every packet matched by
+// entry is also matched by earlier.
+func aclEntryCovers(earlier, entry *ec2.NetworkAclEntry) bool {
+	_, outer, err := net.ParseCIDR(aclEntryCIDR(earlier))
+	if err != nil {
+		return false
+	}
+	_, inner, err := net.ParseCIDR(aclEntryCIDR(entry))
+	if err != nil {
+		return false
+	}
+
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	if outerBits != innerBits || outerOnes > innerOnes || !outer.Contains(inner.IP) {
+		return false
+	}
+
+	earlierProto, err := normalizeProtocol(aws.StringValue(earlier.Protocol))
+	if err != nil {
+		return false
+	}
+	if earlierProto == "-1" {
+		return true
+	}
+
+	entryProto, err := normalizeProtocol(aws.StringValue(entry.Protocol))
+	if err != nil || earlierProto != entryProto {
+		return false
+	}
+	if earlierProto != "6" && earlierProto != "17" || earlier.PortRange == nil {
+		return true
+	}
+	if entry.PortRange == nil {
+		return false
+	}
+
+	return aws.Int64Value(earlier.PortRange.From) <= aws.Int64Value(entry.PortRange.From) &&
+		aws.Int64Value(earlier.PortRange.To) >= aws.Int64Value(entry.PortRange.To)
+}
+
+func aclEntryCIDR(entry *ec2.NetworkAclEntry) string {
+	if entry.CidrBlock != nil {
+		return aws.StringValue(entry.CidrBlock)
+	}
+
+	return aws.StringValue(entry.Ipv6CidrBlock)
+}
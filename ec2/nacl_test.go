@@ -0,0 +1,146 @@
+package ec2_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditNetworkACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []*ec2.NetworkAclEntry
+		want    map[string][]int64
+	}{
+		{
+			name: "default ACL allows all traffic",
+			entries: []*ec2.NetworkAclEntry{
+				aclEntry(100, false, "allow", "-1", 0, 0),
+				aclEntry(32767, false, "deny", "-1", 0, 0),
+				aclEntry(100, true, "allow", "-1", 0, 0),
+				aclEntry(32767, true, "deny", "-1", 0, 0),
+			},
+			want: map[string][]int64{ec2utils.NACLIssueAllowAll: {100, 100}},
+		},
+		{
+			name: "default ACL of an IPv6-enabled VPC",
+			entries: []*ec2.NetworkAclEntry{
+				aclEntry(100, false, "allow", "-1", 0, 0),
+				ipv6ACLEntry(101, false, "allow"),
+				aclEntry(32767, false, "deny", "-1", 0, 0),
+				ipv6ACLEntry(32768, false, "deny"),
+				aclEntry(100, true, "allow", "-1", 0, 0),
+				ipv6ACLEntry(101, true, "allow"),
+				aclEntry(32767, true, "deny", "-1", 0, 0),
+				ipv6ACLEntry(32768, true, "deny"),
+			},
+			want: map[string][]int64{ec2utils.NACLIssueAllowAll: {100, 101, 100, 101}},
+		},
+		{
+			name: "rule shadowed by a broader lower-numbered rule",
+			entries: []*ec2.NetworkAclEntry{
+				aclEntry(100, false, "deny", "6", 0, 1023),
+				aclEntry(110, false, "allow", "6", 22, 22),
+				aclEntry(120, false, "allow", "6", 1024, 65535),
+				aclEntry(100, true, "allow", "6", 1024, 65535),
+				aclEntry(32767, true, "deny", "-1", 0, 0),
+			},
+			want: map[string][]int64{ec2utils.NACLIssueShadowed: {110}},
+		},
+		{
+			name: "inbound HTTPS without outbound ephemeral ports",
+			entries: []*ec2.NetworkAclEntry{
+				aclEntry(100, false, "allow", "6", 443, 443),
+				aclEntry(100, true, "allow", "6", 443, 443),
+				aclEntry(110, true, "allow", "6", 1024, 2048),
+				aclEntry(32767, true, "deny", "-1", 0, 0),
+			},
+			want: map[string][]int64{ec2utils.NACLIssueEphemeralBlocked: {100, 100, 110}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			findings := ec2utils.AuditNetworkACL(&ec2.NetworkAcl{
+				NetworkAclId: aws.String("acl-1"),
+				Entries:      tc.entries,
+			})
+
+			got := make(map[string][]int64)
+			for _, finding := range findings {
+				assert.Equal(t, "acl-1", finding.NetworkACLID)
+				assert.NotEmpty(t, finding.Detail)
+				got[finding.Issue] = append(got[finding.Issue], finding.RuleNumber)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+// ipv6ACLEntry returns an entry for all traffic from or to ::/0.
+func ipv6ACLEntry(number int64, egress bool, action string) *ec2.NetworkAclEntry {
+	entry := aclEntry(number, egress, action, "-1", 0, 0)
+	entry.CidrBlock = nil
+	entry.Ipv6CidrBlock = aws.String("::/0")
+	return entry
+}
+
+func TestCreateNetworkACLEntry(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"CreateNetworkAclEntry":  "<return>true</return>",
+		"ReplaceNetworkAclEntry": "<return>true</return>",
+	}, nil)
+
+	entry := ec2utils.NetworkACLEntry{
+		RuleNumber: 100,
+		Protocol:   "tcp",
+		Action:     "allow",
+		CIDRBlock:  "10.0.0.0/16",
+		FromPort:   443,
+		ToPort:     443,
+	}
+	require.NoError(t, c.CreateNetworkACLEntry("acl-1", entry))
+
+	req := fake.requestsFor("CreateNetworkAclEntry")[0]
+	assert.Equal(t, "acl-1", req.Get("NetworkAclId"))
+	assert.Equal(t, "100", req.Get("RuleNumber"))
+	assert.Equal(t, "6", req.Get("Protocol"))
+	assert.Equal(t, "allow", req.Get("RuleAction"))
+	assert.Equal(t, "10.0.0.0/16", req.Get("CidrBlock"))
+	assert.Equal(t, "443", req.Get("PortRange.From"))
+
+	entry.CIDRBlock = "::/0"
+	require.NoError(t, c.ReplaceNetworkACLEntry("acl-1", entry))
+	assert.Equal(t, "::/0", fake.requestsFor("ReplaceNetworkAclEntry")[0].Get("Ipv6CidrBlock"))
+
+	for _, invalid := range []ec2utils.NetworkACLEntry{
+		{RuleNumber: 32767, Protocol: "tcp", Action: "allow", CIDRBlock: "0.0.0.0/0"},
+		{RuleNumber: 100, Protocol: "tcp", Action: "permit", CIDRBlock: "0.0.0.0/0"},
+		{RuleNumber: 100, Protocol: "tcp", Action: "allow", CIDRBlock: "nope"},
+	} {
+		assert.Error(t, c.CreateNetworkACLEntry("acl-1", invalid))
+	}
+	assert.Len(t, fake.requestsFor("CreateNetworkAclEntry"), 1)
+}
+
+func TestAssociateNetworkACL(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"DescribeNetworkAcls": `<networkAclSet><item><networkAclId>acl-old</networkAclId>
+<associationSet><item><networkAclAssociationId>aclassoc-1</networkAclAssociationId>
+<networkAclId>acl-old</networkAclId><subnetId>subnet-1</subnetId></item></associationSet>
+</item></networkAclSet>`,
+		"ReplaceNetworkAclAssociation": "<newAssociationId>aclassoc-2</newAssociationId>",
+	}, nil)
+
+	id, err := c.AssociateNetworkACL("acl-new", "subnet-1")
+	require.NoError(t, err)
+	assert.Equal(t, "aclassoc-2", id)
+
+	req := fake.requestsFor("ReplaceNetworkAclAssociation")[0]
+	assert.Equal(t, "aclassoc-1", req.Get("AssociationId"))
+	assert.Equal(t, "acl-new", req.Get("NetworkAclId"))
+}
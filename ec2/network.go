@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -386,3 +387,350 @@ func (c *Connection) ListVPCs() ([]*ec2.Vpc, error) {
 
 	return result.Vpcs, nil
 }
+
+// InterfaceEndpointParams provides information
+// about a VPC interface endpoint.
+//
+// **Attributes:**
+//
+// VPCID: the ID of the VPC to create the endpoint in
+// Service: the short service name (e.g. ssm, ssmmessages, ec2messages, secretsmanager)
+// SubnetIDs: the IDs of the subnets to create endpoint network interfaces in
+// SecurityGroupIDs: the IDs of the security groups to attach to the endpoint
+// PrivateDNS: whether to enable private DNS for the endpoint
+type InterfaceEndpointParams struct {
+	VPCID            string
+	Service          string
+	SubnetIDs        []string
+	SecurityGroupIDs []string
+	PrivateDNS       bool
+}
+
+// gatewayEndpointServices lists the services
+// that support gateway VPC endpoints.
+var gatewayEndpointServices = map[string]bool{
+	"s3":       true,
+	"dynamodb": true,
+}
+
+// vpcEndpointPollInterval is how often an endpoint's
+// state is polled while waiting for it.
+const vpcEndpointPollInterval = 10 * time.Second
+
+// CreateGatewayEndpoint creates a gateway VPC endpoint for the provided
+// service and associates it with the provided route tables.
+//
+// **Parameters:**
+//
+// vpcID: the ID of the VPC to create the endpoint in
+//
+// service: the short service name, either s3 or dynamodb
+//
+// routeTableIDs: the IDs of the route tables to route through the endpoint
+//
+// **Returns:**
+//
+// string: the ID of the created endpoint
+//
+// error: an error if any issue occurs while trying to create the endpoint
+func (c *Connection) CreateGatewayEndpoint(vpcID, service string, routeTableIDs []string) (string, error) {
+	if !gatewayEndpointServices[service] {
+		return "", fmt.Errorf("service %s does not support gateway endpoints", service)
+	}
+
+	serviceName, err := c.endpointServiceName(service)
+	if err != nil {
+		return "", err
+	}
+
+	input := &ec2.CreateVpcEndpointInput{
+		VpcId:           aws.String(vpcID),
+		ServiceName:     aws.String(serviceName),
+		VpcEndpointType: aws.String(ec2.VpcEndpointTypeGateway),
+		RouteTableIds:   aws.StringSlice(routeTableIDs),
+	}
+
+	result, err := c.Client.CreateVpcEndpoint(input)
+	if err != nil {
+		return "", fmt.Errorf("error creating %s gateway endpoint: %v", service, err)
+	}
+
+	return aws.StringValue(result.VpcEndpoint.VpcEndpointId), nil
+}
+
+// CreateInterfaceEndpoint creates an interface VPC endpoint
+// with the provided parameters.
+//
+// **Parameters:**
+//
+// params: the parameters to use
+//
+// **Returns:**
+//
+// string: the ID of the created endpoint
+//
+// error: an error if any issue occurs while trying to create the endpoint
+func (c *Connection) CreateInterfaceEndpoint(params InterfaceEndpointParams) (string, error) {
+	if len(params.SubnetIDs) == 0 {
+		return "", errors.New("at least one subnet is required for an interface endpoint")
+	}
+
+	serviceName, err := c.endpointServiceName(params.Service)
+	if err != nil {
+		return "", err
+	}
+
+	input := &ec2.CreateVpcEndpointInput{
+		VpcId:             aws.String(params.VPCID),
+		ServiceName:       aws.String(serviceName),
+		VpcEndpointType:   aws.String(ec2.VpcEndpointTypeInterface),
+		SubnetIds:         aws.StringSlice(params.SubnetIDs),
+		PrivateDnsEnabled: aws.Bool(params.PrivateDNS),
+	}
+
+	if len(params.SecurityGroupIDs) > 0 {
+		input.SecurityGroupIds = aws.StringSlice(params.SecurityGroupIDs)
+	}
+
+	result, err := c.Client.CreateVpcEndpoint(input)
+	if err != nil {
+		return "", fmt.Errorf("error creating %s interface endpoint: %v", params.Service, err)
+	}
+
+	return aws.StringValue(result.VpcEndpoint.VpcEndpointId), nil
+}
+
+// WaitForVPCEndpoint waits until the VPC endpoint
+// with the provided ID is available.
+//
+// **Parameters:**
+//
+// endpointID: the ID of the endpoint to wait for
+//
+// timeout: how long to wait before giving up
+//
+// **Returns:**
+//
+// error: an error if the endpoint fails or does not become available in time
+func (c *Connection) WaitForVPCEndpoint(endpointID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := c.Client.DescribeVpcEndpoints(&ec2.DescribeVpcEndpointsInput{
+			VpcEndpointIds: []*string{aws.String(endpointID)},
+		})
+		if err != nil {
+			return fmt.Errorf("error describing VPC endpoint %s: %v", endpointID, err)
+		}
+
+		if len(result.VpcEndpoints) == 0 {
+			return fmt.Errorf("VPC endpoint %s does not exist", endpointID)
+		}
+
+		state := aws.StringValue(result.VpcEndpoints[0].State)
+		switch {
+		case strings.EqualFold(state, ec2.StateAvailable):
+			return nil
+		case strings.EqualFold(state, ec2.StateFailed), strings.EqualFold(state, ec2.StateRejected):
+			return fmt.Errorf("VPC endpoint %s is in state %s", endpointID, state)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for VPC endpoint %s, last state: %s", endpointID, state)
+		}
+
+		time.Sleep(vpcEndpointPollInterval)
+	}
+}
+
+// DeleteVPCEndpoints deletes the VPC endpoints with the provided IDs.
+//
+// **Parameters:**
+//
+// endpointIDs: the IDs of the endpoints to delete
+//
+// **Returns:**
+//
+// error: an error if any endpoint could not be deleted
+func (c *Connection) DeleteVPCEndpoints(endpointIDs ...string) error {
+	result, err := c.Client.DeleteVpcEndpoints(&ec2.DeleteVpcEndpointsInput{
+		VpcEndpointIds: aws.StringSlice(endpointIDs),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting VPC endpoints: %v", err)
+	}
+
+	if len(result.Unsuccessful) > 0 {
+		item := result.Unsuccessful[0]
+		return fmt.Errorf("error deleting VPC endpoint %s: %s", aws.StringValue(item.ResourceId), aws.StringValue(item.Error.Message))
+	}
+
+	return nil
+}
+
+// CreateNATGateway creates a public NAT gateway in the provided subnet
+// and waits for it to become available. A gateway that does not become
+// available is deleted again. If allocationID is empty, a new Elastic IP
+// is allocated, and released again if the gateway cannot be created.
+//
+// **Parameters:**
+//
+// subnetID: the ID of the public subnet to create the NAT gateway in
+//
+// allocationID: the allocation ID of an existing Elastic IP, or empty to allocate one
+//
+// **Returns:**
+//
+// string: the ID of the created NAT gateway, or of a gateway
+// that could not be deleted after failing to become available
+//
+// error: an error if any issue occurs while trying to create the NAT gateway
+func (c *Connection) CreateNATGateway(subnetID, allocationID string) (string, error) {
+	allocated := false
+	if allocationID == "" {
+		address, err := c.Client.AllocateAddress(&ec2.AllocateAddressInput{
+			Domain: aws.String(ec2.DomainTypeVpc),
+		})
+		if err != nil {
+			return "", fmt.Errorf("error allocating Elastic IP: %v", err)
+		}
+		allocationID = aws.StringValue(address.AllocationId)
+		allocated = true
+	}
+
+	natGatewayID, err := c.createNATGateway(subnetID, allocationID)
+	if err == nil {
+		return natGatewayID, nil
+	}
+
+	// The Elastic IP stays associated with the gateway
+	// until the gateway has been deleted.
+	if natGatewayID != "" {
+		if deleteErr := c.DeleteNATGateway(natGatewayID, false); deleteErr != nil {
+			return natGatewayID, fmt.Errorf("%v (and failed to delete NAT gateway %s: %v)", err, natGatewayID, deleteErr)
+		}
+	}
+
+	if allocated {
+		if _, releaseErr := c.Client.ReleaseAddress(&ec2.ReleaseAddressInput{
+			AllocationId: aws.String(allocationID),
+		}); releaseErr != nil {
+			return "", fmt.Errorf("%v (and failed to release Elastic IP %s: %v)", err, allocationID, releaseErr)
+		}
+	}
+
+	return "", err
+}
+
+// createNATGateway creates a NAT gateway and waits for it to become
+// available. The ID of a gateway that was created is returned even
+// if waiting for it fails.
+func (c *Connection) createNATGateway(subnetID, allocationID string) (string, error) {
+	result, err := c.Client.CreateNatGateway(&ec2.CreateNatGatewayInput{
+		SubnetId:     aws.String(subnetID),
+		AllocationId: aws.String(allocationID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating NAT gateway in %s: %v", subnetID, err)
+	}
+	natGatewayID := aws.StringValue(result.NatGateway.NatGatewayId)
+
+	if err := c.Client.WaitUntilNatGatewayAvailable(&ec2.DescribeNatGatewaysInput{
+		NatGatewayIds: []*string{aws.String(natGatewayID)},
+	}); err != nil {
+		return natGatewayID, fmt.Errorf("error waiting for NAT gateway %s: %v", natGatewayID, err)
+	}
+
+	return natGatewayID, nil
+}
+
+// DeleteNATGateway deletes the NAT gateway with the provided ID and
+// waits for the deletion to complete, optionally releasing its
+// Elastic IPs afterwards.
+//
+// **Parameters:**
+//
+// natGatewayID: the ID of the NAT gateway to delete
+//
+// releaseEIP: whether to release the Elastic IPs of the NAT gateway
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to delete the NAT gateway
+func (c *Connection) DeleteNATGateway(natGatewayID string, releaseEIP bool) error {
+	describeInput := &ec2.DescribeNatGatewaysInput{
+		NatGatewayIds: []*string{aws.String(natGatewayID)},
+	}
+
+	result, err := c.Client.DescribeNatGateways(describeInput)
+	if err != nil {
+		return fmt.Errorf("error describing NAT gateway %s: %v", natGatewayID, err)
+	}
+
+	if len(result.NatGateways) == 0 {
+		return fmt.Errorf("NAT gateway %s does not exist", natGatewayID)
+	}
+
+	if _, err := c.Client.DeleteNatGateway(&ec2.DeleteNatGatewayInput{
+		NatGatewayId: aws.String(natGatewayID),
+	}); err != nil {
+		return fmt.Errorf("error deleting NAT gateway %s: %v", natGatewayID, err)
+	}
+
+	if err := c.Client.WaitUntilNatGatewayDeleted(describeInput); err != nil {
+		return fmt.Errorf("error waiting for NAT gateway %s deletion: %v", natGatewayID, err)
+	}
+
+	if !releaseEIP {
+		return nil
+	}
+
+	for _, address := range result.NatGateways[0].NatGatewayAddresses {
+		if address.AllocationId == nil {
+			continue
+		}
+		if _, err := c.Client.ReleaseAddress(&ec2.ReleaseAddressInput{
+			AllocationId: address.AllocationId,
+		}); err != nil {
+			return fmt.Errorf("error releasing Elastic IP %s: %v", aws.StringValue(address.AllocationId), err)
+		}
+	}
+
+	return nil
+}
+
+// AddNATGatewayRoute adds a default route through the provided
+// NAT gateway to the provided route table.
+//
+// **Parameters:**
+//
+// routeTableID: the ID of the route table to update
+//
+// natGatewayID: the ID of the NAT gateway to route through
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to add the route
+func (c *Connection) AddNATGatewayRoute(routeTableID, natGatewayID string) error {
+	if _, err := c.Client.CreateRoute(&ec2.CreateRouteInput{
+		RouteTableId:         aws.String(routeTableID),
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		NatGatewayId:         aws.String(natGatewayID),
+	}); err != nil {
+		return fmt.Errorf("error adding NAT gateway route to %s: %v", routeTableID, err)
+	}
+
+	return nil
+}
+
+func (c *Connection) endpointServiceName(service string) (string, error) {
+	if service == "" {
+		return "", errors.New("no endpoint service provided")
+	}
+
+	region, err := c.GetRegion()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("com.amazonaws.%s.%s", region, service), nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	ec2utils "github.com/l50/awsutils/ec2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -366,3 +367,101 @@ func TestListVPCs(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateVPCEndpoints(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"CreateVpcEndpoint": "<vpcEndpoint><vpcEndpointId>vpce-123</vpcEndpointId></vpcEndpoint>",
+	}, nil)
+
+	t.Run("gateway endpoint", func(t *testing.T) {
+		id, err := c.CreateGatewayEndpoint("vpc-1", "s3", []string{"rtb-1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "vpce-123", id)
+
+		req := fake.requestsFor("CreateVpcEndpoint")[0]
+		assert.Equal(t, "com.amazonaws.us-west-1.s3", req.Get("ServiceName"))
+		assert.Equal(t, "Gateway", req.Get("VpcEndpointType"))
+		assert.Equal(t, "rtb-1", req.Get("RouteTableId.1"))
+	})
+
+	t.Run("gateway endpoint for unsupported service", func(t *testing.T) {
+		_, err := c.CreateGatewayEndpoint("vpc-1", "ssm", []string{"rtb-1"})
+		assert.Error(t, err)
+	})
+
+	t.Run("interface endpoint", func(t *testing.T) {
+		id, err := c.CreateInterfaceEndpoint(ec2utils.InterfaceEndpointParams{
+			VPCID:            "vpc-1",
+			Service:          "ssmmessages",
+			SubnetIDs:        []string{"subnet-1"},
+			SecurityGroupIDs: []string{"sg-1"},
+			PrivateDNS:       true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "vpce-123", id)
+
+		reqs := fake.requestsFor("CreateVpcEndpoint")
+		req := reqs[len(reqs)-1]
+		assert.Equal(t, "com.amazonaws.us-west-1.ssmmessages", req.Get("ServiceName"))
+		assert.Equal(t, "Interface", req.Get("VpcEndpointType"))
+		assert.Equal(t, "subnet-1", req.Get("SubnetId.1"))
+		assert.Equal(t, "sg-1", req.Get("SecurityGroupId.1"))
+		assert.Equal(t, "true", req.Get("PrivateDnsEnabled"))
+	})
+}
+
+func TestCreateNATGatewayReleasesEIPOnFailure(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"AllocateAddress": "<allocationId>eipalloc-1</allocationId>",
+		"ReleaseAddress":  "<return>true</return>",
+	}, map[string]fakeEC2Error{
+		"CreateNatGateway": {Code: "InvalidSubnet", Message: "bad subnet"},
+	})
+
+	_, err := c.CreateNATGateway("subnet-1", "")
+	assert.Error(t, err)
+
+	releases := fake.requestsFor("ReleaseAddress")
+	if assert.Len(t, releases, 1) {
+		assert.Equal(t, "eipalloc-1", releases[0].Get("AllocationId"))
+	}
+}
+
+func TestCreateNATGatewayDeletesUnavailableGateway(t *testing.T) {
+	responses := map[string]string{
+		"AllocateAddress":  "<allocationId>eipalloc-1</allocationId>",
+		"ReleaseAddress":   "<return>true</return>",
+		"CreateNatGateway": "<natGateway><natGatewayId>nat-1</natGatewayId><state>pending</state></natGateway>",
+		"DescribeNatGateways": `<natGatewaySet><item><natGatewayId>nat-1</natGatewayId><state>deleted</state>
+			<natGatewayAddressSet><item><allocationId>eipalloc-1</allocationId></item></natGatewayAddressSet></item></natGatewaySet>`,
+		"DeleteNatGateway": "<natGatewayId>nat-1</natGatewayId>",
+	}
+
+	t.Run("gateway deleted before releasing the Elastic IP", func(t *testing.T) {
+		c, fake := startFakeEC2(t, responses, nil)
+
+		id, err := c.CreateNATGateway("subnet-1", "")
+		assert.ErrorContains(t, err, "error waiting for NAT gateway nat-1")
+		assert.Empty(t, id)
+
+		deletes := fake.requestsFor("DeleteNatGateway")
+		require.Len(t, deletes, 1)
+		assert.Equal(t, "nat-1", deletes[0].Get("NatGatewayId"))
+		// The deletion is waited for before the address is released.
+		assert.Len(t, fake.requestsFor("DescribeNatGateways"), 3)
+		releases := fake.requestsFor("ReleaseAddress")
+		require.Len(t, releases, 1)
+		assert.Equal(t, "eipalloc-1", releases[0].Get("AllocationId"))
+	})
+
+	t.Run("gateway that can not be deleted", func(t *testing.T) {
+		c, fake := startFakeEC2(t, responses, map[string]fakeEC2Error{
+			"DeleteNatGateway": {Code: "UnauthorizedOperation", Message: "denied"},
+		})
+
+		id, err := c.CreateNATGateway("subnet-1", "")
+		assert.ErrorContains(t, err, "failed to delete NAT gateway nat-1")
+		assert.Equal(t, "nat-1", id)
+		assert.Empty(t, fake.requestsFor("ReleaseAddress"))
+	})
+}
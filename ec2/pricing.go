@@ -0,0 +1,502 @@
+package ec2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/pricing"
+)
+
+// HoursPerMonth is the number of hours AWS uses
+// to convert hourly prices into monthly prices.
+const HoursPerMonth = 730
+
+// defaultVolumeType is the EBS volume type priced when a
+// volume's type is unknown, matching the current EC2 default.
+const defaultVolumeType = "gp3"
+
+// pricingRegion is the region hosting the AWS Pricing API.
+const pricingRegion = "us-east-1"
+
+// PriceList provides the prices used
+// to estimate the cost of EC2 resources.
+//
+// **Attributes:**
+//
+// Region: the region the prices apply to
+// OnDemand: the on-demand hourly price of Linux instances, keyed by instance type
+// Spot: the spot hourly price of Linux instances, keyed by instance type
+// EBS: the monthly price per GiB of EBS volumes, keyed by volume type
+type PriceList struct {
+	Region   string
+	OnDemand map[string]float64
+	Spot     map[string]float64
+	EBS      map[string]float64
+}
+
+// CostEstimate provides the estimated
+// cost of a set of EC2 resources.
+//
+// **Attributes:**
+//
+// InstanceHourly: the hourly cost of the instances
+// StorageHourly: the hourly cost of the EBS volumes
+// Hourly: the total hourly cost
+// Monthly: the total monthly cost
+// Unpriced: the instance or volume types no price was found for
+type CostEstimate struct {
+	InstanceHourly float64
+	StorageHourly  float64
+	Hourly         float64
+	Monthly        float64
+	Unpriced       []string
+}
+
+// priceListProduct mirrors the parts of the AWS bulk pricing
+// format used to extract EC2 prices.
+type priceListProduct struct {
+	SKU           string            `json:"sku"`
+	ProductFamily string            `json:"productFamily"`
+	Attributes    map[string]string `json:"attributes"`
+}
+
+type priceListTerm struct {
+	PriceDimensions map[string]struct {
+		Unit         string            `json:"unit"`
+		PricePerUnit map[string]string `json:"pricePerUnit"`
+	} `json:"priceDimensions"`
+}
+
+type priceListTerms struct {
+	OnDemand map[string]map[string]priceListTerm `json:"OnDemand"`
+}
+
+// NewPriceList creates an empty price list for the provided region.
+//
+// **Parameters:**
+//
+// region: the region the prices apply to
+//
+// **Returns:**
+//
+// *PriceList: an empty price list
+func NewPriceList(region string) *PriceList {
+	return &PriceList{
+		Region:   region,
+		OnDemand: make(map[string]float64),
+		Spot:     make(map[string]float64),
+		EBS:      make(map[string]float64),
+	}
+}
+
+// LoadPriceFile loads on-demand instance and EBS prices for the provided
+// region from an AWS bulk pricing JSON file for the AmazonEC2 offer.
+//
+// **Parameters:**
+//
+// path: the path of the price file
+//
+// region: the region to load prices for (e.g. us-west-1)
+//
+// **Returns:**
+//
+// *PriceList: the prices found in the file
+//
+// error: an error if any issue occurs while trying to load the file
+func LoadPriceFile(path, region string) (*PriceList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParsePriceList(file, region)
+}
+
+// ParsePriceList parses on-demand instance and EBS prices for the
+// provided region from AWS bulk pricing JSON.
+//
+// **Parameters:**
+//
+// r: the reader to parse the bulk pricing JSON from
+//
+// region: the region to load prices for (e.g. us-west-1)
+//
+// **Returns:**
+//
+// *PriceList: the prices found
+//
+// error: an error if the JSON could not be parsed
+func ParsePriceList(r io.Reader, region string) (*PriceList, error) {
+	var offer struct {
+		Products map[string]priceListProduct `json:"products"`
+		Terms    priceListTerms              `json:"terms"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&offer); err != nil {
+		return nil, fmt.Errorf("error parsing price list: %v", err)
+	}
+
+	priceList := NewPriceList(region)
+	for sku, product := range offer.Products {
+		priceList.addProduct(product, offer.Terms.OnDemand[sku])
+	}
+
+	return priceList, nil
+}
+
+// LoadPricesFromAPI loads on-demand prices for the provided instance
+// types and all EBS volume types from the AWS Pricing API.
+//
+// **Parameters:**
+//
+// region: the region to load prices for (e.g. us-west-1)
+//
+// instanceTypes: the instance types to load prices for
+//
+// **Returns:**
+//
+// *PriceList: the prices found
+//
+// error: an error if any issue occurs while trying to query the Pricing API
+func (c *Connection) LoadPricesFromAPI(region string, instanceTypes []string) (*PriceList, error) {
+	sess, err := session.NewSession(c.Client.Config.Copy(&aws.Config{
+		Region: aws.String(pricingRegion),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	svc := pricing.New(sess)
+
+	priceList := NewPriceList(region)
+	filterSets := [][]*pricing.Filter{
+		pricingFilters(map[string]string{
+			"regionCode":    region,
+			"productFamily": "Storage",
+		}),
+	}
+	for _, instanceType := range instanceTypes {
+		filterSets = append(filterSets, pricingFilters(map[string]string{
+			"regionCode":      region,
+			"instanceType":    instanceType,
+			"operatingSystem": "Linux",
+			"tenancy":         "Shared",
+			"preInstalledSw":  "NA",
+			"capacitystatus":  "Used",
+			"operation":       "RunInstances",
+		}))
+	}
+
+	for _, filters := range filterSets {
+		input := &pricing.GetProductsInput{
+			ServiceCode: aws.String("AmazonEC2"),
+			Filters:     filters,
+		}
+
+		var parseErr error
+		if err := svc.GetProductsPages(input, func(page *pricing.GetProductsOutput, _ bool) bool {
+			for _, item := range page.PriceList {
+				if parseErr = priceList.addPriceListItem(item); parseErr != nil {
+					return false
+				}
+			}
+			return true
+		}); err != nil {
+			return nil, fmt.Errorf("error querying the pricing API: %v", err)
+		}
+		if parseErr != nil {
+			return nil, parseErr
+		}
+	}
+
+	return priceList, nil
+}
+
+// LoadSpotPrices loads the latest Linux spot prices for the provided
+// instance types into the price list, using the lowest price found
+// across availability zones.
+//
+// **Parameters:**
+//
+// priceList: the price list to update
+//
+// instanceTypes: the instance types to load spot prices for
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to load the spot prices
+func (c *Connection) LoadSpotPrices(priceList *PriceList, instanceTypes []string) error {
+	input := &ec2.DescribeSpotPriceHistoryInput{
+		InstanceTypes:       aws.StringSlice(instanceTypes),
+		ProductDescriptions: []*string{aws.String("Linux/UNIX")},
+		StartTime:           aws.Time(time.Now()),
+	}
+
+	return c.Client.DescribeSpotPriceHistoryPages(input,
+		func(page *ec2.DescribeSpotPriceHistoryOutput, _ bool) bool {
+			for _, price := range page.SpotPriceHistory {
+				value, err := strconv.ParseFloat(aws.StringValue(price.SpotPrice), 64)
+				if err != nil {
+					continue
+				}
+				instanceType := aws.StringValue(price.InstanceType)
+				if current, ok := priceList.Spot[instanceType]; !ok || value < current {
+					priceList.Spot[instanceType] = value
+				}
+			}
+			return true
+		})
+}
+
+// EstimateParams estimates the cost of launching
+// instances with the provided parameters. The volume
+// is priced as gp3 if the parameters have no VolumeType.
+//
+// **Parameters:**
+//
+// ec2Params: the parameters to estimate the cost of
+//
+// spot: whether to use spot prices instead of on-demand prices
+//
+// **Returns:**
+//
+// CostEstimate: the estimated cost of the launch
+func (p *PriceList) EstimateParams(ec2Params Params, spot bool) CostEstimate {
+	count := ec2Params.MaxCount
+	if count < ec2Params.MinCount {
+		count = ec2Params.MinCount
+	}
+
+	var estimate CostEstimate
+	for i := 0; i < count; i++ {
+		p.addInstance(&estimate, ec2Params.InstanceType, spot)
+		p.addVolume(&estimate, ec2Params.VolumeType, ec2Params.VolumeSize)
+	}
+
+	return estimate.total()
+}
+
+// EstimateInstances estimates the cost of the provided instances
+// and their attached EBS volumes using on-demand prices.
+//
+// **Parameters:**
+//
+// instances: the instances to estimate the cost of, e.g. from GetInstances
+//
+// volumes: the EBS volumes attached to the instances
+//
+// **Returns:**
+//
+// CostEstimate: the estimated cost of the instances
+func (p *PriceList) EstimateInstances(instances []*ec2.Instance, volumes []*ec2.Volume) CostEstimate {
+	var estimate CostEstimate
+	for _, instance := range instances {
+		if instance.State != nil && aws.StringValue(instance.State.Name) != ec2.InstanceStateNameRunning {
+			continue
+		}
+		spot := aws.StringValue(instance.InstanceLifecycle) == ec2.InstanceLifecycleTypeSpot
+		p.addInstance(&estimate, aws.StringValue(instance.InstanceType), spot)
+	}
+
+	for _, volume := range volumes {
+		p.addVolume(&estimate, aws.StringValue(volume.VolumeType), aws.Int64Value(volume.Size))
+	}
+
+	return estimate.total()
+}
+
+// EstimateRunningCost estimates the cost of the instances matching the
+// provided filters, including their attached EBS volumes. Stopped
+// instances only contribute the cost of their volumes.
+//
+// **Parameters:**
+//
+// priceList: the prices to use
+//
+// filters: the filters used to select instances, as for GetInstances
+//
+// **Returns:**
+//
+// CostEstimate: the estimated cost of the instances
+//
+// error: an error if any issue occurs while trying to retrieve the instances or volumes
+func (c *Connection) EstimateRunningCost(priceList *PriceList, filters []*ec2.Filter) (CostEstimate, error) {
+	instances, err := c.GetInstances(filters)
+	if err != nil {
+		return CostEstimate{}, err
+	}
+
+	var volumeIDs []string
+	for _, instance := range instances {
+		for _, mapping := range instance.BlockDeviceMappings {
+			if mapping.Ebs != nil && mapping.Ebs.VolumeId != nil {
+				volumeIDs = append(volumeIDs, *mapping.Ebs.VolumeId)
+			}
+		}
+	}
+
+	var volumes []*ec2.Volume
+	if len(volumeIDs) > 0 {
+		if err := c.Client.DescribeVolumesPages(&ec2.DescribeVolumesInput{
+			VolumeIds: aws.StringSlice(volumeIDs),
+		}, func(page *ec2.DescribeVolumesOutput, _ bool) bool {
+			volumes = append(volumes, page.Volumes...)
+			return true
+		}); err != nil {
+			return CostEstimate{}, fmt.Errorf("error describing volumes: %v", err)
+		}
+	}
+
+	return priceList.EstimateInstances(instances, volumes), nil
+}
+
+func (p *PriceList) addInstance(estimate *CostEstimate, instanceType string, spot bool) {
+	prices := p.OnDemand
+	if spot {
+		prices = p.Spot
+	}
+
+	price, ok := prices[instanceType]
+	if !ok {
+		estimate.addUnpriced(instanceType)
+		return
+	}
+	estimate.InstanceHourly += price
+}
+
+func (p *PriceList) addVolume(estimate *CostEstimate, volumeType string, sizeGiB int64) {
+	if sizeGiB <= 0 {
+		return
+	}
+	if volumeType == "" {
+		volumeType = defaultVolumeType
+	}
+
+	price, ok := p.EBS[volumeType]
+	if !ok {
+		estimate.addUnpriced(volumeType)
+		return
+	}
+	estimate.StorageHourly += price * float64(sizeGiB) / HoursPerMonth
+}
+
+func (e *CostEstimate) addUnpriced(name string) {
+	if !containsString(e.Unpriced, name) {
+		e.Unpriced = append(e.Unpriced, name)
+	}
+}
+
+func (e CostEstimate) total() CostEstimate {
+	e.Hourly = e.InstanceHourly + e.StorageHourly
+	e.Monthly = e.Hourly * HoursPerMonth
+
+	return e
+}
+
+func (p *PriceList) addPriceListItem(item aws.JSONValue) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	var entry struct {
+		Product priceListProduct `json:"product"`
+		Terms   priceListTerms   `json:"terms"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return fmt.Errorf("error parsing price list item: %v", err)
+	}
+
+	p.addProduct(entry.Product, entry.Terms.OnDemand[entry.Product.SKU])
+
+	return nil
+}
+
+// addProduct records the on-demand price of a Linux shared-tenancy
+// instance or an EBS volume type in the price list's region.
+// Instance products for other operations (licensed or BYOL
+// variants) and other market options share the instance type
+// and are skipped, so each type keeps a single price.
+func (p *PriceList) addProduct(product priceListProduct, terms map[string]priceListTerm) {
+	attrs := product.Attributes
+	if attrs["regionCode"] != p.Region {
+		return
+	}
+
+	switch product.ProductFamily {
+	case "Compute Instance":
+		price, ok := usdPrice(terms, "Hrs")
+		if !ok {
+			return
+		}
+		if attrs["operatingSystem"] != "Linux" || attrs["tenancy"] != "Shared" ||
+			attrs["preInstalledSw"] != "NA" || attrs["operation"] != "RunInstances" ||
+			(attrs["capacitystatus"] != "" && attrs["capacitystatus"] != "Used") ||
+			(attrs["marketoption"] != "" && attrs["marketoption"] != "OnDemand") {
+			return
+		}
+		p.OnDemand[attrs["instanceType"]] = price
+	case "Storage":
+		price, ok := usdPrice(terms, "GB-Mo")
+		if !ok {
+			return
+		}
+		if volumeType := attrs["volumeApiName"]; volumeType != "" {
+			p.EBS[volumeType] = price
+		}
+	}
+}
+
+// usdPrice returns the USD price of the first price dimension
+// with the provided unit, visiting terms and dimensions in
+// order of their codes so the result is deterministic.
+func usdPrice(terms map[string]priceListTerm, unit string) (float64, bool) {
+	termCodes := make([]string, 0, len(terms))
+	for code := range terms {
+		termCodes = append(termCodes, code)
+	}
+	sort.Strings(termCodes)
+
+	for _, termCode := range termCodes {
+		dimensions := terms[termCode].PriceDimensions
+		dimensionCodes := make([]string, 0, len(dimensions))
+		for code := range dimensions {
+			dimensionCodes = append(dimensionCodes, code)
+		}
+		sort.Strings(dimensionCodes)
+
+		for _, dimensionCode := range dimensionCodes {
+			dimension := dimensions[dimensionCode]
+			if dimension.Unit != unit {
+				continue
+			}
+			value, err := strconv.ParseFloat(dimension.PricePerUnit["USD"], 64)
+			if err == nil {
+				return value, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func pricingFilters(terms map[string]string) []*pricing.Filter {
+	filters := make([]*pricing.Filter, 0, len(terms))
+	for field, value := range terms {
+		filters = append(filters, &pricing.Filter{
+			Type:  aws.String(pricing.FilterTypeTermMatch),
+			Field: aws.String(field),
+			Value: aws.String(value),
+		})
+	}
+
+	return filters
+}
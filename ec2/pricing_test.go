@@ -0,0 +1,159 @@
+package ec2_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPriceFile = `{
+  "formatVersion": "v1.0",
+  "offerCode": "AmazonEC2",
+  "products": {
+    "SKU1": {
+      "sku": "SKU1",
+      "productFamily": "Compute Instance",
+      "attributes": {"regionCode": "us-west-1", "instanceType": "t3.micro", "operatingSystem": "Linux",
+        "tenancy": "Shared", "preInstalledSw": "NA", "capacitystatus": "Used",
+        "operation": "RunInstances", "marketoption": "OnDemand"}
+    },
+    "SKU2": {
+      "sku": "SKU2",
+      "productFamily": "Compute Instance",
+      "attributes": {"regionCode": "us-west-1", "instanceType": "t3.micro", "operatingSystem": "Windows",
+        "tenancy": "Shared", "preInstalledSw": "NA", "capacitystatus": "Used",
+        "operation": "RunInstances", "marketoption": "OnDemand"}
+    },
+    "SKU3": {
+      "sku": "SKU3",
+      "productFamily": "Compute Instance",
+      "attributes": {"regionCode": "us-east-1", "instanceType": "t3.micro", "operatingSystem": "Linux",
+        "tenancy": "Shared", "preInstalledSw": "NA", "capacitystatus": "Used",
+        "operation": "RunInstances", "marketoption": "OnDemand"}
+    },
+    "SKU0A": {
+      "sku": "SKU0A",
+      "productFamily": "Compute Instance",
+      "attributes": {"regionCode": "us-west-1", "instanceType": "t3.micro", "operatingSystem": "Linux",
+        "tenancy": "Shared", "preInstalledSw": "NA", "capacitystatus": "Used",
+        "operation": "RunInstances:0010", "marketoption": "OnDemand"}
+    },
+    "SKU0B": {
+      "sku": "SKU0B",
+      "productFamily": "Compute Instance",
+      "attributes": {"regionCode": "us-west-1", "instanceType": "t3.micro", "operatingSystem": "Linux",
+        "tenancy": "Shared", "preInstalledSw": "NA", "capacitystatus": "Used",
+        "operation": "RunInstances", "marketoption": "CapacityBlock"}
+    },
+    "SKU4": {
+      "sku": "SKU4",
+      "productFamily": "Storage",
+      "attributes": {"regionCode": "us-west-1", "volumeApiName": "gp2"}
+    },
+    "SKU5": {
+      "sku": "SKU5",
+      "productFamily": "Storage",
+      "attributes": {"regionCode": "us-west-1", "volumeApiName": "gp3"}
+    }
+  },
+  "terms": {
+    "OnDemand": {
+      "SKU1": {"SKU1.T1": {"priceDimensions": {
+        "SKU1.T1.R0": {"unit": "Quantity", "pricePerUnit": {"USD": "99"}},
+        "SKU1.T1.R1": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0124"}},
+        "SKU1.T1.R2": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0"}}
+      }}},
+      "SKU2": {"SKU2.T1": {"priceDimensions": {"SKU2.T1.R1": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0216"}}}}},
+      "SKU3": {"SKU3.T1": {"priceDimensions": {"SKU3.T1.R1": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0104"}}}}},
+      "SKU0A": {"SKU0A.T1": {"priceDimensions": {"SKU0A.T1.R1": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0904"}}}}},
+      "SKU0B": {"SKU0B.T1": {"priceDimensions": {"SKU0B.T1.R1": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0062"}}}}},
+      "SKU4": {"SKU4.T1": {"priceDimensions": {"SKU4.T1.R1": {"unit": "GB-Mo", "pricePerUnit": {"USD": "0.12"}}}}},
+      "SKU5": {"SKU5.T1": {"priceDimensions": {"SKU5.T1.R1": {"unit": "GB-Mo", "pricePerUnit": {"USD": "0.096"}}}}}
+    }
+  }
+}`
+
+func TestParsePriceList(t *testing.T) {
+	// Terms with several price dimensions, and other products sharing
+	// the instance type, are parsed the same way every time.
+	for i := 0; i < 20; i++ {
+		priceList, err := ec2utils.ParsePriceList(strings.NewReader(testPriceFile), "us-west-1")
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]float64{"t3.micro": 0.0124}, priceList.OnDemand)
+		assert.Equal(t, map[string]float64{"gp2": 0.12, "gp3": 0.096}, priceList.EBS)
+	}
+
+	_, err := ec2utils.ParsePriceList(strings.NewReader("{"), "us-west-1")
+	assert.Error(t, err)
+}
+
+func TestPriceListEstimates(t *testing.T) {
+	priceList, err := ec2utils.ParsePriceList(strings.NewReader(testPriceFile), "us-west-1")
+	require.NoError(t, err)
+	priceList.Spot["t3.micro"] = 0.004
+
+	t.Run("params on-demand", func(t *testing.T) {
+		estimate := priceList.EstimateParams(ec2utils.Params{
+			InstanceType: "t3.micro",
+			MinCount:     1,
+			MaxCount:     2,
+			VolumeSize:   73,
+		}, false)
+
+		assert.InDelta(t, 0.0248, estimate.InstanceHourly, 1e-9)
+		assert.InDelta(t, 2*0.096*73/730.0, estimate.StorageHourly, 1e-9)
+		assert.InDelta(t, estimate.Hourly*ec2utils.HoursPerMonth, estimate.Monthly, 1e-9)
+		assert.Empty(t, estimate.Unpriced)
+	})
+
+	t.Run("params volume type", func(t *testing.T) {
+		estimate := priceList.EstimateParams(ec2utils.Params{
+			InstanceType: "t3.micro",
+			MinCount:     1,
+			MaxCount:     1,
+			VolumeSize:   730,
+			VolumeType:   "gp2",
+		}, false)
+		assert.InDelta(t, 0.12, estimate.StorageHourly, 1e-9)
+
+		estimate = priceList.EstimateParams(ec2utils.Params{
+			InstanceType: "t3.micro",
+			MinCount:     1,
+			MaxCount:     1,
+			VolumeSize:   8,
+			VolumeType:   "io2",
+		}, false)
+		assert.Zero(t, estimate.StorageHourly)
+		assert.Equal(t, []string{"io2"}, estimate.Unpriced)
+	})
+
+	t.Run("params spot with unknown type", func(t *testing.T) {
+		estimate := priceList.EstimateParams(ec2utils.Params{
+			InstanceType: "m7g.large",
+			MinCount:     1,
+			MaxCount:     1,
+		}, true)
+
+		assert.Zero(t, estimate.Hourly)
+		assert.Equal(t, []string{"m7g.large"}, estimate.Unpriced)
+	})
+
+	t.Run("running instances", func(t *testing.T) {
+		instances := []*ec2.Instance{
+			{InstanceType: aws.String("t3.micro"), State: &ec2.InstanceState{Name: aws.String("running")}},
+			{InstanceType: aws.String("t3.micro"), State: &ec2.InstanceState{Name: aws.String("running")}, InstanceLifecycle: aws.String("spot")},
+			{InstanceType: aws.String("t3.micro"), State: &ec2.InstanceState{Name: aws.String("stopped")}},
+		}
+		volumes := []*ec2.Volume{{VolumeType: aws.String("gp2"), Size: aws.Int64(730)}}
+
+		estimate := priceList.EstimateInstances(instances, volumes)
+		assert.InDelta(t, 0.0124+0.004, estimate.InstanceHourly, 1e-9)
+		assert.InDelta(t, 0.12, estimate.StorageHourly, 1e-9)
+	})
+}
@@ -0,0 +1,271 @@
+package ec2
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Instance provides a summary
+// of an EC2 instance.
+//
+// **Attributes:**
+//
+// ID: the ID of the instance
+// Name: the value of the instance's Name tag
+// Type: the type of the instance
+// State: the state of the instance
+// PublicIP: the public IP address of the instance
+// PrivateIP: the private IP address of the instance
+// VPCID: the ID of the VPC the instance is in
+// SubnetID: the ID of the subnet the instance is in
+// Tags: the tags of the instance
+// LaunchTime: the time the instance was launched
+type Instance struct {
+	ID         string
+	Name       string
+	Type       string
+	State      string
+	PublicIP   string
+	PrivateIP  string
+	VPCID      string
+	SubnetID   string
+	Tags       map[string]string
+	LaunchTime time.Time
+}
+
+// InstanceQuery builds a query for EC2 instances.
+// Conditions supported by DescribeInstances are sent as
+// server-side filters, the rest are applied client-side.
+// All conditions must match for an instance to be returned.
+type InstanceQuery struct {
+	filters    []*ec2.Filter
+	predicates []func(*ec2.Instance) bool
+	err        error
+}
+
+// NewInstanceQuery creates an empty instance query
+// that matches every instance.
+//
+// **Returns:**
+//
+// *InstanceQuery: a new instance query
+func NewInstanceQuery() *InstanceQuery {
+	return &InstanceQuery{}
+}
+
+// ByTag matches instances with the provided tag. If value
+// is empty, any instance with the tag key matches.
+//
+// **Parameters:**
+//
+// key: the tag key to match
+//
+// value: the tag value to match
+//
+// **Returns:**
+//
+// *InstanceQuery: the updated query
+func (q *InstanceQuery) ByTag(key, value string) *InstanceQuery {
+	if value == "" {
+		return q.addFilter("tag-key", key)
+	}
+
+	return q.addFilter("tag:"+key, value)
+}
+
+// ByState matches instances in any of the provided states.
+// At least one state must be provided.
+//
+// **Parameters:**
+//
+// states: the instance states to match (e.g. running, stopped)
+//
+// **Returns:**
+//
+// *InstanceQuery: the updated query
+func (q *InstanceQuery) ByState(states ...string) *InstanceQuery {
+	return q.addFilter("instance-state-name", states...)
+}
+
+// InVPC matches instances in the provided VPC.
+//
+// **Parameters:**
+//
+// vpcID: the ID of the VPC to match
+//
+// **Returns:**
+//
+// *InstanceQuery: the updated query
+func (q *InstanceQuery) InVPC(vpcID string) *InstanceQuery {
+	return q.addFilter("vpc-id", vpcID)
+}
+
+// InSubnet matches instances in the provided subnet.
+//
+// **Parameters:**
+//
+// subnetID: the ID of the subnet to match
+//
+// **Returns:**
+//
+// *InstanceQuery: the updated query
+func (q *InstanceQuery) InSubnet(subnetID string) *InstanceQuery {
+	return q.addFilter("subnet-id", subnetID)
+}
+
+// InstanceTypeIn matches instances of any of the provided types.
+// At least one instance type must be provided.
+//
+// **Parameters:**
+//
+// instanceTypes: the instance types to match
+//
+// **Returns:**
+//
+// *InstanceQuery: the updated query
+func (q *InstanceQuery) InstanceTypeIn(instanceTypes ...string) *InstanceQuery {
+	return q.addFilter("instance-type", instanceTypes...)
+}
+
+// LaunchedBefore matches instances launched before the provided time.
+// This condition is applied client-side.
+//
+// **Parameters:**
+//
+// t: the time instances must have been launched before
+//
+// **Returns:**
+//
+// *InstanceQuery: the updated query
+func (q *InstanceQuery) LaunchedBefore(t time.Time) *InstanceQuery {
+	q.predicates = append(q.predicates, func(instance *ec2.Instance) bool {
+		return instance.LaunchTime != nil && instance.LaunchTime.Before(t)
+	})
+
+	return q
+}
+
+// Filters returns the server-side filters of the query.
+//
+// **Returns:**
+//
+// []*ec2.Filter: the filters to send to DescribeInstances
+func (q *InstanceQuery) Filters() []*ec2.Filter {
+	return q.filters
+}
+
+// Err returns the first error found while building the
+// query, such as a condition without any values.
+//
+// **Returns:**
+//
+// error: the error found while building the query, or nil
+func (q *InstanceQuery) Err() error {
+	return q.err
+}
+
+// Matches reports whether the provided instance satisfies
+// the client-side conditions of the query.
+//
+// **Parameters:**
+//
+// instance: the instance to check
+//
+// **Returns:**
+//
+// bool: whether the instance matches the client-side conditions
+func (q *InstanceQuery) Matches(instance *ec2.Instance) bool {
+	for _, predicate := range q.predicates {
+		if !predicate(instance) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// QueryInstances retrieves all instances matching the provided query,
+// following every page of DescribeInstances results.
+//
+// **Parameters:**
+//
+// query: the query to run
+//
+// **Returns:**
+//
+// []Instance: summaries of the instances matching the query
+//
+// error: an error if the query is invalid or if any issue
+// occurs while trying to retrieve the instances
+func (c *Connection) QueryInstances(query *InstanceQuery) ([]Instance, error) {
+	if err := query.Err(); err != nil {
+		return nil, err
+	}
+
+	instances, err := c.GetInstances(query.Filters())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Instance
+	for _, instance := range instances {
+		if query.Matches(instance) {
+			results = append(results, SummarizeInstance(instance))
+		}
+	}
+
+	return results, nil
+}
+
+// SummarizeInstance converts an EC2 API instance
+// into an Instance summary.
+//
+// **Parameters:**
+//
+// instance: the instance to summarize
+//
+// **Returns:**
+//
+// Instance: the summary of the instance
+func SummarizeInstance(instance *ec2.Instance) Instance {
+	summary := Instance{
+		ID:        aws.StringValue(instance.InstanceId),
+		Type:      aws.StringValue(instance.InstanceType),
+		PublicIP:  aws.StringValue(instance.PublicIpAddress),
+		PrivateIP: aws.StringValue(instance.PrivateIpAddress),
+		VPCID:     aws.StringValue(instance.VpcId),
+		SubnetID:  aws.StringValue(instance.SubnetId),
+		Tags:      tagsToMap(instance.Tags),
+	}
+
+	if instance.State != nil {
+		summary.State = aws.StringValue(instance.State.Name)
+	}
+
+	if instance.LaunchTime != nil {
+		summary.LaunchTime = *instance.LaunchTime
+	}
+
+	summary.Name = summary.Tags["Name"]
+
+	return summary
+}
+
+func (q *InstanceQuery) addFilter(name string, values ...string) *InstanceQuery {
+	if len(values) == 0 {
+		if q.err == nil {
+			q.err = fmt.Errorf("filter %s requires at least one value", name)
+		}
+		return q
+	}
+
+	q.filters = append(q.filters, &ec2.Filter{
+		Name:   aws.String(name),
+		Values: aws.StringSlice(values),
+	})
+
+	return q
+}
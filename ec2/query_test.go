@@ -0,0 +1,173 @@
+package ec2_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceQueryFilters(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *ec2utils.InstanceQuery
+		want  []*ec2.Filter
+	}{
+		{
+			name:  "empty query",
+			query: ec2utils.NewInstanceQuery(),
+			want:  nil,
+		},
+		{
+			name: "tag with value and state",
+			query: ec2utils.NewInstanceQuery().
+				ByTag("Env", "dev").
+				ByState("running", "pending"),
+			want: []*ec2.Filter{
+				{Name: aws.String("tag:Env"), Values: aws.StringSlice([]string{"dev"})},
+				{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"running", "pending"})},
+			},
+		},
+		{
+			name: "tag key only, vpc, subnet and type",
+			query: ec2utils.NewInstanceQuery().
+				ByTag("Owner", "").
+				InVPC("vpc-123").
+				InSubnet("subnet-123").
+				InstanceTypeIn("t3.micro", "t3.small"),
+			want: []*ec2.Filter{
+				{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{"Owner"})},
+				{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{"vpc-123"})},
+				{Name: aws.String("subnet-id"), Values: aws.StringSlice([]string{"subnet-123"})},
+				{Name: aws.String("instance-type"), Values: aws.StringSlice([]string{"t3.micro", "t3.small"})},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.query.Filters())
+		})
+	}
+}
+
+func TestInstanceQueryRequiresValues(t *testing.T) {
+	c := newFakeEC2Connection(t, nil, nil)
+
+	for name, query := range map[string]*ec2utils.InstanceQuery{
+		"no states": ec2utils.NewInstanceQuery().ByState(),
+		"no types":  ec2utils.NewInstanceQuery().ByTag("Env", "dev").InstanceTypeIn(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, query.Err())
+			for _, filter := range query.Filters() {
+				assert.NotEmpty(t, filter.Values)
+			}
+
+			_, err := c.QueryInstances(query)
+			assert.ErrorContains(t, err, "requires at least one value")
+		})
+	}
+}
+
+// instancesPage returns a DescribeInstances response body with
+// instances named prefix-0 to prefix-(count-1), followed by nextToken.
+func instancesPage(prefix string, count int, nextToken string) string {
+	body := "<reservationSet><item><instancesSet>"
+	for i := 0; i < count; i++ {
+		body += fmt.Sprintf("<item><instanceId>i-%s-%d</instanceId><instanceState><name>running</name></instanceState></item>", prefix, i)
+	}
+	body += "</instancesSet></item></reservationSet>"
+	if nextToken != "" {
+		body += "<nextToken>" + nextToken + "</nextToken>"
+	}
+	return body
+}
+
+func TestQueryInstancesPaginates(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"DescribeInstances":        instancesPage("first", 3, "page-2"),
+		"DescribeInstances/page-2": instancesPage("second", 2, "page-3"),
+		"DescribeInstances/page-3": instancesPage("third", 1, ""),
+	}, nil)
+
+	instances, err := c.QueryInstances(ec2utils.NewInstanceQuery().ByState("running"))
+	require.NoError(t, err)
+	assert.Len(t, instances, 6)
+	assert.Equal(t, "i-third-0", instances[5].ID)
+
+	requests := fake.requestsFor("DescribeInstances")
+	require.Len(t, requests, 3)
+	for _, req := range requests {
+		assert.Equal(t, "running", req.Get("Filter.1.Value.1"))
+	}
+}
+
+func TestInstanceQueryMatches(t *testing.T) {
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := ec2utils.NewInstanceQuery().LaunchedBefore(cutoff)
+
+	tests := []struct {
+		name     string
+		instance *ec2.Instance
+		want     bool
+	}{
+		{
+			name:     "launched before cutoff",
+			instance: &ec2.Instance{LaunchTime: aws.Time(cutoff.Add(-time.Hour))},
+			want:     true,
+		},
+		{
+			name:     "launched after cutoff",
+			instance: &ec2.Instance{LaunchTime: aws.Time(cutoff.Add(time.Hour))},
+			want:     false,
+		},
+		{
+			name:     "no launch time",
+			instance: &ec2.Instance{},
+			want:     false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, query.Matches(tc.instance))
+		})
+	}
+}
+
+func TestSummarizeInstance(t *testing.T) {
+	launch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	instance := &ec2.Instance{
+		InstanceId:       aws.String("i-123"),
+		InstanceType:     aws.String("t3.micro"),
+		PublicIpAddress:  aws.String("203.0.113.10"),
+		PrivateIpAddress: aws.String("10.0.0.10"),
+		VpcId:            aws.String("vpc-123"),
+		SubnetId:         aws.String("subnet-123"),
+		State:            &ec2.InstanceState{Name: aws.String("running")},
+		LaunchTime:       aws.Time(launch),
+		Tags: []*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String("web")},
+			{Key: aws.String("Env"), Value: aws.String("dev")},
+		},
+	}
+
+	assert.Equal(t, ec2utils.Instance{
+		ID:         "i-123",
+		Name:       "web",
+		Type:       "t3.micro",
+		State:      "running",
+		PublicIP:   "203.0.113.10",
+		PrivateIP:  "10.0.0.10",
+		VPCID:      "vpc-123",
+		SubnetID:   "subnet-123",
+		Tags:       map[string]string{"Name": "web", "Env": "dev"},
+		LaunchTime: launch,
+	}, ec2utils.SummarizeInstance(instance))
+}
@@ -0,0 +1,671 @@
+package ec2
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Ephemeral port range used by clients for return traffic,
+// which stateless network ACLs must allow.
+const (
+	ephemeralPortStart = 1024
+	ephemeralPortEnd   = 65535
+)
+
+// Components of a path evaluated by EvaluateReachability.
+const (
+	ReachabilitySecurityGroupEgress  = "security-group-egress"
+	ReachabilityNetworkACLOutbound   = "network-acl-outbound"
+	ReachabilityRoute                = "route"
+	ReachabilityNetworkACLInbound    = "network-acl-inbound"
+	ReachabilitySecurityGroupIngress = "security-group-ingress"
+	ReachabilityReturnRoute          = "return-route"
+	ReachabilityReturnACLOutbound    = "return-network-acl-outbound"
+	ReachabilityReturnACLInbound     = "return-network-acl-inbound"
+)
+
+// ReachabilityEndpoint provides the network configuration
+// of one end of a path.
+//
+// **Attributes:**
+//
+// InstanceID: the ID of the instance
+// PrivateIP: the private IP address of the instance's primary network interface
+// SubnetID: the ID of the instance's subnet
+// VPCID: the ID of the instance's VPC
+// SecurityGroups: the security groups of the primary network interface
+// NetworkACL: the network ACL associated with the subnet
+// RouteTable: the route table associated with the subnet
+type ReachabilityEndpoint struct {
+	InstanceID     string
+	PrivateIP      string
+	SubnetID       string
+	VPCID          string
+	SecurityGroups []*ec2.SecurityGroup
+	NetworkACL     *ec2.NetworkAcl
+	RouteTable     *ec2.RouteTable
+}
+
+// ReachabilityStep provides the outcome of evaluating
+// one component of a path.
+//
+// **Attributes:**
+//
+// Component: the component evaluated, such as security-group-egress
+// ResourceID: the ID of the security group, network ACL or route table that decided
+// Allowed: whether the component allows the traffic
+// Reason: an explanation of the decision, naming the deciding rule
+type ReachabilityStep struct {
+	Component  string
+	ResourceID string
+	Allowed    bool
+	Reason     string
+}
+
+// ReachabilityResult provides the outcome of evaluating a path.
+//
+// **Attributes:**
+//
+// Reachable: whether every component of the path allows the traffic
+// Steps: the outcome of each component, in the order traffic crosses them
+type ReachabilityResult struct {
+	Reachable bool
+	Steps     []ReachabilityStep
+}
+
+// naclDecision provides the outcome of evaluating a network ACL.
+type naclDecision struct {
+	entry   *ec2.NetworkAclEntry
+	allowed bool
+}
+
+// CheckReachability fetches the network configuration of two instances
+// and evaluates whether the source can reach the destination on the
+// provided protocol and port.
+//
+// **Parameters:**
+//
+// srcInstanceID: the ID of the source instance
+//
+// dstInstanceID: the ID of the destination instance
+//
+// protocol: the protocol, tcp, udp, icmp or a protocol number
+//
+// port: the destination port, ignored for icmp
+//
+// **Returns:**
+//
+// ReachabilityResult: the outcome of evaluating the path
+//
+// error: an error if any issue occurs while trying to fetch the configuration
+func (c *Connection) CheckReachability(srcInstanceID, dstInstanceID, protocol string, port int64) (ReachabilityResult, error) {
+	src, err := c.GetReachabilityEndpoint(srcInstanceID)
+	if err != nil {
+		return ReachabilityResult{}, err
+	}
+
+	dst, err := c.GetReachabilityEndpoint(dstInstanceID)
+	if err != nil {
+		return ReachabilityResult{}, err
+	}
+
+	return EvaluateReachability(src, dst, protocol, port)
+}
+
+// GetReachabilityEndpoint fetches the network configuration of the
+// primary network interface of the instance with the provided ID.
+//
+// **Parameters:**
+//
+// instanceID: the ID of the instance
+//
+// **Returns:**
+//
+// ReachabilityEndpoint: the network configuration of the instance
+//
+// error: an error if any issue occurs while trying to fetch the configuration
+func (c *Connection) GetReachabilityEndpoint(instanceID string) (ReachabilityEndpoint, error) {
+	result, err := c.Client.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return ReachabilityEndpoint{}, fmt.Errorf("error describing instance %s: %v", instanceID, err)
+	}
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return ReachabilityEndpoint{}, fmt.Errorf("instance %s does not exist", instanceID)
+	}
+	instance := result.Reservations[0].Instances[0]
+
+	endpoint := ReachabilityEndpoint{
+		InstanceID: instanceID,
+		PrivateIP:  aws.StringValue(instance.PrivateIpAddress),
+		SubnetID:   aws.StringValue(instance.SubnetId),
+		VPCID:      aws.StringValue(instance.VpcId),
+	}
+
+	var groupIDs []string
+	for _, eni := range instance.NetworkInterfaces {
+		if eni.Attachment == nil || aws.Int64Value(eni.Attachment.DeviceIndex) != 0 {
+			continue
+		}
+		endpoint.PrivateIP = aws.StringValue(eni.PrivateIpAddress)
+		endpoint.SubnetID = aws.StringValue(eni.SubnetId)
+		for _, group := range eni.Groups {
+			groupIDs = append(groupIDs, aws.StringValue(group.GroupId))
+		}
+	}
+	if len(groupIDs) == 0 {
+		for _, group := range instance.SecurityGroups {
+			groupIDs = append(groupIDs, aws.StringValue(group.GroupId))
+		}
+	}
+
+	if len(groupIDs) > 0 {
+		groups, err := c.Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+			GroupIds: aws.StringSlice(groupIDs),
+		})
+		if err != nil {
+			return ReachabilityEndpoint{}, fmt.Errorf("error describing security groups of %s: %v", instanceID, err)
+		}
+		endpoint.SecurityGroups = groups.SecurityGroups
+	}
+
+	acls, err := c.Client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("association.subnet-id"),
+				Values: []*string{aws.String(endpoint.SubnetID)},
+			},
+		},
+	})
+	if err != nil {
+		return ReachabilityEndpoint{}, fmt.Errorf("error describing network ACL of subnet %s: %v", endpoint.SubnetID, err)
+	}
+	if len(acls.NetworkAcls) > 0 {
+		endpoint.NetworkACL = acls.NetworkAcls[0]
+	}
+
+	endpoint.RouteTable, err = c.getEffectiveRouteTable(endpoint.SubnetID, endpoint.VPCID)
+	if err != nil {
+		return ReachabilityEndpoint{}, err
+	}
+
+	return endpoint, nil
+}
+
+// EvaluateReachability evaluates whether traffic from src can reach dst
+// on the provided protocol and port, and whether the response can
+// return. Every component is evaluated, even after one blocks the
+// traffic, so that all problems on the path are reported. Network
+// ACLs are only evaluated when the endpoints are in different subnets.
+//
+// **Parameters:**
+//
+// src: the network configuration of the source
+//
+// dst: the network configuration of the destination
+//
+// protocol: the protocol, tcp, udp, icmp or a protocol number
+//
+// port: the destination port, ignored for icmp
+//
+// **Returns:**
+//
+// ReachabilityResult: the outcome of evaluating the path
+//
+// error: an error if the protocol is not supported or an address is invalid
+func EvaluateReachability(src, dst ReachabilityEndpoint, protocol string, port int64) (ReachabilityResult, error) {
+	proto, err := normalizeProtocol(protocol)
+	if err != nil {
+		return ReachabilityResult{}, err
+	}
+
+	srcIP := net.ParseIP(src.PrivateIP)
+	if srcIP == nil {
+		return ReachabilityResult{}, fmt.Errorf("invalid source address %q", src.PrivateIP)
+	}
+	dstIP := net.ParseIP(dst.PrivateIP)
+	if dstIP == nil {
+		return ReachabilityResult{}, fmt.Errorf("invalid destination address %q", dst.PrivateIP)
+	}
+
+	traffic := describeTraffic(proto, port, port)
+	returnTraffic := describeTraffic(proto, ephemeralPortStart, ephemeralPortEnd)
+	crossSubnet := src.SubnetID != dst.SubnetID
+
+	var steps []ReachabilityStep
+	steps = append(steps, evaluateSecurityGroups(ReachabilitySecurityGroupEgress, src.SecurityGroups, true, dstIP, dst.SecurityGroups, proto, port, traffic))
+
+	if crossSubnet {
+		steps = append(steps, evaluateACLStep(ReachabilityNetworkACLOutbound, src.NetworkACL, true, dstIP, proto, port, port, traffic))
+	}
+
+	steps = append(steps, evaluateRoute(ReachabilityRoute, src, dst, dstIP))
+	if src.VPCID != dst.VPCID {
+		steps = append(steps, evaluateRoute(ReachabilityReturnRoute, dst, src, srcIP))
+	}
+
+	if crossSubnet {
+		steps = append(steps, evaluateACLStep(ReachabilityNetworkACLInbound, dst.NetworkACL, false, srcIP, proto, port, port, traffic))
+	}
+
+	steps = append(steps, evaluateSecurityGroups(ReachabilitySecurityGroupIngress, dst.SecurityGroups, false, srcIP, src.SecurityGroups, proto, port, traffic))
+
+	if crossSubnet && proto != "1" {
+		steps = append(steps,
+			evaluateACLStep(ReachabilityReturnACLOutbound, dst.NetworkACL, true, srcIP, proto, ephemeralPortStart, ephemeralPortEnd, returnTraffic),
+			evaluateACLStep(ReachabilityReturnACLInbound, src.NetworkACL, false, dstIP, proto, ephemeralPortStart, ephemeralPortEnd, returnTraffic),
+		)
+	}
+
+	result := ReachabilityResult{Reachable: true, Steps: steps}
+	for _, step := range steps {
+		if !step.Allowed {
+			result.Reachable = false
+		}
+	}
+
+	return result, nil
+}
+
+// Blocking returns the steps that block the traffic.
+//
+// **Returns:**
+//
+// []ReachabilityStep: the steps that do not allow the traffic
+func (r ReachabilityResult) Blocking() []ReachabilityStep {
+	var blocking []ReachabilityStep
+	for _, step := range r.Steps {
+		if !step.Allowed {
+			blocking = append(blocking, step)
+		}
+	}
+
+	return blocking
+}
+
+// evaluateSecurityGroups checks whether any rule of the provided
+// security groups allows traffic to or from the peer, which matches
+// a rule by address or by membership of a referenced group.
+func evaluateSecurityGroups(component string, groups []*ec2.SecurityGroup, egress bool, peerIP net.IP, peerGroups []*ec2.SecurityGroup, proto string, port int64, traffic string) ReachabilityStep {
+	direction := "from"
+	if egress {
+		direction = "to"
+	}
+
+	peerGroupIDs := make(map[string]bool, len(peerGroups))
+	for _, group := range peerGroups {
+		peerGroupIDs[aws.StringValue(group.GroupId)] = true
+	}
+
+	var groupIDs []string
+	for _, group := range groups {
+		groupID := aws.StringValue(group.GroupId)
+		groupIDs = append(groupIDs, groupID)
+
+		permissions := group.IpPermissions
+		if egress {
+			permissions = group.IpPermissionsEgress
+		}
+
+		for _, permission := range permissions {
+			if !permissionMatchesTraffic(permission, proto, port) {
+				continue
+			}
+
+			for _, ipRange := range permission.IpRanges {
+				if cidrContains(aws.StringValue(ipRange.CidrIp), peerIP) {
+					return ReachabilityStep{
+						Component:  component,
+						ResourceID: groupID,
+						Allowed:    true,
+						Reason: fmt.Sprintf("%s allows %s %s %s",
+							groupID, describePermission(permission), direction, aws.StringValue(ipRange.CidrIp)),
+					}
+				}
+			}
+
+			for _, pair := range permission.UserIdGroupPairs {
+				if peerGroupIDs[aws.StringValue(pair.GroupId)] {
+					return ReachabilityStep{
+						Component:  component,
+						ResourceID: groupID,
+						Allowed:    true,
+						Reason: fmt.Sprintf("%s allows %s %s members of %s",
+							groupID, describePermission(permission), direction, aws.StringValue(pair.GroupId)),
+					}
+				}
+			}
+		}
+	}
+
+	if len(groupIDs) == 0 {
+		return ReachabilityStep{
+			Component: component,
+			Reason:    "no security groups are attached",
+		}
+	}
+
+	return ReachabilityStep{
+		Component:  component,
+		ResourceID: strings.Join(groupIDs, ","),
+		Reason:     fmt.Sprintf("no rule in %s allows %s %s %s", strings.Join(groupIDs, ", "), traffic, direction, peerIP),
+	}
+}
+
+// evaluateACLStep evaluates a network ACL and explains its decision.
+func evaluateACLStep(component string, acl *ec2.NetworkAcl, egress bool, peerIP net.IP, proto string, fromPort, toPort int64, traffic string) ReachabilityStep {
+	if acl == nil {
+		return ReachabilityStep{
+			Component: component,
+			Reason:    "no network ACL is associated with the subnet",
+		}
+	}
+
+	aclID := aws.StringValue(acl.NetworkAclId)
+	direction := "from"
+	if egress {
+		direction = "to"
+	}
+
+	decision := evaluateNetworkACL(acl, egress, peerIP, proto, fromPort, toPort)
+	if decision.entry == nil {
+		return ReachabilityStep{
+			Component:  component,
+			ResourceID: aclID,
+			Reason:     fmt.Sprintf("no rule in %s matches %s %s %s, so it is denied", aclID, traffic, direction, peerIP),
+		}
+	}
+
+	ruleNumber := aws.Int64Value(decision.entry.RuleNumber)
+	action := aws.StringValue(decision.entry.RuleAction)
+	reason := fmt.Sprintf("rule %d of %s (%s %s %s) decides %s %s %s",
+		ruleNumber, aclID, action, describeACLEntry(decision.entry), aws.StringValue(decision.entry.CidrBlock),
+		traffic, direction, peerIP)
+	if action == ec2.RuleActionAllow && !decision.allowed {
+		reason += ", but only allows part of the port range"
+	}
+
+	return ReachabilityStep{
+		Component:  component,
+		ResourceID: aclID,
+		Allowed:    decision.allowed,
+		Reason:     reason,
+	}
+}
+
+// evaluateNetworkACL finds the lowest-numbered entry of the ACL that
+// matches the peer, protocol and port range. Traffic is allowed only
+// if that entry allows it and covers the whole port range.
+func evaluateNetworkACL(acl *ec2.NetworkAcl, egress bool, peerIP net.IP, proto string, fromPort, toPort int64) naclDecision {
+	for _, entry := range sortedACLEntries(acl, egress) {
+		if !cidrContains(aclEntryCIDR(entry), peerIP) {
+			continue
+		}
+
+		entryProto, err := normalizeProtocol(aws.StringValue(entry.Protocol))
+		if err != nil || (entryProto != "-1" && entryProto != proto) {
+			continue
+		}
+
+		covers := true
+		if entryProto != "-1" && entryProto != "1" && entry.PortRange != nil && proto != "1" {
+			from := aws.Int64Value(entry.PortRange.From)
+			to := aws.Int64Value(entry.PortRange.To)
+			if to < fromPort || from > toPort {
+				continue
+			}
+			covers = from <= fromPort && to >= toPort
+		}
+
+		return naclDecision{
+			entry:   entry,
+			allowed: aws.StringValue(entry.RuleAction) == ec2.RuleActionAllow && covers,
+		}
+	}
+
+	return naclDecision{}
+}
+
+// evaluateRoute checks that the source route table has a route to
+// the destination address, using the longest matching prefix. The
+// implicit local route is assumed for a VPC without a route table.
+func evaluateRoute(component string, src, dst ReachabilityEndpoint, dstIP net.IP) ReachabilityStep {
+	if src.RouteTable == nil {
+		if src.VPCID == dst.VPCID {
+			return ReachabilityStep{
+				Component: component,
+				Allowed:   true,
+				Reason:    fmt.Sprintf("%s is reached through the local route of %s", dstIP, src.VPCID),
+			}
+		}
+		return ReachabilityStep{
+			Component: component,
+			Reason:    fmt.Sprintf("no route table is associated with subnet %s", src.SubnetID),
+		}
+	}
+
+	tableID := aws.StringValue(src.RouteTable.RouteTableId)
+	var best *ec2.Route
+	bestLen := -1
+	for _, route := range src.RouteTable.Routes {
+		_, network, err := net.ParseCIDR(aws.StringValue(route.DestinationCidrBlock))
+		if err != nil || !network.Contains(dstIP) {
+			continue
+		}
+		if ones, _ := network.Mask.Size(); ones > bestLen {
+			best, bestLen = route, ones
+		}
+	}
+
+	if best == nil {
+		return ReachabilityStep{
+			Component:  component,
+			ResourceID: tableID,
+			Reason:     fmt.Sprintf("%s has no route to %s", tableID, dstIP),
+		}
+	}
+
+	destination := aws.StringValue(best.DestinationCidrBlock)
+	target := routeTarget(best)
+	if aws.StringValue(best.State) == ec2.RouteStateBlackhole {
+		return ReachabilityStep{
+			Component:  component,
+			ResourceID: tableID,
+			Reason:     fmt.Sprintf("route %s -> %s in %s is a blackhole", destination, target, tableID),
+		}
+	}
+
+	if src.VPCID != dst.VPCID && target == "local" {
+		return ReachabilityStep{
+			Component:  component,
+			ResourceID: tableID,
+			Reason:     fmt.Sprintf("route %s -> local in %s does not leave %s", destination, tableID, src.VPCID),
+		}
+	}
+
+	return ReachabilityStep{
+		Component:  component,
+		ResourceID: tableID,
+		Allowed:    true,
+		Reason:     fmt.Sprintf("route %s -> %s in %s matches %s", destination, target, tableID, dstIP),
+	}
+}
+
+// getEffectiveRouteTable returns the route table associated with the
+// subnet, or the main route table of the VPC if there is none.
+func (c *Connection) getEffectiveRouteTable(subnetID, vpcID string) (*ec2.RouteTable, error) {
+	result, err := c.Client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("association.subnet-id"),
+				Values: []*string{aws.String(subnetID)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching route table for subnet %s: %v", subnetID, err)
+	}
+	if len(result.RouteTables) > 0 {
+		return result.RouteTables[0], nil
+	}
+
+	result, err = c.Client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(vpcID)},
+			},
+			{
+				Name:   aws.String("association.main"),
+				Values: []*string{aws.String("true")},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching main route table for VPC %s: %v", vpcID, err)
+	}
+	if len(result.RouteTables) == 0 {
+		return nil, nil
+	}
+
+	return result.RouteTables[0], nil
+}
+
+func sortedACLEntries(acl *ec2.NetworkAcl, egress bool) []*ec2.NetworkAclEntry {
+	var entries []*ec2.NetworkAclEntry
+	for _, entry := range acl.Entries {
+		if aws.BoolValue(entry.Egress) == egress {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return aws.Int64Value(entries[i].RuleNumber) < aws.Int64Value(entries[j].RuleNumber)
+	})
+
+	return entries
+}
+
+// permissionMatchesTraffic reports whether a security group
+// permission covers the protocol and port.
+func permissionMatchesTraffic(permission *ec2.IpPermission, proto string, port int64) bool {
+	permProto, err := normalizeProtocol(aws.StringValue(permission.IpProtocol))
+	if err != nil {
+		return false
+	}
+	if permProto == "-1" {
+		return true
+	}
+	if permProto != proto {
+		return false
+	}
+	if proto != "6" && proto != "17" || permission.FromPort == nil {
+		return true
+	}
+
+	return aws.Int64Value(permission.FromPort) <= port && port <= aws.Int64Value(permission.ToPort)
+}
+
+// normalizeProtocol converts a protocol name or number to the
+// protocol number used by security groups and network ACLs.
+func normalizeProtocol(protocol string) (string, error) {
+	switch strings.ToLower(protocol) {
+	case "-1", "all":
+		return "-1", nil
+	case "tcp", "6":
+		return "6", nil
+	case "udp", "17":
+		return "17", nil
+	case "icmp", "1":
+		return "1", nil
+	}
+
+	for _, r := range protocol {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("unsupported protocol %q", protocol)
+		}
+	}
+	if protocol == "" {
+		return "", fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	return protocol, nil
+}
+
+func protocolName(proto string) string {
+	switch proto {
+	case "-1":
+		return "all traffic"
+	case "6":
+		return "tcp"
+	case "17":
+		return "udp"
+	case "1":
+		return "icmp"
+	}
+
+	return "protocol " + proto
+}
+
+func describeTraffic(proto string, fromPort, toPort int64) string {
+	if proto != "6" && proto != "17" {
+		return protocolName(proto)
+	}
+	if fromPort == toPort {
+		return fmt.Sprintf("%s/%d", protocolName(proto), fromPort)
+	}
+
+	return fmt.Sprintf("%s/%d-%d", protocolName(proto), fromPort, toPort)
+}
+
+func describePermission(permission *ec2.IpPermission) string {
+	proto, err := normalizeProtocol(aws.StringValue(permission.IpProtocol))
+	if err != nil {
+		return aws.StringValue(permission.IpProtocol)
+	}
+	if permission.FromPort == nil {
+		return protocolName(proto)
+	}
+
+	return describeTraffic(proto, aws.Int64Value(permission.FromPort), aws.Int64Value(permission.ToPort))
+}
+
+func describeACLEntry(entry *ec2.NetworkAclEntry) string {
+	proto, err := normalizeProtocol(aws.StringValue(entry.Protocol))
+	if err != nil {
+		return aws.StringValue(entry.Protocol)
+	}
+	if entry.PortRange == nil {
+		return protocolName(proto)
+	}
+
+	return describeTraffic(proto, aws.Int64Value(entry.PortRange.From), aws.Int64Value(entry.PortRange.To))
+}
+
+func routeTarget(route *ec2.Route) string {
+	for _, target := range []*string{
+		route.GatewayId, route.NatGatewayId, route.VpcPeeringConnectionId,
+		route.TransitGatewayId, route.NetworkInterfaceId, route.InstanceId,
+		route.LocalGatewayId, route.CarrierGatewayId, route.EgressOnlyInternetGatewayId,
+	} {
+		if value := aws.StringValue(target); value != "" {
+			return value
+		}
+	}
+
+	return "unknown"
+}
+
+func cidrContains(cidr string, ip net.IP) bool {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+
+	return network.Contains(ip)
+}
@@ -0,0 +1,231 @@
+package ec2_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tcpPermission(port int64, cidr, groupID string) *ec2.IpPermission {
+	permission := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(port),
+		ToPort:     aws.Int64(port),
+	}
+	if cidr != "" {
+		permission.IpRanges = []*ec2.IpRange{{CidrIp: aws.String(cidr)}}
+	}
+	if groupID != "" {
+		permission.UserIdGroupPairs = []*ec2.UserIdGroupPair{{GroupId: aws.String(groupID)}}
+	}
+
+	return permission
+}
+
+var allowAllEgress = []*ec2.IpPermission{{
+	IpProtocol: aws.String("-1"),
+	IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+}}
+
+func aclEntry(number int64, egress bool, action, protocol string, from, to int64) *ec2.NetworkAclEntry {
+	entry := &ec2.NetworkAclEntry{
+		RuleNumber: aws.Int64(number),
+		Egress:     aws.Bool(egress),
+		RuleAction: aws.String(action),
+		Protocol:   aws.String(protocol),
+		CidrBlock:  aws.String("0.0.0.0/0"),
+	}
+	if protocol != "-1" {
+		entry.PortRange = &ec2.PortRange{From: aws.Int64(from), To: aws.Int64(to)}
+	}
+
+	return entry
+}
+
+func defaultACL(id string) *ec2.NetworkAcl {
+	return &ec2.NetworkAcl{
+		NetworkAclId: aws.String(id),
+		Entries: []*ec2.NetworkAclEntry{
+			aclEntry(100, false, "allow", "-1", 0, 0),
+			aclEntry(32767, false, "deny", "-1", 0, 0),
+			aclEntry(100, true, "allow", "-1", 0, 0),
+			aclEntry(32767, true, "deny", "-1", 0, 0),
+		},
+	}
+}
+
+func localRouteTable(id string) *ec2.RouteTable {
+	return &ec2.RouteTable{
+		RouteTableId: aws.String(id),
+		Routes: []*ec2.Route{{
+			DestinationCidrBlock: aws.String("10.0.0.0/16"),
+			GatewayId:            aws.String("local"),
+			State:                aws.String("active"),
+		}},
+	}
+}
+
+func reachabilityFixture() (ec2utils.ReachabilityEndpoint, ec2utils.ReachabilityEndpoint) {
+	src := ec2utils.ReachabilityEndpoint{
+		InstanceID: "i-src",
+		PrivateIP:  "10.0.1.10",
+		SubnetID:   "subnet-a",
+		VPCID:      "vpc-1",
+		SecurityGroups: []*ec2.SecurityGroup{{
+			GroupId:             aws.String("sg-src"),
+			IpPermissionsEgress: allowAllEgress,
+		}},
+		NetworkACL: defaultACL("acl-a"),
+		RouteTable: localRouteTable("rtb-a"),
+	}
+	dst := ec2utils.ReachabilityEndpoint{
+		InstanceID: "i-dst",
+		PrivateIP:  "10.0.2.20",
+		SubnetID:   "subnet-b",
+		VPCID:      "vpc-1",
+		SecurityGroups: []*ec2.SecurityGroup{{
+			GroupId:             aws.String("sg-dst"),
+			IpPermissions:       []*ec2.IpPermission{tcpPermission(443, "", "sg-src")},
+			IpPermissionsEgress: allowAllEgress,
+		}},
+		NetworkACL: defaultACL("acl-b"),
+		RouteTable: localRouteTable("rtb-b"),
+	}
+
+	return src, dst
+}
+
+func TestEvaluateReachability(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(src, dst *ec2utils.ReachabilityEndpoint)
+		protocol     string
+		port         int64
+		wantReach    bool
+		wantBlocking []string
+	}{
+		{
+			name:      "allowed by group reference",
+			protocol:  "tcp",
+			port:      443,
+			wantReach: true,
+		},
+		{
+			name:         "port not allowed by destination security group",
+			protocol:     "tcp",
+			port:         22,
+			wantBlocking: []string{ec2utils.ReachabilitySecurityGroupIngress},
+		},
+		{
+			name: "denied by lower-numbered destination ACL rule",
+			modify: func(_, dst *ec2utils.ReachabilityEndpoint) {
+				dst.NetworkACL.Entries = append(dst.NetworkACL.Entries, aclEntry(50, false, "deny", "6", 443, 443))
+			},
+			protocol:     "tcp",
+			port:         443,
+			wantBlocking: []string{ec2utils.ReachabilityNetworkACLInbound},
+		},
+		{
+			name: "return traffic blocked by source ACL",
+			modify: func(src, _ *ec2utils.ReachabilityEndpoint) {
+				src.NetworkACL.Entries = []*ec2.NetworkAclEntry{
+					aclEntry(100, false, "allow", "6", 22, 22),
+					aclEntry(100, true, "allow", "-1", 0, 0),
+				}
+			},
+			protocol:     "tcp",
+			port:         443,
+			wantBlocking: []string{ec2utils.ReachabilityReturnACLInbound},
+		},
+		{
+			name: "same subnet skips network ACLs",
+			modify: func(src, dst *ec2utils.ReachabilityEndpoint) {
+				dst.SubnetID = src.SubnetID
+				dst.NetworkACL.Entries = nil
+			},
+			protocol:  "tcp",
+			port:      443,
+			wantReach: true,
+		},
+		{
+			name: "no route to a different VPC",
+			modify: func(_, dst *ec2utils.ReachabilityEndpoint) {
+				dst.VPCID = "vpc-2"
+				dst.PrivateIP = "172.16.0.5"
+			},
+			protocol:     "tcp",
+			port:         443,
+			wantBlocking: []string{ec2utils.ReachabilityRoute, ec2utils.ReachabilityReturnRoute},
+		},
+		{
+			name: "peered VPCs",
+			modify: func(src, dst *ec2utils.ReachabilityEndpoint) {
+				dst.VPCID = "vpc-2"
+				dst.PrivateIP = "172.16.0.5"
+				dst.RouteTable.Routes[0].DestinationCidrBlock = aws.String("172.16.0.0/16")
+				src.RouteTable.Routes = append(src.RouteTable.Routes, &ec2.Route{
+					DestinationCidrBlock:   aws.String("172.16.0.0/16"),
+					VpcPeeringConnectionId: aws.String("pcx-1"),
+					State:                  aws.String("active"),
+				})
+				dst.RouteTable.Routes = append(dst.RouteTable.Routes, &ec2.Route{
+					DestinationCidrBlock:   aws.String("10.0.0.0/16"),
+					VpcPeeringConnectionId: aws.String("pcx-1"),
+					State:                  aws.String("active"),
+				})
+			},
+			protocol:  "tcp",
+			port:      443,
+			wantReach: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src, dst := reachabilityFixture()
+			if tc.modify != nil {
+				tc.modify(&src, &dst)
+			}
+
+			result, err := ec2utils.EvaluateReachability(src, dst, tc.protocol, tc.port)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantReach, result.Reachable)
+
+			var blocking []string
+			for _, step := range result.Blocking() {
+				assert.NotEmpty(t, step.Reason)
+				blocking = append(blocking, step.Component)
+			}
+			assert.Equal(t, tc.wantBlocking, blocking)
+		})
+	}
+}
+
+func TestEvaluateReachabilityExplainsRule(t *testing.T) {
+	src, dst := reachabilityFixture()
+	dst.NetworkACL.Entries = append(dst.NetworkACL.Entries, aclEntry(50, false, "deny", "6", 443, 443))
+
+	result, err := ec2utils.EvaluateReachability(src, dst, "tcp", 443)
+	require.NoError(t, err)
+
+	blocking := result.Blocking()
+	require.Len(t, blocking, 1)
+	assert.Equal(t, "acl-b", blocking[0].ResourceID)
+	assert.Contains(t, blocking[0].Reason, "rule 50 of acl-b")
+
+	for _, step := range result.Steps {
+		if step.Component == ec2utils.ReachabilitySecurityGroupIngress {
+			assert.Contains(t, step.Reason, "members of sg-src")
+		}
+	}
+}
+
+func TestEvaluateReachabilityInvalidProtocol(t *testing.T) {
+	src, dst := reachabilityFixture()
+	_, err := ec2utils.EvaluateReachability(src, dst, "sctp-ish", 443)
+	assert.Error(t, err)
+}
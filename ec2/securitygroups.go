@@ -0,0 +1,326 @@
+package ec2
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// eniPollInterval is how often detaching network
+// interfaces are polled while waiting for them.
+const eniPollInterval = 10 * time.Second
+
+// ForceDestroyOptions provides options for
+// ForceDestroySecurityGroup.
+//
+// **Attributes:**
+//
+// ENIWaitTimeout: how long to wait for network interfaces that cannot be
+// modified (e.g. requester-managed ones) to be detached and deleted. If
+// zero, such interfaces cause an error instead.
+// MoveToDefaultGroup: whether network interfaces that only use the group
+// are moved to the VPC's default security group. This changes the network
+// exposure of the instances using them, so such interfaces cause an error
+// unless it is set.
+type ForceDestroyOptions struct {
+	ENIWaitTimeout     time.Duration
+	MoveToDefaultGroup bool
+}
+
+// SecurityGroupChange describes a change made while
+// removing the references to a security group.
+//
+// **Attributes:**
+//
+// Action: the kind of change (revoke-ingress, revoke-egress,
+// modify-eni, wait-eni or delete-group)
+// ResourceID: the ID of the security group or network interface changed
+// Detail: a description of the change
+type SecurityGroupChange struct {
+	Action     string
+	ResourceID string
+	Detail     string
+}
+
+// ForceDestroySecurityGroup destroys the security group with the provided
+// ID after removing everything that references it: rules in other
+// security groups are revoked and the group is removed from network
+// interfaces. A network interface that only uses the group is an error,
+// checked before any change is made, unless opts.MoveToDefaultGroup is
+// set, in which case it is moved to the VPC's default security group.
+// Every change made is reported, including when an error stops the
+// process partway.
+//
+// **Parameters:**
+//
+// groupID: the ID of the security group to destroy
+//
+// opts: the options to use
+//
+// **Returns:**
+//
+// []SecurityGroupChange: the changes made
+//
+// error: an error if any issue occurs while trying to destroy the security group
+func (c *Connection) ForceDestroySecurityGroup(groupID string, opts ForceDestroyOptions) ([]SecurityGroupChange, error) {
+	var groups []*ec2.SecurityGroup
+	if err := c.Client.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{},
+		func(page *ec2.DescribeSecurityGroupsOutput, _ bool) bool {
+			groups = append(groups, page.SecurityGroups...)
+			return true
+		}); err != nil {
+		return nil, fmt.Errorf("error describing security groups: %v", err)
+	}
+
+	var target *ec2.SecurityGroup
+	for _, group := range groups {
+		if aws.StringValue(group.GroupId) == groupID {
+			target = group
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("security group %s does not exist", groupID)
+	}
+
+	enis, err := c.describeGroupENIs(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultID string
+	if soleUsers := soleGroupENIs(enis, groupID); len(soleUsers) > 0 {
+		if !opts.MoveToDefaultGroup {
+			return nil, fmt.Errorf("network interfaces %v only use security group %s, set MoveToDefaultGroup to move them to the default security group", soleUsers, groupID)
+		}
+		defaultID = defaultSecurityGroupID(groups, aws.StringValue(target.VpcId))
+		if defaultID == "" || defaultID == groupID {
+			return nil, fmt.Errorf("network interfaces %v only use %s and no default security group is available", soleUsers, groupID)
+		}
+	}
+
+	changes, err := c.revokeGroupReferences(groupID, groups)
+	if err != nil {
+		return changes, err
+	}
+
+	eniChanges, err := c.removeGroupFromENIs(groupID, enis, defaultID, opts)
+	changes = append(changes, eniChanges...)
+	if err != nil {
+		return changes, err
+	}
+
+	if err := c.DestroySecurityGroup(groupID); err != nil {
+		return changes, fmt.Errorf("error deleting security group %s: %v", groupID, err)
+	}
+	changes = append(changes, SecurityGroupChange{
+		Action:     "delete-group",
+		ResourceID: groupID,
+		Detail:     fmt.Sprintf("deleted security group %s", groupID),
+	})
+
+	return changes, nil
+}
+
+// revokeGroupReferences revokes every rule in other security
+// groups that references groupID.
+func (c *Connection) revokeGroupReferences(groupID string, groups []*ec2.SecurityGroup) ([]SecurityGroupChange, error) {
+	var changes []SecurityGroupChange
+	for _, group := range groups {
+		otherID := aws.StringValue(group.GroupId)
+		if otherID == groupID {
+			continue
+		}
+
+		if ingress := permissionsReferencing(group.IpPermissions, groupID); len(ingress) > 0 {
+			if _, err := c.Client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String(otherID),
+				IpPermissions: ingress,
+			}); err != nil {
+				return changes, fmt.Errorf("error revoking ingress rules of %s: %v", otherID, err)
+			}
+			changes = append(changes, SecurityGroupChange{
+				Action:     "revoke-ingress",
+				ResourceID: otherID,
+				Detail:     fmt.Sprintf("revoked %d ingress rule(s) referencing %s", len(ingress), groupID),
+			})
+		}
+
+		if egress := permissionsReferencing(group.IpPermissionsEgress, groupID); len(egress) > 0 {
+			if _, err := c.Client.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+				GroupId:       aws.String(otherID),
+				IpPermissions: egress,
+			}); err != nil {
+				return changes, fmt.Errorf("error revoking egress rules of %s: %v", otherID, err)
+			}
+			changes = append(changes, SecurityGroupChange{
+				Action:     "revoke-egress",
+				ResourceID: otherID,
+				Detail:     fmt.Sprintf("revoked %d egress rule(s) referencing %s", len(egress), groupID),
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// removeGroupFromENIs removes the group from the provided network
+// interfaces, moving the ones that only use it to defaultID and
+// waiting for the ones that cannot be modified.
+func (c *Connection) removeGroupFromENIs(groupID string, enis []*ec2.NetworkInterface, defaultID string, opts ForceDestroyOptions) ([]SecurityGroupChange, error) {
+	var changes []SecurityGroupChange
+	var waitFor []string
+	for _, eni := range enis {
+		eniID := aws.StringValue(eni.NetworkInterfaceId)
+		if aws.BoolValue(eni.RequesterManaged) {
+			waitFor = append(waitFor, eniID)
+			continue
+		}
+
+		remaining := otherGroupIDs(eni, groupID)
+		if len(remaining) == 0 {
+			remaining = []string{defaultID}
+		}
+
+		if _, err := c.Client.ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: aws.String(eniID),
+			Groups:             aws.StringSlice(remaining),
+		}); err != nil {
+			return changes, fmt.Errorf("error updating security groups of %s: %v", eniID, err)
+		}
+		changes = append(changes, SecurityGroupChange{
+			Action:     "modify-eni",
+			ResourceID: eniID,
+			Detail:     fmt.Sprintf("replaced %s with %v", groupID, remaining),
+		})
+	}
+
+	if len(waitFor) == 0 {
+		return changes, nil
+	}
+
+	if opts.ENIWaitTimeout == 0 {
+		return changes, fmt.Errorf("security group %s is used by requester-managed network interfaces %v", groupID, waitFor)
+	}
+
+	if err := c.waitForENIsDeleted(waitFor, opts.ENIWaitTimeout); err != nil {
+		return changes, err
+	}
+	for _, eniID := range waitFor {
+		changes = append(changes, SecurityGroupChange{
+			Action:     "wait-eni",
+			ResourceID: eniID,
+			Detail:     "waited for requester-managed network interface to be deleted",
+		})
+	}
+
+	return changes, nil
+}
+
+func (c *Connection) describeGroupENIs(groupID string) ([]*ec2.NetworkInterface, error) {
+	var enis []*ec2.NetworkInterface
+	if err := c.Client.DescribeNetworkInterfacesPages(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("group-id"),
+				Values: []*string{aws.String(groupID)},
+			},
+		},
+	}, func(page *ec2.DescribeNetworkInterfacesOutput, _ bool) bool {
+		enis = append(enis, page.NetworkInterfaces...)
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("error describing network interfaces using %s: %v", groupID, err)
+	}
+
+	return enis, nil
+}
+
+func (c *Connection) waitForENIsDeleted(eniIDs []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := c.Client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String("network-interface-id"),
+					Values: aws.StringSlice(eniIDs),
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error describing network interfaces: %v", err)
+		}
+
+		if len(result.NetworkInterfaces) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for network interfaces %v to be deleted", eniIDs)
+		}
+
+		time.Sleep(eniPollInterval)
+	}
+}
+
+// permissionsReferencing returns the permissions, reduced to their
+// group pairs, that reference the provided security group.
+func permissionsReferencing(permissions []*ec2.IpPermission, groupID string) []*ec2.IpPermission {
+	var matched []*ec2.IpPermission
+	for _, permission := range permissions {
+		var pairs []*ec2.UserIdGroupPair
+		for _, pair := range permission.UserIdGroupPairs {
+			if aws.StringValue(pair.GroupId) == groupID {
+				pairs = append(pairs, pair)
+			}
+		}
+
+		if len(pairs) > 0 {
+			matched = append(matched, &ec2.IpPermission{
+				IpProtocol:       permission.IpProtocol,
+				FromPort:         permission.FromPort,
+				ToPort:           permission.ToPort,
+				UserIdGroupPairs: pairs,
+			})
+		}
+	}
+
+	return matched
+}
+
+// soleGroupENIs returns the IDs of the modifiable network
+// interfaces that use no security group other than groupID.
+func soleGroupENIs(enis []*ec2.NetworkInterface, groupID string) []string {
+	var ids []string
+	for _, eni := range enis {
+		if !aws.BoolValue(eni.RequesterManaged) && len(otherGroupIDs(eni, groupID)) == 0 {
+			ids = append(ids, aws.StringValue(eni.NetworkInterfaceId))
+		}
+	}
+
+	return ids
+}
+
+// otherGroupIDs returns the security groups of the
+// network interface other than groupID.
+func otherGroupIDs(eni *ec2.NetworkInterface, groupID string) []string {
+	var ids []string
+	for _, group := range eni.Groups {
+		if id := aws.StringValue(group.GroupId); id != groupID {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func defaultSecurityGroupID(groups []*ec2.SecurityGroup, vpcID string) string {
+	for _, group := range groups {
+		if aws.StringValue(group.GroupName) == "default" && aws.StringValue(group.VpcId) == vpcID {
+			return aws.StringValue(group.GroupId)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,104 @@
+package ec2_test
+
+import (
+	"testing"
+
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecurityGroups = `<securityGroupInfo>
+  <item><groupId>sg-target</groupId><groupName>app</groupName><vpcId>vpc-1</vpcId></item>
+  <item><groupId>sg-default</groupId><groupName>default</groupName><vpcId>vpc-1</vpcId></item>
+  <item>
+    <groupId>sg-other</groupId><groupName>db</groupName><vpcId>vpc-1</vpcId>
+    <ipPermissions>
+      <item>
+        <ipProtocol>tcp</ipProtocol><fromPort>5432</fromPort><toPort>5432</toPort>
+        <groups><item><groupId>sg-target</groupId></item></groups>
+        <ipRanges><item><cidrIp>10.0.0.0/16</cidrIp></item></ipRanges>
+      </item>
+    </ipPermissions>
+  </item>
+</securityGroupInfo>`
+
+func TestForceDestroySecurityGroup(t *testing.T) {
+	responses := map[string]string{
+		"DescribeSecurityGroups": testSecurityGroups,
+		"DescribeNetworkInterfaces": `<networkInterfaceSet>
+		  <item><networkInterfaceId>eni-shared</networkInterfaceId>
+		    <groupSet><item><groupId>sg-target</groupId></item><item><groupId>sg-other</groupId></item></groupSet></item>
+		  <item><networkInterfaceId>eni-only</networkInterfaceId>
+		    <groupSet><item><groupId>sg-target</groupId></item></groupSet></item>
+		</networkInterfaceSet>`,
+		"RevokeSecurityGroupIngress":      "<return>true</return>",
+		"ModifyNetworkInterfaceAttribute": "<return>true</return>",
+		"DeleteSecurityGroup":             "<return>true</return>",
+	}
+
+	t.Run("interface only using the group", func(t *testing.T) {
+		c, fake := startFakeEC2(t, responses, nil)
+
+		// Nothing is changed unless moving to the default group is allowed.
+		changes, err := c.ForceDestroySecurityGroup("sg-target", ec2utils.ForceDestroyOptions{})
+		assert.ErrorContains(t, err, "[eni-only] only use security group sg-target")
+		assert.Empty(t, changes)
+		assert.Empty(t, fake.requestsFor("RevokeSecurityGroupIngress"))
+		assert.Empty(t, fake.requestsFor("ModifyNetworkInterfaceAttribute"))
+		assert.Empty(t, fake.requestsFor("DeleteSecurityGroup"))
+	})
+
+	t.Run("revokes references and moves network interfaces", func(t *testing.T) {
+		c, fake := startFakeEC2(t, responses, nil)
+
+		changes, err := c.ForceDestroySecurityGroup("sg-target", ec2utils.ForceDestroyOptions{MoveToDefaultGroup: true})
+		require.NoError(t, err)
+
+		var actions []string
+		for _, change := range changes {
+			actions = append(actions, change.Action+" "+change.ResourceID)
+		}
+		assert.Equal(t, []string{
+			"revoke-ingress sg-other",
+			"modify-eni eni-shared",
+			"modify-eni eni-only",
+			"delete-group sg-target",
+		}, actions)
+
+		revokes := fake.requestsFor("RevokeSecurityGroupIngress")
+		require.Len(t, revokes, 1)
+		assert.Equal(t, "sg-other", revokes[0].Get("GroupId"))
+		assert.Equal(t, "sg-target", revokes[0].Get("IpPermissions.1.Groups.1.GroupId"))
+		assert.Empty(t, revokes[0].Get("IpPermissions.1.IpRanges.1.CidrIp"))
+
+		modifies := fake.requestsFor("ModifyNetworkInterfaceAttribute")
+		require.Len(t, modifies, 2)
+		assert.Equal(t, "sg-other", modifies[0].Get("SecurityGroupId.1"))
+		assert.Equal(t, "sg-default", modifies[1].Get("SecurityGroupId.1"))
+
+		assert.Len(t, fake.requestsFor("DeleteSecurityGroup"), 1)
+	})
+
+	t.Run("requester-managed interface without waiting", func(t *testing.T) {
+		c, fake := startFakeEC2(t, map[string]string{
+			"DescribeSecurityGroups": testSecurityGroups,
+			"DescribeNetworkInterfaces": `<networkInterfaceSet>
+			  <item><networkInterfaceId>eni-lambda</networkInterfaceId><requesterManaged>true</requesterManaged>
+			    <groupSet><item><groupId>sg-target</groupId></item></groupSet></item>
+			</networkInterfaceSet>`,
+			"RevokeSecurityGroupIngress": "<return>true</return>",
+		}, nil)
+
+		changes, err := c.ForceDestroySecurityGroup("sg-target", ec2utils.ForceDestroyOptions{})
+		assert.Error(t, err)
+		assert.Len(t, changes, 1)
+		assert.Empty(t, fake.requestsFor("DeleteSecurityGroup"))
+	})
+
+	t.Run("missing group", func(t *testing.T) {
+		c := newFakeEC2Connection(t, map[string]string{"DescribeSecurityGroups": testSecurityGroups}, nil)
+		_, err := c.ForceDestroySecurityGroup("sg-missing", ec2utils.ForceDestroyOptions{})
+		assert.Error(t, err)
+	})
+}
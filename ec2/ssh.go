@@ -0,0 +1,353 @@
+package ec2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultSSHPort    = 22
+	defaultSSHTimeout = 5 * time.Minute
+)
+
+// SSHParams provides information used to
+// connect to an EC2 instance over SSH.
+//
+// **Attributes:**
+//
+// User: the user to authenticate as
+// PrivateKey: the PEM encoded private key to authenticate with
+// Port: the SSH port, defaults to 22
+// UsePrivateIP: whether to connect to the private IP address instead of the public one
+// Timeout: how long to wait for the SSH port to open, defaults to 5 minutes
+// HostKeyCallback: the callback used to verify the host key, required unless InsecureSkipHostKeyCheck is set
+// InsecureSkipHostKeyCheck: whether to accept any host key when HostKeyCallback is not set,
+// such as for a freshly launched instance whose host key is not known yet
+type SSHParams struct {
+	User                     string
+	PrivateKey               []byte
+	Port                     int
+	UsePrivateIP             bool
+	Timeout                  time.Duration
+	HostKeyCallback          ssh.HostKeyCallback
+	InsecureSkipHostKeyCheck bool
+}
+
+// SSHClient provides an SSH connection
+// to an EC2 instance.
+//
+// **Attributes:**
+//
+// Client: the underlying SSH client
+type SSHClient struct {
+	Client *ssh.Client
+}
+
+// GetInstanceAddress retrieves the IP address of the instance
+// with the provided ID.
+//
+// **Parameters:**
+//
+// instanceID: the ID of the instance to use
+//
+// private: whether to return the private IP address instead of the public one
+//
+// **Returns:**
+//
+// string: the IP address of the instance
+//
+// error: an error if any issue occurs while trying to retrieve the IP address
+func (c *Connection) GetInstanceAddress(instanceID string, private bool) (string, error) {
+	input := &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	}
+
+	result, err := c.Client.DescribeInstances(input)
+	if err != nil {
+		return "", err
+	}
+
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return "", fmt.Errorf("instance %s does not exist", instanceID)
+	}
+
+	instance := result.Reservations[0].Instances[0]
+	address := aws.StringValue(instance.PublicIpAddress)
+	if private {
+		address = aws.StringValue(instance.PrivateIpAddress)
+	}
+
+	if address == "" {
+		return "", fmt.Errorf("instance %s has no address to connect to", instanceID)
+	}
+
+	return address, nil
+}
+
+// WaitForPort waits until a TCP connection can be
+// established to the provided address.
+//
+// **Parameters:**
+//
+// address: the host:port to connect to
+//
+// timeout: how long to wait before giving up
+//
+// **Returns:**
+//
+// error: an error if the port does not open before the timeout
+func WaitForPort(address string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+		if err == nil {
+			return conn.Close()
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s: %v", address, err)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+// ConnectSSH resolves the address of the instance with the provided ID,
+// waits for its SSH port to open and establishes an SSH connection.
+//
+// **Parameters:**
+//
+// instanceID: the ID of the instance to connect to
+//
+// params: the parameters to use for the connection
+//
+// **Returns:**
+//
+// *SSHClient: the SSH connection to the instance
+//
+// error: an error if any issue occurs while trying to connect to the instance
+func (c *Connection) ConnectSSH(instanceID string, params SSHParams) (*SSHClient, error) {
+	address, err := c.GetInstanceAddress(instanceID, params.UsePrivateIP)
+	if err != nil {
+		return nil, err
+	}
+
+	port := params.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+
+	return NewSSHClient(net.JoinHostPort(address, strconv.Itoa(port)), params)
+}
+
+// NewSSHClient waits for the provided address to accept
+// connections and establishes an SSH connection to it.
+//
+// **Parameters:**
+//
+// address: the host:port to connect to
+//
+// params: the parameters to use for the connection
+//
+// **Returns:**
+//
+// *SSHClient: the SSH connection
+//
+// error: an error if any issue occurs while trying to connect
+func NewSSHClient(address string, params SSHParams) (*SSHClient, error) {
+	hostKeyCallback, err := params.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(params.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %v", err)
+	}
+
+	timeout := params.Timeout
+	if timeout == 0 {
+		timeout = defaultSSHTimeout
+	}
+
+	if err := WaitForPort(address, timeout); err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            params.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}
+
+	client, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", address, err)
+	}
+
+	return &SSHClient{Client: client}, nil
+}
+
+// hostKeyCallback returns the callback used to verify the host key,
+// which accepts any host key only if that was explicitly requested.
+func (p SSHParams) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if p.HostKeyCallback != nil {
+		return p.HostKeyCallback, nil
+	}
+	if !p.InsecureSkipHostKeyCheck {
+		return nil, errors.New("a HostKeyCallback is required to verify the host key, or set InsecureSkipHostKeyCheck to accept any host key")
+	}
+
+	return ssh.InsecureIgnoreHostKey(), nil // #nosec G106 -- explicitly requested
+}
+
+// RunCommand runs the provided command on the remote host.
+//
+// **Parameters:**
+//
+// cmd: the command to run
+//
+// **Returns:**
+//
+// string: the combined stdout and stderr of the command
+//
+// error: an error if the command could not be run or exited non-zero
+func (s *SSHClient) RunCommand(cmd string) (string, error) {
+	session, err := s.Client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("error creating ssh session: %v", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(cmd)
+	if err != nil {
+		return string(output), fmt.Errorf("error running %q: %v", cmd, err)
+	}
+
+	return string(output), nil
+}
+
+// CopyFile copies the local file at localPath to remotePath
+// on the remote host using the scp protocol.
+//
+// **Parameters:**
+//
+// localPath: the path of the local file to copy
+//
+// remotePath: the destination path on the remote host
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to copy the file
+func (s *SSHClient) CopyFile(localPath, remotePath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	session, err := s.Client.NewSession()
+	if err != nil {
+		return fmt.Errorf("error creating ssh session: %v", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := session.Start("scp -t " + shellQuote(remotePath)); err != nil {
+		return fmt.Errorf("error starting scp: %v", err)
+	}
+
+	if err := scpSend(stdin, bufio.NewReader(stdout), file, info.Size(), info.Mode().Perm(), path.Base(remotePath)); err != nil {
+		return fmt.Errorf("error copying %s to %s: %v", localPath, remotePath, err)
+	}
+
+	return session.Wait()
+}
+
+// Close closes the SSH connection.
+//
+// **Returns:**
+//
+// error: an error if the connection could not be closed
+func (s *SSHClient) Close() error {
+	return s.Client.Close()
+}
+
+// scpSend implements the source side of the scp protocol for a single file.
+func scpSend(w io.WriteCloser, r *bufio.Reader, content io.Reader, size int64, mode os.FileMode, name string) error {
+	if err := scpAck(r); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", mode, size, name); err != nil {
+		return err
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+
+	// Exactly the announced number of bytes must follow the header.
+	if _, err := io.CopyN(w, content, size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("content is shorter than the announced %d bytes", size)
+		}
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func scpAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	if code == 0 {
+		return nil
+	}
+
+	msg, _ := r.ReadString('\n')
+	if msg == "" {
+		return errors.New("scp returned an unknown error")
+	}
+
+	return fmt.Errorf("scp: %s", msg)
+}
+
+// shellQuote quotes s for safe use as a single POSIX shell argument.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,384 @@
+package ec2_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer is a minimal in-process SSH server that
+// supports exec requests for echo and scp sink commands.
+type testSSHServer struct {
+	listener net.Listener
+	hostKey  ssh.PublicKey
+	mu       sync.Mutex
+	files    map[string][]byte
+	allowed  [][]byte
+}
+
+// newTestSSHServer starts a test SSH server that accepts the provided
+// authorized key, or no key until authorize is called if it is nil.
+func newTestSSHServer(t *testing.T, authorizedKey []byte) *testSSHServer {
+	t.Helper()
+
+	srv := &testSSHServer{files: map[string][]byte{}}
+	if authorizedKey != nil {
+		require.NoError(t, srv.authorize(authorizedKey))
+	}
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			for _, allowed := range srv.allowed {
+				if bytes.Equal(key.Marshal(), allowed) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown public key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv.listener = listener
+	srv.hostKey = hostSigner.PublicKey()
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn, config)
+		}
+	}()
+
+	return srv
+}
+
+// authorize adds a key in authorized_keys format to the accepted keys.
+func (s *testSSHServer) authorize(authorizedKey []byte) error {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(authorizedKey)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowed = append(s.allowed, key.Marshal())
+	return nil
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			_ = newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleSession(ch, chReqs)
+	}
+}
+
+func (s *testSSHServer) handleSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+
+		cmd := string(req.Payload[4:])
+		status := uint32(0)
+		switch {
+		case strings.HasPrefix(cmd, "echo "):
+			fmt.Fprintln(ch, strings.TrimPrefix(cmd, "echo "))
+		case strings.HasPrefix(cmd, "scp -t "):
+			target := strings.Trim(strings.TrimPrefix(cmd, "scp -t "), "'")
+			if err := s.scpSink(ch, target); err != nil {
+				status = 1
+			}
+		default:
+			fmt.Fprintln(ch.Stderr(), "command not found")
+			status = 127
+		}
+
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, status)
+		_, _ = ch.SendRequest("exit-status", false, payload)
+		return
+	}
+}
+
+func (s *testSSHServer) scpSink(ch ssh.Channel, target string) error {
+	r := bufio.NewReader(ch)
+	if _, err := ch.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	var mode, name string
+	var size int64
+	if _, err := fmt.Sscanf(header, "C%s %d %s", &mode, &size, &name); err != nil {
+		return err
+	}
+	if _, err := ch.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	content := make([]byte, size)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return err
+	}
+	if _, err := r.ReadByte(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.files[target] = content
+	s.mu.Unlock()
+
+	if _, err := ch.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	// Like scp, wait for the source to close its end.
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+func TestGenerateKeyPair(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType string
+		wantErr bool
+	}{
+		{
+			name:    "ed25519 key",
+			keyType: ec2utils.KeyTypeED25519,
+		},
+		{
+			name:    "rsa key",
+			keyType: ec2utils.KeyTypeRSA,
+		},
+		{
+			name:    "unsupported key",
+			keyType: "dsa",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			priv, pub, err := ec2utils.GenerateKeyPair(tc.keyType)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			signer, err := ssh.ParsePrivateKey(priv)
+			require.NoError(t, err)
+			parsedPub, _, _, _, err := ssh.ParseAuthorizedKey(pub)
+			require.NoError(t, err)
+			assert.Equal(t, parsedPub.Marshal(), signer.PublicKey().Marshal())
+		})
+	}
+}
+
+func TestSSHClient(t *testing.T) {
+	priv, pub, err := ec2utils.GenerateKeyPair(ec2utils.KeyTypeED25519)
+	require.NoError(t, err)
+
+	srv := newTestSSHServer(t, pub)
+
+	client, err := ec2utils.NewSSHClient(srv.listener.Addr().String(), ec2utils.SSHParams{
+		User:            "ubuntu",
+		PrivateKey:      priv,
+		Timeout:         5 * time.Second,
+		HostKeyCallback: ssh.FixedHostKey(srv.hostKey),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	t.Run("run command", func(t *testing.T) {
+		out, err := client.RunCommand("echo hello")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello\n", out)
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		_, err := client.RunCommand("false")
+		assert.Error(t, err)
+	})
+
+	t.Run("copy file", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "payload.txt")
+		require.NoError(t, os.WriteFile(localPath, []byte("payload"), 0600))
+
+		require.NoError(t, client.CopyFile(localPath, "/tmp/payload.txt"))
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.Equal(t, []byte("payload"), srv.files["/tmp/payload.txt"])
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		otherPriv, _, err := ec2utils.GenerateKeyPair(ec2utils.KeyTypeED25519)
+		require.NoError(t, err)
+
+		_, err = ec2utils.NewSSHClient(srv.listener.Addr().String(), ec2utils.SSHParams{
+			User:                     "ubuntu",
+			PrivateKey:               otherPriv,
+			Timeout:                  time.Second,
+			InsecureSkipHostKeyCheck: true,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("host key verification", func(t *testing.T) {
+		_, err := ec2utils.NewSSHClient(srv.listener.Addr().String(), ec2utils.SSHParams{
+			User:       "ubuntu",
+			PrivateKey: priv,
+			Timeout:    time.Second,
+		})
+		assert.ErrorContains(t, err, "HostKeyCallback is required")
+
+		otherHost, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		otherKey, err := ssh.NewPublicKey(otherHost)
+		require.NoError(t, err)
+		_, err = ec2utils.NewSSHClient(srv.listener.Addr().String(), ec2utils.SSHParams{
+			User:            "ubuntu",
+			PrivateKey:      priv,
+			Timeout:         time.Second,
+			HostKeyCallback: ssh.FixedHostKey(otherKey),
+		})
+		assert.Error(t, err)
+
+		insecure, err := ec2utils.NewSSHClient(srv.listener.Addr().String(), ec2utils.SSHParams{
+			User:                     "ubuntu",
+			PrivateKey:               priv,
+			Timeout:                  time.Second,
+			InsecureSkipHostKeyCheck: true,
+		})
+		require.NoError(t, err)
+		assert.NoError(t, insecure.Close())
+	})
+}
+
+func TestConnectSSH(t *testing.T) {
+	priv, pub, err := ec2utils.GenerateKeyPair(ec2utils.KeyTypeED25519)
+	require.NoError(t, err)
+	srv := newTestSSHServer(t, pub)
+	_, port, err := net.SplitHostPort(srv.listener.Addr().String())
+	require.NoError(t, err)
+	sshPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	c, fake := startFakeEC2(t, map[string]string{
+		"DescribeInstances": `<reservationSet><item><instancesSet><item>
+<instanceId>i-web</instanceId><ipAddress>127.0.0.1</ipAddress><privateIpAddress>10.0.0.10</privateIpAddress>
+</item></instancesSet></item></reservationSet>`,
+	}, nil)
+
+	address, err := c.GetInstanceAddress("i-web", true)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.10", address)
+	assert.Equal(t, "i-web", fake.requestsFor("DescribeInstances")[0].Get("InstanceId.1"))
+
+	client, err := c.ConnectSSH("i-web", ec2utils.SSHParams{
+		User:            "ubuntu",
+		PrivateKey:      priv,
+		Port:            sshPort,
+		Timeout:         5 * time.Second,
+		HostKeyCallback: ssh.FixedHostKey(srv.hostKey),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	out, err := client.RunCommand("echo connected")
+	require.NoError(t, err)
+	assert.Equal(t, "connected\n", out)
+}
+
+func TestGetInstanceAddressErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  string
+	}{
+		{
+			name:     "unknown instance",
+			response: "<reservationSet/>",
+			wantErr:  "does not exist",
+		},
+		{
+			name:     "no public address",
+			response: "<reservationSet><item><instancesSet><item><instanceId>i-web</instanceId></item></instancesSet></item></reservationSet>",
+			wantErr:  "has no address",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newFakeEC2Connection(t, map[string]string{"DescribeInstances": tc.response}, nil)
+
+			_, err := c.GetInstanceAddress("i-web", false)
+			assert.ErrorContains(t, err, tc.wantErr)
+
+			_, err = c.ConnectSSH("i-web", ec2utils.SSHParams{InsecureSkipHostKeyCheck: true})
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestWaitForPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+
+	assert.NoError(t, ec2utils.WaitForPort(addr, time.Second))
+
+	listener.Close()
+	assert.Error(t, ec2utils.WaitForPort(addr, time.Second))
+}
@@ -0,0 +1,496 @@
+package ec2
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// maxTagResources is the maximum number of resources
+// accepted by a single CreateTags or DeleteTags call.
+const maxTagResources = 1000
+
+// maxFilterValues is the maximum number of values
+// accepted by a single DescribeInstances filter.
+const maxFilterValues = 200
+
+// Resource types supported by the tag policy checker.
+const (
+	ResourceTypeInstance         = "instance"
+	ResourceTypeVolume           = "volume"
+	ResourceTypeSnapshot         = "snapshot"
+	ResourceTypeSecurityGroup    = "security-group"
+	ResourceTypeSubnet           = "subnet"
+	ResourceTypeVPC              = "vpc"
+	ResourceTypeNetworkInterface = "network-interface"
+)
+
+// TagRule describes a tag that resources must carry.
+//
+// **Attributes:**
+//
+// Key: the tag key that is required
+// Pattern: an optional regular expression the tag value must match
+// AllowedValues: an optional list of values the tag value must be one of
+type TagRule struct {
+	Key           string
+	Pattern       string
+	AllowedValues []string
+}
+
+// TagPolicy describes the tags required on EC2 resources.
+//
+// **Attributes:**
+//
+// Rules: the tag rules every resource must satisfy
+// ResourceTypes: the resource types to check, defaults to all supported types
+// Remediate: whether to propagate instance tags to attached volumes and
+// network interfaces before checking
+type TagPolicy struct {
+	Rules         []TagRule
+	ResourceTypes []string
+	Remediate     bool
+}
+
+// TagViolation describes a resource that does not
+// satisfy a tag rule.
+//
+// **Attributes:**
+//
+// ResourceID: the ID of the offending resource
+// ResourceType: the type of the offending resource
+// Key: the tag key of the rule that was violated
+// Value: the offending tag value, empty if the tag is missing
+// Reason: a description of the violation
+type TagViolation struct {
+	ResourceID   string
+	ResourceType string
+	Key          string
+	Value        string
+	Reason       string
+}
+
+// TagResources applies the provided tags to every resource
+// in resourceIDs. Any EC2 resource ID can be used.
+//
+// **Parameters:**
+//
+// resourceIDs: the IDs of the resources to tag
+//
+// tags: the tags to apply
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to tag the resources
+func (c *Connection) TagResources(resourceIDs []string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	for _, batch := range batchIDs(resourceIDs, maxTagResources) {
+		input := &ec2.CreateTagsInput{
+			Resources: aws.StringSlice(batch),
+			Tags:      mapToTags(tags),
+		}
+
+		if _, err := c.Client.CreateTags(input); err != nil {
+			return fmt.Errorf("error tagging resources: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// UntagResources removes the tags with the provided keys
+// from every resource in resourceIDs.
+//
+// **Parameters:**
+//
+// resourceIDs: the IDs of the resources to untag
+//
+// tagKeys: the keys of the tags to remove
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to untag the resources
+func (c *Connection) UntagResources(resourceIDs []string, tagKeys []string) error {
+	if len(tagKeys) == 0 {
+		return nil
+	}
+
+	tags := make([]*ec2.Tag, 0, len(tagKeys))
+	for _, key := range tagKeys {
+		tags = append(tags, &ec2.Tag{Key: aws.String(key)})
+	}
+
+	for _, batch := range batchIDs(resourceIDs, maxTagResources) {
+		input := &ec2.DeleteTagsInput{
+			Resources: aws.StringSlice(batch),
+			Tags:      tags,
+		}
+
+		if _, err := c.Client.DeleteTags(input); err != nil {
+			return fmt.Errorf("error untagging resources: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate checks the provided resource tags against the
+// policy rules.
+//
+// **Parameters:**
+//
+// resourceID: the ID of the resource being checked
+//
+// resourceType: the type of the resource being checked
+//
+// tags: the tags of the resource
+//
+// **Returns:**
+//
+// []TagViolation: the rules the resource violates
+//
+// error: an error if a rule contains an invalid pattern
+func (p TagPolicy) Evaluate(resourceID, resourceType string, tags map[string]string) ([]TagViolation, error) {
+	patterns, err := p.compilePatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.evaluate(resourceID, resourceType, tags, patterns), nil
+}
+
+// compilePatterns compiles the patterns of the policy rules, indexed
+// like the rules, with nil for rules without a pattern.
+func (p TagPolicy) compilePatterns() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, len(p.Rules))
+	for i, rule := range p.Rules {
+		if rule.Pattern == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for tag %s: %v", rule.Key, err)
+		}
+		patterns[i] = re
+	}
+
+	return patterns, nil
+}
+
+// evaluate checks resource tags against the policy rules
+// using the patterns returned by compilePatterns.
+func (p TagPolicy) evaluate(resourceID, resourceType string, tags map[string]string, patterns []*regexp.Regexp) []TagViolation {
+	var violations []TagViolation
+	for i, rule := range p.Rules {
+		violation := TagViolation{
+			ResourceID:   resourceID,
+			ResourceType: resourceType,
+			Key:          rule.Key,
+		}
+
+		value, ok := tags[rule.Key]
+		if !ok {
+			violation.Reason = "missing required tag"
+			violations = append(violations, violation)
+			continue
+		}
+		violation.Value = value
+
+		if patterns[i] != nil && !patterns[i].MatchString(value) {
+			violation.Reason = fmt.Sprintf("value does not match pattern %q", rule.Pattern)
+			violations = append(violations, violation)
+			continue
+		}
+
+		if len(rule.AllowedValues) > 0 && !containsString(rule.AllowedValues, value) {
+			violation.Reason = fmt.Sprintf("value is not one of: %s", strings.Join(rule.AllowedValues, ", "))
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations
+}
+
+// CheckTagPolicy reports every resource of the policy's resource
+// types that violates one of its rules. If the policy's Remediate
+// flag is set, instance tags covered by the rules are first
+// propagated to attached volumes and network interfaces.
+//
+// **Parameters:**
+//
+// policy: the tag policy to enforce
+//
+// **Returns:**
+//
+// []TagViolation: the violations found
+//
+// error: an error if any issue occurs while trying to check the resources
+func (c *Connection) CheckTagPolicy(policy TagPolicy) ([]TagViolation, error) {
+	// Patterns are validated before anything is remediated.
+	patterns, err := policy.compilePatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.Remediate {
+		keys := make([]string, 0, len(policy.Rules))
+		for _, rule := range policy.Rules {
+			keys = append(keys, rule.Key)
+		}
+
+		instances, err := c.GetInstances(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var instanceIDs []string
+		for _, instance := range instances {
+			instanceIDs = append(instanceIDs, aws.StringValue(instance.InstanceId))
+		}
+
+		if _, err := c.PropagateInstanceTags(instanceIDs, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	resourceTypes := policy.ResourceTypes
+	if len(resourceTypes) == 0 {
+		resourceTypes = []string{
+			ResourceTypeInstance, ResourceTypeVolume, ResourceTypeSnapshot,
+			ResourceTypeSecurityGroup, ResourceTypeSubnet, ResourceTypeVPC,
+			ResourceTypeNetworkInterface,
+		}
+	}
+
+	var violations []TagViolation
+	for _, resourceType := range resourceTypes {
+		resources, err := c.listResourceTags(resourceType)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make([]string, 0, len(resources))
+		for id := range resources {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			violations = append(violations, policy.evaluate(id, resourceType, resources[id], patterns)...)
+		}
+	}
+
+	return violations, nil
+}
+
+// PropagateInstanceTags copies the tags of each provided instance to
+// its attached EBS volumes and network interfaces. Tags with the
+// reserved aws: prefix are never copied.
+//
+// **Parameters:**
+//
+// instanceIDs: the IDs of the instances whose tags should be propagated
+//
+// keys: the tag keys to propagate, all tags are propagated if empty
+//
+// **Returns:**
+//
+// []string: the IDs of the resources that were tagged
+//
+// error: an error if any issue occurs while trying to propagate the tags
+func (c *Connection) PropagateInstanceTags(instanceIDs []string, keys []string) ([]string, error) {
+	if len(instanceIDs) == 0 {
+		return nil, nil
+	}
+
+	var tagged []string
+	for _, batch := range batchIDs(instanceIDs, maxFilterValues) {
+		instances, err := c.GetInstances([]*ec2.Filter{
+			{
+				Name:   aws.String("instance-id"),
+				Values: aws.StringSlice(batch),
+			},
+		})
+		if err != nil {
+			return tagged, err
+		}
+
+		for _, instance := range instances {
+			tags := make(map[string]string)
+			for _, tag := range instance.Tags {
+				key := aws.StringValue(tag.Key)
+				if strings.HasPrefix(key, "aws:") {
+					continue
+				}
+				if len(keys) > 0 && !containsString(keys, key) {
+					continue
+				}
+				tags[key] = aws.StringValue(tag.Value)
+			}
+
+			attached := attachedResourceIDs(instance)
+			if len(tags) == 0 || len(attached) == 0 {
+				continue
+			}
+
+			if err := c.TagResources(attached, tags); err != nil {
+				return tagged, err
+			}
+			tagged = append(tagged, attached...)
+		}
+	}
+
+	return tagged, nil
+}
+
+// listResourceTags returns the tags of every resource
+// of the provided type, keyed by resource ID.
+func (c *Connection) listResourceTags(resourceType string) (map[string]map[string]string, error) {
+	resources := make(map[string]map[string]string)
+	var err error
+
+	switch resourceType {
+	case ResourceTypeInstance:
+		err = c.Client.DescribeInstancesPages(&ec2.DescribeInstancesInput{},
+			func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+				for _, reservation := range page.Reservations {
+					for _, instance := range reservation.Instances {
+						resources[aws.StringValue(instance.InstanceId)] = tagsToMap(instance.Tags)
+					}
+				}
+				return true
+			})
+	case ResourceTypeVolume:
+		err = c.Client.DescribeVolumesPages(&ec2.DescribeVolumesInput{},
+			func(page *ec2.DescribeVolumesOutput, _ bool) bool {
+				for _, volume := range page.Volumes {
+					resources[aws.StringValue(volume.VolumeId)] = tagsToMap(volume.Tags)
+				}
+				return true
+			})
+	case ResourceTypeSnapshot:
+		err = c.Client.DescribeSnapshotsPages(&ec2.DescribeSnapshotsInput{
+			OwnerIds: []*string{aws.String("self")},
+		}, func(page *ec2.DescribeSnapshotsOutput, _ bool) bool {
+			for _, snapshot := range page.Snapshots {
+				resources[aws.StringValue(snapshot.SnapshotId)] = tagsToMap(snapshot.Tags)
+			}
+			return true
+		})
+	case ResourceTypeSecurityGroup:
+		err = c.Client.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{},
+			func(page *ec2.DescribeSecurityGroupsOutput, _ bool) bool {
+				for _, group := range page.SecurityGroups {
+					resources[aws.StringValue(group.GroupId)] = tagsToMap(group.Tags)
+				}
+				return true
+			})
+	case ResourceTypeSubnet:
+		err = c.Client.DescribeSubnetsPages(&ec2.DescribeSubnetsInput{},
+			func(page *ec2.DescribeSubnetsOutput, _ bool) bool {
+				for _, subnet := range page.Subnets {
+					resources[aws.StringValue(subnet.SubnetId)] = tagsToMap(subnet.Tags)
+				}
+				return true
+			})
+	case ResourceTypeVPC:
+		err = c.Client.DescribeVpcsPages(&ec2.DescribeVpcsInput{},
+			func(page *ec2.DescribeVpcsOutput, _ bool) bool {
+				for _, vpc := range page.Vpcs {
+					resources[aws.StringValue(vpc.VpcId)] = tagsToMap(vpc.Tags)
+				}
+				return true
+			})
+	case ResourceTypeNetworkInterface:
+		err = c.Client.DescribeNetworkInterfacesPages(&ec2.DescribeNetworkInterfacesInput{},
+			func(page *ec2.DescribeNetworkInterfacesOutput, _ bool) bool {
+				for _, eni := range page.NetworkInterfaces {
+					resources[aws.StringValue(eni.NetworkInterfaceId)] = tagsToMap(eni.TagSet)
+				}
+				return true
+			})
+	default:
+		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s resources: %v", resourceType, err)
+	}
+
+	return resources, nil
+}
+
+func attachedResourceIDs(instance *ec2.Instance) []string {
+	var ids []string
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.VolumeId != nil {
+			ids = append(ids, *mapping.Ebs.VolumeId)
+		}
+	}
+
+	for _, eni := range instance.NetworkInterfaces {
+		if eni.NetworkInterfaceId != nil {
+			ids = append(ids, *eni.NetworkInterfaceId)
+		}
+	}
+
+	return ids
+}
+
+func tagsToMap(tags []*ec2.Tag) map[string]string {
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		result[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return result
+}
+
+func mapToTags(tags map[string]string) []*ec2.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*ec2.Tag, 0, len(tags))
+	for _, key := range keys {
+		result = append(result, &ec2.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+
+	return result
+}
+
+func batchIDs(ids []string, size int) [][]string {
+	var batches [][]string
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batches = append(batches, ids[start:end])
+	}
+
+	return batches
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
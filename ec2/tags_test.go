@@ -0,0 +1,253 @@
+package ec2_test
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	ec2utils "github.com/l50/awsutils/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagPolicyEvaluate(t *testing.T) {
+	policy := ec2utils.TagPolicy{
+		Rules: []ec2utils.TagRule{
+			{Key: "Owner", Pattern: `^[a-z]+@example\.com$`},
+			{Key: "Env", AllowedValues: []string{"dev", "prod"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "compliant resource",
+			tags: map[string]string{"Owner": "alice@example.com", "Env": "dev"},
+		},
+		{
+			name: "missing tags",
+			tags: map[string]string{},
+			want: []string{"Owner", "Env"},
+		},
+		{
+			name: "invalid values",
+			tags: map[string]string{"Owner": "alice", "Env": "staging"},
+			want: []string{"Owner", "Env"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := policy.Evaluate("vol-123", ec2utils.ResourceTypeVolume, tc.tags)
+			assert.NoError(t, err)
+
+			var keys []string
+			for _, v := range violations {
+				assert.Equal(t, "vol-123", v.ResourceID)
+				assert.NotEmpty(t, v.Reason)
+				keys = append(keys, v.Key)
+			}
+			assert.Equal(t, tc.want, keys)
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		bad := ec2utils.TagPolicy{Rules: []ec2utils.TagRule{{Key: "Owner", Pattern: "("}}}
+		_, err := bad.Evaluate("vol-123", ec2utils.ResourceTypeVolume, map[string]string{"Owner": "x"})
+		assert.Error(t, err)
+	})
+}
+
+// formValues returns the values of the numbered form parameters
+// prefix.1, prefix.2, ... of a request.
+func formValues(req url.Values, prefix string) []string {
+	var values []string
+	for i := 1; ; i++ {
+		value, ok := req[fmt.Sprintf("%s.%d", prefix, i)]
+		if !ok {
+			return values
+		}
+		values = append(values, value[0])
+	}
+}
+
+func TestTagResourcesBatches(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"CreateTags": "<return>true</return>",
+		"DeleteTags": "<return>true</return>",
+	}, nil)
+
+	ids := make([]string, 2500)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("vol-%04d", i)
+	}
+
+	require.NoError(t, c.TagResources(ids, map[string]string{"Owner": "ops", "Env": "dev"}))
+	creates := fake.requestsFor("CreateTags")
+	require.Len(t, creates, 3)
+	for i, want := range []int{1000, 1000, 500} {
+		resources := formValues(creates[i], "ResourceId")
+		assert.Len(t, resources, want)
+		assert.Equal(t, ids[i*1000], resources[0])
+		assert.Equal(t, "Env", creates[i].Get("Tag.1.Key"))
+		assert.Equal(t, "dev", creates[i].Get("Tag.1.Value"))
+		assert.Equal(t, "Owner", creates[i].Get("Tag.2.Key"))
+	}
+
+	require.NoError(t, c.UntagResources(ids[:1001], []string{"Env"}))
+	deletes := fake.requestsFor("DeleteTags")
+	require.Len(t, deletes, 2)
+	assert.Len(t, formValues(deletes[0], "ResourceId"), 1000)
+	assert.Equal(t, []string{"vol-1000"}, formValues(deletes[1], "ResourceId"))
+	assert.Equal(t, "Env", deletes[1].Get("Tag.1.Key"))
+	assert.Empty(t, deletes[1].Get("Tag.1.Value"))
+
+	// Nothing is sent without tags.
+	require.NoError(t, c.TagResources(ids, nil))
+	require.NoError(t, c.UntagResources(ids, nil))
+	assert.Len(t, fake.requestsFor("CreateTags"), 3)
+	assert.Len(t, fake.requestsFor("DeleteTags"), 2)
+
+	failing := newFakeEC2Connection(t, nil, map[string]fakeEC2Error{"CreateTags": {Code: "UnauthorizedOperation"}})
+	assert.ErrorContains(t, failing.TagResources(ids, map[string]string{"Env": "dev"}), "UnauthorizedOperation")
+}
+
+// taggedInstancesPage returns a DescribeInstances response body with
+// one instance per ID, each carrying the Owner and aws:cloudformation:stack-name
+// tags and with a volume and network interface named after the instance.
+func taggedInstancesPage(nextToken string, ids ...string) string {
+	body := "<reservationSet><item><instancesSet>"
+	for _, id := range ids {
+		body += fmt.Sprintf(`<item><instanceId>i-%[1]s</instanceId>
+			<tagSet>
+				<item><key>Owner</key><value>%[1]s@example.com</value></item>
+				<item><key>Name</key><value>%[1]s</value></item>
+				<item><key>aws:cloudformation:stack-name</key><value>stack</value></item>
+			</tagSet>
+			<blockDeviceMapping><item><deviceName>/dev/xvda</deviceName><ebs><volumeId>vol-%[1]s</volumeId></ebs></item></blockDeviceMapping>
+			<networkInterfaceSet><item><networkInterfaceId>eni-%[1]s</networkInterfaceId></item></networkInterfaceSet>
+		</item>`, id)
+	}
+	body += "</instancesSet></item></reservationSet>"
+	if nextToken != "" {
+		body += "<nextToken>" + nextToken + "</nextToken>"
+	}
+	return body
+}
+
+func TestPropagateInstanceTags(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"DescribeInstances":        taggedInstancesPage("page-2", "web"),
+		"DescribeInstances/page-2": taggedInstancesPage("", "db"),
+		"CreateTags":               "<return>true</return>",
+	}, nil)
+
+	tagged, err := c.PropagateInstanceTags([]string{"i-web", "i-db"}, []string{"Owner"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vol-web", "eni-web", "vol-db", "eni-db"}, tagged)
+
+	describes := fake.requestsFor("DescribeInstances")
+	require.Len(t, describes, 2)
+	assert.Equal(t, "instance-id", describes[0].Get("Filter.1.Name"))
+	assert.Equal(t, []string{"i-web", "i-db"}, formValues(describes[0], "Filter.1.Value"))
+
+	creates := fake.requestsFor("CreateTags")
+	require.Len(t, creates, 2)
+	assert.Equal(t, []string{"vol-db", "eni-db"}, formValues(creates[1], "ResourceId"))
+	assert.Equal(t, "Owner", creates[1].Get("Tag.1.Key"))
+	assert.Empty(t, creates[1].Get("Tag.2.Key"))
+	assert.Equal(t, "db@example.com", creates[1].Get("Tag.1.Value"))
+
+	t.Run("all tags except reserved ones", func(t *testing.T) {
+		before := len(fake.requestsFor("CreateTags"))
+		_, err := c.PropagateInstanceTags([]string{"i-web", "i-db"}, nil)
+		require.NoError(t, err)
+
+		for _, req := range fake.requestsFor("CreateTags")[before:] {
+			assert.Equal(t, "Name", req.Get("Tag.1.Key"))
+			assert.Equal(t, "Owner", req.Get("Tag.2.Key"))
+			assert.Empty(t, req.Get("Tag.3.Key"))
+		}
+	})
+}
+
+func TestCheckTagPolicyRemediate(t *testing.T) {
+	c, fake := startFakeEC2(t, map[string]string{
+		"DescribeInstances":        taggedInstancesPage("page-2", "web"),
+		"DescribeInstances/page-2": taggedInstancesPage("", "db"),
+		"CreateTags":               "<return>true</return>",
+		"DescribeVolumes": `<volumeSet>
+			<item><volumeId>vol-web</volumeId><tagSet><item><key>Owner</key><value>web@example.com</value></item></tagSet></item>
+			<item><volumeId>vol-orphan</volumeId></item>
+		</volumeSet>`,
+	}, nil)
+
+	policy := ec2utils.TagPolicy{
+		Rules:         []ec2utils.TagRule{{Key: "Owner"}},
+		ResourceTypes: []string{ec2utils.ResourceTypeVolume},
+		Remediate:     true,
+	}
+	violations, err := c.CheckTagPolicy(policy)
+	require.NoError(t, err)
+	assert.Equal(t, []ec2utils.TagViolation{{
+		ResourceID:   "vol-orphan",
+		ResourceType: ec2utils.ResourceTypeVolume,
+		Key:          "Owner",
+		Reason:       "missing required tag",
+	}}, violations)
+
+	// Instances on every page are remediated before checking.
+	var tagged []string
+	for _, req := range fake.requestsFor("CreateTags") {
+		tagged = append(tagged, formValues(req, "ResourceId")...)
+	}
+	assert.Equal(t, []string{"vol-web", "eni-web", "vol-db", "eni-db"}, tagged)
+
+	describes := fake.requestsFor("DescribeInstances")
+	require.Len(t, describes, 4)
+	assert.Equal(t, []string{"i-web", "i-db"}, formValues(describes[2], "Filter.1.Value"))
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		before := len(fake.requestsFor("DescribeInstances"))
+		_, err := c.CheckTagPolicy(ec2utils.TagPolicy{
+			Rules:     []ec2utils.TagRule{{Key: "Owner", Pattern: "("}},
+			Remediate: true,
+		})
+		assert.ErrorContains(t, err, "invalid pattern for tag Owner")
+		assert.Len(t, fake.requestsFor("DescribeInstances"), before)
+	})
+
+	t.Run("unsupported resource type", func(t *testing.T) {
+		_, err := c.CheckTagPolicy(ec2utils.TagPolicy{ResourceTypes: []string{"bucket"}})
+		assert.ErrorContains(t, err, "unsupported resource type")
+	})
+}
+
+func TestCheckTagPolicyRemediateManyInstances(t *testing.T) {
+	ids := make([]string, 250)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("host%d", i)
+	}
+	c, fake := startFakeEC2(t, map[string]string{
+		"DescribeInstances": taggedInstancesPage("", ids...),
+		"CreateTags":        "<return>true</return>",
+		"DescribeVolumes":   "<volumeSet/>",
+	}, nil)
+
+	_, err := c.CheckTagPolicy(ec2utils.TagPolicy{
+		Rules:         []ec2utils.TagRule{{Key: "Owner"}},
+		ResourceTypes: []string{ec2utils.ResourceTypeVolume},
+		Remediate:     true,
+	})
+	require.NoError(t, err)
+
+	// The instances are looked up at most 200 per filter.
+	describes := fake.requestsFor("DescribeInstances")
+	require.Len(t, describes, 3)
+	assert.Len(t, formValues(describes[1], "Filter.1.Value"), 200)
+	assert.Len(t, formValues(describes[2], "Filter.1.Value"), 50)
+}
@@ -0,0 +1,195 @@
+package ec2
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	iamutils "github.com/l50/awsutils/iam"
+)
+
+// maxVolumeSizeGiB is the largest EBS volume size accepted by CreateInstance.
+const maxVolumeSizeGiB = 16384
+
+// ValidateParams checks that the resources referenced by the provided
+// parameters exist and are consistent with each other before they are
+// passed to CreateInstance. Every problem found is returned, rather than
+// stopping at the first one. If ec2Params.DryRun is set, a dry run of
+// RunInstances is also performed to check permissions.
+//
+// **Parameters:**
+//
+// ec2Params: the parameters to validate
+//
+// iamService: the service used to look up the instance profile, a default
+// one is created if nil and an instance profile is set
+//
+// **Returns:**
+//
+// []error: the problems found with the parameters, empty if they are valid
+func (c *Connection) ValidateParams(ec2Params Params, iamService *iamutils.AWSService) []error {
+	var problems []error
+
+	if ec2Params.MinCount < 1 {
+		problems = append(problems, fmt.Errorf("MinCount must be at least 1, got %d", ec2Params.MinCount))
+	}
+	if ec2Params.MaxCount < ec2Params.MinCount {
+		problems = append(problems, fmt.Errorf("MaxCount (%d) must not be less than MinCount (%d)", ec2Params.MaxCount, ec2Params.MinCount))
+	}
+	if ec2Params.VolumeSize < 1 || ec2Params.VolumeSize > maxVolumeSizeGiB {
+		problems = append(problems, fmt.Errorf("VolumeSize must be between 1 and %d GiB, got %d", maxVolumeSizeGiB, ec2Params.VolumeSize))
+	}
+
+	problems = append(problems, c.validateNetwork(ec2Params)...)
+	problems = append(problems, c.validateImage(ec2Params)...)
+
+	if ec2Params.KeyName != "" {
+		if err := c.checkResourceExistence("key-pair", ec2Params.KeyName); err != nil {
+			problems = append(problems, fmt.Errorf("key pair %s does not exist: %v", ec2Params.KeyName, err))
+		}
+	}
+
+	if ec2Params.InstanceProfile != "" {
+		if err := validateInstanceProfile(ec2Params.InstanceProfile, iamService); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if ec2Params.DryRun && len(problems) == 0 {
+		if err := c.dryRunInstances(ec2Params); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	return problems
+}
+
+// validateNetwork checks that the subnet exists and that every
+// security group exists and belongs to the subnet's VPC.
+func (c *Connection) validateNetwork(ec2Params Params) []error {
+	var problems []error
+
+	if ec2Params.SubnetID == "" {
+		return append(problems, fmt.Errorf("SubnetID must be set"))
+	}
+
+	if err := c.checkResourceExistence("subnet", ec2Params.SubnetID); err != nil {
+		return append(problems, fmt.Errorf("subnet %s does not exist: %v", ec2Params.SubnetID, err))
+	}
+
+	subnets, err := c.Client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		SubnetIds: []*string{aws.String(ec2Params.SubnetID)},
+	})
+	if err != nil || len(subnets.Subnets) == 0 {
+		return append(problems, fmt.Errorf("error describing subnet %s: %v", ec2Params.SubnetID, err))
+	}
+	vpcID := aws.StringValue(subnets.Subnets[0].VpcId)
+
+	for _, groupID := range ec2Params.SecurityGroupIDs {
+		if err := c.checkResourceExistence("security-group", groupID); err != nil {
+			problems = append(problems, fmt.Errorf("security group %s does not exist: %v", groupID, err))
+			continue
+		}
+
+		groups, err := c.Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+			GroupIds: []*string{aws.String(groupID)},
+		})
+		if err != nil || len(groups.SecurityGroups) == 0 {
+			problems = append(problems, fmt.Errorf("error describing security group %s: %v", groupID, err))
+			continue
+		}
+
+		if groupVPC := aws.StringValue(groups.SecurityGroups[0].VpcId); groupVPC != vpcID {
+			problems = append(problems, fmt.Errorf("security group %s is in VPC %s, but subnet %s is in VPC %s",
+				groupID, groupVPC, ec2Params.SubnetID, vpcID))
+		}
+	}
+
+	return problems
+}
+
+// validateImage checks that the AMI exists, that its architecture is
+// supported by the instance type and that the volume is not smaller
+// than the AMI snapshot for the same device.
+func (c *Connection) validateImage(ec2Params Params) []error {
+	var problems []error
+
+	if ec2Params.ImageID == "" {
+		return append(problems, fmt.Errorf("ImageID must be set"))
+	}
+
+	images, err := c.Client.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(ec2Params.ImageID)},
+	})
+	if err != nil {
+		return append(problems, fmt.Errorf("image %s does not exist: %v", ec2Params.ImageID, err))
+	}
+	if len(images.Images) == 0 {
+		return append(problems, fmt.Errorf("image %s does not exist", ec2Params.ImageID))
+	}
+	image := images.Images[0]
+	imageArch := aws.StringValue(image.Architecture)
+
+	for _, mapping := range image.BlockDeviceMappings {
+		if aws.StringValue(mapping.DeviceName) != volumeDeviceName || mapping.Ebs == nil {
+			continue
+		}
+		if snapshotSize := aws.Int64Value(mapping.Ebs.VolumeSize); ec2Params.VolumeSize < snapshotSize {
+			problems = append(problems, fmt.Errorf("VolumeSize (%d GiB) is smaller than the %d GiB snapshot %s of image %s",
+				ec2Params.VolumeSize, snapshotSize, aws.StringValue(mapping.Ebs.SnapshotId), ec2Params.ImageID))
+		}
+	}
+
+	if ec2Params.InstanceType == "" {
+		return append(problems, fmt.Errorf("InstanceType must be set"))
+	}
+
+	infos, err := c.DescribeInstanceTypes([]string{ec2Params.InstanceType})
+	if err != nil {
+		return append(problems, fmt.Errorf("instance type %s does not exist: %v", ec2Params.InstanceType, err))
+	}
+	if len(infos) == 0 {
+		return append(problems, fmt.Errorf("instance type %s does not exist", ec2Params.InstanceType))
+	}
+
+	if !containsString(infos[0].Architectures, imageArch) {
+		problems = append(problems, fmt.Errorf("instance type %s does not support the %s architecture of image %s",
+			ec2Params.InstanceType, imageArch, ec2Params.ImageID))
+	}
+
+	return problems
+}
+
+// dryRunInstances performs a dry run of RunInstances, which
+// reports success with the DryRunOperation error code.
+func (c *Connection) dryRunInstances(ec2Params Params) error {
+	input := c.getRunInstancesInput(ec2Params)
+	input.DryRun = aws.Bool(true)
+
+	_, err := c.Client.RunInstances(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "DryRunOperation" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("dry run failed: %v", err)
+	}
+
+	return nil
+}
+
+func validateInstanceProfile(profileName string, iamService *iamutils.AWSService) error {
+	if iamService == nil {
+		var err error
+		iamService, err = iamutils.NewAWSService()
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := iamService.GetInstanceProfile(profileName); err != nil {
+		return fmt.Errorf("instance profile %s does not exist: %v", profileName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package ec2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	ec2utils "github.com/l50/awsutils/ec2"
+	iamutils "github.com/l50/awsutils/iam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIAMClient struct {
+	iamutils.IdentityClientAPI
+	profiles map[string]bool
+}
+
+func (f *fakeIAMClient) GetInstanceProfile(_ context.Context, params *iam.GetInstanceProfileInput, _ ...func(*iam.Options)) (*iam.GetInstanceProfileOutput, error) {
+	if !f.profiles[*params.InstanceProfileName] {
+		return nil, errors.New("NoSuchEntity")
+	}
+	return &iam.GetInstanceProfileOutput{InstanceProfile: &types.InstanceProfile{InstanceProfileName: params.InstanceProfileName}}, nil
+}
+
+func TestValidateParams(t *testing.T) {
+	iamService := &iamutils.AWSService{IAMClient: &fakeIAMClient{profiles: map[string]bool{"good-profile": true}}}
+
+	baseResponses := map[string]string{
+		"DescribeSubnets":        "<subnetSet><item><subnetId>subnet-1</subnetId><vpcId>vpc-1</vpcId></item></subnetSet>",
+		"DescribeSecurityGroups": "<securityGroupInfo><item><groupId>sg-1</groupId><vpcId>vpc-1</vpcId></item></securityGroupInfo>",
+		"DescribeKeyPairs":       "<keySet><item><keyName>my-key</keyName></item></keySet>",
+		"DescribeImages":         "<imagesSet><item><imageId>ami-1</imageId><architecture>x86_64</architecture></item></imagesSet>",
+		"DescribeInstanceTypes":  "<instanceTypeSet><item><instanceType>t3.micro</instanceType><processorInfo><supportedArchitectures><item>x86_64</item></supportedArchitectures></processorInfo></item></instanceTypeSet>",
+	}
+
+	params := ec2utils.Params{
+		ImageID:          "ami-1",
+		InstanceType:     "t3.micro",
+		InstanceProfile:  "good-profile",
+		KeyName:          "my-key",
+		MinCount:         1,
+		MaxCount:         1,
+		SecurityGroupIDs: []string{"sg-1"},
+		SubnetID:         "subnet-1",
+		VolumeSize:       8,
+		DryRun:           true,
+	}
+
+	t.Run("valid params with dry run", func(t *testing.T) {
+		c, fake := startFakeEC2(t, baseResponses, map[string]fakeEC2Error{
+			"RunInstances": {Code: "DryRunOperation", Message: "Request would have succeeded"},
+		})
+		assert.Empty(t, c.ValidateParams(params, iamService))
+
+		withType := params
+		withType.VolumeType = "gp3"
+		assert.Empty(t, c.ValidateParams(withType, iamService))
+
+		runs := fake.requestsFor("RunInstances")
+		require.Len(t, runs, 2)
+		assert.Empty(t, runs[0].Get("BlockDeviceMapping.1.Ebs.VolumeType"))
+		assert.Equal(t, "gp3", runs[1].Get("BlockDeviceMapping.1.Ebs.VolumeType"))
+	})
+
+	t.Run("all problems reported", func(t *testing.T) {
+		responses := map[string]string{}
+		for k, v := range baseResponses {
+			responses[k] = v
+		}
+		responses["DescribeSecurityGroups"] = "<securityGroupInfo><item><groupId>sg-1</groupId><vpcId>vpc-2</vpcId></item></securityGroupInfo>"
+		responses["DescribeImages"] = "<imagesSet><item><imageId>ami-1</imageId><architecture>arm64</architecture>" +
+			"<blockDeviceMapping><item><deviceName>/dev/sdh</deviceName><ebs><snapshotId>snap-1</snapshotId><volumeSize>20</volumeSize></ebs></item></blockDeviceMapping>" +
+			"</item></imagesSet>"
+		c := newFakeEC2Connection(t, responses, map[string]fakeEC2Error{
+			"DescribeKeyPairs": {Code: "InvalidKeyPair.NotFound", Message: "missing"},
+		})
+
+		bad := params
+		bad.InstanceProfile = "typo-profile"
+		bad.MaxCount = 0
+
+		problems := c.ValidateParams(bad, iamService)
+		var messages []string
+		for _, p := range problems {
+			messages = append(messages, p.Error())
+		}
+
+		require.Len(t, problems, 6, messages)
+		assert.Contains(t, messages[0], "MaxCount")
+		assert.Contains(t, messages[1], "is in VPC vpc-2")
+		assert.Contains(t, messages[2], "smaller than the 20 GiB snapshot")
+		assert.Contains(t, messages[3], "arm64 architecture")
+		assert.Contains(t, messages[4], "key pair my-key")
+		assert.Contains(t, messages[5], "instance profile typo-profile")
+	})
+}
@@ -0,0 +1,524 @@
+package elbv2
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// waiterDelay is how often target health is
+// polled while waiting for targets.
+const waiterDelay = 15 * time.Second
+
+// defaultSSLPolicy is the security policy used by
+// HTTPS and TLS listeners when none is specified.
+const defaultSSLPolicy = "ELBSecurityPolicy-TLS13-1-2-2021-06"
+
+// Connection provides a connection
+// to AWS Elastic Load Balancing.
+//
+// **Attributes:**
+//
+// Client: the Elastic Load Balancing v2 client
+// Session: the AWS session from which the client is derived
+type Connection struct {
+	Client  elbv2iface.ELBV2API
+	Session *session.Session
+}
+
+// TargetGroupParams provides information
+// about a target group to create.
+//
+// **Attributes:**
+//
+// Name: the name of the target group
+// VPCID: the ID of the VPC of the targets
+// Protocol: the protocol used to route traffic to targets, such as HTTP or TCP
+// Port: the port targets receive traffic on
+// TargetType: the type of targets, defaults to instance
+// HealthCheckPath: the path of HTTP and HTTPS health checks
+// HealthCheckPort: the port of health checks, defaults to the traffic port
+// HealthCheckMatcher: the HTTP codes of healthy targets, such as 200-299
+// DeregistrationDelay: the seconds to drain deregistered targets, AWS default if zero
+// Tags: the tags of the target group
+type TargetGroupParams struct {
+	Name                string
+	VPCID               string
+	Protocol            string
+	Port                int64
+	TargetType          string
+	HealthCheckPath     string
+	HealthCheckPort     string
+	HealthCheckMatcher  string
+	DeregistrationDelay int64
+	Tags                map[string]string
+}
+
+// Target provides a target of a target group.
+//
+// **Attributes:**
+//
+// ID: the ID of the instance, or the IP address for IP targets
+// Port: the port of the target, the target group port if zero
+type Target struct {
+	ID   string
+	Port int64
+}
+
+// TargetHealth provides the health of a target.
+//
+// **Attributes:**
+//
+// ID: the ID of the target
+// Port: the port of the target
+// State: the health state, such as initial, healthy, unhealthy or draining
+// Reason: the reason code of the state, if any
+// Description: a description of the state, if any
+type TargetHealth struct {
+	ID          string
+	Port        int64
+	State       string
+	Reason      string
+	Description string
+}
+
+// ListenerParams provides information
+// about a listener to create.
+//
+// **Attributes:**
+//
+// LoadBalancerARN: the ARN of the load balancer
+// Protocol: the protocol of the listener, HTTPS if certificates are provided and empty
+// Port: the port of the listener
+// CertificateARNs: the ACM certificate ARNs, the first one is the default certificate
+// SSLPolicy: the security policy of HTTPS and TLS listeners
+// TargetGroupARN: the target group traffic is forwarded to
+type ListenerParams struct {
+	LoadBalancerARN string
+	Protocol        string
+	Port            int64
+	CertificateARNs []string
+	SSLPolicy       string
+	TargetGroupARN  string
+}
+
+// createClient creates a new AWS session and
+// Elastic Load Balancing v2 client.
+func createClient() (elbv2iface.ELBV2API, *session.Session) {
+	sess := session.Must(session.NewSessionWithOptions(
+		session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		}))
+
+	return elbv2.New(sess), sess
+}
+
+// CreateConnection creates a new connection
+// to AWS Elastic Load Balancing.
+//
+// **Returns:**
+//
+// Connection: a new connection to AWS Elastic Load Balancing
+func CreateConnection() Connection {
+	connection := Connection{}
+	connection.Client, connection.Session = createClient()
+
+	return connection
+}
+
+// CreateTargetGroup creates a target group.
+//
+// **Parameters:**
+//
+// params: the parameters of the target group
+//
+// **Returns:**
+//
+// string: the ARN of the created target group
+//
+// error: an error if any issue occurs while trying to create the target group
+func (c *Connection) CreateTargetGroup(params TargetGroupParams) (string, error) {
+	if params.Name == "" {
+		return "", errors.New("a target group name is required")
+	}
+
+	targetType := params.TargetType
+	if targetType == "" {
+		targetType = elbv2.TargetTypeEnumInstance
+	}
+
+	input := &elbv2.CreateTargetGroupInput{
+		Name:       aws.String(params.Name),
+		TargetType: aws.String(targetType),
+	}
+	if params.VPCID != "" {
+		input.VpcId = aws.String(params.VPCID)
+	}
+	if params.Protocol != "" {
+		input.Protocol = aws.String(params.Protocol)
+	}
+	if params.Port != 0 {
+		input.Port = aws.Int64(params.Port)
+	}
+	if params.HealthCheckPath != "" {
+		input.HealthCheckPath = aws.String(params.HealthCheckPath)
+	}
+	if params.HealthCheckPort != "" {
+		input.HealthCheckPort = aws.String(params.HealthCheckPort)
+	}
+	if params.HealthCheckMatcher != "" {
+		input.Matcher = &elbv2.Matcher{HttpCode: aws.String(params.HealthCheckMatcher)}
+	}
+	if len(params.Tags) > 0 {
+		input.Tags = mapToTags(params.Tags)
+	}
+
+	result, err := c.Client.CreateTargetGroup(input)
+	if err != nil {
+		return "", fmt.Errorf("error creating target group %s: %v", params.Name, err)
+	}
+	if len(result.TargetGroups) == 0 {
+		return "", fmt.Errorf("no target group was created for %s", params.Name)
+	}
+	arn := aws.StringValue(result.TargetGroups[0].TargetGroupArn)
+
+	if params.DeregistrationDelay != 0 {
+		if _, err := c.Client.ModifyTargetGroupAttributes(&elbv2.ModifyTargetGroupAttributesInput{
+			TargetGroupArn: aws.String(arn),
+			Attributes: []*elbv2.TargetGroupAttribute{
+				{
+					Key:   aws.String("deregistration_delay.timeout_seconds"),
+					Value: aws.String(strconv.FormatInt(params.DeregistrationDelay, 10)),
+				},
+			},
+		}); err != nil {
+			return arn, fmt.Errorf("error setting deregistration delay of %s: %v", params.Name, err)
+		}
+	}
+
+	return arn, nil
+}
+
+// DeleteTargetGroup deletes a target group, which must not
+// be used by any listener or rule.
+//
+// **Parameters:**
+//
+// targetGroupARN: the ARN of the target group
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to delete the target group
+func (c *Connection) DeleteTargetGroup(targetGroupARN string) error {
+	if _, err := c.Client.DeleteTargetGroup(&elbv2.DeleteTargetGroupInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+	}); err != nil {
+		return fmt.Errorf("error deleting target group %s: %v", targetGroupARN, err)
+	}
+
+	return nil
+}
+
+// RegisterTargets registers targets with a target group.
+//
+// **Parameters:**
+//
+// targetGroupARN: the ARN of the target group
+//
+// targets: the targets to register
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to register the targets
+func (c *Connection) RegisterTargets(targetGroupARN string, targets ...Target) error {
+	if _, err := c.Client.RegisterTargets(&elbv2.RegisterTargetsInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        targetDescriptions(targets),
+	}); err != nil {
+		return fmt.Errorf("error registering targets with %s: %v", targetGroupARN, err)
+	}
+
+	return nil
+}
+
+// DeregisterTargets deregisters targets from a target group.
+// The targets keep serving in-flight requests while they drain;
+// use WaitForTargetsDeregistered to wait for draining to finish.
+//
+// **Parameters:**
+//
+// targetGroupARN: the ARN of the target group
+//
+// targets: the targets to deregister
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to deregister the targets
+func (c *Connection) DeregisterTargets(targetGroupARN string, targets ...Target) error {
+	if _, err := c.Client.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        targetDescriptions(targets),
+	}); err != nil {
+		return fmt.Errorf("error deregistering targets from %s: %v", targetGroupARN, err)
+	}
+
+	return nil
+}
+
+// WaitForTargetsHealthy waits for targets of a
+// target group to pass their health checks.
+//
+// **Parameters:**
+//
+// targetGroupARN: the ARN of the target group
+//
+// timeout: how long to wait before giving up
+//
+// targets: the targets to wait for
+//
+// **Returns:**
+//
+// error: an error if the targets are not healthy before the timeout
+func (c *Connection) WaitForTargetsHealthy(targetGroupARN string, timeout time.Duration, targets ...Target) error {
+	if err := c.Client.WaitUntilTargetInServiceWithContext(aws.BackgroundContext(), &elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        targetDescriptions(targets),
+	}, waiterOptions(timeout)...); err != nil {
+		return fmt.Errorf("error waiting for targets of %s to be healthy: %v", targetGroupARN, err)
+	}
+
+	return nil
+}
+
+// WaitForTargetsDeregistered waits for deregistered targets
+// of a target group to finish draining.
+//
+// **Parameters:**
+//
+// targetGroupARN: the ARN of the target group
+//
+// timeout: how long to wait before giving up
+//
+// targets: the targets to wait for
+//
+// **Returns:**
+//
+// error: an error if the targets are not deregistered before the timeout
+func (c *Connection) WaitForTargetsDeregistered(targetGroupARN string, timeout time.Duration, targets ...Target) error {
+	if err := c.Client.WaitUntilTargetDeregisteredWithContext(aws.BackgroundContext(), &elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        targetDescriptions(targets),
+	}, waiterOptions(timeout)...); err != nil {
+		return fmt.Errorf("error waiting for targets of %s to drain: %v", targetGroupARN, err)
+	}
+
+	return nil
+}
+
+// GetTargetHealth retrieves the health of the
+// targets registered with a target group.
+//
+// **Parameters:**
+//
+// targetGroupARN: the ARN of the target group
+//
+// **Returns:**
+//
+// []TargetHealth: the health of each target, sorted by ID and port
+//
+// error: an error if any issue occurs while trying to retrieve the health
+func (c *Connection) GetTargetHealth(targetGroupARN string) ([]TargetHealth, error) {
+	result, err := c.Client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing target health of %s: %v", targetGroupARN, err)
+	}
+
+	health := make([]TargetHealth, 0, len(result.TargetHealthDescriptions))
+	for _, description := range result.TargetHealthDescriptions {
+		target := TargetHealth{}
+		if description.Target != nil {
+			target.ID = aws.StringValue(description.Target.Id)
+			target.Port = aws.Int64Value(description.Target.Port)
+		}
+		if description.TargetHealth != nil {
+			target.State = aws.StringValue(description.TargetHealth.State)
+			target.Reason = aws.StringValue(description.TargetHealth.Reason)
+			target.Description = aws.StringValue(description.TargetHealth.Description)
+		}
+		health = append(health, target)
+	}
+
+	sort.Slice(health, func(i, j int) bool {
+		if health[i].ID != health[j].ID {
+			return health[i].ID < health[j].ID
+		}
+		return health[i].Port < health[j].Port
+	})
+
+	return health, nil
+}
+
+// CreateListener creates a listener that forwards traffic to a target
+// group. Additional certificates are added to the listener for SNI.
+//
+// **Parameters:**
+//
+// params: the parameters of the listener
+//
+// **Returns:**
+//
+// string: the ARN of the created listener
+//
+// error: an error if any issue occurs while trying to create the listener
+func (c *Connection) CreateListener(params ListenerParams) (string, error) {
+	protocol := params.Protocol
+	if protocol == "" {
+		if len(params.CertificateARNs) > 0 {
+			protocol = elbv2.ProtocolEnumHttps
+		} else {
+			protocol = elbv2.ProtocolEnumHttp
+		}
+	}
+
+	secure := protocol == elbv2.ProtocolEnumHttps || protocol == elbv2.ProtocolEnumTls
+	if secure && len(params.CertificateARNs) == 0 {
+		return "", fmt.Errorf("a certificate is required for %s listeners", protocol)
+	}
+
+	input := &elbv2.CreateListenerInput{
+		LoadBalancerArn: aws.String(params.LoadBalancerARN),
+		Protocol:        aws.String(protocol),
+		Port:            aws.Int64(params.Port),
+		DefaultActions:  forwardActions(params.TargetGroupARN),
+	}
+	if secure {
+		sslPolicy := params.SSLPolicy
+		if sslPolicy == "" {
+			sslPolicy = defaultSSLPolicy
+		}
+		input.SslPolicy = aws.String(sslPolicy)
+		input.Certificates = []*elbv2.Certificate{{CertificateArn: aws.String(params.CertificateARNs[0])}}
+	}
+
+	result, err := c.Client.CreateListener(input)
+	if err != nil {
+		return "", fmt.Errorf("error creating %s listener on port %d: %v", protocol, params.Port, err)
+	}
+	if len(result.Listeners) == 0 {
+		return "", fmt.Errorf("no listener was created on port %d", params.Port)
+	}
+	arn := aws.StringValue(result.Listeners[0].ListenerArn)
+
+	if secure && len(params.CertificateARNs) > 1 {
+		var certificates []*elbv2.Certificate
+		for _, certificateARN := range params.CertificateARNs[1:] {
+			certificates = append(certificates, &elbv2.Certificate{CertificateArn: aws.String(certificateARN)})
+		}
+
+		if _, err := c.Client.AddListenerCertificates(&elbv2.AddListenerCertificatesInput{
+			ListenerArn:  aws.String(arn),
+			Certificates: certificates,
+		}); err != nil {
+			return arn, fmt.Errorf("error adding certificates to listener %s: %v", arn, err)
+		}
+	}
+
+	return arn, nil
+}
+
+// SwapListenerTargetGroup changes the target group a listener
+// forwards traffic to, such as for a blue/green deployment.
+//
+// **Parameters:**
+//
+// listenerARN: the ARN of the listener
+//
+// targetGroupARN: the ARN of the target group to forward traffic to
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to modify the listener
+func (c *Connection) SwapListenerTargetGroup(listenerARN, targetGroupARN string) error {
+	if _, err := c.Client.ModifyListener(&elbv2.ModifyListenerInput{
+		ListenerArn:    aws.String(listenerARN),
+		DefaultActions: forwardActions(targetGroupARN),
+	}); err != nil {
+		return fmt.Errorf("error forwarding listener %s to %s: %v", listenerARN, targetGroupARN, err)
+	}
+
+	return nil
+}
+
+// DeleteListener deletes a listener.
+//
+// **Parameters:**
+//
+// listenerARN: the ARN of the listener
+//
+// **Returns:**
+//
+// error: an error if any issue occurs while trying to delete the listener
+func (c *Connection) DeleteListener(listenerARN string) error {
+	if _, err := c.Client.DeleteListener(&elbv2.DeleteListenerInput{
+		ListenerArn: aws.String(listenerARN),
+	}); err != nil {
+		return fmt.Errorf("error deleting listener %s: %v", listenerARN, err)
+	}
+
+	return nil
+}
+
+// waiterOptions bounds a target health waiter by the provided timeout.
+func waiterOptions(timeout time.Duration) []request.WaiterOption {
+	return []request.WaiterOption{
+		request.WithWaiterDelay(request.ConstantWaiterDelay(waiterDelay)),
+		request.WithWaiterMaxAttempts(int(timeout/waiterDelay) + 1),
+	}
+}
+
+func forwardActions(targetGroupARN string) []*elbv2.Action {
+	return []*elbv2.Action{
+		{
+			Type:           aws.String(elbv2.ActionTypeEnumForward),
+			TargetGroupArn: aws.String(targetGroupARN),
+		},
+	}
+}
+
+func targetDescriptions(targets []Target) []*elbv2.TargetDescription {
+	descriptions := make([]*elbv2.TargetDescription, 0, len(targets))
+	for _, target := range targets {
+		description := &elbv2.TargetDescription{Id: aws.String(target.ID)}
+		if target.Port != 0 {
+			description.Port = aws.Int64(target.Port)
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	return descriptions
+}
+
+func mapToTags(tags map[string]string) []*elbv2.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*elbv2.Tag, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &elbv2.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+
+	return result
+}
@@ -0,0 +1,189 @@
+package elbv2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	elbv2utils "github.com/l50/awsutils/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeELBV2Client records the inputs of the calls it
+// receives and answers them with canned results.
+type fakeELBV2Client struct {
+	elbv2iface.ELBV2API
+
+	health []*elbv2.TargetHealthDescription
+
+	targetGroup  *elbv2.CreateTargetGroupInput
+	attributes   *elbv2.ModifyTargetGroupAttributesInput
+	registered   *elbv2.RegisterTargetsInput
+	listener     *elbv2.CreateListenerInput
+	certificates *elbv2.AddListenerCertificatesInput
+	modified     *elbv2.ModifyListenerInput
+	drained      *elbv2.DescribeTargetHealthInput
+	waitOptions  []request.WaiterOption
+}
+
+func (f *fakeELBV2Client) CreateTargetGroup(input *elbv2.CreateTargetGroupInput) (*elbv2.CreateTargetGroupOutput, error) {
+	f.targetGroup = input
+	return &elbv2.CreateTargetGroupOutput{
+		TargetGroups: []*elbv2.TargetGroup{{TargetGroupArn: aws.String("arn:tg/" + aws.StringValue(input.Name))}},
+	}, nil
+}
+
+func (f *fakeELBV2Client) ModifyTargetGroupAttributes(input *elbv2.ModifyTargetGroupAttributesInput) (*elbv2.ModifyTargetGroupAttributesOutput, error) {
+	f.attributes = input
+	return &elbv2.ModifyTargetGroupAttributesOutput{}, nil
+}
+
+func (f *fakeELBV2Client) RegisterTargets(input *elbv2.RegisterTargetsInput) (*elbv2.RegisterTargetsOutput, error) {
+	f.registered = input
+	return &elbv2.RegisterTargetsOutput{}, nil
+}
+
+func (f *fakeELBV2Client) CreateListener(input *elbv2.CreateListenerInput) (*elbv2.CreateListenerOutput, error) {
+	f.listener = input
+	return &elbv2.CreateListenerOutput{
+		Listeners: []*elbv2.Listener{{ListenerArn: aws.String("arn:listener/1")}},
+	}, nil
+}
+
+func (f *fakeELBV2Client) AddListenerCertificates(input *elbv2.AddListenerCertificatesInput) (*elbv2.AddListenerCertificatesOutput, error) {
+	f.certificates = input
+	return &elbv2.AddListenerCertificatesOutput{}, nil
+}
+
+func (f *fakeELBV2Client) ModifyListener(input *elbv2.ModifyListenerInput) (*elbv2.ModifyListenerOutput, error) {
+	f.modified = input
+	return &elbv2.ModifyListenerOutput{}, nil
+}
+
+func (f *fakeELBV2Client) DescribeTargetHealth(*elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error) {
+	return &elbv2.DescribeTargetHealthOutput{TargetHealthDescriptions: f.health}, nil
+}
+
+func (f *fakeELBV2Client) WaitUntilTargetDeregisteredWithContext(_ aws.Context, input *elbv2.DescribeTargetHealthInput, opts ...request.WaiterOption) error {
+	f.drained = input
+	f.waitOptions = opts
+	return nil
+}
+
+func TestCreateTargetGroup(t *testing.T) {
+	fake := &fakeELBV2Client{}
+	c := elbv2utils.Connection{Client: fake}
+
+	arn, err := c.CreateTargetGroup(elbv2utils.TargetGroupParams{
+		Name:                "blue",
+		VPCID:               "vpc-1",
+		Protocol:            "HTTP",
+		Port:                8080,
+		HealthCheckPath:     "/healthz",
+		HealthCheckMatcher:  "200-299",
+		DeregistrationDelay: 30,
+		Tags:                map[string]string{"Color": "blue"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "arn:tg/blue", arn)
+
+	assert.Equal(t, "instance", aws.StringValue(fake.targetGroup.TargetType))
+	assert.Equal(t, "/healthz", aws.StringValue(fake.targetGroup.HealthCheckPath))
+	assert.Equal(t, "200-299", aws.StringValue(fake.targetGroup.Matcher.HttpCode))
+	require.Len(t, fake.targetGroup.Tags, 1)
+
+	require.NotNil(t, fake.attributes)
+	assert.Equal(t, "deregistration_delay.timeout_seconds", aws.StringValue(fake.attributes.Attributes[0].Key))
+	assert.Equal(t, "30", aws.StringValue(fake.attributes.Attributes[0].Value))
+}
+
+func TestRegisterAndDrainTargets(t *testing.T) {
+	fake := &fakeELBV2Client{}
+	c := elbv2utils.Connection{Client: fake}
+
+	require.NoError(t, c.RegisterTargets("arn:tg/blue", elbv2utils.Target{ID: "i-1"}, elbv2utils.Target{ID: "i-2", Port: 9090}))
+	require.Len(t, fake.registered.Targets, 2)
+	assert.Nil(t, fake.registered.Targets[0].Port)
+	assert.Equal(t, int64(9090), aws.Int64Value(fake.registered.Targets[1].Port))
+
+	require.NoError(t, c.WaitForTargetsDeregistered("arn:tg/blue", time.Minute, elbv2utils.Target{ID: "i-1"}))
+	assert.Equal(t, "i-1", aws.StringValue(fake.drained.Targets[0].Id))
+
+	waiter := request.Waiter{}
+	waiter.ApplyOptions(fake.waitOptions...)
+	assert.Equal(t, 5, waiter.MaxAttempts)
+}
+
+func TestGetTargetHealth(t *testing.T) {
+	fake := &fakeELBV2Client{
+		health: []*elbv2.TargetHealthDescription{
+			{
+				Target:       &elbv2.TargetDescription{Id: aws.String("i-2"), Port: aws.Int64(80)},
+				TargetHealth: &elbv2.TargetHealth{State: aws.String("draining"), Reason: aws.String("Target.DeregistrationInProgress")},
+			},
+			{
+				Target:       &elbv2.TargetDescription{Id: aws.String("i-1"), Port: aws.Int64(80)},
+				TargetHealth: &elbv2.TargetHealth{State: aws.String("healthy")},
+			},
+		},
+	}
+	c := elbv2utils.Connection{Client: fake}
+
+	health, err := c.GetTargetHealth("arn:tg/blue")
+	require.NoError(t, err)
+	assert.Equal(t, []elbv2utils.TargetHealth{
+		{ID: "i-1", Port: 80, State: "healthy"},
+		{ID: "i-2", Port: 80, State: "draining", Reason: "Target.DeregistrationInProgress"},
+	}, health)
+}
+
+func TestCreateListener(t *testing.T) {
+	t.Run("https with extra certificates", func(t *testing.T) {
+		fake := &fakeELBV2Client{}
+		c := elbv2utils.Connection{Client: fake}
+
+		arn, err := c.CreateListener(elbv2utils.ListenerParams{
+			LoadBalancerARN: "arn:lb/1",
+			Port:            443,
+			CertificateARNs: []string{"arn:cert/default", "arn:cert/sni"},
+			TargetGroupARN:  "arn:tg/blue",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "arn:listener/1", arn)
+
+		assert.Equal(t, "HTTPS", aws.StringValue(fake.listener.Protocol))
+		assert.NotEmpty(t, aws.StringValue(fake.listener.SslPolicy))
+		assert.Equal(t, "arn:cert/default", aws.StringValue(fake.listener.Certificates[0].CertificateArn))
+		assert.Equal(t, "arn:tg/blue", aws.StringValue(fake.listener.DefaultActions[0].TargetGroupArn))
+
+		require.NotNil(t, fake.certificates)
+		assert.Equal(t, "arn:cert/sni", aws.StringValue(fake.certificates.Certificates[0].CertificateArn))
+	})
+
+	t.Run("https without certificate", func(t *testing.T) {
+		fake := &fakeELBV2Client{}
+		c := elbv2utils.Connection{Client: fake}
+
+		_, err := c.CreateListener(elbv2utils.ListenerParams{
+			LoadBalancerARN: "arn:lb/1",
+			Protocol:        "HTTPS",
+			Port:            443,
+			TargetGroupARN:  "arn:tg/blue",
+		})
+		assert.Error(t, err)
+		assert.Nil(t, fake.listener)
+	})
+}
+
+func TestSwapListenerTargetGroup(t *testing.T) {
+	fake := &fakeELBV2Client{}
+	c := elbv2utils.Connection{Client: fake}
+
+	require.NoError(t, c.SwapListenerTargetGroup("arn:listener/1", "arn:tg/green"))
+	assert.Equal(t, "forward", aws.StringValue(fake.modified.DefaultActions[0].Type))
+	assert.Equal(t, "arn:tg/green", aws.StringValue(fake.modified.DefaultActions[0].TargetGroupArn))
+}
@@ -16,6 +16,7 @@ require (
 	github.com/magefile/mage v1.15.0
 	github.com/spf13/afero v1.11.0
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.25.0
 )
 
 require (
@@ -55,7 +56,6 @@ require (
 	github.com/skeema/knownhosts v1.2.2 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
 	github.com/xanzy/ssh-agent v0.3.3 // indirect
-	golang.org/x/crypto v0.25.0 // indirect
 	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
@@ -0,0 +1,731 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3control"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Severities of audit findings.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+// Checks performed by AuditBucket.
+const (
+	CheckPublicACL         = "S3_PUBLIC_ACL"
+	CheckPublicPolicy      = "S3_PUBLIC_POLICY"
+	CheckPublicAccessBlock = "S3_PUBLIC_ACCESS_BLOCK"
+	CheckEncryption        = "S3_DEFAULT_ENCRYPTION"
+	CheckVersioning        = "S3_VERSIONING"
+	CheckLogging           = "S3_ACCESS_LOGGING"
+	CheckLifecycle         = "S3_LIFECYCLE"
+	CheckSecureTransport   = "S3_SECURE_TRANSPORT"
+)
+
+// auditChecks describes each check for SARIF output.
+var auditChecks = []struct {
+	id          string
+	severity    string
+	description string
+}{
+	{CheckPublicACL, SeverityHigh, "Bucket ACL grants access to everyone or to all authenticated AWS users."},
+	{CheckPublicPolicy, SeverityHigh, "Bucket policy allows access to anonymous principals."},
+	{CheckPublicAccessBlock, SeverityHigh, "Bucket does not block all public access."},
+	{CheckEncryption, SeverityMedium, "Bucket has no default encryption."},
+	{CheckVersioning, SeverityMedium, "Bucket versioning is not enabled."},
+	{CheckLogging, SeverityLow, "Bucket server access logging is not enabled."},
+	{CheckLifecycle, SeverityLow, "Bucket has no enabled lifecycle rules."},
+	{CheckSecureTransport, SeverityMedium, "Bucket policy does not deny requests without TLS (aws:SecureTransport)."},
+}
+
+// publicGrantees are the ACL groups that make a bucket public.
+var publicGrantees = map[string]bool{
+	"http://acs.amazonaws.com/groups/global/AllUsers":           true,
+	"http://acs.amazonaws.com/groups/global/AuthenticatedUsers": true,
+}
+
+// restrictingConditionKeys are the condition keys that restrict an
+// otherwise public statement to known accounts or networks.
+var restrictingConditionKeys = map[string]bool{
+	"aws:principalaccount":      true,
+	"aws:principalarn":          true,
+	"aws:principalorgid":        true,
+	"aws:principalorgpaths":     true,
+	"aws:sourceaccount":         true,
+	"aws:sourcearn":             true,
+	"aws:sourceip":              true,
+	"aws:sourceorgid":           true,
+	"aws:sourceorgpaths":        true,
+	"aws:sourcevpc":             true,
+	"aws:sourcevpce":            true,
+	"aws:userid":                true,
+	"aws:username":              true,
+	"s3:dataaccesspointaccount": true,
+	"s3:dataaccesspointarn":     true,
+}
+
+// restrictingConditionOperators are the condition operators that only
+// match the values they are given. Negated operators, and IfExists
+// variants that match requests without the key, do not restrict.
+var restrictingConditionOperators = map[string]bool{
+	"stringequals":           true,
+	"stringequalsignorecase": true,
+	"stringlike":             true,
+	"arnequals":              true,
+	"arnlike":                true,
+	"ipaddress":              true,
+}
+
+// anyNetworkConditionValues are the IP address
+// condition values that match any network.
+var anyNetworkConditionValues = map[string]bool{
+	"0.0.0.0/0": true,
+	"::/0":      true,
+}
+
+// Finding is a struct that describes an issue
+// found by a bucket security audit.
+//
+// **Attributes:**
+//
+// Bucket: The name of the bucket.
+// Check: The check that found the issue, such as CheckVersioning.
+// Severity: The severity of the issue, SeverityHigh, SeverityMedium or SeverityLow.
+// Message: A description of the issue.
+type Finding struct {
+	Bucket   string `json:"bucket"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// PolicyAnalysis is a struct that describes
+// the security of a bucket policy.
+//
+// **Attributes:**
+//
+// PublicStatements: The Sids, or indexes if unnamed, of the statements that allow anonymous access.
+// EnforcesSecureTransport: Whether the policy denies all requests not sent over TLS.
+type PolicyAnalysis struct {
+	PublicStatements        []string
+	EnforcesSecureTransport bool
+}
+
+// policyValues is a policy element that is either a single value or
+// a list of values. Values such as booleans in conditions are kept
+// in their string form.
+type policyValues []string
+
+func (v *policyValues) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		items = []interface{}{raw}
+	}
+
+	*v = make(policyValues, 0, len(items))
+	for _, item := range items {
+		switch item.(type) {
+		case string, bool, float64:
+			*v = append(*v, fmt.Sprint(item))
+		default:
+			return fmt.Errorf("unexpected policy value %s", data)
+		}
+	}
+	return nil
+}
+
+// contains returns whether any of the values matches one of the
+// input values, case-insensitively.
+func (v policyValues) contains(values ...string) bool {
+	for _, have := range v {
+		for _, want := range values {
+			if strings.EqualFold(have, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policyPrincipal is a policy principal, either "*"
+// or a map of principal types to principals.
+type policyPrincipal map[string]policyValues
+
+func (p *policyPrincipal) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = policyPrincipal{"*": {single}}
+		return nil
+	}
+	var principals map[string]policyValues
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return err
+	}
+	*p = principals
+	return nil
+}
+
+// anonymous returns whether the principal includes everyone.
+func (p policyPrincipal) anonymous() bool {
+	return p["*"].contains("*") || p["AWS"].contains("*")
+}
+
+type policyStatement struct {
+	Sid       string
+	Effect    string
+	Principal policyPrincipal
+	Action    policyValues
+	Condition map[string]map[string]policyValues
+}
+
+// policyStatements is the Statement element of a policy, either
+// a single statement or a list of statements.
+type policyStatements []policyStatement
+
+func (s *policyStatements) UnmarshalJSON(data []byte) error {
+	var single policyStatement
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = policyStatements{single}
+		return nil
+	}
+	var list []policyStatement
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// AnalyzePolicy analyzes a bucket policy document without calling AWS.
+// A statement is public if it allows an anonymous principal without a
+// condition restricting it to known accounts or networks. The policy
+// enforces secure transport if it denies every S3 action to everyone
+// when aws:SecureTransport is false.
+//
+// **Parameters:**
+//
+// policy: The JSON policy document.
+//
+// **Returns:**
+//
+// PolicyAnalysis: The analysis of the policy.
+// error: An error if the policy could not be parsed.
+func AnalyzePolicy(policy string) (PolicyAnalysis, error) {
+	var doc struct {
+		Statement policyStatements
+	}
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		return PolicyAnalysis{}, fmt.Errorf("error parsing policy: %v", err)
+	}
+
+	var analysis PolicyAnalysis
+	for i, statement := range doc.Statement {
+		switch {
+		case strings.EqualFold(statement.Effect, "Allow"):
+			if statement.Principal.anonymous() && !statement.restricted() {
+				name := statement.Sid
+				if name == "" {
+					name = fmt.Sprint(i)
+				}
+				analysis.PublicStatements = append(analysis.PublicStatements, name)
+			}
+		case strings.EqualFold(statement.Effect, "Deny"):
+			if statement.Principal.anonymous() && statement.Action.contains("*", "s3:*") && statement.deniesInsecureTransport() {
+				analysis.EnforcesSecureTransport = true
+			}
+		}
+	}
+
+	return analysis, nil
+}
+
+// restricted returns whether a condition of the statement restricts
+// it to known accounts or networks: a positive operator, such as
+// StringEquals or IpAddress, on a restricting key whose values do
+// not match everyone.
+func (s policyStatement) restricted() bool {
+	for operator, conditions := range s.Condition {
+		if !restrictingConditionOperators[strings.ToLower(operator)] {
+			continue
+		}
+		for key, values := range conditions {
+			if restrictingConditionKeys[strings.ToLower(key)] && len(values) > 0 && !values.matchesAnyone() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesAnyone returns whether any of the condition values
+// matches every account or network, such as "*" or 0.0.0.0/0.
+func (v policyValues) matchesAnyone() bool {
+	for _, value := range v {
+		if anyNetworkConditionValues[value] || strings.Trim(value, "*?") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// deniesInsecureTransport returns whether the statement
+// applies to requests where aws:SecureTransport is false.
+func (s policyStatement) deniesInsecureTransport() bool {
+	for operator, conditions := range s.Condition {
+		if !strings.EqualFold(operator, "Bool") && !strings.EqualFold(operator, "BoolIfExists") {
+			continue
+		}
+		for key, values := range conditions {
+			if strings.EqualFold(key, "aws:SecureTransport") && values.contains("false") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AuditBuckets audits every bucket returned by GetBuckets
+// with AuditBucket.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+//
+// **Returns:**
+//
+// []Finding: The findings of all buckets, sorted by bucket and check.
+// error: An error joining the errors of the checks that could not be performed.
+func AuditBuckets(client *s3.S3) ([]Finding, error) {
+	buckets, err := GetBuckets(client)
+	if err != nil {
+		return nil, fmt.Errorf("error listing buckets: %v", err)
+	}
+
+	// The public access block of the account is
+	// only looked up once for all buckets.
+	account := &accountAudit{client: client}
+	var findings []Finding
+	var errs []error
+	for _, bucket := range buckets {
+		bucketFindings, err := auditBucket(client, aws.StringValue(bucket.Name), account)
+		findings = append(findings, bucketFindings...)
+		errs = append(errs, err)
+	}
+
+	return findings, errors.Join(errs...)
+}
+
+// AuditBucket checks the security posture of the bucket specified by
+// bucketName: public ACLs or policies, public access that is not
+// blocked, missing default encryption, versioning, access logging
+// or lifecycle rules, and a policy that does not enforce TLS. Public
+// access blocked by the account, which requires s3:GetAccountPublicAccessBlock
+// and sts:GetCallerIdentity to check, is not reported. A check that
+// fails, such as for lack of permissions, does not stop the others.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to audit.
+//
+// **Returns:**
+//
+// []Finding: The findings of the bucket, sorted by check.
+// error: An error joining the errors of the checks that could not be performed.
+func AuditBucket(client *s3.S3, bucketName string) ([]Finding, error) {
+	return auditBucket(client, bucketName, &accountAudit{client: client})
+}
+
+// auditBucket audits a bucket, looking up the settings
+// of its account through account when needed.
+func auditBucket(client *s3.S3, bucketName string, account *accountAudit) ([]Finding, error) {
+	location, err := client.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		return nil, fmt.Errorf("error getting location of %s: %v", bucketName, err)
+	}
+	client, err = clientForRegion(client, s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint)))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &bucketAudit{client: client, bucket: bucketName, account: account}
+	a.checkACL()
+	a.checkPolicy()
+	a.checkPublicAccessBlock()
+	a.checkEncryption()
+	a.checkVersioning()
+	a.checkLogging()
+	a.checkLifecycle()
+
+	sort.SliceStable(a.findings, func(i, j int) bool {
+		return a.findings[i].Check < a.findings[j].Check
+	})
+	return a.findings, errors.Join(a.errs...)
+}
+
+// bucketAudit collects the findings and errors of the checks of a bucket.
+type bucketAudit struct {
+	client   *s3.S3
+	bucket   string
+	account  *accountAudit
+	findings []Finding
+	errs     []error
+}
+
+// accountAudit looks up the public access block of the
+// account of the client's credentials on first use.
+type accountAudit struct {
+	client *s3.S3
+	loaded bool
+	block  *s3control.PublicAccessBlockConfiguration
+	err    error
+}
+
+// publicAccessBlock returns the public access block of
+// the account, or nil if the account has none.
+func (a *accountAudit) publicAccessBlock() (*s3control.PublicAccessBlockConfiguration, error) {
+	if a.loaded {
+		return a.block, a.err
+	}
+	a.loaded = true
+
+	sess, err := session.NewSession(a.client.Config.Copy())
+	if err != nil {
+		a.err = fmt.Errorf("error creating session: %v", err)
+		return nil, a.err
+	}
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		a.err = fmt.Errorf("error getting account ID: %v", err)
+		return nil, a.err
+	}
+
+	out, err := s3control.New(sess).GetPublicAccessBlock(&s3control.GetPublicAccessBlockInput{AccountId: identity.Account})
+	switch {
+	case awsErrorCode(err) == s3control.ErrCodeNoSuchPublicAccessBlockConfiguration:
+	case err != nil:
+		a.err = fmt.Errorf("error getting public access block of account %s: %v", aws.StringValue(identity.Account), err)
+	default:
+		a.block = out.PublicAccessBlockConfiguration
+	}
+	return a.block, a.err
+}
+
+// add records a finding of a check.
+func (a *bucketAudit) add(check, severity, format string, args ...interface{}) {
+	a.findings = append(a.findings, Finding{
+		Bucket:   a.bucket,
+		Check:    check,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// failed records that a check could not be performed.
+func (a *bucketAudit) failed(check string, err error) {
+	a.errs = append(a.errs, fmt.Errorf("error running %s on %s: %v", check, a.bucket, err))
+}
+
+func (a *bucketAudit) checkACL() {
+	acl, err := a.client.GetBucketAcl(&s3.GetBucketAclInput{Bucket: aws.String(a.bucket)})
+	if err != nil {
+		a.failed(CheckPublicACL, err)
+		return
+	}
+
+	for _, grant := range acl.Grants {
+		if grant.Grantee == nil || !publicGrantees[aws.StringValue(grant.Grantee.URI)] {
+			continue
+		}
+		a.add(CheckPublicACL, SeverityHigh, "ACL grants %s to %s", aws.StringValue(grant.Permission), aws.StringValue(grant.Grantee.URI))
+	}
+}
+
+func (a *bucketAudit) checkPolicy() {
+	out, err := a.client.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(a.bucket)})
+	if awsErrorCode(err) == "NoSuchBucketPolicy" {
+		a.add(CheckSecureTransport, SeverityMedium, "bucket has no policy denying requests without TLS")
+		return
+	}
+	if err != nil {
+		a.failed(CheckPublicPolicy, err)
+		return
+	}
+
+	analysis, err := AnalyzePolicy(aws.StringValue(out.Policy))
+	if err != nil {
+		a.failed(CheckPublicPolicy, err)
+		return
+	}
+	if len(analysis.PublicStatements) > 0 {
+		a.add(CheckPublicPolicy, SeverityHigh, "policy statements %s allow anonymous access", strings.Join(analysis.PublicStatements, ", "))
+	}
+	if !analysis.EnforcesSecureTransport {
+		a.add(CheckSecureTransport, SeverityMedium, "policy does not deny requests without TLS")
+	}
+}
+
+func (a *bucketAudit) checkPublicAccessBlock() {
+	out, err := a.client.GetPublicAccessBlock(&s3.GetPublicAccessBlockInput{Bucket: aws.String(a.bucket)})
+	bucketConfig := &s3.PublicAccessBlockConfiguration{}
+	hasBucketBlock := false
+	switch {
+	case awsErrorCode(err) == "NoSuchPublicAccessBlockConfiguration":
+	case err != nil:
+		a.failed(CheckPublicAccessBlock, err)
+		return
+	default:
+		bucketConfig, hasBucketBlock = out.PublicAccessBlockConfiguration, true
+	}
+
+	disabled := disabledPublicAccessBlocks(bucketConfig.BlockPublicAcls, bucketConfig.IgnorePublicAcls,
+		bucketConfig.BlockPublicPolicy, bucketConfig.RestrictPublicBuckets)
+	if len(disabled) == 0 {
+		return
+	}
+
+	// Settings enabled on the account apply to all of its buckets.
+	account, err := a.account.publicAccessBlock()
+	if err != nil {
+		a.failed(CheckPublicAccessBlock, err)
+		return
+	}
+	if account != nil {
+		accountDisabled := disabledPublicAccessBlocks(account.BlockPublicAcls, account.IgnorePublicAcls,
+			account.BlockPublicPolicy, account.RestrictPublicBuckets)
+		var both []string
+		for _, name := range disabled {
+			if slices.Contains(accountDisabled, name) {
+				both = append(both, name)
+			}
+		}
+		disabled = both
+	}
+
+	switch {
+	case len(disabled) == 0:
+	case !hasBucketBlock && account == nil:
+		a.add(CheckPublicAccessBlock, SeverityHigh, "neither the bucket nor its account has a public access block")
+	default:
+		a.add(CheckPublicAccessBlock, SeverityHigh, "public access block does not enable %s", strings.Join(disabled, ", "))
+	}
+}
+
+// disabledPublicAccessBlocks returns the names of the
+// public access block settings that are not enabled.
+func disabledPublicAccessBlocks(blockPublicAcls, ignorePublicAcls, blockPublicPolicy, restrictPublicBuckets *bool) []string {
+	var disabled []string
+	for _, setting := range []struct {
+		name    string
+		enabled *bool
+	}{
+		{"BlockPublicAcls", blockPublicAcls},
+		{"BlockPublicPolicy", blockPublicPolicy},
+		{"IgnorePublicAcls", ignorePublicAcls},
+		{"RestrictPublicBuckets", restrictPublicBuckets},
+	} {
+		if !aws.BoolValue(setting.enabled) {
+			disabled = append(disabled, setting.name)
+		}
+	}
+	return disabled
+}
+
+func (a *bucketAudit) checkEncryption() {
+	_, err := a.client.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(a.bucket)})
+	if awsErrorCode(err) == "ServerSideEncryptionConfigurationNotFoundError" {
+		a.add(CheckEncryption, SeverityMedium, "bucket has no default encryption")
+		return
+	}
+	if err != nil {
+		a.failed(CheckEncryption, err)
+	}
+}
+
+func (a *bucketAudit) checkVersioning() {
+	out, err := a.client.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String(a.bucket)})
+	if err != nil {
+		a.failed(CheckVersioning, err)
+		return
+	}
+	if aws.StringValue(out.Status) != s3.BucketVersioningStatusEnabled {
+		a.add(CheckVersioning, SeverityMedium, "versioning is not enabled")
+	}
+}
+
+func (a *bucketAudit) checkLogging() {
+	out, err := a.client.GetBucketLogging(&s3.GetBucketLoggingInput{Bucket: aws.String(a.bucket)})
+	if err != nil {
+		a.failed(CheckLogging, err)
+		return
+	}
+	if out.LoggingEnabled == nil {
+		a.add(CheckLogging, SeverityLow, "server access logging is not enabled")
+	}
+}
+
+func (a *bucketAudit) checkLifecycle() {
+	out, err := a.client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(a.bucket)})
+	if awsErrorCode(err) == "NoSuchLifecycleConfiguration" {
+		a.add(CheckLifecycle, SeverityLow, "bucket has no lifecycle rules")
+		return
+	}
+	if err != nil {
+		a.failed(CheckLifecycle, err)
+		return
+	}
+
+	for _, rule := range out.Rules {
+		if aws.StringValue(rule.Status) == s3.ExpirationStatusEnabled {
+			return
+		}
+	}
+	a.add(CheckLifecycle, SeverityLow, "bucket has no enabled lifecycle rules")
+}
+
+// WriteFindingsJSON writes findings to w as a JSON array.
+//
+// **Parameters:**
+//
+// w: Where the findings are written to.
+// findings: The findings to write.
+//
+// **Returns:**
+//
+// error: An error if the findings could not be written.
+func WriteFindingsJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver sarifDriver `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifLevel returns the SARIF level of a severity.
+func sarifLevel(severity string) string {
+	switch severity {
+	case SeverityHigh:
+		return "error"
+	case SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// WriteFindingsSARIF writes findings to w as a SARIF 2.1.0 log,
+// such as for code scanning tools. Each bucket is reported as
+// the location s3://<bucket>.
+//
+// **Parameters:**
+//
+// w: Where the findings are written to.
+// findings: The findings to write.
+//
+// **Returns:**
+//
+// error: An error if the findings could not be written.
+func WriteFindingsSARIF(w io.Writer, findings []Finding) error {
+	var run sarifRun
+	run.Tool.Driver = sarifDriver{Name: "awsutils-s3-audit", InformationURI: "https://github.com/l50/awsutils"}
+	for _, check := range auditChecks {
+		rule := sarifRule{ID: check.id, ShortDescription: sarifMessage{Text: check.description}}
+		rule.DefaultConfiguration.Level = sarifLevel(check.severity)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+	}
+
+	run.Results = []sarifResult{}
+	for _, finding := range findings {
+		var location sarifLocation
+		location.PhysicalLocation.ArtifactLocation.URI = "s3://" + finding.Bucket
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    finding.Check,
+			Level:     sarifLevel(finding.Severity),
+			Message:   sarifMessage{Text: fmt.Sprintf("%s: %s", finding.Bucket, finding.Message)},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// awsErrorCode returns the code of an AWS error, or an
+// empty string if err is nil or not an AWS error.
+func awsErrorCode(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	return ""
+}
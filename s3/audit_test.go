@@ -0,0 +1,310 @@
+package s3_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secureTransportPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [{
+		"Sid": "DenyInsecureTransport",
+		"Effect": "Deny",
+		"Principal": "*",
+		"Action": "s3:*",
+		"Resource": ["arn:aws:s3:::hardened", "arn:aws:s3:::hardened/*"],
+		"Condition": {"Bool": {"aws:SecureTransport": "false"}}
+	}]
+}`
+
+func TestAnalyzePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		wantPublic []string
+		wantSecure bool
+		wantErr    bool
+	}{
+		{
+			name:       "enforces secure transport",
+			policy:     secureTransportPolicy,
+			wantSecure: true,
+		},
+		{
+			name: "secure transport as boolean",
+			policy: `{"Statement": {"Effect": "Deny", "Principal": {"AWS": "*"}, "Action": "*",
+				"Condition": {"BoolIfExists": {"aws:SecureTransport": false}}}}`,
+			wantSecure: true,
+		},
+		{
+			name: "secure transport for some actions only",
+			policy: `{"Statement": [{"Effect": "Deny", "Principal": "*", "Action": ["s3:PutObject"],
+				"Condition": {"Bool": {"aws:SecureTransport": "false"}}}]}`,
+		},
+		{
+			name:       "public read",
+			policy:     `{"Statement": [{"Sid": "PublicRead", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::site/*"}]}`,
+			wantPublic: []string{"PublicRead"},
+		},
+		{
+			name: "unnamed public statement",
+			policy: `{"Statement": [
+				{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111122223333:root"}, "Action": "s3:*"},
+				{"Effect": "Allow", "Principal": {"AWS": ["*"]}, "Action": ["s3:ListBucket"]}
+			]}`,
+			wantPublic: []string{"1"},
+		},
+		{
+			name: "anonymous principal restricted to a VPC endpoint",
+			policy: `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+				"Condition": {"StringEquals": {"aws:SourceVpce": "vpce-1a2b3c4d"}}}]}`,
+		},
+		{
+			name: "anonymous principal with unrelated condition",
+			policy: `{"Statement": [{"Sid": "TLSOnly", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+				"Condition": {"Bool": {"aws:SecureTransport": "true"}}}]}`,
+			wantPublic: []string{"TLSOnly"},
+		},
+		{
+			name: "negated IP address condition",
+			policy: `{"Statement": [{"Sid": "NotOffice", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+				"Condition": {"NotIpAddress": {"aws:SourceIp": "203.0.113.0/24"}}}]}`,
+			wantPublic: []string{"NotOffice"},
+		},
+		{
+			name: "IP address condition matching any network",
+			policy: `{"Statement": [{"Sid": "AnyIP", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+				"Condition": {"IpAddress": {"aws:SourceIp": "0.0.0.0/0"}}}]}`,
+			wantPublic: []string{"AnyIP"},
+		},
+		{
+			name: "principal ARN condition matching any principal",
+			policy: `{"Statement": [{"Sid": "AnyPrincipal", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+				"Condition": {"StringLike": {"aws:PrincipalArn": "*"}}}]}`,
+			wantPublic: []string{"AnyPrincipal"},
+		},
+		{
+			name: "anonymous principal restricted to an account's principals",
+			policy: `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+				"Condition": {"ArnLike": {"aws:PrincipalArn": "arn:aws:iam::111122223333:*"}}}]}`,
+		},
+		{
+			name:    "invalid policy",
+			policy:  `{"Statement": [`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			analysis, err := s3utils.AnalyzePolicy(tc.policy)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPublic, analysis.PublicStatements)
+			assert.Equal(t, tc.wantSecure, analysis.EnforcesSecureTransport)
+		})
+	}
+}
+
+// findingChecks returns the checks of findings.
+func findingChecks(findings []s3utils.Finding) []string {
+	checks := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		checks = append(checks, finding.Check)
+	}
+	return checks
+}
+
+// setupAuditBuckets creates an open bucket with a public ACL and
+// policy, and a hardened bucket that passes every check.
+func setupAuditBuckets(t *testing.T, client *s3.S3, fake *fakeS3) {
+	t.Helper()
+
+	fake.addObject("open", "index.html", []byte("<html/>"), time.Now())
+	_, err := client.PutBucketAcl(&s3.PutBucketAclInput{
+		Bucket: aws.String("open"),
+		AccessControlPolicy: &s3.AccessControlPolicy{
+			Owner: &s3.Owner{ID: aws.String("owner")},
+			Grants: []*s3.Grant{{
+				Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+				Permission: aws.String(s3.PermissionRead),
+			}},
+		},
+	})
+	require.NoError(t, err)
+	_, err = client.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String("open"),
+		Policy: aws.String(`{"Statement": [{"Sid": "PublicRead", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::open/*"}]}`),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s3utils.CreateBucketWithConfig(client, "hardened", s3utils.DefaultBucketConfig("us-west-1")))
+	_, err = client.PutBucketLogging(&s3.PutBucketLoggingInput{
+		Bucket: aws.String("hardened"),
+		BucketLoggingStatus: &s3.BucketLoggingStatus{
+			LoggingEnabled: &s3.LoggingEnabled{TargetBucket: aws.String("logs"), TargetPrefix: aws.String("hardened/")},
+		},
+	})
+	require.NoError(t, err)
+	_, err = client.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String("hardened"),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
+			Rules: []*s3.LifecycleRule{{
+				ID:                          aws.String("expire-noncurrent"),
+				Status:                      aws.String(s3.ExpirationStatusEnabled),
+				Filter:                      &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+				NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(30)},
+			}},
+		},
+	})
+	require.NoError(t, err)
+	_, err = client.PutBucketPolicy(&s3.PutBucketPolicyInput{Bucket: aws.String("hardened"), Policy: aws.String(secureTransportPolicy)})
+	require.NoError(t, err)
+}
+
+func TestAuditBuckets(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	setupAuditBuckets(t, client, fake)
+
+	findings, err := s3utils.AuditBuckets(client)
+	require.NoError(t, err)
+
+	for _, finding := range findings {
+		assert.Equal(t, "open", finding.Bucket)
+	}
+	assert.Equal(t, []string{
+		s3utils.CheckLogging,
+		s3utils.CheckEncryption,
+		s3utils.CheckLifecycle,
+		s3utils.CheckPublicAccessBlock,
+		s3utils.CheckPublicACL,
+		s3utils.CheckPublicPolicy,
+		s3utils.CheckSecureTransport,
+		s3utils.CheckVersioning,
+	}, findingChecks(findings))
+	assert.Contains(t, findings[4].Message, "AllUsers")
+	assert.Equal(t, s3utils.SeverityHigh, findings[4].Severity)
+	assert.Contains(t, findings[5].Message, "PublicRead")
+}
+
+func TestAuditBucketErrors(t *testing.T) {
+	client, fake := newFakeS3Client(t, map[string]fakeS3Error{
+		"GetBucketLogging": {Status: http.StatusForbidden, Code: "AccessDenied"},
+	})
+	setupAuditBuckets(t, client, fake)
+
+	// A check that can not be performed does not stop the others.
+	findings, err := s3utils.AuditBucket(client, "open")
+	assert.ErrorContains(t, err, s3utils.CheckLogging)
+	assert.Len(t, findings, 7)
+	assert.NotContains(t, findingChecks(findings), s3utils.CheckLogging)
+
+	_, err = s3utils.AuditBucket(client, "missing")
+	assert.Error(t, err)
+}
+
+func TestAuditBucketAccountPublicAccessBlock(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	setupAuditBuckets(t, client, fake)
+
+	// Settings enabled on the account apply to the bucket.
+	fake.setAccountPublicAccessBlock("BlockPublicAcls", "IgnorePublicAcls")
+	findings, err := s3utils.AuditBucket(client, "open")
+	require.NoError(t, err)
+	require.Contains(t, findingChecks(findings), s3utils.CheckPublicAccessBlock)
+	assert.Equal(t, "public access block does not enable BlockPublicPolicy, RestrictPublicBuckets", findings[3].Message)
+
+	fake.setAccountPublicAccessBlock("BlockPublicAcls", "IgnorePublicAcls", "BlockPublicPolicy", "RestrictPublicBuckets")
+	findings, err = s3utils.AuditBucket(client, "open")
+	require.NoError(t, err)
+	assert.NotContains(t, findingChecks(findings), s3utils.CheckPublicAccessBlock)
+
+	// The account is looked up once for all buckets.
+	before := len(fake.requestsFor("GetCallerIdentity"))
+	fake.addObject("open-too", "index.html", []byte("<html/>"), time.Now())
+	_, err = s3utils.AuditBuckets(client)
+	require.NoError(t, err)
+	assert.Len(t, fake.requestsFor("GetCallerIdentity"), before+1)
+}
+
+func TestAuditBucketAccountPublicAccessBlockError(t *testing.T) {
+	client, fake := newFakeS3Client(t, map[string]fakeS3Error{
+		"GetCallerIdentity": {Status: http.StatusForbidden, Code: "AccessDenied"},
+	})
+	setupAuditBuckets(t, client, fake)
+
+	// The account is only needed if the bucket does not block everything.
+	findings, err := s3utils.AuditBucket(client, "hardened")
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+
+	findings, err = s3utils.AuditBucket(client, "open")
+	assert.ErrorContains(t, err, s3utils.CheckPublicAccessBlock)
+	assert.ErrorContains(t, err, "AccessDenied")
+	assert.NotContains(t, findingChecks(findings), s3utils.CheckPublicAccessBlock)
+}
+
+func TestWriteFindings(t *testing.T) {
+	findings := []s3utils.Finding{
+		{Bucket: "open", Check: s3utils.CheckPublicACL, Severity: s3utils.SeverityHigh, Message: "ACL grants READ to everyone"},
+		{Bucket: "open", Check: s3utils.CheckLogging, Severity: s3utils.SeverityLow, Message: "server access logging is not enabled"},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, s3utils.WriteFindingsJSON(&out, findings))
+	var decoded []s3utils.Finding
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, findings, decoded)
+	assert.Contains(t, out.String(), `"check": "S3_PUBLIC_ACL"`)
+
+	out.Reset()
+	require.NoError(t, s3utils.WriteFindingsJSON(&out, nil))
+	assert.Equal(t, "[]\n", out.String())
+
+	out.Reset()
+	require.NoError(t, s3utils.WriteFindingsSARIF(&out, findings))
+	var sarif struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &sarif))
+	assert.Equal(t, "2.1.0", sarif.Version)
+	require.Len(t, sarif.Runs, 1)
+	assert.Len(t, sarif.Runs[0].Tool.Driver.Rules, 8)
+	require.Len(t, sarif.Runs[0].Results, 2)
+	assert.Equal(t, s3utils.CheckPublicACL, sarif.Runs[0].Results[0].RuleID)
+	assert.Equal(t, "error", sarif.Runs[0].Results[0].Level)
+	assert.Equal(t, "note", sarif.Runs[0].Results[1].Level)
+	assert.Equal(t, "s3://open", sarif.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+}
@@ -0,0 +1,230 @@
+package s3
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Default encryption algorithms supported by BucketConfig.
+const (
+	EncryptionSSES3  = s3.ServerSideEncryptionAes256
+	EncryptionSSEKMS = s3.ServerSideEncryptionAwsKms
+)
+
+// BucketConfig is a struct that provides the configuration
+// applied to a bucket by CreateBucketWithConfig.
+//
+// **Attributes:**
+//
+// Region: The region to create the bucket in, defaults to the client's region.
+// Versioning: Whether to enable versioning.
+// Encryption: The default encryption, EncryptionSSES3, EncryptionSSEKMS or empty for none.
+// KMSKeyID: The KMS key used with EncryptionSSEKMS, defaults to the AWS managed key.
+// BucketKey: Whether to use an S3 Bucket Key to reduce KMS requests.
+// BlockPublicAccess: Whether to block all public access.
+// ObjectOwnership: The object ownership setting, such as BucketOwnerEnforced.
+// Tags: The tags of the bucket.
+// LifecycleRules: The lifecycle rules of the bucket.
+type BucketConfig struct {
+	Region            string
+	Versioning        bool
+	Encryption        string
+	KMSKeyID          string
+	BucketKey         bool
+	BlockPublicAccess bool
+	ObjectOwnership   string
+	Tags              map[string]string
+	LifecycleRules    []*s3.LifecycleRule
+}
+
+// DefaultBucketConfig returns a secure-by-default bucket configuration:
+// versioning enabled, SSE-S3 default encryption, all public access
+// blocked and ACLs disabled.
+//
+// **Parameters:**
+//
+// region: The region to create the bucket in, the client's region if empty.
+//
+// **Returns:**
+//
+// BucketConfig: The secure-by-default configuration.
+func DefaultBucketConfig(region string) BucketConfig {
+	return BucketConfig{
+		Region:            region,
+		Versioning:        true,
+		Encryption:        EncryptionSSES3,
+		BlockPublicAccess: true,
+		ObjectOwnership:   s3.ObjectOwnershipBucketOwnerEnforced,
+	}
+}
+
+// CreateBucketWithConfig creates a bucket in the configured region and
+// applies the rest of the configuration. If any step fails, the bucket
+// is deleted again so that no partially configured bucket is left
+// behind. Unlike CreateBucket, a bucket that already exists is an error
+// and is never reconfigured or deleted, including in us-east-1 where
+// creating a bucket you already own succeeds.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to create.
+// config: The configuration to apply to the bucket.
+//
+// **Returns:**
+//
+// error: An error if the bucket could not be created or configured.
+func CreateBucketWithConfig(client *s3.S3, bucketName string, config BucketConfig) error {
+	if config.Encryption != "" && config.Encryption != EncryptionSSES3 && config.Encryption != EncryptionSSEKMS {
+		return fmt.Errorf("unsupported encryption %q", config.Encryption)
+	}
+
+	regional, err := clientForRegion(client, config.Region)
+	if err != nil {
+		return err
+	}
+	region := aws.StringValue(regional.Config.Region)
+
+	input := &s3.CreateBucketInput{
+		Bucket:                    aws.String(bucketName),
+		CreateBucketConfiguration: &s3.CreateBucketConfiguration{},
+	}
+	// us-east-1 is the default location and must not be specified.
+	if region != "us-east-1" {
+		input.CreateBucketConfiguration.LocationConstraint = aws.String(region)
+	}
+	if config.ObjectOwnership != "" {
+		input.ObjectOwnership = aws.String(config.ObjectOwnership)
+	}
+
+	// CreateBucket does not report a bucket we already own in
+	// us-east-1, which must then not be configured or rolled back.
+	if _, err := regional.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucketName)}); err == nil {
+		return fmt.Errorf("bucket %s already exists", bucketName)
+	}
+
+	if _, err := regional.CreateBucket(input); err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+			return fmt.Errorf("bucket %s already exists", bucketName)
+		}
+		return fmt.Errorf("error creating bucket %s in %s: %v", bucketName, region, err)
+	}
+
+	if err := configureBucket(regional, bucketName, config); err != nil {
+		if _, delErr := regional.DeleteBucket(&s3.DeleteBucketInput{
+			Bucket: aws.String(bucketName),
+		}); delErr != nil {
+			return fmt.Errorf("%v (rolling back bucket %s also failed: %v)", err, bucketName, delErr)
+		}
+		return fmt.Errorf("%v (bucket %s was rolled back)", err, bucketName)
+	}
+
+	return nil
+}
+
+// configureBucket applies every setting of the
+// configuration to a newly created bucket.
+func configureBucket(client *s3.S3, bucketName string, config BucketConfig) error {
+	bucket := aws.String(bucketName)
+
+	if config.BlockPublicAccess {
+		if _, err := client.PutPublicAccessBlock(&s3.PutPublicAccessBlockInput{
+			Bucket: bucket,
+			PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(true),
+				BlockPublicPolicy:     aws.Bool(true),
+				IgnorePublicAcls:      aws.Bool(true),
+				RestrictPublicBuckets: aws.Bool(true),
+			},
+		}); err != nil {
+			return fmt.Errorf("error blocking public access to %s: %v", bucketName, err)
+		}
+	}
+
+	if config.Encryption != "" {
+		rule := &s3.ServerSideEncryptionRule{
+			ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+				SSEAlgorithm: aws.String(config.Encryption),
+			},
+		}
+		if config.Encryption == EncryptionSSEKMS {
+			if config.KMSKeyID != "" {
+				rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID = aws.String(config.KMSKeyID)
+			}
+			rule.BucketKeyEnabled = aws.Bool(config.BucketKey)
+		}
+
+		if _, err := client.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+			Bucket: bucket,
+			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+				Rules: []*s3.ServerSideEncryptionRule{rule},
+			},
+		}); err != nil {
+			return fmt.Errorf("error setting default encryption of %s: %v", bucketName, err)
+		}
+	}
+
+	if config.Versioning {
+		if _, err := client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+			Bucket: bucket,
+			VersioningConfiguration: &s3.VersioningConfiguration{
+				Status: aws.String(s3.BucketVersioningStatusEnabled),
+			},
+		}); err != nil {
+			return fmt.Errorf("error enabling versioning of %s: %v", bucketName, err)
+		}
+	}
+
+	if len(config.Tags) > 0 {
+		keys := make([]string, 0, len(config.Tags))
+		for key := range config.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		tagSet := make([]*s3.Tag, 0, len(keys))
+		for _, key := range keys {
+			tagSet = append(tagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(config.Tags[key])})
+		}
+
+		if _, err := client.PutBucketTagging(&s3.PutBucketTaggingInput{
+			Bucket:  bucket,
+			Tagging: &s3.Tagging{TagSet: tagSet},
+		}); err != nil {
+			return fmt.Errorf("error tagging %s: %v", bucketName, err)
+		}
+	}
+
+	if len(config.LifecycleRules) > 0 {
+		if _, err := client.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 bucket,
+			LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: config.LifecycleRules},
+		}); err != nil {
+			return fmt.Errorf("error setting lifecycle rules of %s: %v", bucketName, err)
+		}
+	}
+
+	return nil
+}
+
+// clientForRegion returns the client itself if it is configured for
+// the region, or a copy of it configured for the region otherwise.
+func clientForRegion(client *s3.S3, region string) (*s3.S3, error) {
+	if region == "" || region == aws.StringValue(client.Config.Region) {
+		return client, nil
+	}
+
+	sess, err := session.NewSession(client.Config.Copy(&aws.Config{
+		Region: aws.String(region),
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("error creating session for region %s: %v", region, err)
+	}
+
+	return s3.New(sess), nil
+}
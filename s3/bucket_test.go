@@ -0,0 +1,127 @@
+package s3_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateBucketWithConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		region         string
+		wantConstraint bool
+	}{
+		{name: "client region", wantConstraint: true},
+		{name: "us-east-1", region: "us-east-1"},
+		{name: "other region", region: "eu-west-2", wantConstraint: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, fake := newFakeS3Client(t, nil)
+
+			config := s3utils.DefaultBucketConfig(tc.region)
+			config.Tags = map[string]string{"Team": "red", "Env": "test"}
+			config.LifecycleRules = []*s3.LifecycleRule{{
+				ID:         aws.String("expire"),
+				Status:     aws.String(s3.ExpirationStatusEnabled),
+				Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+				Expiration: &s3.LifecycleExpiration{Days: aws.Int64(30)},
+			}}
+			require.NoError(t, s3utils.CreateBucketWithConfig(client, "secure", config))
+
+			assert.Equal(t, []string{
+				"HeadBucket",
+				"CreateBucket",
+				"PutPublicAccessBlock",
+				"PutBucketEncryption",
+				"PutBucketVersioning",
+				"PutBucketTagging",
+				"PutBucketLifecycleConfiguration",
+			}, fake.operations())
+
+			create := fake.requestsFor("CreateBucket")[0]
+			assert.Equal(t, s3.ObjectOwnershipBucketOwnerEnforced, create.Header.Get("X-Amz-Object-Ownership"))
+			if tc.wantConstraint {
+				region := tc.region
+				if region == "" {
+					region = "us-west-1"
+				}
+				assert.Contains(t, string(create.Body), "<LocationConstraint>"+region+"</LocationConstraint>")
+			} else {
+				assert.NotContains(t, string(create.Body), "LocationConstraint")
+			}
+
+			assert.Contains(t, string(fake.requestsFor("PutBucketEncryption")[0].Body), "<SSEAlgorithm>AES256</SSEAlgorithm>")
+			assert.Contains(t, string(fake.requestsFor("PutBucketVersioning")[0].Body), "<Status>Enabled</Status>")
+		})
+	}
+}
+
+func TestCreateBucketWithConfigKMS(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+
+	require.NoError(t, s3utils.CreateBucketWithConfig(client, "kms", s3utils.BucketConfig{
+		Encryption: s3utils.EncryptionSSEKMS,
+		KMSKeyID:   "alias/bucket",
+		BucketKey:  true,
+	}))
+
+	assert.Equal(t, []string{"HeadBucket", "CreateBucket", "PutBucketEncryption"}, fake.operations())
+	body := string(fake.requestsFor("PutBucketEncryption")[0].Body)
+	assert.Contains(t, body, "<SSEAlgorithm>aws:kms</SSEAlgorithm>")
+	assert.Contains(t, body, "<KMSMasterKeyID>alias/bucket</KMSMasterKeyID>")
+	assert.Contains(t, body, "<BucketKeyEnabled>true</BucketKeyEnabled>")
+}
+
+func TestCreateBucketWithConfigRollback(t *testing.T) {
+	client, fake := newFakeS3Client(t, map[string]fakeS3Error{
+		"PutBucketEncryption": {Status: http.StatusForbidden, Code: "AccessDenied"},
+	})
+
+	err := s3utils.CreateBucketWithConfig(client, "rollback", s3utils.DefaultBucketConfig(""))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AccessDenied")
+	assert.Contains(t, err.Error(), "rolled back")
+
+	assert.Len(t, fake.requestsFor("DeleteBucket"), 1)
+	assert.Empty(t, fake.requestsFor("PutBucketVersioning"))
+	assert.Empty(t, fake.buckets)
+}
+
+func TestCreateBucketWithConfigErrors(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+
+	require.NoError(t, s3utils.CreateBucketWithConfig(client, "existing", s3utils.BucketConfig{}))
+	err := s3utils.CreateBucketWithConfig(client, "existing", s3utils.BucketConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+	// The existing bucket must not be rolled back.
+	assert.Empty(t, fake.requestsFor("DeleteBucket"))
+
+	err = s3utils.CreateBucketWithConfig(client, "invalid", s3utils.BucketConfig{Encryption: "DES"})
+	assert.Error(t, err)
+	assert.Len(t, fake.requestsFor("CreateBucket"), 1)
+}
+
+func TestCreateBucketWithConfigExistingInUSEast1(t *testing.T) {
+	client, fake := newFakeS3Client(t, map[string]fakeS3Error{
+		"PutPublicAccessBlock": {Status: http.StatusForbidden, Code: "AccessDenied"},
+	})
+	fake.addBucket("legacy", "")
+
+	// Creating the empty bucket again would succeed in us-east-1, so
+	// it must be detected before it is configured and rolled back.
+	err := s3utils.CreateBucketWithConfig(client, "legacy", s3utils.DefaultBucketConfig("us-east-1"))
+	assert.ErrorContains(t, err, "already exists")
+	assert.Empty(t, fake.requestsFor("CreateBucket"))
+	assert.Empty(t, fake.requestsFor("PutPublicAccessBlock"))
+	assert.Empty(t, fake.requestsFor("DeleteBucket"))
+	assert.Contains(t, fake.buckets, "legacy")
+}
@@ -0,0 +1,497 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// maxCopyObjectSize is the largest object a single CopyObject
+	// request can copy, larger objects are copied in parts.
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// defaultCopyPartSize is the size of each part copied by
+	// UploadPartCopy if no part size is set.
+	defaultCopyPartSize = 512 * 1024 * 1024
+)
+
+// CopyOptions is a struct that provides the options used by
+// CopyObject, MoveObject, CopyPrefix and MovePrefix.
+//
+// **Attributes:**
+//
+// DestinationClient: The client the destination is written with, defaults to the source client. Use a client of another region or account to copy across them, whose credentials must be able to read the source.
+// ACL: The canned ACL of the copies, such as "bucket-owner-full-control" when writing to a bucket of another account.
+// StorageClass: The storage class of the copies, defaults to STANDARD.
+// ReplaceMetadata: Whether to replace the Content-Type and metadata of the copies rather than preserving those of the sources.
+// ContentType: The Content-Type of the copies, if ReplaceMetadata is set.
+// Metadata: The user-defined metadata of the copies, if ReplaceMetadata is set.
+// ReplaceTags: Whether to replace the tags of the copies rather than preserving those of the sources.
+// Tags: The tags of the copies, if ReplaceTags is set.
+// MultipartThreshold: The size from which objects are copied in parts, defaults to and is at most 5 GiB.
+// PartSize: The size of each part copied in bytes, defaults to 512 MiB.
+// Workers: The number of objects, or parts of an object, copied concurrently, defaults to 4.
+type CopyOptions struct {
+	DestinationClient  *s3.S3
+	ACL                string
+	StorageClass       string
+	ReplaceMetadata    bool
+	ContentType        string
+	Metadata           map[string]string
+	ReplaceTags        bool
+	Tags               map[string]string
+	MultipartThreshold int64
+	PartSize           int64
+	Workers            int
+}
+
+// CopyFailure is a struct that describes an object
+// that could not be copied or moved.
+//
+// **Attributes:**
+//
+// Key: The key of the source object.
+// Err: The error that occurred.
+type CopyFailure struct {
+	Key string
+	Err error
+}
+
+// CopyResult is a struct that summarizes the
+// copy or move of the objects under a prefix.
+//
+// **Attributes:**
+//
+// Copied: The keys of the source objects copied, or moved, in key order.
+// Failed: The objects that could not be copied, or moved, in key order.
+// Bytes: The number of bytes copied.
+type CopyResult struct {
+	Copied []string
+	Failed []CopyFailure
+	Bytes  int64
+}
+
+// CopyObject copies an object within S3, without downloading it,
+// from srcKey of the bucket specified by srcBucket to dstKey of the
+// bucket specified by dstBucket. Objects larger than the multipart
+// threshold are copied in concurrent parts with UploadPartCopy. The
+// metadata and tags of the source are preserved unless the options
+// replace them.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client of the source bucket's region.
+// srcBucket: The name of the bucket to copy from.
+// srcKey: The key of the object to copy.
+// dstBucket: The name of the bucket to copy to.
+// dstKey: The key of the copy.
+// opts: The options of the copy.
+//
+// **Returns:**
+//
+// error: An error if the object could not be copied.
+func CopyObject(client *s3.S3, srcBucket string, srcKey string, dstBucket string, dstKey string, opts CopyOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	_, err := opts.copyObject(client, srcBucket, srcKey, -1, dstBucket, dstKey)
+	return err
+}
+
+// MoveObject copies an object like CopyObject and then
+// deletes the source object.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client of the source bucket's region.
+// srcBucket: The name of the bucket to move from.
+// srcKey: The key of the object to move.
+// dstBucket: The name of the bucket to move to.
+// dstKey: The key of the moved object.
+// opts: The options of the move.
+//
+// **Returns:**
+//
+// error: An error if the object could not be moved.
+func MoveObject(client *s3.S3, srcBucket string, srcKey string, dstBucket string, dstKey string, opts CopyOptions) error {
+	if srcBucket == dstBucket && srcKey == dstKey {
+		return fmt.Errorf("can not move %s onto itself", srcKey)
+	}
+	if err := CopyObject(client, srcBucket, srcKey, dstBucket, dstKey, opts); err != nil {
+		return err
+	}
+
+	if _, err := client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	}); err != nil {
+		return fmt.Errorf("error deleting %s from %s after copying it: %v", srcKey, srcBucket, err)
+	}
+	return nil
+}
+
+// CopyPrefix concurrently copies the objects under srcPrefix of the
+// bucket specified by srcBucket to the same keys under dstPrefix of
+// the bucket specified by dstBucket, as CopyObject does. A failed
+// object does not stop the others from being copied.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client of the source bucket's region.
+// srcBucket: The name of the bucket to copy from.
+// srcPrefix: The prefix of the objects to copy.
+// dstBucket: The name of the bucket to copy to.
+// dstPrefix: The prefix the keys of the copies start with instead.
+// opts: The options of the copy.
+//
+// **Returns:**
+//
+// CopyResult: A summary of the objects copied and those that failed.
+// error: An error joining the errors of the objects that could not be copied.
+func CopyPrefix(client *s3.S3, srcBucket string, srcPrefix string, dstBucket string, dstPrefix string, opts CopyOptions) (CopyResult, error) {
+	return copyPrefix(client, srcBucket, srcPrefix, dstBucket, dstPrefix, opts, false)
+}
+
+// MovePrefix copies the objects under a prefix like CopyPrefix and
+// then deletes the source objects that were copied.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client of the source bucket's region.
+// srcBucket: The name of the bucket to move from.
+// srcPrefix: The prefix of the objects to move.
+// dstBucket: The name of the bucket to move to.
+// dstPrefix: The prefix the keys of the moved objects start with instead.
+// opts: The options of the move.
+//
+// **Returns:**
+//
+// CopyResult: A summary of the objects moved and those that failed.
+// error: An error joining the errors of the objects that could not be moved.
+func MovePrefix(client *s3.S3, srcBucket string, srcPrefix string, dstBucket string, dstPrefix string, opts CopyOptions) (CopyResult, error) {
+	return copyPrefix(client, srcBucket, srcPrefix, dstBucket, dstPrefix, opts, true)
+}
+
+// copyPrefix copies, and optionally moves, the objects under a prefix.
+func copyPrefix(client *s3.S3, srcBucket, srcPrefix, dstBucket, dstPrefix string, opts CopyOptions, move bool) (CopyResult, error) {
+	if err := opts.validate(); err != nil {
+		return CopyResult{}, err
+	}
+	// Copies under the source prefix would be listed and copied again.
+	if srcBucket == dstBucket && (strings.HasPrefix(dstPrefix, srcPrefix) || strings.HasPrefix(srcPrefix, dstPrefix)) {
+		return CopyResult{}, fmt.Errorf("prefixes %q and %q of %s overlap", srcPrefix, dstPrefix, srcBucket)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultSyncWorkers
+	}
+
+	var mu sync.Mutex
+	var result CopyResult
+	fail := func(key string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Failed = append(result.Failed, CopyFailure{Key: key, Err: err})
+	}
+
+	// Objects are copied as they are listed, so that
+	// prefixes of any size are copied in constant memory.
+	objects := make(chan ObjectInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range objects {
+				dstKey := dstPrefix + strings.TrimPrefix(obj.Key, srcPrefix)
+				size, err := opts.copyObject(client, srcBucket, obj.Key, obj.Size, dstBucket, dstKey)
+				if err != nil {
+					fail(obj.Key, err)
+					continue
+				}
+
+				mu.Lock()
+				result.Copied = append(result.Copied, obj.Key)
+				result.Bytes += size
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var listErr error
+	ListObjects(client, srcBucket, ListObjectsOptions{Prefix: srcPrefix})(func(obj ObjectInfo, err error) bool {
+		if err != nil {
+			listErr = err
+			return false
+		}
+		objects <- obj
+		return true
+	})
+	close(objects)
+	wg.Wait()
+
+	if move {
+		failed := deleteKeys(client, srcBucket, result.Copied)
+		moved := result.Copied[:0]
+		for _, key := range result.Copied {
+			if err, ok := failed[key]; ok {
+				result.Failed = append(result.Failed, CopyFailure{Key: key, Err: fmt.Errorf("error deleting %s from %s after copying it: %v", key, srcBucket, err)})
+				continue
+			}
+			moved = append(moved, key)
+		}
+		result.Copied = moved
+	}
+
+	sort.Strings(result.Copied)
+	sort.Slice(result.Failed, func(i, j int) bool {
+		return result.Failed[i].Key < result.Failed[j].Key
+	})
+
+	errs := []error{listErr}
+	for _, failure := range result.Failed {
+		errs = append(errs, failure.Err)
+	}
+	return result, errors.Join(errs...)
+}
+
+// validate checks the options of a copy.
+func (opts CopyOptions) validate() error {
+	if opts.MultipartThreshold < 0 || opts.MultipartThreshold > maxCopyObjectSize {
+		return fmt.Errorf("multipart threshold must be at most %d bytes", maxCopyObjectSize)
+	}
+	if opts.PartSize != 0 && (opts.PartSize < s3manager.MinUploadPartSize || opts.PartSize > maxCopyObjectSize) {
+		return fmt.Errorf("part size must be between %d and %d bytes", s3manager.MinUploadPartSize, maxCopyObjectSize)
+	}
+	if !opts.ReplaceMetadata && (opts.ContentType != "" || opts.Metadata != nil) {
+		return fmt.Errorf("a Content-Type or metadata requires ReplaceMetadata")
+	}
+	if !opts.ReplaceTags && opts.Tags != nil {
+		return fmt.Errorf("tags require ReplaceTags")
+	}
+	return nil
+}
+
+// copyObject copies an object of size bytes, or of unknown
+// size if negative, and returns the number of bytes copied.
+func (opts CopyOptions) copyObject(client *s3.S3, srcBucket, srcKey string, size int64, dstBucket, dstKey string) (int64, error) {
+	threshold := opts.MultipartThreshold
+	if threshold == 0 {
+		threshold = maxCopyObjectSize
+	}
+
+	var head *s3.HeadObjectOutput
+	if size < 0 || size > threshold {
+		var err error
+		head, err = client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(srcBucket),
+			Key:    aws.String(srcKey),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error getting details of %s in %s: %v", srcKey, srcBucket, err)
+		}
+		size = aws.Int64Value(head.ContentLength)
+	}
+
+	var err error
+	if size > threshold {
+		err = opts.copyParts(client, srcBucket, srcKey, head, dstBucket, dstKey)
+	} else {
+		err = opts.copySingle(client, srcBucket, srcKey, dstBucket, dstKey)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// destination returns the client the destination is written with.
+func (opts CopyOptions) destination(client *s3.S3) *s3.S3 {
+	if opts.DestinationClient != nil {
+		return opts.DestinationClient
+	}
+	return client
+}
+
+// copySingle copies an object with a single CopyObject request.
+func (opts CopyOptions) copySingle(client *s3.S3, srcBucket, srcKey, dstBucket, dstKey string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(copySource(srcBucket, srcKey)),
+	}
+	if opts.ACL != "" {
+		input.ACL = aws.String(opts.ACL)
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = aws.String(opts.StorageClass)
+	}
+	if opts.ReplaceMetadata {
+		input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+		input.Metadata = aws.StringMap(opts.Metadata)
+		if opts.ContentType != "" {
+			input.ContentType = aws.String(opts.ContentType)
+		}
+	}
+	if opts.ReplaceTags {
+		input.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+		input.Tagging = aws.String(encodeTags(opts.Tags))
+	}
+
+	if _, err := opts.destination(client).CopyObject(input); err != nil {
+		return fmt.Errorf("error copying %s from %s to %s in %s: %v", srcKey, srcBucket, dstKey, dstBucket, err)
+	}
+	return nil
+}
+
+// copyParts copies an object in concurrent parts with UploadPartCopy.
+// UploadPartCopy copies neither metadata nor tags, so those of the
+// source are set on the upload unless they are replaced.
+func (opts CopyOptions) copyParts(client *s3.S3, srcBucket, srcKey string, head *s3.HeadObjectOutput, dstBucket, dstKey string) error {
+	create := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(dstBucket),
+		Key:    aws.String(dstKey),
+	}
+	if opts.ACL != "" {
+		create.ACL = aws.String(opts.ACL)
+	}
+	if opts.StorageClass != "" {
+		create.StorageClass = aws.String(opts.StorageClass)
+	}
+	if opts.ReplaceMetadata {
+		create.Metadata = aws.StringMap(opts.Metadata)
+		if opts.ContentType != "" {
+			create.ContentType = aws.String(opts.ContentType)
+		}
+	} else {
+		create.Metadata = head.Metadata
+		create.ContentType = head.ContentType
+		create.CacheControl = head.CacheControl
+		create.ContentDisposition = head.ContentDisposition
+		create.ContentEncoding = head.ContentEncoding
+		create.ContentLanguage = head.ContentLanguage
+	}
+
+	tags := opts.Tags
+	if !opts.ReplaceTags {
+		out, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{
+			Bucket: aws.String(srcBucket),
+			Key:    aws.String(srcKey),
+		})
+		if err != nil {
+			return fmt.Errorf("error getting tags of %s in %s: %v", srcKey, srcBucket, err)
+		}
+		tags = make(map[string]string, len(out.TagSet))
+		for _, tag := range out.TagSet {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+	if len(tags) > 0 {
+		create.Tagging = aws.String(encodeTags(tags))
+	}
+
+	dst := opts.destination(client)
+	upload, err := dst.CreateMultipartUpload(create)
+	if err != nil {
+		return fmt.Errorf("error starting copy of %s from %s to %s in %s: %v", srcKey, srcBucket, dstKey, dstBucket, err)
+	}
+
+	parts, err := opts.uploadPartCopies(dst, srcBucket, srcKey, head, dstBucket, dstKey, aws.StringValue(upload.UploadId))
+	if err == nil {
+		_, err = dst.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(dstBucket),
+			Key:             aws.String(dstKey),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		// The parts copied so far are billed until the upload is aborted.
+		_, _ = dst.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(dstBucket),
+			Key:      aws.String(dstKey),
+			UploadId: upload.UploadId,
+		})
+		return fmt.Errorf("error copying %s from %s to %s in %s: %v", srcKey, srcBucket, dstKey, dstBucket, err)
+	}
+	return nil
+}
+
+// uploadPartCopies concurrently copies the parts of an object to a
+// multipart upload. Each part requires the source to still have the
+// ETag it had when the copy started, so that a source changing
+// during the copy fails it rather than mixing two versions.
+func (opts CopyOptions) uploadPartCopies(dst *s3.S3, srcBucket, srcKey string, head *s3.HeadObjectOutput, dstBucket, dstKey, uploadID string) ([]*s3.CompletedPart, error) {
+	size := aws.Int64Value(head.ContentLength)
+	partSize := opts.PartSize
+	if partSize == 0 {
+		partSize = defaultCopyPartSize
+	}
+	if size/partSize >= s3manager.MaxUploadParts {
+		partSize = size/s3manager.MaxUploadParts + 1
+	}
+	numParts := (size + partSize - 1) / partSize
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultSyncWorkers
+	}
+
+	parts := make([]*s3.CompletedPart, numParts)
+	errs := make([]error, numParts)
+	numbers := make(chan int64)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				start := (number - 1) * partSize
+				end := min(start+partSize, size) - 1
+				out, err := dst.UploadPartCopy(&s3.UploadPartCopyInput{
+					Bucket:            aws.String(dstBucket),
+					Key:               aws.String(dstKey),
+					UploadId:          aws.String(uploadID),
+					PartNumber:        aws.Int64(number),
+					CopySource:        aws.String(copySource(srcBucket, srcKey)),
+					CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					CopySourceIfMatch: head.ETag,
+				})
+				if err != nil {
+					errs[number-1] = fmt.Errorf("error copying part %d: %v", number, err)
+					continue
+				}
+				parts[number-1] = &s3.CompletedPart{PartNumber: aws.Int64(number), ETag: out.CopyPartResult.ETag}
+			}
+		}()
+	}
+	for number := int64(1); number <= numParts; number++ {
+		numbers <- number
+	}
+	close(numbers)
+	wg.Wait()
+
+	return parts, errors.Join(errs...)
+}
+
+// copySource returns the URL-encoded source of a copy.
+func copySource(bucketName, key string) string {
+	return url.PathEscape(bucketName + "/" + key)
+}
+
+// encodeTags returns tags in the query string form S3 expects.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
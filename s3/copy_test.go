@@ -0,0 +1,255 @@
+package s3_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putTestObject uploads an object with a Content-Type, metadata and tags.
+func putTestObject(t *testing.T, client *s3.S3, bucketName, key string, data []byte) {
+	t.Helper()
+
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("text/plain"),
+		Metadata:    aws.StringMap(map[string]string{"Origin": "build"}),
+		Tagging:     aws.String("env=prod"),
+	})
+	require.NoError(t, err)
+}
+
+// objectDetails returns the Content-Type, metadata and tags of an object.
+func objectDetails(t *testing.T, client *s3.S3, bucketName, key string) (string, map[string]string, map[string]string) {
+	t.Helper()
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucketName), Key: aws.String(key)})
+	require.NoError(t, err)
+	out, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String(bucketName), Key: aws.String(key)})
+	require.NoError(t, err)
+
+	tags := map[string]string{}
+	for _, tag := range out.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return aws.StringValue(head.ContentType), aws.StringValueMap(head.Metadata), tags
+}
+
+func TestCopyObject(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("source", "placeholder", nil, time.Now())
+	fake.addObject("backup", "placeholder", nil, time.Now())
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*testPartSize+1024)/16)
+	putTestObject(t, client, "source", "small.txt", []byte("small"))
+	putTestObject(t, client, "source", "large.bin", content)
+
+	tests := []struct {
+		name            string
+		key             string
+		opts            s3utils.CopyOptions
+		wantContentType string
+		wantMetadata    map[string]string
+		wantTags        map[string]string
+		wantPartCopies  int
+	}{
+		{
+			name:            "preserves metadata and tags",
+			key:             "small.txt",
+			wantContentType: "text/plain",
+			wantMetadata:    map[string]string{"Origin": "build"},
+			wantTags:        map[string]string{"env": "prod"},
+		},
+		{
+			name: "replaces metadata and tags",
+			key:  "small.txt",
+			opts: s3utils.CopyOptions{
+				ReplaceMetadata: true,
+				ContentType:     "text/markdown",
+				Metadata:        map[string]string{"Origin": "copy"},
+				ReplaceTags:     true,
+				Tags:            map[string]string{"env": "dev"},
+			},
+			wantContentType: "text/markdown",
+			wantMetadata:    map[string]string{"Origin": "copy"},
+			wantTags:        map[string]string{"env": "dev"},
+		},
+		{
+			name:            "multipart preserves metadata and tags",
+			key:             "large.bin",
+			opts:            s3utils.CopyOptions{MultipartThreshold: testPartSize, PartSize: testPartSize},
+			wantContentType: "text/plain",
+			wantMetadata:    map[string]string{"Origin": "build"},
+			wantTags:        map[string]string{"env": "prod"},
+			wantPartCopies:  3,
+		},
+		{
+			name: "multipart replaces metadata and tags",
+			key:  "large.bin",
+			opts: s3utils.CopyOptions{
+				MultipartThreshold: testPartSize,
+				PartSize:           testPartSize,
+				ReplaceMetadata:    true,
+				ContentType:        "application/octet-stream",
+				ReplaceTags:        true,
+				Tags:               map[string]string{"env": "dev"},
+			},
+			wantContentType: "application/octet-stream",
+			wantMetadata:    map[string]string{},
+			wantTags:        map[string]string{"env": "dev"},
+			wantPartCopies:  3,
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			before := len(fake.requestsFor("UploadPartCopy"))
+			dstKey := fmt.Sprintf("copies/%d/%s", i, tc.key)
+			require.NoError(t, s3utils.CopyObject(client, "source", tc.key, "backup", dstKey, tc.opts))
+
+			src, _ := fake.object("source", tc.key)
+			dst, ok := fake.object("backup", dstKey)
+			require.True(t, ok)
+			assert.Equal(t, src, dst)
+			assert.Len(t, fake.requestsFor("UploadPartCopy")[before:], tc.wantPartCopies)
+
+			contentType, metadata, tags := objectDetails(t, client, "backup", dstKey)
+			assert.Equal(t, tc.wantContentType, contentType)
+			assert.Equal(t, tc.wantMetadata, metadata)
+			assert.Equal(t, tc.wantTags, tags)
+		})
+	}
+
+	t.Run("failed multipart copy is aborted", func(t *testing.T) {
+		fake.failAfter("UploadPartCopy", 1)
+		defer fake.failAfter("UploadPartCopy", -1)
+
+		err := s3utils.CopyObject(client, "source", "large.bin", "backup", "failed.bin", s3utils.CopyOptions{MultipartThreshold: testPartSize, PartSize: testPartSize})
+		require.Error(t, err)
+		assert.Len(t, fake.requestsFor("AbortMultipartUpload"), 1)
+		_, ok := fake.object("backup", "failed.bin")
+		assert.False(t, ok)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		assert.Error(t, s3utils.CopyObject(client, "source", "small.txt", "backup", "x", s3utils.CopyOptions{Metadata: map[string]string{"a": "b"}}))
+		assert.Error(t, s3utils.CopyObject(client, "source", "small.txt", "backup", "x", s3utils.CopyOptions{Tags: map[string]string{"a": "b"}}))
+		assert.Error(t, s3utils.CopyObject(client, "source", "small.txt", "backup", "x", s3utils.CopyOptions{PartSize: 1024}))
+		assert.Error(t, s3utils.CopyObject(client, "source", "missing.txt", "backup", "x", s3utils.CopyOptions{}))
+	})
+}
+
+func TestCopyObjectCrossAccount(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("source", "placeholder", nil, time.Now())
+	putTestObject(t, client, "source", "report.csv", []byte("a,b"))
+	fake.addObject("partner", "placeholder", nil, time.Now())
+
+	// The destination is written with a client of another region and account.
+	sess, err := session.NewSession(client.Config.Copy(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("partner-id", "partner-secret", ""),
+	}))
+	require.NoError(t, err)
+	partner := s3.New(sess)
+
+	opts := s3utils.CopyOptions{DestinationClient: partner, ACL: s3.ObjectCannedACLBucketOwnerFullControl}
+	require.NoError(t, s3utils.CopyObject(client, "source", "report.csv", "partner", "inbox/report.csv", opts))
+
+	copies := fake.requestsFor("CopyObject")
+	require.Len(t, copies, 1)
+	assert.Contains(t, copies[0].Header.Get("Authorization"), "Credential=partner-id/")
+	assert.Contains(t, copies[0].Header.Get("Authorization"), "/eu-west-1/s3/")
+	assert.Equal(t, s3.ObjectCannedACLBucketOwnerFullControl, copies[0].Header.Get("X-Amz-Acl"))
+	data, _ := fake.object("partner", "inbox/report.csv")
+	assert.Equal(t, "a,b", string(data))
+}
+
+func TestMoveObject(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("bucket", "inbox/a.txt", []byte("a"), time.Now())
+
+	require.NoError(t, s3utils.MoveObject(client, "bucket", "inbox/a.txt", "bucket", "done/a.txt", s3utils.CopyOptions{}))
+	assert.Equal(t, []string{"done/a.txt"}, fake.keys("bucket"))
+
+	assert.Error(t, s3utils.MoveObject(client, "bucket", "done/a.txt", "bucket", "done/a.txt", s3utils.CopyOptions{}))
+}
+
+func TestCopyPrefix(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	for i := 0; i < 25; i++ {
+		fake.addObject("source", fmt.Sprintf("data/%02d.json", i), []byte("{}"), time.Now())
+	}
+	fake.addObject("source", "other/skipped.json", []byte("{}"), time.Now())
+	fake.addObject("backup", "placeholder", nil, time.Now())
+
+	// Five of the copies fail, which does not stop the others.
+	fake.failAfter("CopyObject", 20)
+	result, err := s3utils.CopyPrefix(client, "source", "data/", "backup", "2024/data/", s3utils.CopyOptions{Workers: 3})
+	require.Error(t, err)
+	assert.Len(t, result.Copied, 20)
+	assert.Len(t, result.Failed, 5)
+	assert.Equal(t, int64(40), result.Bytes)
+	for _, failure := range result.Failed {
+		assert.ErrorContains(t, failure.Err, "InternalError")
+		_, ok := fake.object("backup", "2024/"+failure.Key)
+		assert.False(t, ok)
+	}
+	for _, key := range result.Copied {
+		_, ok := fake.object("backup", "2024/"+key)
+		assert.True(t, ok, key)
+	}
+	assert.Len(t, fake.keys("source"), 26)
+
+	_, err = s3utils.CopyPrefix(client, "source", "data/", "source", "data/copy/", s3utils.CopyOptions{})
+	assert.ErrorContains(t, err, "overlap")
+}
+
+func TestMovePrefix(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	for i := 0; i < 10; i++ {
+		fake.addObject("bucket", fmt.Sprintf("incoming/%d.csv", i), []byte("a,b"), time.Now())
+	}
+	fake.addObject("bucket", "incoming.csv", []byte("a,b"), time.Now())
+
+	fake.failAfter("CopyObject", 9)
+	result, err := s3utils.MovePrefix(client, "bucket", "incoming/", "bucket", "processed/", s3utils.CopyOptions{Workers: 1})
+	require.Error(t, err)
+	assert.Len(t, result.Copied, 9)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, "incoming/9.csv", result.Failed[0].Key)
+
+	// Only the sources that were copied are deleted.
+	var processed int
+	for _, key := range fake.keys("bucket") {
+		if strings.HasPrefix(key, "processed/") {
+			processed++
+		}
+	}
+	assert.Equal(t, 9, processed)
+	assert.Equal(t, []string{"incoming.csv", "incoming/9.csv"}, fake.keys("bucket")[:2])
+	assert.Len(t, fake.requestsFor("DeleteObjects"), 1)
+
+	t.Run("failed delete", func(t *testing.T) {
+		client, fake := newFakeS3Client(t, map[string]fakeS3Error{"DeleteObjects": {Status: http.StatusForbidden, Code: "AccessDenied"}})
+		fake.addObject("bucket", "incoming/a.csv", []byte("a"), time.Now())
+
+		result, err := s3utils.MovePrefix(client, "bucket", "incoming/", "bucket", "processed/", s3utils.CopyOptions{})
+		require.Error(t, err)
+		assert.Empty(t, result.Copied)
+		require.Len(t, result.Failed, 1)
+		assert.ErrorContains(t, result.Failed[0].Err, "error deleting incoming/a.csv")
+	})
+}
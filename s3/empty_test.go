@@ -0,0 +1,140 @@
+package s3_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyBucketWithContext(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	for i := 0; i < 1500; i++ {
+		key := fmt.Sprintf("logs/%04d.json", i)
+		fake.addObject("versioned", key, []byte("{}"), time.Now())
+		switch {
+		case i < 700:
+			fake.addVersion("versioned", fakeVersion{key: key, id: fmt.Sprintf("v%d", i)})
+		case i < 1000:
+			fake.addVersion("versioned", fakeVersion{key: key, id: fmt.Sprintf("m%d", i), deleteMarker: true})
+		}
+	}
+	fake.addUpload("versioned", "upload/a.bin", "upload-1")
+	fake.addUpload("versioned", "upload/b.bin", "upload-2")
+
+	// Noncurrent versions keep the bucket from being destroyed.
+	_, err := client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("versioned")})
+	require.Error(t, err)
+
+	result, err := s3utils.EmptyBucketWithContext(context.Background(), client, "versioned", s3utils.EmptyBucketOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, s3utils.EmptyBucketResult{Versions: 2200, DeleteMarkers: 300, AbortedUploads: 2}, result)
+	assert.Zero(t, fake.versionCount("versioned"))
+
+	deletes := fake.requestsFor("DeleteObjects")
+	require.Len(t, deletes, 3)
+	for _, req := range deletes {
+		assert.LessOrEqual(t, strings.Count(string(req.Body), "<Object>"), 1000)
+	}
+
+	require.NoError(t, s3utils.DestroyBucket(client, "versioned"))
+}
+
+func TestEmptyBucketObjectLock(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("locked", "evidence.log", []byte("log"), time.Now())
+	fake.addVersion("locked", fakeVersion{key: "evidence.log", id: "v1", locked: true})
+	_, err := client.PutObjectLockConfiguration(&s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String("locked"),
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+			ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+		},
+	})
+	require.NoError(t, err)
+
+	err = s3utils.EmptyBucket(client, "locked")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "object lock")
+	assert.Empty(t, fake.requestsFor("DeleteObjects"))
+
+	result, err := s3utils.EmptyBucketWithContext(context.Background(), client, "locked", s3utils.EmptyBucketOptions{Force: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Versions)
+	assert.Equal(t, "true", fake.requestsFor("DeleteObjects")[0].Header.Get("X-Amz-Bypass-Governance-Retention"))
+}
+
+func TestEmptyBucketObjectLockErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     fakeS3Error
+		wantErr string
+	}{
+		{
+			name: "no object lock configuration",
+			err:  fakeS3Error{Status: http.StatusNotFound, Code: "ObjectLockConfigurationNotFoundError"},
+		},
+		{
+			name: "object lock not implemented",
+			err:  fakeS3Error{Status: http.StatusNotImplemented, Code: "NotImplemented"},
+		},
+		{
+			name:    "access denied",
+			err:     fakeS3Error{Status: http.StatusForbidden, Code: "AccessDenied"},
+			wantErr: "access denied getting object lock configuration of bucket",
+		},
+		{
+			name:    "other error",
+			err:     fakeS3Error{Status: http.StatusBadRequest, Code: "InvalidRequest"},
+			wantErr: "error getting object lock configuration of bucket",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, fake := newFakeS3Client(t, map[string]fakeS3Error{"GetObjectLockConfiguration": tc.err})
+			fake.addObject("bucket", "a.txt", []byte("a"), time.Now())
+
+			err := s3utils.EmptyBucket(client, "bucket")
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				assert.Empty(t, fake.requestsFor("DeleteObjects"))
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, s3utils.DestroyBucket(client, "bucket"))
+		})
+	}
+}
+
+func TestEmptyBucketPartialFailure(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("partial", "a.txt", []byte("a"), time.Now())
+	// Locked versions cannot be deleted without bypassing governance
+	// retention, such as when object lock was enabled afterwards.
+	fake.addVersion("partial", fakeVersion{key: "a.txt", id: "v1", locked: true})
+	fake.addVersion("partial", fakeVersion{key: "a.txt", id: "m1", deleteMarker: true})
+
+	result, err := s3utils.EmptyBucketWithContext(context.Background(), client, "partial", s3utils.EmptyBucketOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AccessDenied")
+	assert.Equal(t, s3utils.EmptyBucketResult{Versions: 1, DeleteMarkers: 1}, result)
+}
+
+func TestEmptyBucketContext(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("cancelled", "a.txt", []byte("a"), time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s3utils.EmptyBucketWithContext(ctx, client, "cancelled", s3utils.EmptyBucketOptions{})
+	require.Error(t, err)
+	assert.Equal(t, 1, fake.versionCount("cancelled"))
+}
@@ -0,0 +1,1287 @@
+package s3_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAccessKeyID and fakeSecretAccessKey are the credentials of the
+// fake clients, which presigned requests and POST policies are
+// verified with.
+const (
+	fakeAccessKeyID     = "id"
+	fakeSecretAccessKey = "secret"
+)
+
+// fakeAccountID is the account of the fake credentials.
+const fakeAccountID = "111122223333"
+
+// fakeS3Error is an error response returned by the fake S3 endpoint.
+type fakeS3Error struct {
+	Status int
+	Code   string
+}
+
+// fakeS3Request is a request received by the fake S3 endpoint.
+type fakeS3Request struct {
+	Operation string
+	Bucket    string
+	Key       string
+	Query     url.Values
+	Header    http.Header
+	Body      []byte
+}
+
+// fakeObject is an object stored by the fake S3 endpoint.
+type fakeObject struct {
+	data     []byte
+	etag     string
+	modified time.Time
+	header   http.Header
+	tags     url.Values
+}
+
+// fakeUpload is a multipart upload in progress.
+type fakeUpload struct {
+	key       string
+	parts     map[int][]byte
+	header    http.Header
+	tags      url.Values
+	initiated time.Time
+}
+
+// fakeVersion is a noncurrent object version or delete marker.
+// Current objects are stored as objects with the version ID "null".
+type fakeVersion struct {
+	key          string
+	id           string
+	deleteMarker bool
+	locked       bool
+}
+
+// fakeBucket is a bucket stored by the fake S3 endpoint.
+type fakeBucket struct {
+	location string
+	config   map[string][]byte
+	objects  map[string]*fakeObject
+	uploads  map[string]*fakeUpload
+	versions []*fakeVersion
+}
+
+// fakeS3 is a minimal in-memory S3-compatible endpoint using
+// path-style addressing. Bucket sub-resources such as versioning
+// or encryption are stored as the raw XML documents they were
+// put with.
+type fakeS3 struct {
+	mu       sync.Mutex
+	buckets  map[string]*fakeBucket
+	errs     map[string]fakeS3Error
+	limits   map[string]int
+	requests []fakeS3Request
+	// truncated is the number of GetObject responses
+	// left to end halfway through their body.
+	truncated int
+	// accountBlock holds the enabled settings of the public
+	// access block of the account, nil if it has none.
+	accountBlock []string
+}
+
+// bucketSubresources maps bucket sub-resource query parameters
+// to the suffix of the operations using them.
+var bucketSubresources = map[string]string{
+	"versioning":        "BucketVersioning",
+	"encryption":        "BucketEncryption",
+	"publicAccessBlock": "PublicAccessBlock",
+	"ownershipControls": "BucketOwnershipControls",
+	"tagging":           "BucketTagging",
+	"lifecycle":         "BucketLifecycleConfiguration",
+	"policy":            "BucketPolicy",
+	"acl":               "BucketAcl",
+	"logging":           "BucketLogging",
+	"object-lock":       "ObjectLockConfiguration",
+	"location":          "BucketLocation",
+}
+
+// newFakeBucket returns an empty bucket in a location.
+func newFakeBucket(location string) *fakeBucket {
+	return &fakeBucket{
+		location: location,
+		config:   map[string][]byte{},
+		objects:  map[string]*fakeObject{},
+		uploads:  map[string]*fakeUpload{},
+	}
+}
+
+// newFakeS3Client starts a fake S3 endpoint that fails the operations
+// in errs and returns the endpoint and a client that talks to it.
+func newFakeS3Client(t *testing.T, errs map[string]fakeS3Error) (*s3.S3, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{buckets: map[string]*fakeBucket{}, errs: errs}
+	// TLS is required to send SSE-C keys.
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	// A CA bundle from the environment would replace the
+	// test server's certificate in the client's transport.
+	t.Setenv("AWS_CA_BUNDLE", "")
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-west-1"),
+		Endpoint:         aws.String(server.URL),
+		HTTPClient:       server.Client(),
+		Credentials:      credentials.NewStaticCredentials(fakeAccessKeyID, fakeSecretAccessKey, ""),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+		// S3 Control prefixes the endpoint with the account ID.
+		DisableEndpointHostPrefix: aws.Bool(true),
+	})
+	require.NoError(t, err)
+
+	return s3.New(sess), fake
+}
+
+// addBucket creates an empty bucket directly in the provided
+// location, empty for us-east-1.
+func (f *fakeS3) addBucket(bucketName, location string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buckets[bucketName] = newFakeBucket(location)
+}
+
+// addObject stores an object directly, creating its bucket if needed.
+func (f *fakeS3) addObject(bucketName, key string, data []byte, modified time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, ok := f.buckets[bucketName]
+	if !ok {
+		bucket = newFakeBucket("")
+		f.buckets[bucketName] = bucket
+	}
+	bucket.putObject(key, data, modified)
+}
+
+// setETag replaces the ETag of a stored object, such as with
+// the ETag of a multipart upload.
+func (f *fakeS3) setETag(bucketName, key, etag string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buckets[bucketName].objects[key].etag = etag
+}
+
+// addVersion stores a noncurrent version or a delete marker, which
+// can only be deleted bypassing governance retention if locked.
+func (f *fakeS3) addVersion(bucketName string, version fakeVersion) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := f.buckets[bucketName]
+	bucket.versions = append(bucket.versions, &version)
+}
+
+// addUpload starts a multipart upload directly.
+func (f *fakeS3) addUpload(bucketName, key, uploadID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buckets[bucketName].uploads[uploadID] = &fakeUpload{key: key, parts: map[int][]byte{}, header: http.Header{}, initiated: time.Now()}
+}
+
+// versionCount returns the number of versions and delete markers
+// of a bucket, counting current objects as versions.
+func (f *fakeS3) versionCount(bucketName string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := f.buckets[bucketName]
+	return len(bucket.objects) + len(bucket.versions)
+}
+
+// object returns the content of a stored object.
+func (f *fakeS3) object(bucketName, key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, ok := f.buckets[bucketName]
+	if !ok {
+		return nil, false
+	}
+	obj, ok := bucket.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return obj.data, true
+}
+
+// keys returns the sorted keys of the objects in a bucket.
+func (f *fakeS3) keys(bucketName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var keys []string
+	if bucket, ok := f.buckets[bucketName]; ok {
+		keys = bucket.sortedKeys()
+	}
+	return keys
+}
+
+// failAfter makes an operation fail once it has succeeded n times,
+// or lifts that limit again if n is negative.
+func (f *fakeS3) failAfter(operation string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.limits == nil {
+		f.limits = map[string]int{}
+	}
+	if n < 0 {
+		delete(f.limits, operation)
+		return
+	}
+	f.limits[operation] = n
+}
+
+// setAccountPublicAccessBlock gives the account a public access
+// block with the provided settings enabled, such as BlockPublicAcls.
+func (f *fakeS3) setAccountPublicAccessBlock(enabled ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accountBlock = append([]string{}, enabled...)
+}
+
+// writeAccountPublicAccessBlock answers a GET of the
+// public access block of the account.
+func (f *fakeS3) writeAccountPublicAccessBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Amz-Account-Id") != fakeAccountID {
+		writeAccountError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	if f.accountBlock == nil {
+		writeAccountError(w, http.StatusNotFound, "NoSuchPublicAccessBlockConfiguration")
+		return
+	}
+
+	var settings strings.Builder
+	for _, name := range f.accountBlock {
+		fmt.Fprintf(&settings, "<%s>true</%s>", name, name)
+	}
+	fmt.Fprintf(w, "<PublicAccessBlockConfiguration>%s</PublicAccessBlockConfiguration>", settings.String())
+}
+
+// truncateGets makes the next n GetObject responses end
+// halfway through their body.
+func (f *fakeS3) truncateGets(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.truncated = n
+}
+
+// operations returns the operations received, in order.
+func (f *fakeS3) operations() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ops := make([]string, 0, len(f.requests))
+	for _, req := range f.requests {
+		ops = append(ops, req.Operation)
+	}
+	return ops
+}
+
+// requestsFor returns the requests received for an operation.
+func (f *fakeS3) requestsFor(operation string) []fakeS3Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var reqs []fakeS3Request
+	for _, req := range f.requests {
+		if req.Operation == operation {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	op, sub := operationName(r.Method, key, query)
+	if bucketName == "" && r.Method == http.MethodGet {
+		op = "ListBuckets"
+	}
+	// STS and S3 Control requests are answered for the account.
+	if bucketName == "" && r.Method == http.MethodPost {
+		form, _ := url.ParseQuery(string(body))
+		op = form.Get("Action")
+	}
+	if strings.HasPrefix(r.URL.Path, "/v20180820/configuration/publicAccessBlock") {
+		op = "GetAccountPublicAccessBlock"
+	}
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		op = strings.Replace(op, "UploadPart", "UploadPartCopy", 1)
+		op = strings.Replace(op, "PutObject", "CopyObject", 1)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, fakeS3Request{Operation: op, Bucket: bucketName, Key: key, Query: query, Header: r.Header.Clone(), Body: body})
+	if query.Get("X-Amz-Signature") != "" {
+		if status, code := checkPresigned(r); code != "" {
+			writeS3Error(w, status, code)
+			return
+		}
+	}
+	if sum := r.Header.Get("Content-Md5"); sum != "" {
+		digest := md5.Sum(body)
+		if sum != base64.StdEncoding.EncodeToString(digest[:]) {
+			writeS3Error(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+	}
+	if e, ok := f.errs[op]; ok {
+		if op == "GetCallerIdentity" || op == "GetAccountPublicAccessBlock" {
+			writeAccountError(w, e.Status, e.Code)
+			return
+		}
+		writeS3Error(w, e.Status, e.Code)
+		return
+	}
+	if limit, ok := f.limits[op]; ok {
+		if limit == 0 {
+			writeS3Error(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+		f.limits[op] = limit - 1
+	}
+
+	switch op {
+	case "ListBuckets":
+		writeXML(w, f.listBuckets())
+		return
+	case "GetCallerIdentity":
+		fmt.Fprintf(w, "<GetCallerIdentityResponse><GetCallerIdentityResult><Account>%s</Account></GetCallerIdentityResult></GetCallerIdentityResponse>", fakeAccountID)
+		return
+	case "GetAccountPublicAccessBlock":
+		f.writeAccountPublicAccessBlock(w, r)
+		return
+	}
+	bucket, exists := f.buckets[bucketName]
+	if op == "CreateBucket" {
+		var config s3.CreateBucketConfiguration
+		_ = xml.Unmarshal(body, &config)
+		// Like us-east-1, creating a bucket you already own
+		// there succeeds without changing it.
+		if exists && (config.LocationConstraint != nil || bucket.location != "") {
+			writeS3Error(w, http.StatusConflict, s3.ErrCodeBucketAlreadyOwnedByYou)
+			return
+		}
+		if !exists {
+			f.buckets[bucketName] = newFakeBucket(aws.StringValue(config.LocationConstraint))
+		}
+		return
+	}
+	if !exists {
+		writeS3Error(w, http.StatusNotFound, s3.ErrCodeNoSuchBucket)
+		return
+	}
+
+	switch {
+	case op == "HeadBucket":
+	case op == "ListObjectsV2":
+		writeXML(w, bucket.listObjectsV2(bucketName, query))
+	case op == "DeleteObjects":
+		writeXML(w, bucket.deleteObjects(body, r.Header.Get("X-Amz-Bypass-Governance-Retention") == "true"))
+	case op == "ListObjectVersions":
+		writeXML(w, bucket.listObjectVersions(query))
+	case op == "ListMultipartUploads":
+		writeXML(w, bucket.listMultipartUploads())
+	case op == "PutObject":
+		obj := bucket.putObject(key, body, time.Now())
+		copyObjectHeaders(obj.header, r.Header)
+		obj.tags, _ = url.ParseQuery(r.Header.Get("X-Amz-Tagging"))
+		w.Header().Set("ETag", obj.etag)
+	case op == "PostObject":
+		if status, code := bucket.postObject(bucketName, r.Header.Get("Content-Type"), body); code != "" {
+			writeS3Error(w, status, code)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case op == "CreateMultipartUpload":
+		id := strconv.Itoa(len(f.requests))
+		bucket.uploads[id] = &fakeUpload{key: key, parts: map[int][]byte{}, header: http.Header{}, initiated: time.Now()}
+		copyObjectHeaders(bucket.uploads[id].header, r.Header)
+		bucket.uploads[id].tags, _ = url.ParseQuery(r.Header.Get("X-Amz-Tagging"))
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>",
+			bucketName, key, id)
+	case op == "CopyObject":
+		src, status, code := f.copySource(r.Header)
+		if code != "" {
+			writeS3Error(w, status, code)
+			return
+		}
+		obj := bucket.putObject(key, src.data, time.Now())
+		obj.etag = src.etag
+		if r.Header.Get("X-Amz-Metadata-Directive") == s3.MetadataDirectiveReplace {
+			copyObjectHeaders(obj.header, r.Header)
+		} else {
+			copyObjectHeaders(obj.header, src.header)
+			if class := r.Header.Get("X-Amz-Storage-Class"); class != "" {
+				obj.header.Set("X-Amz-Storage-Class", class)
+			}
+		}
+		obj.tags = src.tags
+		if r.Header.Get("X-Amz-Tagging-Directive") == s3.TaggingDirectiveReplace {
+			obj.tags, _ = url.ParseQuery(r.Header.Get("X-Amz-Tagging"))
+		}
+		fmt.Fprintf(w, "<CopyObjectResult><ETag>%s</ETag><LastModified>%s</LastModified></CopyObjectResult>",
+			obj.etag, obj.modified.Format(time.RFC3339))
+	case op == "UploadPart", op == "UploadPartCopy", op == "ListParts", op == "CompleteMultipartUpload", op == "AbortMultipartUpload":
+		upload, ok := bucket.uploads[query.Get("uploadId")]
+		if !ok || upload.key != key {
+			writeS3Error(w, http.StatusNotFound, s3.ErrCodeNoSuchUpload)
+			return
+		}
+		switch op {
+		case "UploadPart":
+			number, _ := strconv.Atoi(query.Get("partNumber"))
+			upload.parts[number] = body
+			sum := md5.Sum(body)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		case "UploadPartCopy":
+			src, status, code := f.copySource(r.Header)
+			if code != "" {
+				writeS3Error(w, status, code)
+				return
+			}
+			var start, end int
+			if _, err := fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &start, &end); err != nil || end >= len(src.data) {
+				writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+				return
+			}
+			number, _ := strconv.Atoi(query.Get("partNumber"))
+			upload.parts[number] = src.data[start : end+1]
+			sum := md5.Sum(upload.parts[number])
+			fmt.Fprintf(w, `<CopyPartResult><ETag>"%s"</ETag></CopyPartResult>`, hex.EncodeToString(sum[:]))
+		case "ListParts":
+			writeXML(w, upload.listParts())
+		case "CompleteMultipartUpload":
+			obj, err := bucket.completeUpload(key, upload, body)
+			if err != nil {
+				writeS3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			delete(bucket.uploads, query.Get("uploadId"))
+			fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>",
+				bucketName, key, obj.etag)
+		default:
+			delete(bucket.uploads, query.Get("uploadId"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case op == "GetObject" || op == "HeadObject":
+		obj, ok := bucket.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, s3.ErrCodeNoSuchKey)
+			return
+		}
+		truncate := op == "GetObject" && f.truncated > 0
+		if truncate {
+			f.truncated--
+		}
+		obj.write(w, r, truncate)
+	case op == "PutObjectTagging", op == "GetObjectTagging", op == "DeleteObjectTagging":
+		obj, ok := bucket.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, s3.ErrCodeNoSuchKey)
+			return
+		}
+		switch op {
+		case "PutObjectTagging":
+			var tagging fakeTagging
+			_ = xml.Unmarshal(body, &tagging)
+			obj.tags = url.Values{}
+			for _, tag := range tagging.TagSet {
+				obj.tags.Set(tag.Key, tag.Value)
+			}
+		case "GetObjectTagging":
+			writeXML(w, newFakeTagging(obj.tags))
+		default:
+			obj.tags = nil
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case op == "DeleteObject":
+		delete(bucket.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case op == "DeleteBucket":
+		if len(bucket.objects) > 0 || len(bucket.versions) > 0 {
+			writeS3Error(w, http.StatusConflict, "BucketNotEmpty")
+			return
+		}
+		delete(f.buckets, bucketName)
+		w.WriteHeader(http.StatusNoContent)
+	case sub == "location":
+		fmt.Fprintf(w, "<LocationConstraint>%s</LocationConstraint>", bucket.location)
+	case sub != "" && r.Method == http.MethodPut:
+		bucket.config[sub] = body
+	case sub != "" && r.Method == http.MethodDelete:
+		delete(bucket.config, sub)
+		w.WriteHeader(http.StatusNoContent)
+	case sub != "" && r.Method == http.MethodGet:
+		if doc, ok := bucket.config[sub]; ok {
+			_, _ = w.Write(doc)
+			return
+		}
+		writeMissingSubresource(w, sub)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+type fakeListedBucket struct {
+	Name string
+}
+
+type fakeListBucketsResult struct {
+	XMLName xml.Name           `xml:"ListAllMyBucketsResult"`
+	Buckets []fakeListedBucket `xml:"Buckets>Bucket"`
+}
+
+// listBuckets answers a ListBuckets request.
+func (f *fakeS3) listBuckets() fakeListBucketsResult {
+	var result fakeListBucketsResult
+	for name := range f.buckets {
+		result.Buckets = append(result.Buckets, fakeListedBucket{Name: name})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		return result.Buckets[i].Name < result.Buckets[j].Name
+	})
+	return result
+}
+
+// operationName returns the S3 operation of a request and the
+// bucket sub-resource it targets, if any.
+func operationName(method, key string, query url.Values) (string, string) {
+	if key == "" {
+		if query.Get("list-type") == "2" {
+			return "ListObjectsV2", ""
+		}
+		if _, ok := query["delete"]; ok && method == http.MethodPost {
+			return "DeleteObjects", ""
+		}
+		if _, ok := query["uploads"]; ok && method == http.MethodGet {
+			return "ListMultipartUploads", ""
+		}
+		if _, ok := query["versions"]; ok && method == http.MethodGet {
+			return "ListObjectVersions", ""
+		}
+		if len(query) == 0 && method == http.MethodPost {
+			return "PostObject", ""
+		}
+
+		for sub, suffix := range bucketSubresources {
+			if _, ok := query[sub]; ok {
+				prefix := map[string]string{http.MethodPut: "Put", http.MethodGet: "Get", http.MethodDelete: "Delete"}[method]
+				return prefix + suffix, sub
+			}
+		}
+
+		switch method {
+		case http.MethodPut:
+			return "CreateBucket", ""
+		case http.MethodHead:
+			return "HeadBucket", ""
+		case http.MethodDelete:
+			return "DeleteBucket", ""
+		}
+	}
+
+	if _, ok := query["uploads"]; ok && method == http.MethodPost {
+		return "CreateMultipartUpload", ""
+	}
+	if _, ok := query["tagging"]; ok {
+		prefix := map[string]string{http.MethodPut: "Put", http.MethodGet: "Get", http.MethodDelete: "Delete"}[method]
+		return prefix + "ObjectTagging", ""
+	}
+	if query.Get("uploadId") != "" {
+		switch method {
+		case http.MethodGet:
+			return "ListParts", ""
+		case http.MethodPut:
+			return "UploadPart", ""
+		case http.MethodPost:
+			return "CompleteMultipartUpload", ""
+		case http.MethodDelete:
+			return "AbortMultipartUpload", ""
+		}
+	}
+
+	switch method {
+	case http.MethodPut:
+		return "PutObject", ""
+	case http.MethodGet:
+		return "GetObject", ""
+	case http.MethodHead:
+		return "HeadObject", ""
+	case http.MethodDelete:
+		return "DeleteObject", ""
+	}
+
+	return method + " " + key, ""
+}
+
+func (b *fakeBucket) putObject(key string, data []byte, modified time.Time) *fakeObject {
+	sum := md5.Sum(data)
+	obj := &fakeObject{
+		data:     data,
+		etag:     `"` + hex.EncodeToString(sum[:]) + `"`,
+		modified: modified.UTC().Truncate(time.Second),
+		header:   http.Header{},
+	}
+	b.objects[key] = obj
+	return obj
+}
+
+type fakePart struct {
+	PartNumber int
+	ETag       string
+	Size       int
+}
+
+type fakeListPartsResult struct {
+	XMLName     xml.Name `xml:"ListPartsResult"`
+	IsTruncated bool
+	Parts       []fakePart `xml:"Part"`
+}
+
+func (u *fakeUpload) listParts() fakeListPartsResult {
+	var result fakeListPartsResult
+	for _, number := range u.partNumbers() {
+		sum := md5.Sum(u.parts[number])
+		result.Parts = append(result.Parts, fakePart{
+			PartNumber: number,
+			ETag:       `"` + hex.EncodeToString(sum[:]) + `"`,
+			Size:       len(u.parts[number]),
+		})
+	}
+	return result
+}
+
+func (u *fakeUpload) partNumbers() []int {
+	numbers := make([]int, 0, len(u.parts))
+	for number := range u.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// completeUpload stores the parts listed in a CompleteMultipartUpload
+// request body as an object with the ETag S3 gives multipart uploads.
+func (b *fakeBucket) completeUpload(key string, upload *fakeUpload, body []byte) (*fakeObject, error) {
+	var request struct {
+		Part []fakePart
+	}
+	if err := xml.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, part := range request.Part {
+		if _, ok := upload.parts[part.PartNumber]; !ok {
+			return nil, fmt.Errorf("part %d was not uploaded", part.PartNumber)
+		}
+		numbers = append(numbers, part.PartNumber)
+	}
+
+	var data []byte
+	combined := md5.New()
+	for _, number := range numbers {
+		data = append(data, upload.parts[number]...)
+		sum := md5.Sum(upload.parts[number])
+		combined.Write(sum[:])
+	}
+
+	obj := b.putObject(key, data, time.Now())
+	obj.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(combined.Sum(nil)), len(numbers))
+	obj.header = upload.header
+	obj.tags = upload.tags
+	return obj, nil
+}
+
+// copyObjectHeaders copies the headers S3 stores with an object.
+func copyObjectHeaders(dst, src http.Header) {
+	for name, values := range src {
+		if strings.HasPrefix(name, "X-Amz-Meta-") || strings.HasPrefix(name, "X-Amz-Server-Side-Encryption") ||
+			name == "Content-Type" || name == "Cache-Control" || name == "X-Amz-Storage-Class" {
+			dst[name] = values
+		}
+	}
+}
+
+// storageClass returns the storage class the object was stored with.
+func (o *fakeObject) storageClass() string {
+	if class := o.header.Get("X-Amz-Storage-Class"); class != "" {
+		return class
+	}
+	return s3.StorageClassStandard
+}
+
+type fakeTag struct {
+	Key   string
+	Value string
+}
+
+type fakeTagging struct {
+	XMLName xml.Name  `xml:"Tagging"`
+	TagSet  []fakeTag `xml:"TagSet>Tag"`
+}
+
+// newFakeTagging returns the tag set of an object, sorted by key.
+func newFakeTagging(tags url.Values) fakeTagging {
+	tagging := fakeTagging{TagSet: []fakeTag{}}
+	for key := range tags {
+		tagging.TagSet = append(tagging.TagSet, fakeTag{Key: key, Value: tags.Get(key)})
+	}
+	sort.Slice(tagging.TagSet, func(i, j int) bool {
+		return tagging.TagSet[i].Key < tagging.TagSet[j].Key
+	})
+	return tagging
+}
+
+func (b *fakeBucket) sortedKeys() []string {
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type fakeListedObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+type fakeCommonPrefix struct {
+	Prefix string
+}
+
+type fakeListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	NextContinuationToken string             `xml:",omitempty"`
+	Contents              []fakeListedObject `xml:"Contents"`
+	CommonPrefixes        []fakeCommonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjectsV2 answers a ListObjectsV2 request, using the last
+// key returned as the continuation token.
+func (b *fakeBucket) listObjectsV2(bucketName string, query url.Values) fakeListResult {
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys := 1000
+	if v, err := strconv.Atoi(query.Get("max-keys")); err == nil {
+		maxKeys = v
+	}
+	after := query.Get("start-after")
+	if token := query.Get("continuation-token"); token != "" {
+		after = token
+	}
+
+	result := fakeListResult{Name: bucketName, Prefix: prefix, MaxKeys: maxKeys}
+	seen := map[string]bool{}
+	for _, key := range b.sortedKeys() {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		// A token naming a common prefix resumes after all of its keys.
+		if delimiter != "" && strings.HasSuffix(after, delimiter) && strings.HasPrefix(key, after) {
+			continue
+		}
+		common := ""
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common = key[:len(prefix)+i+len(delimiter)]
+				if seen[common] {
+					continue
+				}
+			}
+		}
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if common != "" {
+			seen[common] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, fakeCommonPrefix{Prefix: common})
+			result.KeyCount++
+			result.NextContinuationToken = common
+			continue
+		}
+
+		obj := b.objects[key]
+		result.Contents = append(result.Contents, fakeListedObject{
+			Key:          key,
+			LastModified: obj.modified.Format(time.RFC3339),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: obj.storageClass(),
+		})
+		result.KeyCount++
+		result.NextContinuationToken = key
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	return result
+}
+
+type fakeDeleted struct {
+	Key string
+}
+
+type fakeDeleteError struct {
+	Key       string
+	VersionId string
+	Code      string
+	Message   string
+}
+
+type fakeDeleteResult struct {
+	XMLName xml.Name          `xml:"DeleteResult"`
+	Deleted []fakeDeleted     `xml:"Deleted"`
+	Errors  []fakeDeleteError `xml:"Error"`
+}
+
+// deleteObjects answers a DeleteObjects request. Deleting without
+// a version ID deletes the current object.
+func (b *fakeBucket) deleteObjects(body []byte, bypassGovernance bool) fakeDeleteResult {
+	var request struct {
+		Object []struct {
+			Key       string
+			VersionId string
+		}
+	}
+	_ = xml.Unmarshal(body, &request)
+
+	var result fakeDeleteResult
+	for _, obj := range request.Object {
+		if obj.VersionId == "" || obj.VersionId == "null" {
+			delete(b.objects, obj.Key)
+			result.Deleted = append(result.Deleted, fakeDeleted{Key: obj.Key})
+			continue
+		}
+
+		for i, version := range b.versions {
+			if version.key != obj.Key || version.id != obj.VersionId {
+				continue
+			}
+			if version.locked && !bypassGovernance {
+				result.Errors = append(result.Errors, fakeDeleteError{
+					Key: obj.Key, VersionId: obj.VersionId, Code: "AccessDenied", Message: "Access Denied because object protected by object lock.",
+				})
+				break
+			}
+			b.versions = append(b.versions[:i], b.versions[i+1:]...)
+			result.Deleted = append(result.Deleted, fakeDeleted{Key: obj.Key})
+			break
+		}
+	}
+	return result
+}
+
+type fakeListedVersion struct {
+	Key       string
+	VersionId string
+	IsLatest  bool
+}
+
+type fakeListVersionsResult struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	IsTruncated         bool
+	NextKeyMarker       string              `xml:",omitempty"`
+	NextVersionIdMarker string              `xml:",omitempty"`
+	Versions            []fakeListedVersion `xml:"Version"`
+	DeleteMarkers       []fakeListedVersion `xml:"DeleteMarker"`
+}
+
+// listObjectVersions answers a ListObjectVersions request, listing
+// the current objects followed by the other versions of each key.
+func (b *fakeBucket) listObjectVersions(query url.Values) fakeListVersionsResult {
+	type entry struct {
+		fakeListedVersion
+		deleteMarker bool
+	}
+	var entries []entry
+	for _, key := range b.sortedKeys() {
+		entries = append(entries, entry{fakeListedVersion: fakeListedVersion{Key: key, VersionId: "null", IsLatest: true}})
+	}
+	for _, version := range b.versions {
+		entries = append(entries, entry{fakeListedVersion: fakeListedVersion{Key: version.key, VersionId: version.id}, deleteMarker: version.deleteMarker})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	maxKeys := 1000
+	if v, err := strconv.Atoi(query.Get("max-keys")); err == nil {
+		maxKeys = v
+	}
+	start := 0
+	if marker := query.Get("key-marker"); marker != "" {
+		for i, e := range entries {
+			if e.Key == marker && e.VersionId == query.Get("version-id-marker") {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	var result fakeListVersionsResult
+	for i := start; i < len(entries); i++ {
+		if i-start == maxKeys {
+			result.IsTruncated = true
+			result.NextKeyMarker = entries[i-1].Key
+			result.NextVersionIdMarker = entries[i-1].VersionId
+			break
+		}
+		if entries[i].deleteMarker {
+			result.DeleteMarkers = append(result.DeleteMarkers, entries[i].fakeListedVersion)
+		} else {
+			result.Versions = append(result.Versions, entries[i].fakeListedVersion)
+		}
+	}
+	return result
+}
+
+type fakeListedUpload struct {
+	Key      string
+	UploadId string
+}
+
+type fakeListUploadsResult struct {
+	XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+	IsTruncated bool
+	Uploads     []fakeListedUpload `xml:"Upload"`
+}
+
+func (b *fakeBucket) listMultipartUploads() fakeListUploadsResult {
+	var result fakeListUploadsResult
+	for id, upload := range b.uploads {
+		result.Uploads = append(result.Uploads, fakeListedUpload{Key: upload.key, UploadId: id})
+	}
+	sort.Slice(result.Uploads, func(i, j int) bool {
+		return result.Uploads[i].UploadId < result.Uploads[j].UploadId
+	})
+	return result
+}
+
+// write answers a GET or HEAD of the object, honouring a single
+// byte range as used by ranged and concurrent downloads. If truncate
+// is set, only the first half of the body is sent, as when the
+// connection is interrupted.
+func (o *fakeObject) write(w http.ResponseWriter, r *http.Request, truncate bool) {
+	for name, values := range o.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("ETag", o.etag)
+	w.Header().Set("Last-Modified", o.modified.Format(http.TimeFormat))
+	if contentType := r.URL.Query().Get("response-content-type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	data, status := o.data, http.StatusOK
+	if spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+		startStr, endStr, _ := strings.Cut(spec, "-")
+		start, _ := strconv.Atoi(startStr)
+		end, err := strconv.Atoi(endStr)
+		if err != nil || end >= len(o.data) {
+			end = len(o.data) - 1
+		}
+		if start > end {
+			writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		data, status = o.data[start:end+1], http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(o.data)))
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if truncate {
+		data = data[:len(data)/2]
+	}
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(data)
+	}
+}
+
+// copySource returns the source object of a copy request, honouring
+// its ETag precondition, or the status and error code S3 would answer
+// with if it can not be copied.
+func (f *fakeS3) copySource(header http.Header) (*fakeObject, int, string) {
+	source, err := url.PathUnescape(header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return nil, http.StatusBadRequest, "InvalidArgument"
+	}
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	bucket, ok := f.buckets[bucketName]
+	if !ok {
+		return nil, http.StatusNotFound, s3.ErrCodeNoSuchBucket
+	}
+	obj, ok := bucket.objects[key]
+	if !ok {
+		return nil, http.StatusNotFound, s3.ErrCodeNoSuchKey
+	}
+	if etag := header.Get("X-Amz-Copy-Source-If-Match"); etag != "" && etag != obj.etag {
+		return nil, http.StatusPreconditionFailed, "PreconditionFailed"
+	}
+	return obj, 0, ""
+}
+
+// checkPresigned verifies the expiry and signature of a presigned
+// request by presigning it again, returning the status and error
+// code S3 would answer with if it is not valid.
+func checkPresigned(r *http.Request) (int, string) {
+	query := r.URL.Query()
+	signTime, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return http.StatusBadRequest, "AuthorizationQueryParametersError"
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return http.StatusBadRequest, "AuthorizationQueryParametersError"
+	}
+	expiry := time.Duration(seconds) * time.Second
+	if time.Now().After(signTime.Add(expiry)) {
+		return http.StatusForbidden, "AccessDenied"
+	}
+	scope := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(scope) != 5 || scope[0] != fakeAccessKeyID {
+		return http.StatusForbidden, "InvalidAccessKeyId"
+	}
+
+	unsigned := url.Values{}
+	for name, values := range query {
+		switch name {
+		case "X-Amz-Algorithm", "X-Amz-Credential", "X-Amz-Date", "X-Amz-Expires", "X-Amz-SignedHeaders", "X-Amz-Signature":
+		default:
+			unsigned[name] = values
+		}
+	}
+	req, _ := http.NewRequest(r.Method, "https://"+r.Host+r.URL.EscapedPath()+"?"+unsigned.Encode(), nil)
+	for _, name := range strings.Split(query.Get("X-Amz-SignedHeaders"), ";") {
+		if name != "host" {
+			req.Header.Set(name, r.Header.Get(name))
+		}
+	}
+
+	signer := v4.NewSigner(credentials.NewStaticCredentials(fakeAccessKeyID, fakeSecretAccessKey, ""), func(s *v4.Signer) {
+		s.DisableURIPathEscaping = true
+	})
+	if _, err := signer.Presign(req, nil, "s3", scope[2], expiry, signTime); err != nil {
+		return http.StatusForbidden, "SignatureDoesNotMatch"
+	}
+	if req.URL.Query().Get("X-Amz-Signature") != query.Get("X-Amz-Signature") {
+		return http.StatusForbidden, "SignatureDoesNotMatch"
+	}
+	return 0, ""
+}
+
+// postObject stores the file of a browser POST upload if its form
+// satisfies its signed policy, returning the status and error code
+// S3 would answer with otherwise.
+func (b *fakeBucket) postObject(bucketName, contentType string, body []byte) (int, string) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return http.StatusBadRequest, "MalformedPOSTRequest"
+	}
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(int64(len(body)) + 1)
+	if err != nil || len(form.File["file"]) != 1 {
+		return http.StatusBadRequest, "MalformedPOSTRequest"
+	}
+	file, err := form.File["file"][0].Open()
+	if err != nil {
+		return http.StatusBadRequest, "MalformedPOSTRequest"
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+
+	// Field names are case-insensitive.
+	fields := map[string]string{}
+	for name, values := range form.Value {
+		fields[strings.ToLower(name)] = values[0]
+	}
+	fields["key"] = strings.ReplaceAll(fields["key"], "${filename}", form.File["file"][0].Filename)
+
+	if status, code := checkPostPolicy(bucketName, fields, int64(len(data))); code != "" {
+		return status, code
+	}
+
+	obj := b.putObject(fields["key"], data, time.Now())
+	if contentType := fields["content-type"]; contentType != "" {
+		obj.header.Set("Content-Type", contentType)
+	}
+	return 0, ""
+}
+
+// checkPostPolicy verifies the signature, expiry and conditions of
+// the policy of a POST upload, which must cover every form field.
+func checkPostPolicy(bucketName string, fields map[string]string, size int64) (int, string) {
+	scope := strings.Split(fields["x-amz-credential"], "/")
+	if len(scope) != 5 || scope[0] != fakeAccessKeyID {
+		return http.StatusForbidden, "InvalidAccessKeyId"
+	}
+	key := []byte("AWS4" + fakeSecretAccessKey)
+	for _, part := range append(scope[1:], fields["policy"]) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if hex.EncodeToString(key) != fields["x-amz-signature"] {
+		return http.StatusForbidden, "SignatureDoesNotMatch"
+	}
+
+	var policy struct {
+		Expiration time.Time     `json:"expiration"`
+		Conditions []interface{} `json:"conditions"`
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(fields["policy"])
+	if err := json.Unmarshal(decoded, &policy); err != nil {
+		return http.StatusBadRequest, "InvalidPolicyDocument"
+	}
+	if time.Now().After(policy.Expiration) {
+		return http.StatusForbidden, "AccessDenied"
+	}
+
+	covered := map[string]bool{"policy": true, "x-amz-signature": true, "file": true}
+	matches := func(op, name, value string) bool {
+		name = strings.ToLower(strings.TrimPrefix(name, "$"))
+		covered[name] = true
+		actual := fields[name]
+		if name == "bucket" {
+			actual = bucketName
+		}
+		if op == "starts-with" {
+			return strings.HasPrefix(actual, value)
+		}
+		return actual == value
+	}
+	for _, condition := range policy.Conditions {
+		switch condition := condition.(type) {
+		case map[string]interface{}:
+			for name, value := range condition {
+				if !matches("eq", name, fmt.Sprint(value)) {
+					return http.StatusForbidden, "AccessDenied"
+				}
+			}
+		case []interface{}:
+			if len(condition) != 3 {
+				return http.StatusBadRequest, "InvalidPolicyDocument"
+			}
+			op := strings.ToLower(fmt.Sprint(condition[0]))
+			if op == "content-length-range" {
+				minSize, _ := condition[1].(float64)
+				maxSize, _ := condition[2].(float64)
+				if size < int64(minSize) {
+					return http.StatusBadRequest, "EntityTooSmall"
+				}
+				if size > int64(maxSize) {
+					return http.StatusBadRequest, "EntityTooLarge"
+				}
+				continue
+			}
+			if !matches(op, fmt.Sprint(condition[1]), fmt.Sprint(condition[2])) {
+				return http.StatusForbidden, "AccessDenied"
+			}
+		}
+	}
+
+	for name := range fields {
+		if !covered[name] && !strings.HasPrefix(name, "x-ignore-") {
+			return http.StatusForbidden, "AccessDenied"
+		}
+	}
+	return 0, ""
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	out, _ := xml.Marshal(v)
+	_, _ = w.Write(out)
+}
+
+// writeMissingSubresource answers a GET of a sub-resource that was never
+// put the way S3 does: with an empty document or a specific error.
+func writeMissingSubresource(w http.ResponseWriter, sub string) {
+	switch sub {
+	case "versioning":
+		_, _ = w.Write([]byte("<VersioningConfiguration/>"))
+	case "logging":
+		_, _ = w.Write([]byte("<BucketLoggingStatus/>"))
+	case "acl":
+		_, _ = w.Write([]byte("<AccessControlPolicy><Owner><ID>owner</ID></Owner><AccessControlList/></AccessControlPolicy>"))
+	case "encryption":
+		writeS3Error(w, http.StatusNotFound, "ServerSideEncryptionConfigurationNotFoundError")
+	case "publicAccessBlock":
+		writeS3Error(w, http.StatusNotFound, "NoSuchPublicAccessBlockConfiguration")
+	case "policy":
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucketPolicy")
+	case "lifecycle":
+		writeS3Error(w, http.StatusNotFound, "NoSuchLifecycleConfiguration")
+	case "tagging":
+		writeS3Error(w, http.StatusNotFound, "NoSuchTagSet")
+	case "object-lock":
+		writeS3Error(w, http.StatusNotFound, "ObjectLockConfigurationNotFoundError")
+	default:
+		writeS3Error(w, http.StatusNotFound, "NoSuchConfiguration")
+	}
+}
+
+// writeAccountError writes an error the way STS
+// and S3 Control do, wrapped in an ErrorResponse.
+func writeAccountError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<ErrorResponse><Error><Code>%s</Code><Message>%s</Message></Error></ErrorResponse>", code, code)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
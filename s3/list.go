@@ -0,0 +1,229 @@
+package s3
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxListKeys is the maximum number of keys S3 returns per page.
+const maxListKeys = 1000
+
+// ListObjectsOptions is a struct that provides the
+// options used by ListObjects.
+//
+// **Attributes:**
+//
+// Prefix: Only lists the keys starting with the prefix.
+// Delimiter: Groups the keys containing the delimiter after the prefix into a single prefix entry, such as "/" to list a directory.
+// StartAfter: Only lists the keys after this key.
+// MaxKeys: The maximum number of objects and prefixes listed, or 0 for all.
+// Head: Whether to get the Content-Type, metadata and storage class of each object with a HEAD request.
+// Tags: Whether to get the tags of each object.
+// Workers: The number of objects enriched concurrently and ahead of the iteration, defaults to 4.
+type ListObjectsOptions struct {
+	Prefix     string
+	Delimiter  string
+	StartAfter string
+	MaxKeys    int
+	Head       bool
+	Tags       bool
+	Workers    int
+}
+
+// ObjectInfo is a struct that describes a listed object,
+// or a common prefix when listing with a delimiter.
+//
+// **Attributes:**
+//
+// Key: The key of the object, or the prefix.
+// IsPrefix: Whether the entry is a common prefix rather than an object.
+// Size: The size of the object in bytes.
+// ETag: The ETag of the object.
+// LastModified: The time the object was last modified.
+// StorageClass: The storage class of the object.
+// ContentType: The Content-Type of the object, if listed with Head.
+// Metadata: The user-defined metadata of the object, if listed with Head.
+// Tags: The tags of the object, if listed with Tags.
+type ObjectInfo struct {
+	Key          string
+	IsPrefix     bool
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	StorageClass string
+	ContentType  string
+	Metadata     map[string]string
+	Tags         map[string]string
+}
+
+// ObjectIterator is an iterator over listed objects. It has the shape
+// of iter.Seq2[ObjectInfo, error], so it can be ranged over from
+// Go 1.23 on, or called with a yield function that returns false to
+// stop the iteration.
+type ObjectIterator func(yield func(ObjectInfo, error) bool)
+
+// ListObjects returns an iterator over the objects in the bucket
+// specified by bucketName in key order. Objects are listed one page
+// at a time as the iteration proceeds, so that buckets of any size
+// can be walked in constant memory. A failed listing is yielded as an
+// error that ends the iteration, while an object that could not be
+// enriched is yielded with its error and the iteration continues.
+// Objects are enriched opts.Workers at a time as they are yielded.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to list.
+// opts: The options of the listing.
+//
+// **Returns:**
+//
+// ObjectIterator: An iterator over the listed objects.
+func ListObjects(client *s3.S3, bucketName string, opts ListObjectsOptions) ObjectIterator {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultSyncWorkers
+	}
+
+	return func(yield func(ObjectInfo, error) bool) {
+		input := &s3.ListObjectsV2Input{Bucket: aws.String(bucketName)}
+		if opts.Prefix != "" {
+			input.Prefix = aws.String(opts.Prefix)
+		}
+		if opts.Delimiter != "" {
+			input.Delimiter = aws.String(opts.Delimiter)
+		}
+		if opts.StartAfter != "" {
+			input.StartAfter = aws.String(opts.StartAfter)
+		}
+
+		listed := 0
+		for {
+			pageSize := maxListKeys
+			if opts.MaxKeys > 0 {
+				pageSize = min(pageSize, opts.MaxKeys-listed)
+			}
+			input.MaxKeys = aws.Int64(int64(pageSize))
+
+			page, err := client.ListObjectsV2(input)
+			if err != nil {
+				yield(ObjectInfo{}, fmt.Errorf("error listing objects in %s: %v", bucketName, err))
+				return
+			}
+
+			// Objects are enriched a chunk at a time, so that the first
+			// objects are not held back by the details of the whole page.
+			infos := pageObjects(page)
+			chunkSize := len(infos)
+			if opts.Head || opts.Tags {
+				chunkSize = opts.Workers
+			}
+			for start := 0; start < len(infos); start += chunkSize {
+				chunk := infos[start:min(start+chunkSize, len(infos))]
+				errs := enrichObjects(client, bucketName, chunk, opts)
+				for i, info := range chunk {
+					if !yield(info, errs[i]) {
+						return
+					}
+				}
+			}
+
+			listed += len(infos)
+			if !aws.BoolValue(page.IsTruncated) || (opts.MaxKeys > 0 && listed >= opts.MaxKeys) {
+				return
+			}
+			input.ContinuationToken = page.NextContinuationToken
+		}
+	}
+}
+
+// pageObjects returns the objects and common prefixes
+// of a listed page merged in key order.
+func pageObjects(page *s3.ListObjectsV2Output) []ObjectInfo {
+	infos := make([]ObjectInfo, 0, len(page.Contents)+len(page.CommonPrefixes))
+	for _, obj := range page.Contents {
+		infos = append(infos, ObjectInfo{
+			Key:          aws.StringValue(obj.Key),
+			Size:         aws.Int64Value(obj.Size),
+			ETag:         aws.StringValue(obj.ETag),
+			LastModified: aws.TimeValue(obj.LastModified),
+			StorageClass: aws.StringValue(obj.StorageClass),
+		})
+	}
+	for _, prefix := range page.CommonPrefixes {
+		infos = append(infos, ObjectInfo{Key: aws.StringValue(prefix.Prefix), IsPrefix: true})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+	return infos
+}
+
+// enrichObjects concurrently gets the details of the objects requested
+// by the options and returns the error of each object, if any.
+func enrichObjects(client *s3.S3, bucketName string, infos []ObjectInfo, opts ListObjectsOptions) []error {
+	errs := make([]error, len(infos))
+	if !opts.Head && !opts.Tags {
+		return errs
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = enrichObject(client, bucketName, &infos[i], opts)
+			}
+		}()
+	}
+	for i := range infos {
+		if !infos[i].IsPrefix {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
+
+// enrichObject gets the details of an object requested by the options.
+func enrichObject(client *s3.S3, bucketName string, info *ObjectInfo, opts ListObjectsOptions) error {
+	if opts.Head {
+		head, err := client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(info.Key),
+		})
+		if err != nil {
+			return fmt.Errorf("error getting details of %s in %s: %v", info.Key, bucketName, err)
+		}
+		info.ContentType = aws.StringValue(head.ContentType)
+		info.Metadata = aws.StringValueMap(head.Metadata)
+		// HEAD only returns the storage class if it is not STANDARD.
+		if head.StorageClass != nil {
+			info.StorageClass = aws.StringValue(head.StorageClass)
+		}
+	}
+
+	if opts.Tags {
+		out, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(info.Key),
+		})
+		if err != nil {
+			return fmt.Errorf("error getting tags of %s in %s: %v", info.Key, bucketName, err)
+		}
+		info.Tags = make(map[string]string, len(out.TagSet))
+		for _, tag := range out.TagSet {
+			info.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package s3_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectObjects iterates over objects until it has collected limit
+// of them, or all of them if limit is 0, stopping at the first error.
+func collectObjects(objects s3utils.ObjectIterator, limit int) ([]s3utils.ObjectInfo, error) {
+	var infos []s3utils.ObjectInfo
+	var iterErr error
+	objects(func(info s3utils.ObjectInfo, err error) bool {
+		if err != nil {
+			iterErr = err
+			return false
+		}
+		infos = append(infos, info)
+		return limit == 0 || len(infos) < limit
+	})
+	return infos, iterErr
+}
+
+// objectKeys returns the keys of listed objects, with
+// a trailing "(prefix)" for common prefixes.
+func objectKeys(infos []s3utils.ObjectInfo) []string {
+	keys := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsPrefix {
+			keys = append(keys, info.Key+" (prefix)")
+			continue
+		}
+		keys = append(keys, info.Key)
+	}
+	return keys
+}
+
+func TestListObjects(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	for i := 0; i < 2500; i++ {
+		fake.addObject("logs", fmt.Sprintf("2024/%04d.log", i), []byte("entry"), time.Now())
+	}
+	for _, key := range []string{"2023/01/a.log", "2023/02/b.log", "README", "latest/x.log"} {
+		fake.addObject("logs", key, []byte("entry"), time.Now())
+	}
+
+	tests := []struct {
+		name      string
+		opts      s3utils.ListObjectsOptions
+		limit     int
+		wantCount int
+		wantFirst []string
+		wantPages []string
+	}{
+		{
+			name:      "all objects",
+			wantCount: 2504,
+			wantFirst: []string{"2023/01/a.log", "2023/02/b.log", "2024/0000.log"},
+			wantPages: []string{"1000", "1000", "1000"},
+		},
+		{
+			name:      "directory",
+			opts:      s3utils.ListObjectsOptions{Delimiter: "/"},
+			wantCount: 4,
+			wantFirst: []string{"2023/ (prefix)", "2024/ (prefix)", "README", "latest/ (prefix)"},
+			wantPages: []string{"1000"},
+		},
+		{
+			name:      "prefix directory",
+			opts:      s3utils.ListObjectsOptions{Prefix: "2023/", Delimiter: "/"},
+			wantCount: 2,
+			wantFirst: []string{"2023/01/ (prefix)", "2023/02/ (prefix)"},
+			wantPages: []string{"1000"},
+		},
+		{
+			name:      "start after with max keys",
+			opts:      s3utils.ListObjectsOptions{Prefix: "2024/", StartAfter: "2024/0999.log", MaxKeys: 1200},
+			wantCount: 1200,
+			wantFirst: []string{"2024/1000.log", "2024/1001.log"},
+			wantPages: []string{"1000", "200"},
+		},
+		{
+			name:      "stopped early",
+			limit:     5,
+			wantCount: 5,
+			wantFirst: []string{"2023/01/a.log"},
+			wantPages: []string{"1000"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			before := len(fake.requestsFor("ListObjectsV2"))
+			infos, err := collectObjects(s3utils.ListObjects(client, "logs", tc.opts), tc.limit)
+			require.NoError(t, err)
+			require.Len(t, infos, tc.wantCount)
+			assert.Equal(t, tc.wantFirst, objectKeys(infos)[:len(tc.wantFirst)])
+
+			var pages []string
+			for _, req := range fake.requestsFor("ListObjectsV2")[before:] {
+				pages = append(pages, req.Query.Get("max-keys"))
+			}
+			assert.Equal(t, tc.wantPages, pages)
+		})
+	}
+}
+
+func TestListObjectsEnrichment(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("archive", "placeholder", nil, time.Now())
+
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String("archive"),
+		Key:          aws.String("reports/q1.pdf"),
+		Body:         strings.NewReader("pdf"),
+		ContentType:  aws.String("application/pdf"),
+		Metadata:     aws.StringMap(map[string]string{"Owner": "finance"}),
+		StorageClass: aws.String(s3.StorageClassStandardIa),
+		Tagging:      aws.String("team=finance&retention=7y"),
+	})
+	require.NoError(t, err)
+
+	infos, err := collectObjects(s3utils.ListObjects(client, "archive", s3utils.ListObjectsOptions{Prefix: "reports/", Head: true, Tags: true}), 0)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+
+	info := infos[0]
+	assert.Equal(t, "reports/q1.pdf", info.Key)
+	assert.Equal(t, int64(3), info.Size)
+	assert.Equal(t, "application/pdf", info.ContentType)
+	assert.Equal(t, s3.StorageClassStandardIa, info.StorageClass)
+	assert.Equal(t, map[string]string{"Owner": "finance"}, info.Metadata)
+	assert.Equal(t, map[string]string{"team": "finance", "retention": "7y"}, info.Tags)
+
+	// Without enrichment, only the listing is requested.
+	before := len(fake.operations())
+	_, err = collectObjects(s3utils.ListObjects(client, "archive", s3utils.ListObjectsOptions{}), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ListObjectsV2"}, fake.operations()[before:])
+}
+
+func TestListObjectsEnrichesAsYielded(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	for i := 0; i < 20; i++ {
+		fake.addObject("archive", fmt.Sprintf("reports/%02d.pdf", i), []byte("pdf"), time.Now())
+	}
+
+	// Only the chunk of the first object is enriched
+	// before it is yielded, not the whole page.
+	infos, err := collectObjects(s3utils.ListObjects(client, "archive", s3utils.ListObjectsOptions{Head: true, Workers: 3}), 1)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Len(t, fake.requestsFor("HeadObject"), 3)
+
+	infos, err = collectObjects(s3utils.ListObjects(client, "archive", s3utils.ListObjectsOptions{Head: true, Workers: 3}), 0)
+	require.NoError(t, err)
+	assert.Len(t, infos, 20)
+	assert.Len(t, fake.requestsFor("HeadObject"), 23)
+}
+
+func TestListObjectsErrors(t *testing.T) {
+	client, fake := newFakeS3Client(t, map[string]fakeS3Error{
+		"GetObjectTagging": {Status: http.StatusForbidden, Code: "AccessDenied"},
+	})
+	fake.addObject("private", "a.txt", []byte("a"), time.Now())
+	fake.addObject("private", "b.txt", []byte("b"), time.Now())
+
+	// An object that can not be enriched does not end the iteration.
+	var keys []string
+	var errs []error
+	s3utils.ListObjects(client, "private", s3utils.ListObjectsOptions{Tags: true})(func(info s3utils.ObjectInfo, err error) bool {
+		keys = append(keys, info.Key)
+		errs = append(errs, err)
+		return true
+	})
+	assert.Equal(t, []string{"a.txt", "b.txt"}, keys)
+	for _, err := range errs {
+		assert.ErrorContains(t, err, "AccessDenied")
+	}
+
+	_, err := collectObjects(s3utils.ListObjects(client, "missing", s3utils.ListObjectsOptions{}), 0)
+	assert.ErrorContains(t, err, s3.ErrCodeNoSuchBucket)
+}
+
+func TestGetBucketsError(t *testing.T) {
+	client, _ := newFakeS3Client(t, map[string]fakeS3Error{
+		"ListBuckets": {Status: http.StatusForbidden, Code: "AccessDenied"},
+	})
+
+	buckets, err := s3utils.GetBuckets(client)
+	assert.Error(t, err)
+	assert.Nil(t, buckets)
+}
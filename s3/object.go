@@ -0,0 +1,311 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// sseCustomerKeySize is the size of an SSE-C key in bytes.
+const sseCustomerKeySize = 32
+
+// PutObjectOptions is a struct that provides the
+// options used by PutObject.
+//
+// **Attributes:**
+//
+// ContentType: The MIME type of the object.
+// CacheControl: The Cache-Control header of the object.
+// Metadata: The user-defined metadata of the object.
+// Encryption: The server-side encryption, EncryptionSSES3, EncryptionSSEKMS or empty for the bucket default.
+// KMSKeyID: The KMS key used with EncryptionSSEKMS, defaults to the AWS managed key.
+// SSECustomerKey: A 256-bit key to encrypt the object with SSE-C, mutually exclusive with Encryption.
+// PartSize: The size of each uploaded part in bytes, defaults to 5 MiB.
+// Concurrency: The number of parts uploaded concurrently, defaults to 5.
+// Progress: Receives progress updates of the upload, if set.
+// RateLimiter: Limits the bandwidth of the upload, if set.
+type PutObjectOptions struct {
+	ContentType    string
+	CacheControl   string
+	Metadata       map[string]string
+	Encryption     string
+	KMSKeyID       string
+	SSECustomerKey []byte
+	PartSize       int64
+	Concurrency    int
+	Progress       ProgressReporter
+	RateLimiter    *RateLimiter
+}
+
+// GetObjectOptions is a struct that provides the
+// options used by GetObject and GetObjectAt.
+//
+// **Attributes:**
+//
+// SSECustomerKey: The key the object was encrypted with using SSE-C.
+// PartSize: The size of each part downloaded by GetObjectAt in bytes, defaults to 5 MiB.
+// Concurrency: The number of parts GetObjectAt downloads concurrently, defaults to 5.
+// Progress: Receives progress updates of the download, if set.
+// RateLimiter: Limits the bandwidth of the download, if set.
+type GetObjectOptions struct {
+	SSECustomerKey []byte
+	PartSize       int64
+	Concurrency    int
+	Progress       ProgressReporter
+	RateLimiter    *RateLimiter
+}
+
+// UploadResult is a struct that describes an uploaded object.
+//
+// **Attributes:**
+//
+// Location: The URL of the object.
+// ETag: The ETag of the object.
+// VersionID: The version ID of the object, if the bucket is versioned.
+type UploadResult struct {
+	Location  string
+	ETag      string
+	VersionID string
+}
+
+// PutObject uploads the content read from body to the input key of
+// the bucket specified by bucketName. The length of body does not
+// need to be known: content larger than a single part is uploaded as
+// a multipart upload, buffering one part per concurrent upload. As an
+// upload has at most 10,000 parts, streams larger than 10,000 times
+// the part size must use a larger PartSize.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to upload to.
+// key: The key of the object to upload.
+// body: The content of the object.
+// opts: The options of the upload.
+//
+// **Returns:**
+//
+// UploadResult: A description of the uploaded object.
+// error: An error if the object could not be uploaded.
+func PutObject(client *s3.S3, bucketName string, key string, body io.Reader, opts PutObjectOptions) (UploadResult, error) {
+	input, err := uploadInput(bucketName, key, opts)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	// The length of the body is determined up front to report it,
+	// where possible. Seeking fails on pipes such as os.Stdin, whose
+	// length is then reported as unknown.
+	size := int64(-1)
+	if seeker, ok := body.(io.Seeker); ok && opts.Progress != nil {
+		if n, err := readerSize(seeker); err == nil {
+			size = n
+		}
+	}
+	object := newTransferTracker(opts.Progress, opts.RateLimiter).object(key, 0, size)
+	input.Body = object.reader(body)
+
+	uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		if opts.PartSize > 0 {
+			u.PartSize = opts.PartSize
+		}
+		if opts.Concurrency > 0 {
+			u.Concurrency = opts.Concurrency
+		}
+	})
+
+	out, err := uploader.Upload(input)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("error uploading %s to %s: %v", key, bucketName, err)
+	}
+
+	return UploadResult{
+		Location:  out.Location,
+		ETag:      aws.StringValue(out.ETag),
+		VersionID: aws.StringValue(out.VersionID),
+	}, nil
+}
+
+// uploadInput returns the input to upload an object with,
+// without its body.
+func uploadInput(bucketName, key string, opts PutObjectOptions) (*s3manager.UploadInput, error) {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+
+	switch opts.Encryption {
+	case "":
+	case EncryptionSSES3, EncryptionSSEKMS:
+		if opts.SSECustomerKey != nil {
+			return nil, fmt.Errorf("SSE-C cannot be combined with %s encryption", opts.Encryption)
+		}
+		input.ServerSideEncryption = aws.String(opts.Encryption)
+	default:
+		return nil, fmt.Errorf("unsupported encryption %q", opts.Encryption)
+	}
+	if opts.KMSKeyID != "" {
+		if opts.Encryption != EncryptionSSEKMS {
+			return nil, fmt.Errorf("a KMS key requires %s encryption", EncryptionSSEKMS)
+		}
+		input.SSEKMSKeyId = aws.String(opts.KMSKeyID)
+	}
+	if opts.SSECustomerKey != nil {
+		if len(opts.SSECustomerKey) != sseCustomerKeySize {
+			return nil, fmt.Errorf("SSE-C key must be %d bytes, got %d", sseCustomerKeySize, len(opts.SSECustomerKey))
+		}
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = aws.String(string(opts.SSECustomerKey))
+	}
+
+	return input, nil
+}
+
+// readerSize returns the number of bytes left to read from a seeker.
+func readerSize(seeker io.Seeker) (int64, error) {
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - current, nil
+}
+
+// GetObjectAt downloads the object at the input key of the bucket
+// specified by bucketName in concurrent ranged parts and writes
+// them to w at their offsets.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to download from.
+// key: The key of the object to download.
+// w: Where the content of the object is written to, such as an *os.File.
+// opts: The options of the download.
+//
+// **Returns:**
+//
+// int64: The number of bytes written.
+// error: An error if the object could not be downloaded.
+func GetObjectAt(client *s3.S3, bucketName string, key string, w io.WriterAt, opts GetObjectOptions) (int64, error) {
+	input, err := getObjectInput(bucketName, key, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	tracker := newTransferTracker(opts.Progress, opts.RateLimiter)
+	var object *objectTransfer
+	if tracker != nil {
+		// The size is only needed to report progress.
+		size := int64(-1)
+		if opts.Progress != nil {
+			head, err := client.HeadObject(&s3.HeadObjectInput{
+				Bucket:               input.Bucket,
+				Key:                  input.Key,
+				SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+				SSECustomerKey:       input.SSECustomerKey,
+			})
+			if err != nil {
+				return 0, fmt.Errorf("error getting size of %s in %s: %v", key, bucketName, err)
+			}
+			size = aws.Int64Value(head.ContentLength)
+		}
+		object = tracker.object(key, 0, size)
+	}
+
+	downloader := s3manager.NewDownloaderWithClient(client, func(d *s3manager.Downloader) {
+		if opts.PartSize > 0 {
+			d.PartSize = opts.PartSize
+		}
+		if opts.Concurrency > 0 {
+			d.Concurrency = opts.Concurrency
+		}
+	})
+
+	n, err := downloader.Download(object.writerAt(w), input)
+	if err != nil {
+		return n, fmt.Errorf("error downloading %s from %s: %v", key, bucketName, err)
+	}
+
+	return n, nil
+}
+
+// GetObject downloads the object at the input key of the bucket
+// specified by bucketName and streams it to w in a single request.
+// If w is also an io.WriterAt, GetObjectAt is used instead.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to download from.
+// key: The key of the object to download.
+// w: Where the content of the object is written to.
+// opts: The options of the download.
+//
+// **Returns:**
+//
+// int64: The number of bytes written.
+// error: An error if the object could not be downloaded.
+func GetObject(client *s3.S3, bucketName string, key string, w io.Writer, opts GetObjectOptions) (int64, error) {
+	if wa, ok := w.(io.WriterAt); ok {
+		return GetObjectAt(client, bucketName, key, wa, opts)
+	}
+
+	input, err := getObjectInput(bucketName, key, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := client.GetObject(input)
+	if err != nil {
+		return 0, fmt.Errorf("error downloading %s from %s: %v", key, bucketName, err)
+	}
+	defer out.Body.Close()
+
+	size := int64(-1)
+	if out.ContentLength != nil {
+		size = *out.ContentLength
+	}
+	object := newTransferTracker(opts.Progress, opts.RateLimiter).object(key, 0, size)
+
+	n, err := io.Copy(object.writer(w), out.Body)
+	if err != nil {
+		return n, fmt.Errorf("error reading %s from %s: %v", key, bucketName, err)
+	}
+
+	return n, nil
+}
+
+// getObjectInput returns the input to download an object with.
+func getObjectInput(bucketName, key string, opts GetObjectOptions) (*s3.GetObjectInput, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+	if opts.SSECustomerKey != nil {
+		if len(opts.SSECustomerKey) != sseCustomerKeySize {
+			return nil, fmt.Errorf("SSE-C key must be %d bytes, got %d", sseCustomerKeySize, len(opts.SSECustomerKey))
+		}
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = aws.String(string(opts.SSECustomerKey))
+	}
+	return input, nil
+}
@@ -0,0 +1,115 @@
+package s3_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutObject(t *testing.T) {
+	t.Run("stream of unknown length", func(t *testing.T) {
+		client, fake := newFakeS3Client(t, nil)
+		fake.addObject("artifacts", "placeholder", nil, time.Now())
+
+		content := bytes.Repeat([]byte("0123456789"), 1100*1024)
+		// io.MultiReader hides the length of the content.
+		result, err := s3utils.PutObject(client, "artifacts", "release.tar.gz", io.MultiReader(bytes.NewReader(content)), s3utils.PutObjectOptions{
+			ContentType:  "application/gzip",
+			CacheControl: "no-cache",
+			Metadata:     map[string]string{"Commit": "abc123"},
+			Encryption:   s3utils.EncryptionSSEKMS,
+			KMSKeyID:     "alias/artifacts",
+			PartSize:     5 * 1024 * 1024,
+		})
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(result.ETag, `-3"`), result.ETag)
+
+		assert.Len(t, fake.requestsFor("UploadPart"), 3)
+		create := fake.requestsFor("CreateMultipartUpload")
+		require.Len(t, create, 1)
+		assert.Equal(t, "application/gzip", create[0].Header.Get("Content-Type"))
+		assert.Equal(t, "no-cache", create[0].Header.Get("Cache-Control"))
+		assert.Equal(t, "abc123", create[0].Header.Get("X-Amz-Meta-Commit"))
+		assert.Equal(t, "aws:kms", create[0].Header.Get("X-Amz-Server-Side-Encryption"))
+		assert.Equal(t, "alias/artifacts", create[0].Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+
+		data, ok := fake.object("artifacts", "release.tar.gz")
+		require.True(t, ok)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("small object", func(t *testing.T) {
+		client, fake := newFakeS3Client(t, nil)
+		fake.addObject("artifacts", "placeholder", nil, time.Now())
+
+		key := bytes.Repeat([]byte("k"), 32)
+		_, err := s3utils.PutObject(client, "artifacts", "small.txt", strings.NewReader("hello"), s3utils.PutObjectOptions{SSECustomerKey: key})
+		require.NoError(t, err)
+
+		put := fake.requestsFor("PutObject")
+		require.Len(t, put, 1)
+		assert.Equal(t, "AES256", put[0].Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+		assert.NotEmpty(t, put[0].Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"))
+		assert.Empty(t, fake.requestsFor("CreateMultipartUpload"))
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		client, fake := newFakeS3Client(t, nil)
+
+		for _, opts := range []s3utils.PutObjectOptions{
+			{Encryption: "DES"},
+			{KMSKeyID: "alias/artifacts"},
+			{SSECustomerKey: []byte("short")},
+			{Encryption: s3utils.EncryptionSSES3, SSECustomerKey: bytes.Repeat([]byte("k"), 32)},
+		} {
+			_, err := s3utils.PutObject(client, "artifacts", "key", strings.NewReader(""), opts)
+			assert.Error(t, err)
+		}
+		assert.Empty(t, fake.operations())
+	})
+}
+
+func TestGetObject(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	content := bytes.Repeat([]byte("abcdefgh"), 1024*1024)
+	fake.addObject("artifacts", "large.bin", content, time.Now())
+
+	t.Run("writer at", func(t *testing.T) {
+		before := len(fake.requestsFor("GetObject"))
+
+		buf := aws.NewWriteAtBuffer(nil)
+		n, err := s3utils.GetObjectAt(client, "artifacts", "large.bin", buf, s3utils.GetObjectOptions{PartSize: 5 * 1024 * 1024, Concurrency: 2})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Len(t, fake.requestsFor("GetObject")[before:], 2)
+	})
+
+	t.Run("writer", func(t *testing.T) {
+		before := len(fake.requestsFor("GetObject"))
+
+		var buf bytes.Buffer
+		key := bytes.Repeat([]byte("k"), 32)
+		n, err := s3utils.GetObject(client, "artifacts", "large.bin", &buf, s3utils.GetObjectOptions{SSECustomerKey: key})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.Bytes())
+
+		gets := fake.requestsFor("GetObject")[before:]
+		require.Len(t, gets, 1)
+		assert.Empty(t, gets[0].Header.Get("Range"))
+		assert.Equal(t, "AES256", gets[0].Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		_, err := s3utils.GetObject(client, "artifacts", "missing", io.Discard, s3utils.GetObjectOptions{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,305 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// defaultPresignExpiry is how long presigned URLs and
+	// POST policies are valid for if no expiry is set.
+	defaultPresignExpiry = 15 * time.Minute
+	// maxPresignExpiry is the longest expiry SigV4 allows.
+	maxPresignExpiry = 7 * 24 * time.Hour
+	// maxPostObjectSize is the largest object a POST upload can create.
+	maxPostObjectSize = 5 * 1024 * 1024 * 1024
+)
+
+// PresignOptions is a struct that provides the options used by
+// PresignGetObject and PresignPutObject.
+//
+// **Attributes:**
+//
+// Expiry: How long the URL is valid for, defaults to 15 minutes and is at most 7 days.
+// ContentType: For uploads, the Content-Type the upload must be sent with. For downloads, the Content-Type the object is served with.
+// ContentMD5: For uploads, the MD5 digest the uploaded content must match.
+type PresignOptions struct {
+	Expiry      time.Duration
+	ContentType string
+	ContentMD5  []byte
+}
+
+// PresignedRequest is a struct that describes a presigned request.
+//
+// **Attributes:**
+//
+// URL: The presigned URL.
+// Method: The HTTP method the request must use.
+// Header: The headers the request must be sent with, as they are signed.
+// Expires: The time the URL expires at.
+type PresignedRequest struct {
+	URL     string
+	Method  string
+	Header  http.Header
+	Expires time.Time
+}
+
+// PostPolicyOptions is a struct that provides the
+// options used by PresignPostPolicy.
+//
+// **Attributes:**
+//
+// Expiry: How long the policy is valid for, defaults to 15 minutes and is at most 7 days.
+// Key: The exact key the object must be uploaded to, mutually exclusive with KeyPrefix.
+// KeyPrefix: The prefix the key of the object must start with.
+// ContentType: The Content-Type the object must be uploaded with, if set.
+// MinSize: The minimum size of the object in bytes.
+// MaxSize: The maximum size of the object in bytes, defaults to 5 GiB.
+type PostPolicyOptions struct {
+	Expiry      time.Duration
+	Key         string
+	KeyPrefix   string
+	ContentType string
+	MinSize     int64
+	MaxSize     int64
+}
+
+// PresignedPost is a struct that describes a presigned
+// browser POST upload.
+//
+// **Attributes:**
+//
+// URL: The URL of the bucket the form is posted to.
+// Fields: The form fields to post before the file field. With a KeyPrefix, the key field ends in ${filename}, which S3 replaces with the name of the uploaded file.
+// Expires: The time the policy expires at.
+type PresignedPost struct {
+	URL     string
+	Fields  map[string]string
+	Expires time.Time
+}
+
+// PresignGetObject returns a URL that downloads the object at the
+// input key of the bucket specified by bucketName until it expires,
+// without requiring AWS credentials.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to download from.
+// key: The key of the object to download.
+// opts: The options of the URL. ContentMD5 does not apply to downloads.
+//
+// **Returns:**
+//
+// PresignedRequest: The presigned download request.
+// error: An error if the URL could not be presigned.
+func PresignGetObject(client *s3.S3, bucketName string, key string, opts PresignOptions) (PresignedRequest, error) {
+	if opts.ContentMD5 != nil {
+		return PresignedRequest{}, fmt.Errorf("a content MD5 only applies to uploads")
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ResponseContentType = aws.String(opts.ContentType)
+	}
+
+	req, _ := client.GetObjectRequest(input)
+	return presign(req.HTTPRequest.Method, key, opts.Expiry, req.PresignRequest)
+}
+
+// PresignPutObject returns a URL that uploads an object to the input
+// key of the bucket specified by bucketName until it expires, without
+// requiring AWS credentials. The upload must be sent with the headers
+// of the returned request, so a Content-Type or MD5 digest set in the
+// options can not be changed by whoever uses the URL.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to upload to.
+// key: The key of the object to upload.
+// opts: The options of the URL.
+//
+// **Returns:**
+//
+// PresignedRequest: The presigned upload request.
+// error: An error if the URL could not be presigned.
+func PresignPutObject(client *s3.S3, bucketName string, key string, opts PresignOptions) (PresignedRequest, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentMD5 != nil {
+		if len(opts.ContentMD5) != md5.Size {
+			return PresignedRequest{}, fmt.Errorf("content MD5 must be %d bytes, got %d", md5.Size, len(opts.ContentMD5))
+		}
+		input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(opts.ContentMD5))
+	}
+
+	req, _ := client.PutObjectRequest(input)
+	return presign(req.HTTPRequest.Method, key, opts.Expiry, req.PresignRequest)
+}
+
+// presign presigns a request with its PresignRequest method.
+func presign(method, key string, expiry time.Duration, presignRequest func(time.Duration) (string, http.Header, error)) (PresignedRequest, error) {
+	expiry, err := presignExpiry(expiry)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	expires := time.Now().Add(expiry)
+	url, header, err := presignRequest(expiry)
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("error presigning %s of %s: %v", method, key, err)
+	}
+
+	// The SDK keys the signed headers by their lowercase names,
+	// copy them under canonical names so Header.Get finds them.
+	canonical := http.Header{}
+	for name, values := range header {
+		for _, value := range values {
+			canonical.Add(name, value)
+		}
+	}
+
+	return PresignedRequest{URL: url, Method: method, Header: canonical, Expires: expires}, nil
+}
+
+// presignExpiry returns the expiry to presign with.
+func presignExpiry(expiry time.Duration) (time.Duration, error) {
+	switch {
+	case expiry == 0:
+		return defaultPresignExpiry, nil
+	case expiry < time.Second || expiry > maxPresignExpiry:
+		return 0, fmt.Errorf("expiry must be between 1 second and %s, got %s", maxPresignExpiry, expiry)
+	}
+	return expiry, nil
+}
+
+// PresignPostPolicy returns the URL and signed form fields of a browser
+// POST upload to the bucket specified by bucketName. The policy signed
+// into the fields restricts the key, size and Content-Type of the
+// uploaded object as set in the options, and S3 rejects forms with
+// fields the policy does not cover.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to upload to.
+// opts: The options of the policy.
+//
+// **Returns:**
+//
+// PresignedPost: The URL and form fields of the upload.
+// error: An error if the policy could not be signed.
+func PresignPostPolicy(client *s3.S3, bucketName string, opts PostPolicyOptions) (PresignedPost, error) {
+	expiry, err := presignExpiry(opts.Expiry)
+	if err != nil {
+		return PresignedPost{}, err
+	}
+	if opts.Key != "" && opts.KeyPrefix != "" {
+		return PresignedPost{}, fmt.Errorf("a key can not be combined with a key prefix")
+	}
+	maxSize := opts.MaxSize
+	if maxSize == 0 {
+		maxSize = maxPostObjectSize
+	}
+	if opts.MinSize < 0 || opts.MinSize > maxSize || maxSize > maxPostObjectSize {
+		return PresignedPost{}, fmt.Errorf("invalid size range %d to %d", opts.MinSize, maxSize)
+	}
+
+	creds, err := client.Config.Credentials.Get()
+	if err != nil {
+		return PresignedPost{}, fmt.Errorf("error getting credentials: %v", err)
+	}
+
+	// The bucket URL is resolved by the client, so that
+	// it follows its endpoint and addressing style.
+	req, _ := client.ListObjectsV2Request(&s3.ListObjectsV2Input{Bucket: aws.String(bucketName)})
+	if err := req.Build(); err != nil {
+		return PresignedPost{}, fmt.Errorf("error resolving URL of %s: %v", bucketName, err)
+	}
+	bucketURL := *req.HTTPRequest.URL
+	bucketURL.RawQuery = ""
+
+	now := time.Now().UTC()
+	expires := now.Add(expiry)
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), aws.StringValue(client.Config.Region))
+
+	fields := map[string]string{
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": creds.AccessKeyID + "/" + scope,
+		"x-amz-date":       amzDate,
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+	if opts.ContentType != "" {
+		fields["Content-Type"] = opts.ContentType
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": bucketName},
+		[]interface{}{"content-length-range", opts.MinSize, maxSize},
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conditions = append(conditions, map[string]string{name: fields[name]})
+	}
+	if opts.Key != "" {
+		fields["key"] = opts.Key
+		conditions = append(conditions, map[string]string{"key": opts.Key})
+	} else {
+		fields["key"] = opts.KeyPrefix + "${filename}"
+		conditions = append(conditions, []interface{}{"starts-with", "$key", opts.KeyPrefix})
+	}
+
+	policy, err := json.Marshal(struct {
+		Expiration string        `json:"expiration"`
+		Conditions []interface{} `json:"conditions"`
+	}{
+		Expiration: expires.Format("2006-01-02T15:04:05.000Z"),
+		Conditions: conditions,
+	})
+	if err != nil {
+		return PresignedPost{}, err
+	}
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+
+	// The policy is signed with the SigV4 signing key of the scope.
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{now.Format("20060102"), aws.StringValue(client.Config.Region), "s3", "aws4_request", fields["policy"]} {
+		key = hmacSHA256(key, part)
+	}
+	fields["x-amz-signature"] = hex.EncodeToString(key)
+
+	return PresignedPost{URL: bucketURL.String(), Fields: fields, Expires: expires}, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
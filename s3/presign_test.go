@@ -0,0 +1,196 @@
+package s3_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendPresigned sends a presigned request with a body
+// and returns the status code of the response.
+func sendPresigned(t *testing.T, client *s3.S3, presigned s3utils.PresignedRequest, header http.Header, body []byte) (int, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(presigned.Method, presigned.URL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header = header
+
+	resp, err := client.Config.HTTPClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, data
+}
+
+func TestPresignGetObject(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("downloads", "report.csv", []byte("a,b\n1,2\n"), time.Now())
+
+	presigned, err := s3utils.PresignGetObject(client, "downloads", "report.csv", s3utils.PresignOptions{ContentType: "text/csv"})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodGet, presigned.Method)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), presigned.Expires, time.Minute)
+
+	req, err := http.NewRequest(presigned.Method, presigned.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Config.HTTPClient.Do(req)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "a,b\n1,2\n", string(data))
+
+	// The URL is only valid for the key it was signed for.
+	tampered := presigned
+	tampered.URL = strings.Replace(presigned.URL, "report.csv", "secret.csv", 1)
+	status, _ := sendPresigned(t, client, tampered, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	t.Run("expired", func(t *testing.T) {
+		presigned, err := s3utils.PresignGetObject(client, "downloads", "report.csv", s3utils.PresignOptions{Expiry: time.Second})
+		require.NoError(t, err)
+		time.Sleep(1100 * time.Millisecond)
+
+		status, body := sendPresigned(t, client, presigned, nil, nil)
+		assert.Equal(t, http.StatusForbidden, status)
+		assert.Contains(t, string(body), "AccessDenied")
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := s3utils.PresignGetObject(client, "downloads", "report.csv", s3utils.PresignOptions{Expiry: 8 * 24 * time.Hour})
+		assert.Error(t, err)
+		_, err = s3utils.PresignGetObject(client, "downloads", "report.csv", s3utils.PresignOptions{ContentMD5: make([]byte, md5.Size)})
+		assert.Error(t, err)
+	})
+}
+
+func TestPresignPutObject(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("uploads", "placeholder", nil, time.Now())
+
+	content := []byte(`{"status":"ok"}`)
+	sum := md5.Sum(content)
+	presigned, err := s3utils.PresignPutObject(client, "uploads", "status.json", s3utils.PresignOptions{
+		Expiry:      time.Hour,
+		ContentType: "application/json",
+		ContentMD5:  sum[:],
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, presigned.Method)
+	assert.Equal(t, "application/json", presigned.Header.Get("Content-Type"))
+
+	t.Run("other content type", func(t *testing.T) {
+		header := presigned.Header.Clone()
+		header.Set("Content-Type", "text/html")
+		status, body := sendPresigned(t, client, presigned, header, content)
+		assert.Equal(t, http.StatusForbidden, status)
+		assert.Contains(t, string(body), "SignatureDoesNotMatch")
+	})
+
+	t.Run("other content", func(t *testing.T) {
+		status, body := sendPresigned(t, client, presigned, presigned.Header.Clone(), []byte(`{"status":"pwned"}`))
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, string(body), "BadDigest")
+	})
+
+	status, _ := sendPresigned(t, client, presigned, presigned.Header.Clone(), content)
+	assert.Equal(t, http.StatusOK, status)
+	data, ok := fake.object("uploads", "status.json")
+	require.True(t, ok)
+	assert.Equal(t, content, data)
+
+	_, err = s3utils.PresignPutObject(client, "uploads", "status.json", s3utils.PresignOptions{ContentMD5: []byte("short")})
+	assert.Error(t, err)
+}
+
+// postForm posts the fields of a presigned POST upload and
+// a file, returning the status code of the response.
+func postForm(t *testing.T, client *s3.S3, post s3utils.PresignedPost, fields map[string]string, filename string, content []byte) (int, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, form.WriteField(name, value))
+	}
+	file, err := form.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = file.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	resp, err := client.Config.HTTPClient.Post(post.URL, form.FormDataContentType(), &body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+func TestPresignPostPolicy(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("uploads", "placeholder", nil, time.Now())
+
+	post, err := s3utils.PresignPostPolicy(client, "uploads", s3utils.PostPolicyOptions{
+		KeyPrefix:   "avatars/",
+		ContentType: "image/png",
+		MinSize:     1,
+		MaxSize:     16,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "avatars/${filename}", post.Fields["key"])
+
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		content  string
+		wantCode string
+	}{
+		{name: "valid", content: "png"},
+		{name: "too large", content: strings.Repeat("x", 17), wantCode: "EntityTooLarge"},
+		{name: "too small", content: "", wantCode: "EntityTooSmall"},
+		{name: "outside prefix", fields: map[string]string{"key": "config/${filename}"}, content: "png", wantCode: "AccessDenied"},
+		{name: "other content type", fields: map[string]string{"Content-Type": "text/html"}, content: "png", wantCode: "AccessDenied"},
+		{name: "unsigned field", fields: map[string]string{"acl": "public-read"}, content: "png", wantCode: "AccessDenied"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]string{}
+			for name, value := range post.Fields {
+				fields[name] = value
+			}
+			for name, value := range tc.fields {
+				fields[name] = value
+			}
+
+			status, body := postForm(t, client, post, fields, "me.png", []byte(tc.content))
+			if tc.wantCode != "" {
+				assert.Contains(t, body, tc.wantCode)
+				return
+			}
+			assert.Equal(t, http.StatusNoContent, status)
+		})
+	}
+
+	assert.Equal(t, []string{"avatars/me.png", "placeholder"}, fake.keys("uploads"))
+
+	_, err = s3utils.PresignPostPolicy(client, "uploads", s3utils.PostPolicyOptions{Key: "a", KeyPrefix: "b/"})
+	assert.Error(t, err)
+	_, err = s3utils.PresignPostPolicy(client, "uploads", s3utils.PostPolicyOptions{MinSize: 10, MaxSize: 5})
+	assert.Error(t, err)
+}
@@ -0,0 +1,310 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// resumableUpload is the state of a resumable upload as
+// saved to its state file after every uploaded part.
+type resumableUpload struct {
+	Bucket   string           `json:"bucket"`
+	Key      string           `json:"key"`
+	UploadID string           `json:"upload_id"`
+	Size     int64            `json:"size"`
+	ModTime  time.Time        `json:"mod_time"`
+	PartSize int64            `json:"part_size"`
+	Parts    map[int64]string `json:"parts"`
+}
+
+// UploadFileResumable uploads the file at filePath to the input key of
+// the bucket specified by bucketName as a multipart upload, saving its
+// progress to the state file at statePath after every part. If the
+// upload is interrupted, even by a process restart, calling it again
+// with the same state file uploads only the parts that are missing.
+// If the file changed in the meantime, the previous upload is aborted
+// and a new one is started. The state file is removed once the upload
+// completes.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to upload to.
+// key: The key of the object to upload.
+// filePath: The file path of the file to upload.
+// statePath: The file path of the state file.
+// opts: The options of the upload. Progress is reported per part.
+//
+// **Returns:**
+//
+// UploadResult: A description of the uploaded object.
+// error: An error if the file could not be uploaded.
+func UploadFileResumable(client *s3.S3, bucketName string, key string, filePath string, statePath string, opts PutObjectOptions) (UploadResult, error) {
+	input, err := uploadInput(bucketName, key, opts)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	partSize := opts.PartSize
+	if partSize == 0 {
+		partSize = s3manager.DefaultUploadPartSize
+	}
+	if partSize < s3manager.MinUploadPartSize {
+		return UploadResult{}, fmt.Errorf("part size must be at least %d bytes", s3manager.MinUploadPartSize)
+	}
+	if info.Size()/partSize >= s3manager.MaxUploadParts {
+		partSize = info.Size()/s3manager.MaxUploadParts + 1
+	}
+
+	upload, err := resumeUpload(client, statePath, bucketName, key, info, partSize)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if upload == nil {
+		create := &s3.CreateMultipartUploadInput{}
+		awsutil.Copy(create, input)
+		out, err := client.CreateMultipartUpload(create)
+		if err != nil {
+			return UploadResult{}, fmt.Errorf("error starting upload of %s to %s: %v", key, bucketName, err)
+		}
+
+		upload = &resumableUpload{
+			Bucket:   bucketName,
+			Key:      key,
+			UploadID: aws.StringValue(out.UploadId),
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			PartSize: partSize,
+			Parts:    map[int64]string{},
+		}
+		if err := upload.save(statePath); err != nil {
+			return UploadResult{}, err
+		}
+	}
+
+	if err := upload.uploadParts(client, file, statePath, input, opts); err != nil {
+		return UploadResult{}, err
+	}
+
+	parts := make([]*s3.CompletedPart, 0, len(upload.Parts))
+	for number, etag := range upload.Parts {
+		parts = append(parts, &s3.CompletedPart{PartNumber: aws.Int64(number), ETag: aws.String(etag)})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+
+	out, err := client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucketName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(upload.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("error completing upload of %s to %s: %v", key, bucketName, err)
+	}
+
+	if err := os.Remove(statePath); err != nil {
+		return UploadResult{}, err
+	}
+
+	return UploadResult{
+		Location:  aws.StringValue(out.Location),
+		ETag:      aws.StringValue(out.ETag),
+		VersionID: aws.StringValue(out.VersionId),
+	}, nil
+}
+
+// resumeUpload loads the state file and returns the upload to resume,
+// with the parts S3 has received, or nil if a new upload must be
+// started because there is no state, the file changed or the upload
+// no longer exists.
+func resumeUpload(client *s3.S3, statePath, bucketName, key string, info os.FileInfo, partSize int64) (*resumableUpload, error) {
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var upload resumableUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("error reading state file %s: %v", statePath, err)
+	}
+	if upload.Bucket != bucketName || upload.Key != key {
+		return nil, fmt.Errorf("state file %s belongs to the upload of %s to %s", statePath, upload.Key, upload.Bucket)
+	}
+
+	if upload.Size != info.Size() || !upload.ModTime.Equal(info.ModTime()) || upload.PartSize != partSize {
+		if _, err := client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucketName),
+			Key:      aws.String(key),
+			UploadId: aws.String(upload.UploadID),
+		}); err != nil && !isNoSuchUpload(err) {
+			return nil, fmt.Errorf("error aborting outdated upload of %s to %s: %v", key, bucketName, err)
+		}
+		return nil, nil
+	}
+
+	// S3 is authoritative about which parts it has received, as the
+	// process may have stopped before saving the state of a part.
+	upload.Parts = map[int64]string{}
+	if err := client.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(upload.UploadID),
+	}, func(page *s3.ListPartsOutput, _ bool) bool {
+		for _, part := range page.Parts {
+			upload.Parts[aws.Int64Value(part.PartNumber)] = aws.StringValue(part.ETag)
+		}
+		return true
+	}); err != nil {
+		if isNoSuchUpload(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error listing parts of %s in %s: %v", key, bucketName, err)
+	}
+
+	return &upload, nil
+}
+
+// uploadParts uploads the parts that are missing concurrently,
+// saving the state after each part.
+func (u *resumableUpload) uploadParts(client *s3.S3, file io.ReaderAt, statePath string, input *s3manager.UploadInput, opts PutObjectOptions) error {
+	numParts := (u.Size + u.PartSize - 1) / u.PartSize
+	// An empty file is uploaded as a single empty part.
+	numParts = max(numParts, 1)
+
+	var done int64
+	var missing []int64
+	for number := int64(1); number <= numParts; number++ {
+		if _, ok := u.Parts[number]; ok {
+			done += u.partLength(number)
+			continue
+		}
+		missing = append(missing, number)
+	}
+	object := newTransferTracker(opts.Progress, opts.RateLimiter).object(u.Key, done, u.Size)
+
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = s3manager.DefaultUploadConcurrency
+	}
+
+	var mu sync.Mutex
+	var firstErr error
+	numbers := make(chan int64)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+				if failed {
+					continue
+				}
+
+				length := u.partLength(number)
+				object.wait(int(length))
+				out, err := client.UploadPart(&s3.UploadPartInput{
+					Bucket:               input.Bucket,
+					Key:                  input.Key,
+					UploadId:             aws.String(u.UploadID),
+					PartNumber:           aws.Int64(number),
+					Body:                 io.NewSectionReader(file, (number-1)*u.PartSize, length),
+					SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+					SSECustomerKey:       input.SSECustomerKey,
+				})
+
+				mu.Lock()
+				if err == nil {
+					u.Parts[number] = aws.StringValue(out.ETag)
+					err = u.save(statePath)
+				} else {
+					err = fmt.Errorf("error uploading part %d of %s: %v", number, u.Key, err)
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+
+				if err == nil {
+					object.report(int(length))
+				}
+			}
+		}()
+	}
+	for _, number := range missing {
+		numbers <- number
+	}
+	close(numbers)
+	wg.Wait()
+
+	return firstErr
+}
+
+// partLength returns the length of a part, the last part
+// being shorter unless the size is a multiple of the part size.
+func (u *resumableUpload) partLength(number int64) int64 {
+	return min(u.PartSize, u.Size-(number-1)*u.PartSize)
+}
+
+// save atomically replaces the state file with the current state.
+func (u *resumableUpload) save(statePath string) error {
+	data, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(statePath), "."+filepath.Base(statePath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), statePath); err != nil {
+		return fmt.Errorf("error saving state file %s: %v", statePath, err)
+	}
+	return nil
+}
+
+func isNoSuchUpload(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == s3.ErrCodeNoSuchUpload
+}
@@ -0,0 +1,89 @@
+package s3_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPartSize = 5 * 1024 * 1024
+
+func TestUploadFileResumable(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "placeholder", nil, time.Now())
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "image.iso")
+	statePath := filepath.Join(dir, "image.iso.upload")
+	content := bytes.Repeat([]byte("0123456789abcdef"), (3*testPartSize-1024)/16)
+	require.NoError(t, os.WriteFile(filePath, content, 0644))
+
+	opts := s3utils.PutObjectOptions{PartSize: testPartSize, Concurrency: 1, ContentType: "application/x-iso9660-image"}
+
+	// The upload fails after two of its three parts.
+	fake.failAfter("UploadPart", 2)
+	_, err := s3utils.UploadFileResumable(client, "artifacts", "image.iso", filePath, statePath, opts)
+	require.Error(t, err)
+	assert.FileExists(t, statePath)
+	assert.Empty(t, fake.requestsFor("CompleteMultipartUpload"))
+
+	// Resuming, as after a restart, only uploads the missing part.
+	fake.failAfter("UploadPart", -1)
+	recorder := &progressRecorder{}
+	opts.Progress = recorder
+	result, err := s3utils.UploadFileResumable(client, "artifacts", "image.iso", filePath, statePath, opts)
+	require.NoError(t, err)
+	assert.Contains(t, result.ETag, "-3")
+
+	assert.Len(t, fake.requestsFor("CreateMultipartUpload"), 1)
+	assert.Len(t, fake.requestsFor("ListParts"), 1)
+	assert.Len(t, fake.requestsFor("UploadPart"), 4)
+	assert.NoFileExists(t, statePath)
+
+	data, ok := fake.object("artifacts", "image.iso")
+	require.True(t, ok)
+	assert.Equal(t, content, data)
+
+	require.Len(t, recorder.updates, 1)
+	assert.Equal(t, int64(len(content)), recorder.updates[0].Done)
+	assert.Equal(t, int64(len(content)), recorder.updates[0].Total)
+}
+
+func TestUploadFileResumableChangedFile(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "placeholder", nil, time.Now())
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "data.bin")
+	statePath := filepath.Join(dir, "data.bin.upload")
+	require.NoError(t, os.WriteFile(filePath, bytes.Repeat([]byte("a"), testPartSize+1), 0644))
+
+	opts := s3utils.PutObjectOptions{PartSize: testPartSize, Concurrency: 1}
+	fake.failAfter("UploadPart", 1)
+	_, err := s3utils.UploadFileResumable(client, "artifacts", "data.bin", filePath, statePath, opts)
+	require.Error(t, err)
+
+	// The file changes before the upload is resumed.
+	content := bytes.Repeat([]byte("b"), testPartSize+2)
+	require.NoError(t, os.WriteFile(filePath, content, 0644))
+	fake.failAfter("UploadPart", -1)
+	_, err = s3utils.UploadFileResumable(client, "artifacts", "data.bin", filePath, statePath, opts)
+	require.NoError(t, err)
+
+	assert.Len(t, fake.requestsFor("AbortMultipartUpload"), 1)
+	assert.Len(t, fake.requestsFor("CreateMultipartUpload"), 2)
+	data, _ := fake.object("artifacts", "data.bin")
+	assert.Equal(t, content, data)
+
+	// A state file of another upload is not touched.
+	require.NoError(t, os.WriteFile(statePath, []byte(`{"bucket":"other","key":"data.bin"}`), 0644))
+	_, err = s3utils.UploadFileResumable(client, "artifacts", "data.bin", filePath, statePath, opts)
+	assert.Error(t, err)
+	assert.FileExists(t, statePath)
+}
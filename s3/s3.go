@@ -10,7 +10,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 // Connection is a struct that contains all of the relevant
@@ -118,13 +117,42 @@ func GetBuckets(client *s3.S3) ([]*s3.Bucket, error) {
 
 	result, err := client.ListBuckets(input)
 	if err != nil {
-		return result.Buckets, err
+		return nil, err
 	}
 
 	return result.Buckets, nil
 }
 
-// EmptyBucket deletes everything found in the input bucketName.
+// EmptyBucketOptions is a struct that provides the
+// options used by EmptyBucketWithContext.
+//
+// **Attributes:**
+//
+// Force: Whether to empty a bucket with object lock enabled, bypassing
+// governance mode retention. Versions under compliance mode retention
+// or a legal hold can still not be deleted.
+type EmptyBucketOptions struct {
+	Force bool
+}
+
+// EmptyBucketResult is a struct that reports
+// what was removed from a bucket.
+//
+// **Attributes:**
+//
+// Versions: The number of object versions deleted.
+// DeleteMarkers: The number of delete markers deleted.
+// AbortedUploads: The number of in-progress multipart uploads aborted.
+type EmptyBucketResult struct {
+	Versions       int
+	DeleteMarkers  int
+	AbortedUploads int
+}
+
+// EmptyBucket deletes everything found in the input bucketName,
+// including noncurrent versions and delete markers of versioned
+// buckets and in-progress multipart uploads. Buckets with object
+// lock enabled are refused, see EmptyBucketWithContext.
 //
 // **Parameters:**
 //
@@ -135,16 +163,162 @@ func GetBuckets(client *s3.S3) ([]*s3.Bucket, error) {
 //
 // error: An error if the bucket could not be emptied.
 func EmptyBucket(client *s3.S3, bucketName string) error {
-	iter := s3manager.NewDeleteListIterator(client, &s3.ListObjectsInput{
-		Bucket: aws.String(bucketName),
-	})
+	_, err := EmptyBucketWithContext(aws.BackgroundContext(), client, bucketName, EmptyBucketOptions{})
+	return err
+}
 
-	// Iterate through bucket and delete each discovered object.
-	if err := s3manager.NewBatchDeleteWithClient(client).Delete(aws.BackgroundContext(), iter); err != nil {
-		return err
+// EmptyBucketWithContext aborts the in-progress multipart uploads of
+// the input bucketName and deletes all of its object versions and
+// delete markers, in batches of 1000, so that the bucket can be
+// destroyed. It refuses to empty a bucket with object lock enabled
+// unless opts.Force is set, and a bucket whose object lock
+// configuration can not be read, such as when access is denied.
+//
+// **Parameters:**
+//
+// ctx: The context used to cancel emptying the bucket.
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to empty.
+// opts: The options for emptying the bucket.
+//
+// **Returns:**
+//
+// EmptyBucketResult: What was removed from the bucket, also on error.
+// error: An error if the bucket could not be emptied completely.
+func EmptyBucketWithContext(ctx aws.Context, client *s3.S3, bucketName string, opts EmptyBucketOptions) (EmptyBucketResult, error) {
+	var result EmptyBucketResult
+	bucket := aws.String(bucketName)
+
+	locked, err := objectLockEnabled(ctx, client, bucketName)
+	if err != nil {
+		return result, err
+	}
+	if locked && !opts.Force {
+		return result, fmt.Errorf("bucket %s has object lock enabled, refusing to empty it without force", bucketName)
 	}
 
-	return nil
+	// Uploads are aborted first so that they cannot complete
+	// into new objects while the versions are deleted.
+	var abortErr error
+	if err := client.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{Bucket: bucket},
+		func(page *s3.ListMultipartUploadsOutput, _ bool) bool {
+			for _, upload := range page.Uploads {
+				if _, abortErr = client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+					Bucket:   bucket,
+					Key:      upload.Key,
+					UploadId: upload.UploadId,
+				}); abortErr != nil && !isNoSuchUpload(abortErr) {
+					abortErr = fmt.Errorf("error aborting upload of %s: %v", aws.StringValue(upload.Key), abortErr)
+					return false
+				}
+				abortErr = nil
+				result.AbortedUploads++
+			}
+			return true
+		}); err != nil {
+		return result, fmt.Errorf("error listing multipart uploads of %s: %v", bucketName, err)
+	}
+	if abortErr != nil {
+		return result, abortErr
+	}
+
+	var batch []*s3.ObjectIdentifier
+	markers := map[string]bool{}
+	var deleteErr error
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		out, err := client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket:                    bucket,
+			Delete:                    &s3.Delete{Objects: batch, Quiet: aws.Bool(true)},
+			BypassGovernanceRetention: aws.Bool(opts.Force),
+		})
+		if err != nil {
+			return fmt.Errorf("error deleting objects from %s: %v", bucketName, err)
+		}
+
+		failed := map[string]bool{}
+		for _, e := range out.Errors {
+			failed[aws.StringValue(e.Key)+"\x00"+aws.StringValue(e.VersionId)] = true
+		}
+		for _, id := range batch {
+			version := aws.StringValue(id.Key) + "\x00" + aws.StringValue(id.VersionId)
+			switch {
+			case failed[version]:
+			case markers[version]:
+				result.DeleteMarkers++
+			default:
+				result.Versions++
+			}
+		}
+		batch, markers = nil, map[string]bool{}
+
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("error deleting %d objects from %s, such as %s (version %s): %s: %s",
+				len(out.Errors), bucketName, aws.StringValue(e.Key), aws.StringValue(e.VersionId),
+				aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+		return nil
+	}
+
+	if err := client.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{Bucket: bucket},
+		func(page *s3.ListObjectVersionsOutput, _ bool) bool {
+			add := func(key, versionID *string, marker bool) bool {
+				batch = append(batch, &s3.ObjectIdentifier{Key: key, VersionId: versionID})
+				if marker {
+					markers[aws.StringValue(key)+"\x00"+aws.StringValue(versionID)] = true
+				}
+				if len(batch) == maxDeleteObjects {
+					deleteErr = flush()
+				}
+				return deleteErr == nil
+			}
+
+			for _, version := range page.Versions {
+				if !add(version.Key, version.VersionId, false) {
+					return false
+				}
+			}
+			for _, marker := range page.DeleteMarkers {
+				if !add(marker.Key, marker.VersionId, true) {
+					return false
+				}
+			}
+			return true
+		}); err != nil {
+		return result, fmt.Errorf("error listing object versions of %s: %v", bucketName, err)
+	}
+	if deleteErr != nil {
+		return result, deleteErr
+	}
+
+	return result, flush()
+}
+
+// objectLockEnabled reports whether object lock is enabled on a
+// bucket. Buckets without an object lock configuration, and
+// S3-compatible services that do not implement object lock, are
+// reported as unlocked. Any other error, such as a denied request,
+// is returned as the bucket may be locked.
+func objectLockEnabled(ctx aws.Context, client *s3.S3, bucketName string) (bool, error) {
+	lock, err := client.GetObjectLockConfigurationWithContext(ctx, &s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		switch {
+		case ok && (aerr.Code() == "ObjectLockConfigurationNotFoundError" || aerr.Code() == "NotImplemented"):
+			return false, nil
+		case ok && aerr.Code() == "AccessDenied":
+			return false, fmt.Errorf("access denied getting object lock configuration of %s, "+
+				"s3:GetBucketObjectLockConfiguration is required to check that it is not locked: %v", bucketName, err)
+		default:
+			return false, fmt.Errorf("error getting object lock configuration of %s: %v", bucketName, err)
+		}
+	}
+
+	return lock.ObjectLockConfiguration != nil &&
+		aws.StringValue(lock.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled, nil
 }
 
 // DestroyBucket destroys a bucket with the input
@@ -186,6 +360,9 @@ func DestroyBucket(client *s3.S3, bucketName string) error {
 // **Returns:**
 //
 // error: An error if the directory could not be uploaded.
+//
+// Deprecated: Use SyncToBucket, which uses keys relative to the
+// directory, skips unchanged files and uploads concurrently.
 func UploadBucketDir(sess *session.Session, bucketName string, dirPath string) error {
 	if err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if !info.IsDir() {
@@ -216,12 +393,31 @@ func UploadBucketDir(sess *session.Session, bucketName string, dirPath string) e
 //
 // error: An error if the file could not be uploaded.
 func UploadBucketFile(sess *session.Session, bucketName string, uploadFP string) error {
-	uploader := s3manager.NewUploader(sess)
-
-	if _, err := os.Stat(uploadFP); os.IsNotExist(err) {
+	if err := UploadBucketFileWithOptions(sess, bucketName, uploadFP, PutObjectOptions{}); err != nil {
 		return err
 	}
 
+	fmt.Printf("Successfully uploaded %v to %v\n", uploadFP, bucketName)
+
+	return nil
+}
+
+// UploadBucketFileWithOptions uploads a file found at the file path
+// specified with (uploadFP) to the input bucketName, using the file
+// path as key. Use opts.Progress to follow the upload and
+// opts.RateLimiter to limit its bandwidth.
+//
+// **Parameters:**
+//
+// sess: An AWS session.
+// bucketName: The name of the bucket to upload to.
+// uploadFP: The file path of the file to upload.
+// opts: The options of the upload.
+//
+// **Returns:**
+//
+// error: An error if the file could not be uploaded.
+func UploadBucketFileWithOptions(sess *session.Session, bucketName string, uploadFP string, opts PutObjectOptions) error {
 	file, err := os.Open(uploadFP)
 	if err != nil {
 		return err
@@ -229,17 +425,8 @@ func UploadBucketFile(sess *session.Session, bucketName string, uploadFP string)
 
 	defer file.Close()
 
-	if _, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(uploadFP),
-		Body:   file,
-	}); err != nil {
-		return err
-	}
-
-	fmt.Printf("Successfully uploaded %v to %v\n", uploadFP, bucketName)
-
-	return nil
+	_, err = PutObject(s3.New(sess), bucketName, uploadFP, file, opts)
+	return err
 }
 
 // DownloadBucketFile downloads a file found at the object key specified with
@@ -258,25 +445,93 @@ func UploadBucketFile(sess *session.Session, bucketName string, uploadFP string)
 // string: The name of the downloaded file.
 // error: An error if the file could not be downloaded.
 func DownloadBucketFile(sess *session.Session, bucketName string, objectKey string, downloadFP string) (string, error) {
-	downloader := s3manager.NewDownloader(sess)
+	name, err := DownloadBucketFileWithOptions(sess, bucketName, objectKey, downloadFP, GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
 
-	file, err := os.Create(downloadFP)
+	info, err := os.Stat(name)
 	if err != nil {
 		return "", err
 	}
 
-	defer file.Close()
+	fmt.Println("Successfully downloaded", name, info.Size(), "bytes")
 
-	numBytes, err := downloader.Download(file,
-		&s3.GetObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(objectKey),
-		})
+	return name, nil
+}
+
+// DownloadBucketFileWithOptions downloads a file found at the object
+// key specified with the input objectKey from the bucket specified by
+// bucketName, and writes it to downloadFP. Use opts.Progress to follow
+// the download and opts.RateLimiter to limit its bandwidth.
+//
+// **Parameters:**
+//
+// sess: An AWS session.
+// bucketName: The name of the bucket to download from.
+// objectKey: The key of the object to download.
+// downloadFP: The file path to write the downloaded file to.
+// opts: The options of the download.
+//
+// **Returns:**
+//
+// string: The name of the downloaded file.
+// error: An error if the file could not be downloaded.
+func DownloadBucketFileWithOptions(sess *session.Session, bucketName string, objectKey string, downloadFP string, opts GetObjectOptions) (string, error) {
+	file, err := os.Create(downloadFP)
 	if err != nil {
 		return "", err
 	}
 
-	fmt.Println("Successfully downloaded", file.Name(), numBytes, "bytes")
+	defer file.Close()
+
+	if _, err := GetObjectAt(s3.New(sess), bucketName, objectKey, file, opts); err != nil {
+		return "", err
+	}
 
 	return file.Name(), nil
 }
+
+// DownloadPrefix downloads every object under the input prefix of the
+// bucket specified by bucketName into dirPath, recreating the key
+// structure below the prefix as directories. Objects are downloaded
+// concurrently and verified against their ETag where it is a checksum
+// of the content. Keys that would escape dirPath, such as keys
+// containing ../, are rejected before anything is downloaded.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to download from.
+// prefix: The key prefix to download, the whole bucket if empty.
+// dirPath: The directory to download to.
+// workers: The number of concurrent downloads, defaults to 4.
+//
+// **Returns:**
+//
+// []string: The file paths of the downloaded files.
+// error: An error if any of the objects could not be downloaded.
+func DownloadPrefix(client *s3.S3, bucketName string, prefix string, dirPath string, workers int) ([]string, error) {
+	opts := SyncOptions{Prefix: prefix, Workers: workers}
+	objects, err := listRemoteFiles(client, bucketName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &syncer{client: client, bucket: bucketName, dir: dirPath, opts: opts, toLocal: true}
+	downloads := make([]SyncAction, 0, len(objects))
+	for _, rel := range sortedEntryNames(objects) {
+		if _, err := localPath(dirPath, rel); err != nil {
+			return nil, fmt.Errorf("error downloading %s: %v", s.key(rel), err)
+		}
+		downloads = append(downloads, s.action(SyncDownload, objects[rel]))
+	}
+
+	result, err := s.run(downloads, nil)
+	paths := make([]string, 0, len(result.Actions))
+	for _, action := range result.Actions {
+		paths = append(paths, action.Path)
+	}
+
+	return paths, err
+}
@@ -0,0 +1,733 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Comparison modes used by the sync functions to detect changed files.
+const (
+	CompareChecksum = "checksum"
+	CompareModTime  = "mtime"
+)
+
+// Operations of a SyncAction.
+const (
+	SyncUpload   = "upload"
+	SyncDownload = "download"
+	SyncDelete   = "delete"
+)
+
+const (
+	defaultSyncWorkers = 4
+	// maxDeleteObjects is the most keys a single DeleteObjects call accepts.
+	maxDeleteObjects = 1000
+)
+
+// SyncOptions is a struct that provides the options
+// used by SyncToBucket and SyncFromBucket.
+//
+// **Attributes:**
+//
+// Prefix: The key prefix that the directory maps to, the bucket root if empty.
+// Compare: How files are compared, CompareChecksum (the default) or CompareModTime.
+// Include: Globs of relative paths to sync, everything if empty.
+// Exclude: Globs of relative paths to skip, applied after Include.
+// Delete: Whether to delete files from the destination that are missing from the source.
+// DryRun: Whether to only report the actions that would be taken.
+// Workers: The number of concurrent transfers, defaults to 4.
+// Output: Where each action is reported, nothing is reported if nil.
+// Progress: Receives progress updates of the transfers, if set.
+// RateLimiter: Limits the combined bandwidth of the transfers, if set.
+type SyncOptions struct {
+	Prefix      string
+	Compare     string
+	Include     []string
+	Exclude     []string
+	Delete      bool
+	DryRun      bool
+	Workers     int
+	Output      io.Writer
+	Progress    ProgressReporter
+	RateLimiter *RateLimiter
+}
+
+// SyncAction is a struct that describes a
+// single action taken by a sync.
+//
+// **Attributes:**
+//
+// Operation: The operation, SyncUpload, SyncDownload or SyncDelete.
+// Key: The object key.
+// Path: The local file path.
+// Size: The size of the transferred file.
+// Modified: The modification time of the source.
+type SyncAction struct {
+	Operation string
+	Key       string
+	Path      string
+	Size      int64
+	Modified  time.Time
+}
+
+// SyncResult is a struct that summarizes a sync.
+//
+// **Attributes:**
+//
+// Actions: The actions taken, or that would be taken on a dry run, sorted by key.
+// Unchanged: The number of files that were already up to date.
+type SyncResult struct {
+	Actions   []SyncAction
+	Unchanged int
+}
+
+// syncEntry is a file found on either side of a sync.
+type syncEntry struct {
+	rel      string
+	size     int64
+	modified time.Time
+	etag     string
+}
+
+// SyncToBucket uploads the files of a local directory to a bucket
+// under the configured prefix, using keys relative to the directory.
+// Files that are unchanged in the bucket are skipped.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// dirPath: The local directory to upload.
+// bucketName: The name of the bucket to upload to.
+// opts: The options of the sync.
+//
+// **Returns:**
+//
+// SyncResult: A summary of the sync.
+// error: An error if any of the files could not be synced.
+func SyncToBucket(client *s3.S3, dirPath string, bucketName string, opts SyncOptions) (SyncResult, error) {
+	if err := opts.validate(); err != nil {
+		return SyncResult{}, err
+	}
+
+	local, err := listLocalFiles(dirPath, opts)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	remote, err := listRemoteFiles(client, bucketName, opts)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	s := &syncer{client: client, bucket: bucketName, dir: dirPath, opts: opts}
+	var transfers, deletes []SyncAction
+	for _, rel := range sortedEntryNames(local) {
+		src := local[rel]
+		dst, ok := remote[rel]
+		if ok {
+			changed, err := s.changed(src, dst, filepath.Join(dirPath, filepath.FromSlash(rel)), dst.etag, src.modified.After(dst.modified))
+			if err != nil {
+				return SyncResult{}, err
+			}
+			if !changed {
+				s.result.Unchanged++
+				continue
+			}
+		}
+		transfers = append(transfers, s.action(SyncUpload, src))
+	}
+	if opts.Delete {
+		for _, rel := range sortedEntryNames(remote) {
+			if _, ok := local[rel]; !ok {
+				deletes = append(deletes, s.action(SyncDelete, remote[rel]))
+			}
+		}
+	}
+
+	return s.run(transfers, deletes)
+}
+
+// SyncFromBucket downloads the objects under the configured prefix
+// of a bucket to a local directory, using paths relative to the
+// prefix. Files that are unchanged locally are skipped.
+//
+// **Parameters:**
+//
+// client: An AWS S3 client.
+// bucketName: The name of the bucket to download from.
+// dirPath: The local directory to download to.
+// opts: The options of the sync.
+//
+// **Returns:**
+//
+// SyncResult: A summary of the sync.
+// error: An error if any of the objects could not be synced.
+func SyncFromBucket(client *s3.S3, bucketName string, dirPath string, opts SyncOptions) (SyncResult, error) {
+	if err := opts.validate(); err != nil {
+		return SyncResult{}, err
+	}
+
+	remote, err := listRemoteFiles(client, bucketName, opts)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	local, err := listLocalFiles(dirPath, opts)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return SyncResult{}, err
+	}
+
+	s := &syncer{client: client, bucket: bucketName, dir: dirPath, opts: opts, toLocal: true}
+	var transfers, deletes []SyncAction
+	for _, rel := range sortedEntryNames(remote) {
+		if _, err := localPath(dirPath, rel); err != nil {
+			return SyncResult{}, fmt.Errorf("error syncing %s: %v", s.key(rel), err)
+		}
+
+		src := remote[rel]
+		dst, ok := local[rel]
+		if ok {
+			changed, err := s.changed(src, dst, filepath.Join(dirPath, filepath.FromSlash(rel)), src.etag, src.modified.After(dst.modified))
+			if err != nil {
+				return SyncResult{}, err
+			}
+			if !changed {
+				s.result.Unchanged++
+				continue
+			}
+		}
+		transfers = append(transfers, s.action(SyncDownload, src))
+	}
+	if opts.Delete {
+		for _, rel := range sortedEntryNames(local) {
+			if _, ok := remote[rel]; !ok {
+				deletes = append(deletes, s.action(SyncDelete, local[rel]))
+			}
+		}
+	}
+
+	return s.run(transfers, deletes)
+}
+
+// validate checks the options and their glob patterns.
+func (o SyncOptions) validate() error {
+	if o.Compare != "" && o.Compare != CompareChecksum && o.Compare != CompareModTime {
+		return fmt.Errorf("unsupported comparison %q", o.Compare)
+	}
+	for _, pattern := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// selected reports whether a relative path passes the include
+// and exclude globs.
+func (o SyncOptions) selected(rel string) bool {
+	if len(o.Include) > 0 && !matchesAny(o.Include, rel) {
+		return false
+	}
+	return !matchesAny(o.Exclude, rel)
+}
+
+// matchesAny reports whether a relative path matches any of the
+// patterns. Patterns without a slash also match the base name and
+// patterns ending in a slash match everything below that directory.
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(rel, pattern) {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listLocalFiles returns the selected regular files below
+// a directory, keyed by their slash-separated relative path.
+func listLocalFiles(dirPath string, opts SyncOptions) (map[string]syncEntry, error) {
+	files := map[string]syncEntry{}
+	err := filepath.WalkDir(dirPath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dirPath, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !opts.selected(rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = syncEntry{rel: rel, size: info.Size(), modified: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", dirPath, err)
+	}
+
+	return files, nil
+}
+
+// listRemoteFiles returns the selected objects below the prefix
+// of a bucket, keyed by their path relative to the prefix.
+func listRemoteFiles(client *s3.S3, bucketName string, opts SyncOptions) (map[string]syncEntry, error) {
+	prefix := syncPrefix(opts.Prefix)
+
+	objects := map[string]syncEntry{}
+	if err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			rel := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
+			// Skip folder placeholder objects.
+			if rel == "" || strings.HasSuffix(rel, "/") || !opts.selected(rel) {
+				continue
+			}
+			objects[rel] = syncEntry{
+				rel:      rel,
+				size:     aws.Int64Value(obj.Size),
+				modified: aws.TimeValue(obj.LastModified),
+				etag:     aws.StringValue(obj.ETag),
+			}
+		}
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("error listing objects in %s: %v", bucketName, err)
+	}
+
+	return objects, nil
+}
+
+// syncPrefix returns the key prefix of a sync, which
+// is either empty or ends with a slash.
+func syncPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+func sortedEntryNames(entries map[string]syncEntry) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// syncer carries out the actions of a sync.
+type syncer struct {
+	client  *s3.S3
+	bucket  string
+	dir     string
+	opts    SyncOptions
+	toLocal bool
+
+	mu     sync.Mutex
+	result SyncResult
+}
+
+func (s *syncer) key(rel string) string {
+	return syncPrefix(s.opts.Prefix) + rel
+}
+
+func (s *syncer) action(operation string, entry syncEntry) SyncAction {
+	return SyncAction{
+		Operation: operation,
+		Key:       s.key(entry.rel),
+		Path:      filepath.Join(s.dir, filepath.FromSlash(entry.rel)),
+		Size:      entry.size,
+		Modified:  entry.modified,
+	}
+}
+
+// changed reports whether a file present on both sides needs to be
+// transferred. newer reports whether the source is newer than the
+// destination and is only used when comparing modification times.
+func (s *syncer) changed(src, dst syncEntry, filePath, etag string, newer bool) (bool, error) {
+	if src.size != dst.size {
+		return true, nil
+	}
+	if s.opts.Compare == CompareModTime {
+		return newer, nil
+	}
+
+	// A file that can not be verified against the ETag is
+	// transferred again rather than assumed to be unchanged.
+	matches, verified, err := etagMatches(filePath, src.size, etag)
+	if err != nil {
+		return false, fmt.Errorf("error comparing %s: %v", filePath, err)
+	}
+	return !verified || !matches, nil
+}
+
+// run performs the transfers concurrently and then the deletions,
+// or only reports them on a dry run.
+func (s *syncer) run(transfers, deletes []SyncAction) (SyncResult, error) {
+	if s.opts.DryRun {
+		for _, action := range append(transfers, deletes...) {
+			s.report(action)
+		}
+		return s.sortedResult(), nil
+	}
+
+	workers := s.opts.Workers
+	if workers <= 0 {
+		workers = defaultSyncWorkers
+	}
+
+	uploader := s3manager.NewUploaderWithClient(s.client)
+	downloader := s3manager.NewDownloaderWithClient(s.client)
+	// All objects are registered before the first transfer
+	// starts so that the aggregate size is known throughout.
+	tracker := newTransferTracker(s.opts.Progress, s.opts.RateLimiter)
+	objects := make([]*objectTransfer, len(transfers))
+	for i, action := range transfers {
+		objects[i] = tracker.object(action.Key, 0, action.Size)
+	}
+
+	type job struct {
+		action SyncAction
+		object *objectTransfer
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	var errs []error
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var err error
+				if j.action.Operation == SyncUpload {
+					err = s.upload(uploader, j.action, j.object)
+				} else {
+					err = s.download(downloader, j.action, j.object)
+				}
+				s.done(j.action, err, &errs)
+			}
+		}()
+	}
+	for i, action := range transfers {
+		jobs <- job{action: action, object: objects[i]}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if s.toLocal {
+		for _, action := range deletes {
+			s.done(action, os.Remove(action.Path), &errs)
+		}
+	} else {
+		s.deleteObjects(deletes, &errs)
+	}
+
+	return s.sortedResult(), errors.Join(errs...)
+}
+
+// sortedResult returns the result with its actions sorted by key.
+func (s *syncer) sortedResult() SyncResult {
+	sort.SliceStable(s.result.Actions, func(i, j int) bool {
+		return s.result.Actions[i].Key < s.result.Actions[j].Key
+	})
+	return s.result
+}
+
+func (s *syncer) upload(uploader *s3manager.Uploader, action SyncAction, object *objectTransfer) error {
+	file, err := os.Open(action.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(action.Key),
+		Body:   object.reader(file),
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// download writes an object to a temporary file next to its
+// destination, verifies its checksum and renames it into place. The
+// modification time is set to the object's so that later syncs
+// comparing modification times see the file as unchanged.
+func (s *syncer) download(downloader *s3manager.Downloader, action SyncAction, object *objectTransfer) error {
+	if err := os.MkdirAll(filepath.Dir(action.Path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(action.Path), "."+filepath.Base(action.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	// The downloader may fetch the object in several ranged
+	// requests, all of which describe the same object.
+	var once sync.Once
+	var etag, encryption string
+	size, err := downloader.Download(object.writerAt(file), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(action.Key),
+	}, func(d *s3manager.Downloader) {
+		d.RequestOptions = append(d.RequestOptions, func(r *request.Request) {
+			r.Handlers.Complete.PushBack(func(r *request.Request) {
+				out, ok := r.Data.(*s3.GetObjectOutput)
+				if !ok || r.Error != nil {
+					return
+				}
+				once.Do(func() {
+					etag = aws.StringValue(out.ETag)
+					encryption = aws.StringValue(out.ServerSideEncryption)
+					if out.SSECustomerAlgorithm != nil {
+						encryption = "SSE-C"
+					}
+				})
+			})
+		})
+	})
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if etagIsChecksum(etag, encryption) {
+		// The ETag of a multipart upload can only be verified if
+		// its part size is recovered, otherwise the download is kept.
+		matches, verified, err := etagMatches(file.Name(), size, etag)
+		if err != nil {
+			return err
+		}
+		if verified && !matches {
+			return fmt.Errorf("checksum mismatch, downloaded content does not match ETag %s", etag)
+		}
+	}
+
+	if err := os.Rename(file.Name(), action.Path); err != nil {
+		return err
+	}
+	return os.Chtimes(action.Path, action.Modified, action.Modified)
+}
+
+// deleteObjects deletes objects from the bucket in batches.
+func (s *syncer) deleteObjects(actions []SyncAction, errs *[]error) {
+	keys := make([]string, 0, len(actions))
+	for _, action := range actions {
+		keys = append(keys, action.Key)
+	}
+
+	failed := deleteKeys(s.client, s.bucket, keys)
+	for _, action := range actions {
+		s.done(action, failed[action.Key], errs)
+	}
+}
+
+// deleteKeys deletes keys from the bucket in batches and returns
+// the error of each key that could not be deleted.
+func deleteKeys(client *s3.S3, bucketName string, keys []string) map[string]error {
+	failed := map[string]error{}
+	for start := 0; start < len(keys); start += maxDeleteObjects {
+		batch := keys[start:min(start+maxDeleteObjects, len(keys))]
+
+		objects := make([]*s3.ObjectIdentifier, 0, len(batch))
+		for _, key := range batch {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		out, err := client.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			for _, key := range batch {
+				failed[key] = err
+			}
+			continue
+		}
+
+		for _, e := range out.Errors {
+			failed[aws.StringValue(e.Key)] = fmt.Errorf("%s: %s", aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+	}
+	return failed
+}
+
+// done records the outcome of an action.
+func (s *syncer) done(action SyncAction, err error, errs *[]error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("error during %s of %s: %v", action.Operation, action.Key, err))
+		return
+	}
+	s.report(action)
+}
+
+// report records an action and writes it to the output.
+func (s *syncer) report(action SyncAction) {
+	s.result.Actions = append(s.result.Actions, action)
+	if s.opts.Output == nil {
+		return
+	}
+
+	dryRun := ""
+	if s.opts.DryRun {
+		dryRun = "(dryrun) "
+	}
+	object := fmt.Sprintf("s3://%s/%s", s.bucket, action.Key)
+	switch action.Operation {
+	case SyncUpload:
+		fmt.Fprintf(s.opts.Output, "%supload: %s to %s\n", dryRun, action.Path, object)
+	case SyncDownload:
+		fmt.Fprintf(s.opts.Output, "%sdownload: %s to %s\n", dryRun, object, action.Path)
+	case SyncDelete:
+		target := object
+		if s.toLocal {
+			target = action.Path
+		}
+		fmt.Fprintf(s.opts.Output, "%sdelete: %s\n", dryRun, target)
+	}
+}
+
+// etagIsChecksum reports whether the ETag of an object is derived
+// from the MD5 of its content, which is not the case for objects
+// encrypted with SSE-KMS or SSE-C.
+func etagIsChecksum(etag, encryption string) bool {
+	if etag == "" || encryption == "SSE-C" || strings.HasPrefix(encryption, s3.ServerSideEncryptionAwsKms) {
+		return false
+	}
+	return true
+}
+
+// localPath joins a slash-separated relative path to a directory,
+// rejecting paths that are absolute or would escape the directory.
+func localPath(dirPath, rel string) (string, error) {
+	native := filepath.FromSlash(rel)
+	if !filepath.IsLocal(native) {
+		return "", fmt.Errorf("path %s escapes %s", rel, dirPath)
+	}
+	return filepath.Join(dirPath, native), nil
+}
+
+// etagMatches reports whether a local file has the content described
+// by an object's ETag. Single part uploads have the MD5 of the content
+// as ETag, while multipart uploads have the MD5 of the concatenated
+// part MD5s followed by the number of parts. The part size of a
+// multipart upload is not recorded, so the common part sizes are tried
+// and verified is false if none of them produces the ETag, as the
+// object may have been uploaded with another part size. ETags of
+// objects encrypted with SSE-KMS never match, use CompareModTime for
+// such buckets.
+func etagMatches(filePath string, size int64, etag string) (matches, verified bool, err error) {
+	etag = strings.Trim(etag, `"`)
+	_, partsStr, multipart := strings.Cut(etag, "-")
+	if !multipart {
+		sum, err := fileETag(filePath, size, 0)
+		return sum == etag, err == nil, err
+	}
+
+	parts, err := strconv.ParseInt(partsStr, 10, 64)
+	if err != nil || parts <= 0 {
+		return false, false, nil
+	}
+
+	const mib = 1024 * 1024
+	candidates := []int64{
+		s3manager.DefaultUploadPartSize,
+		8 * mib,
+		16 * mib,
+		(size + parts - 1) / parts,
+		((size+parts-1)/parts + mib - 1) / mib * mib,
+	}
+	tried := map[int64]bool{}
+	for _, partSize := range candidates {
+		if partSize <= 0 || tried[partSize] || (size+partSize-1)/partSize != parts {
+			continue
+		}
+		tried[partSize] = true
+
+		sum, err := fileETag(filePath, size, partSize)
+		if err != nil {
+			return false, false, err
+		}
+		if sum == etag {
+			return true, true, nil
+		}
+	}
+
+	return false, false, nil
+}
+
+// fileETag returns the ETag S3 computes for a file uploaded in
+// parts of partSize bytes, or in a single part if partSize is 0.
+func fileETag(filePath string, size, partSize int64) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if partSize == 0 {
+		hash := md5.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	combined := md5.New()
+	parts := 0
+	for offset := int64(0); offset < size; offset += partSize {
+		hash := md5.New()
+		if _, err := io.Copy(hash, io.NewSectionReader(file, offset, partSize)); err != nil {
+			return "", err
+		}
+		combined.Write(hash.Sum(nil))
+		parts++
+	}
+
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(combined.Sum(nil)), parts), nil
+}
@@ -0,0 +1,264 @@
+package s3_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	}
+}
+
+func actionSummary(result s3utils.SyncResult) []string {
+	var summary []string
+	for _, action := range result.Actions {
+		summary = append(summary, action.Operation+" "+action.Key)
+	}
+	return summary
+}
+
+func TestSyncToBucket(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"a.txt":     "unchanged",
+		"sub/b.log": "new",
+		"sub/c.txt": "changed",
+		"skip.tmp":  "excluded",
+	})
+	now := time.Now()
+	fake.addObject("sync", "backup/a.txt", []byte("unchanged"), now)
+	fake.addObject("sync", "backup/sub/c.txt", []byte("CHANGED"), now)
+	fake.addObject("sync", "backup/old.txt", []byte("extraneous"), now)
+	fake.addObject("sync", "backup/keep.tmp", []byte("excluded"), now)
+	fake.addObject("sync", "other/x.txt", []byte("outside prefix"), now)
+
+	opts := s3utils.SyncOptions{
+		Prefix:  "backup/",
+		Exclude: []string{"*.tmp"},
+		Delete:  true,
+		DryRun:  true,
+		Workers: 2,
+	}
+	var out bytes.Buffer
+	opts.Output = &out
+
+	result, err := s3utils.SyncToBucket(client, dir, "sync", opts)
+	require.NoError(t, err)
+	want := []string{"delete backup/old.txt", "upload backup/sub/b.log", "upload backup/sub/c.txt"}
+	assert.Equal(t, want, actionSummary(result))
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Contains(t, out.String(), "(dryrun) upload: "+filepath.Join(dir, "sub", "b.log")+" to s3://sync/backup/sub/b.log")
+	assert.Contains(t, out.String(), "(dryrun) delete: s3://sync/backup/old.txt")
+	assert.Empty(t, fake.requestsFor("PutObject"))
+	assert.Empty(t, fake.requestsFor("DeleteObjects"))
+
+	opts.DryRun = false
+	out.Reset()
+	result, err = s3utils.SyncToBucket(client, dir, "sync", opts)
+	require.NoError(t, err)
+	assert.Equal(t, want, actionSummary(result))
+	assert.NotContains(t, out.String(), "(dryrun)")
+
+	assert.Equal(t, []string{
+		"backup/a.txt",
+		"backup/keep.tmp",
+		"backup/sub/b.log",
+		"backup/sub/c.txt",
+		"other/x.txt",
+	}, fake.keys("sync"))
+	data, _ := fake.object("sync", "backup/sub/c.txt")
+	assert.Equal(t, "changed", string(data))
+
+	result, err = s3utils.SyncToBucket(client, dir, "sync", opts)
+	require.NoError(t, err)
+	assert.Empty(t, result.Actions)
+	assert.Equal(t, 3, result.Unchanged)
+}
+
+// multipartETag returns the ETag S3 gives content
+// uploaded in parts of partSize bytes.
+func multipartETag(content []byte, partSize int) string {
+	combined := md5.New()
+	parts := 0
+	for start := 0; start < len(content); start += partSize {
+		sum := md5.Sum(content[start:min(start+partSize, len(content))])
+		combined.Write(sum[:])
+		parts++
+	}
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(combined.Sum(nil)), parts)
+}
+
+func TestSyncToBucketMultipartETag(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	dir := t.TempDir()
+
+	const partSize = 5 * 1024 * 1024
+	content := bytes.Repeat([]byte("x"), partSize+10)
+	writeTestFiles(t, dir, map[string]string{"large.bin": string(content)})
+
+	fake.addObject("sync", "large.bin", content, time.Now())
+	fake.setETag("sync", "large.bin", multipartETag(content, partSize))
+
+	result, err := s3utils.SyncToBucket(client, dir, "sync", s3utils.SyncOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Actions)
+	assert.Equal(t, 1, result.Unchanged)
+}
+
+func TestSyncFromBucket(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"stale.txt":  "gone from the bucket",
+		"index.html": "<p>old</p>",
+	})
+	modified := time.Now().Add(-time.Hour)
+	// Same size as the object, but older.
+	older := modified.Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "index.html"), older, older))
+	fake.addObject("site", "www/index.html", []byte("<p>new</p>"), modified)
+	fake.addObject("site", "www/css/site.css", []byte("body {}"), modified)
+	fake.addObject("site", "www/assets/", nil, modified)
+
+	opts := s3utils.SyncOptions{Prefix: "www", Compare: s3utils.CompareModTime, Delete: true}
+	result, err := s3utils.SyncFromBucket(client, "site", dir, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"download www/css/site.css", "download www/index.html", "delete www/stale.txt"}, actionSummary(result))
+
+	data, err := os.ReadFile(filepath.Join(dir, "css", "site.css"))
+	require.NoError(t, err)
+	assert.Equal(t, "body {}", string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "stale.txt"))
+	assert.NoDirExists(t, filepath.Join(dir, "assets"))
+
+	info, err := os.Stat(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(modified.UTC().Truncate(time.Second)))
+
+	result, err = s3utils.SyncFromBucket(client, "site", dir, opts)
+	require.NoError(t, err)
+	assert.Empty(t, result.Actions)
+	assert.Equal(t, 2, result.Unchanged)
+}
+
+func TestSyncFromBucketErrors(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("evil", "www/../../outside.txt", []byte("escape"), time.Now())
+
+	_, err := s3utils.SyncFromBucket(client, "evil", t.TempDir(), s3utils.SyncOptions{Prefix: "www"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "escapes")
+	assert.Empty(t, fake.requestsFor("GetObject"))
+
+	_, err = s3utils.SyncFromBucket(client, "evil", t.TempDir(), s3utils.SyncOptions{Include: []string{"[unclosed"}})
+	assert.Error(t, err)
+
+	_, err = s3utils.SyncFromBucket(client, "evil", t.TempDir(), s3utils.SyncOptions{Compare: "size"})
+	assert.Error(t, err)
+}
+
+func TestDownloadPrefix(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	// More objects than fit in a single listing page.
+	for i := 0; i < 1005; i++ {
+		fake.addObject("artifacts", fmt.Sprintf("build/42/part-%04d.txt", i), []byte(fmt.Sprint(i)), time.Now())
+	}
+	fake.addObject("artifacts", "build/42/bin/tool", []byte("#!/bin/sh"), time.Now())
+	fake.addObject("artifacts", "build/43/other.txt", []byte("not included"), time.Now())
+
+	dir := t.TempDir()
+	paths, err := s3utils.DownloadPrefix(client, "artifacts", "build/42", dir, 8)
+	require.NoError(t, err)
+	require.Len(t, paths, 1006)
+	assert.Equal(t, filepath.Join(dir, "bin", "tool"), paths[0])
+	assert.Len(t, fake.requestsFor("ListObjectsV2"), 2)
+
+	data, err := os.ReadFile(filepath.Join(dir, "part-1004.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "1004", string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "other.txt"))
+}
+
+func TestDownloadPrefixTraversal(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "build/ok.txt", []byte("ok"), time.Now())
+	fake.addObject("artifacts", "build/../../etc/passwd", []byte("root"), time.Now())
+
+	dir := t.TempDir()
+	_, err := s3utils.DownloadPrefix(client, "artifacts", "build", dir, 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "escapes")
+	assert.Empty(t, fake.requestsFor("GetObject"))
+	assert.NoFileExists(t, filepath.Join(dir, "ok.txt"))
+}
+
+func TestDownloadPrefixChecksum(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "build/corrupt.txt", []byte("corrupt"), time.Now())
+	fake.setETag("artifacts", "build/corrupt.txt", `"00000000000000000000000000000000"`)
+
+	// The ETag of an SSE-KMS object is not a checksum of its content.
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String("artifacts"),
+		Key:                  aws.String("build/kms.txt"),
+		Body:                 bytes.NewReader([]byte("encrypted")),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+	})
+	require.NoError(t, err)
+	fake.setETag("artifacts", "build/kms.txt", `"11111111111111111111111111111111"`)
+
+	dir := t.TempDir()
+	paths, err := s3utils.DownloadPrefix(client, "artifacts", "build", dir, 2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+	assert.Equal(t, []string{filepath.Join(dir, "kms.txt")}, paths)
+	assert.NoFileExists(t, filepath.Join(dir, "corrupt.txt"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files must be removed")
+}
+
+func TestDownloadPrefixUnrecoverablePartSize(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+
+	// None of the part sizes tried for verification produce
+	// four parts of this content, as with an upload using an
+	// uncommon part size such as 64 MiB.
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	fake.addObject("artifacts", "build/large.bin", content, time.Now())
+	fake.setETag("artifacts", "build/large.bin", multipartETag(content, 30))
+
+	dir := t.TempDir()
+	paths, err := s3utils.DownloadPrefix(client, "artifacts", "build", dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "large.bin")}, paths)
+
+	got, err := os.ReadFile(filepath.Join(dir, "large.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Without a verified checksum the file is transferred again.
+	result, err := s3utils.SyncToBucket(client, dir, "artifacts", s3utils.SyncOptions{Prefix: "build"})
+	require.NoError(t, err)
+	assert.Len(t, result.Actions, 1)
+}
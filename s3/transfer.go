@@ -0,0 +1,311 @@
+package s3
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TransferProgress is a struct that describes the
+// progress of a transfer.
+//
+// **Attributes:**
+//
+// Key: The key of the object that progressed.
+// Done: The number of bytes of the object transferred so far.
+// Total: The size of the object, or -1 if it is not known.
+// AggregateDone: The number of bytes of all objects transferred so far.
+// AggregateTotal: The size of all objects, or -1 if any size is not known.
+type TransferProgress struct {
+	Key            string
+	Done           int64
+	Total          int64
+	AggregateDone  int64
+	AggregateTotal int64
+}
+
+// ProgressReporter is an interface for receiving progress updates of
+// transfers. Progress is called every time bytes of an object are
+// transferred, from a single goroutine at a time, and should return
+// quickly as it delays the transfer.
+type ProgressReporter interface {
+	Progress(progress TransferProgress)
+}
+
+// ProgressFunc is an adapter to use a function as ProgressReporter.
+type ProgressFunc func(progress TransferProgress)
+
+// Progress calls f(progress).
+func (f ProgressFunc) Progress(progress TransferProgress) {
+	f(progress)
+}
+
+// RateLimiter limits the bandwidth of the transfers using it to a
+// number of bytes per second, allowing bursts of up to one second
+// worth of bytes. A RateLimiter may be shared by concurrent transfers.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that allows the input
+// number of bytes per second. A rate that is not positive means
+// no limit, for which nil is returned.
+//
+// **Parameters:**
+//
+// bytesPerSecond: The number of bytes per second to allow.
+//
+// **Returns:**
+//
+// *RateLimiter: The rate limiter, or nil if the rate is not positive.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n bytes may be transferred. The bytes are taken
+// from the budget immediately, so that a large transfer delays the
+// transfers after it rather than waiting for the budget to fill up.
+func (l *RateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// transferTracker aggregates the progress of the objects
+// of one or more transfers and applies their rate limit.
+type transferTracker struct {
+	reporter ProgressReporter
+	limiter  *RateLimiter
+
+	mu      sync.Mutex
+	done    int64
+	total   int64
+	unknown bool
+}
+
+// objectTransfer is the progress of a single object.
+type objectTransfer struct {
+	tracker *transferTracker
+	key     string
+	done    int64
+	total   int64
+	// covered holds the byte ranges transferred through
+	// io.ReaderAt and io.WriterAt, which may be read or
+	// written more than once.
+	covered byteRanges
+}
+
+// byteRanges is a set of byte ranges, kept sorted
+// and with overlapping or adjacent ranges merged.
+type byteRanges [][2]int64
+
+// add adds the bytes from start to end to the set and returns
+// the number of them that were not in it yet.
+func (r *byteRanges) add(start, end int64) int64 {
+	added := end - start
+	merged := [][2]int64{}
+	for _, existing := range *r {
+		if existing[1] < start || existing[0] > end {
+			merged = append(merged, existing)
+			continue
+		}
+		added -= max(0, min(end, existing[1])-max(start, existing[0]))
+		start, end = min(start, existing[0]), max(end, existing[1])
+	}
+
+	i := sort.Search(len(merged), func(i int) bool { return merged[i][0] > start })
+	merged = append(merged[:i], append([][2]int64{{start, end}}, merged[i:]...)...)
+	*r = merged
+	return added
+}
+
+// newTransferTracker returns a tracker for the reporter and limiter,
+// or nil if both are nil so that transfers are left untouched.
+func newTransferTracker(reporter ProgressReporter, limiter *RateLimiter) *transferTracker {
+	if reporter == nil && limiter == nil {
+		return nil
+	}
+	return &transferTracker{reporter: reporter, limiter: limiter}
+}
+
+// object registers an object of total bytes, -1 if not known,
+// of which done bytes have already been transferred.
+func (t *transferTracker) object(key string, done, total int64) *objectTransfer {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if total < 0 {
+		t.unknown = true
+	} else {
+		t.total += total
+	}
+	t.done += done
+	return &objectTransfer{tracker: t, key: key, done: done, total: total}
+}
+
+// wait blocks until the rate limit allows n more bytes.
+func (o *objectTransfer) wait(n int) {
+	if o != nil {
+		o.tracker.limiter.wait(n)
+	}
+}
+
+// cover records that the n bytes at off were transferred and
+// returns how many of them were not transferred before, so that
+// bytes transferred again, such as by a retried part, count once.
+func (o *objectTransfer) cover(off int64, n int) int {
+	if o == nil || n <= 0 {
+		return 0
+	}
+
+	o.tracker.mu.Lock()
+	defer o.tracker.mu.Unlock()
+	return int(o.covered.add(off, off+int64(n)))
+}
+
+// report records that n more bytes were transferred.
+func (o *objectTransfer) report(n int) {
+	if o == nil || n <= 0 {
+		return
+	}
+
+	t := o.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o.done += int64(n)
+	t.done += int64(n)
+	if t.reporter == nil {
+		return
+	}
+
+	total := t.total
+	if t.unknown {
+		total = -1
+	}
+	t.reporter.Progress(TransferProgress{
+		Key:            o.key,
+		Done:           o.done,
+		Total:          o.total,
+		AggregateDone:  t.done,
+		AggregateTotal: total,
+	})
+}
+
+// reader returns r reporting the bytes read from it. If r is an
+// io.ReaderAt and io.ReadSeeker, so is the returned reader, which
+// lets the uploader read parts from it instead of buffering them.
+func (o *objectTransfer) reader(r io.Reader) io.Reader {
+	if o == nil {
+		return r
+	}
+	if ras, ok := r.(readerAtSeeker); ok {
+		return &progressReaderAt{readerAtSeeker: ras, object: o}
+	}
+	return &progressReader{r: r, object: o}
+}
+
+// writer returns w reporting the bytes written to it.
+func (o *objectTransfer) writer(w io.Writer) io.Writer {
+	if o == nil {
+		return w
+	}
+	return &progressWriter{w: w, object: o}
+}
+
+// writerAt returns w reporting the bytes written to it.
+func (o *objectTransfer) writerAt(w io.WriterAt) io.WriterAt {
+	if o == nil {
+		return w
+	}
+	return &progressWriterAt{w: w, object: o}
+}
+
+type progressReader struct {
+	r      io.Reader
+	object *objectTransfer
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.object.wait(n)
+	p.object.report(n)
+	return n, err
+}
+
+// readerAtSeeker is the interface the uploader
+// reads parts from without buffering them.
+type readerAtSeeker interface {
+	io.ReaderAt
+	io.ReadSeeker
+}
+
+// progressReaderAt reports the bytes read through ReadAt. Parts
+// are read more than once, to sign them and to send them, so only
+// the bytes not read before are reported and rate limited.
+type progressReaderAt struct {
+	readerAtSeeker
+	object *objectTransfer
+}
+
+func (p *progressReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.readerAtSeeker.ReadAt(b, off)
+	added := p.object.cover(off, n)
+	p.object.wait(added)
+	p.object.report(added)
+	return n, err
+}
+
+type progressWriter struct {
+	w      io.Writer
+	object *objectTransfer
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.object.wait(len(b))
+	n, err := p.w.Write(b)
+	p.object.report(n)
+	return n, err
+}
+
+type progressWriterAt struct {
+	w      io.WriterAt
+	object *objectTransfer
+}
+
+// WriteAt reports the bytes written, counting the bytes
+// of a retried part that were already written only once.
+func (p *progressWriterAt) WriteAt(b []byte, off int64) (int, error) {
+	p.object.wait(len(b))
+	n, err := p.w.WriteAt(b, off)
+	p.object.report(p.object.cover(off, n))
+	return n, err
+}
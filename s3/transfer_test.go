@@ -0,0 +1,204 @@
+package s3_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3utils "github.com/l50/awsutils/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressRecorder records the progress updates it receives.
+type progressRecorder struct {
+	mu      sync.Mutex
+	updates []s3utils.TransferProgress
+}
+
+func (r *progressRecorder) Progress(p s3utils.TransferProgress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, p)
+}
+
+// last returns the last update received for each key.
+func (r *progressRecorder) last() map[string]s3utils.TransferProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last := map[string]s3utils.TransferProgress{}
+	for _, p := range r.updates {
+		last[p.Key] = p
+	}
+	return last
+}
+
+func TestTransferProgress(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "placeholder", nil, time.Now())
+	content := bytes.Repeat([]byte("x"), 64*1024)
+
+	t.Run("put object of known size", func(t *testing.T) {
+		recorder := &progressRecorder{}
+		_, err := s3utils.PutObject(client, "artifacts", "known", bytes.NewReader(content), s3utils.PutObjectOptions{Progress: recorder})
+		require.NoError(t, err)
+
+		last := recorder.last()["known"]
+		assert.Equal(t, int64(len(content)), last.Done)
+		assert.Equal(t, int64(len(content)), last.Total)
+		assert.Equal(t, int64(len(content)), last.AggregateTotal)
+	})
+
+	t.Run("put object of unknown size", func(t *testing.T) {
+		recorder := &progressRecorder{}
+		_, err := s3utils.PutObject(client, "artifacts", "unknown", io.MultiReader(bytes.NewReader(content)), s3utils.PutObjectOptions{Progress: recorder})
+		require.NoError(t, err)
+
+		last := recorder.last()["unknown"]
+		assert.Equal(t, int64(len(content)), last.Done)
+		assert.Equal(t, int64(-1), last.Total)
+		assert.Equal(t, int64(-1), last.AggregateTotal)
+	})
+
+	t.Run("get object", func(t *testing.T) {
+		recorder := &progressRecorder{}
+		_, err := s3utils.GetObject(client, "artifacts", "known", &bytes.Buffer{}, s3utils.GetObjectOptions{Progress: recorder})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), recorder.last()["known"].Done)
+		assert.Equal(t, int64(len(content)), recorder.last()["known"].Total)
+
+		recorder = &progressRecorder{}
+		_, err = s3utils.GetObjectAt(client, "artifacts", "known", aws.NewWriteAtBuffer(nil), s3utils.GetObjectOptions{Progress: recorder})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), recorder.last()["known"].Done)
+		assert.Equal(t, int64(len(content)), recorder.last()["known"].Total)
+	})
+
+	t.Run("sync aggregates objects", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFiles(t, dir, map[string]string{"a.txt": "aaaa", "b/c.txt": "cccccc"})
+
+		recorder := &progressRecorder{}
+		_, err := s3utils.SyncToBucket(client, dir, "artifacts", s3utils.SyncOptions{Prefix: "sync", Progress: recorder})
+		require.NoError(t, err)
+
+		last := recorder.last()
+		assert.Equal(t, int64(4), last["sync/a.txt"].Total)
+		assert.Equal(t, int64(6), last["sync/b/c.txt"].Done)
+		for _, p := range recorder.updates {
+			assert.Equal(t, int64(10), p.AggregateTotal)
+		}
+		assert.Equal(t, int64(10), recorder.updates[len(recorder.updates)-1].AggregateDone)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "placeholder", nil, time.Now())
+
+	// The first second worth of bytes is a burst, the
+	// remaining half second worth has to wait.
+	limiter := s3utils.NewRateLimiter(256 * 1024)
+	content := bytes.Repeat([]byte("x"), 384*1024)
+
+	start := time.Now()
+	_, err := s3utils.PutObject(client, "artifacts", "limited", bytes.NewReader(content), s3utils.PutObjectOptions{RateLimiter: limiter})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	data, _ := fake.object("artifacts", "limited")
+	assert.Equal(t, content, data)
+}
+
+func TestNewRateLimiterUnlimited(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "placeholder", nil, time.Now())
+
+	for _, rate := range []int64{0, -1} {
+		limiter := s3utils.NewRateLimiter(rate)
+		assert.Nil(t, limiter)
+
+		_, err := s3utils.PutObject(client, "artifacts", "unlimited", bytes.NewReader([]byte("data")), s3utils.PutObjectOptions{RateLimiter: limiter})
+		require.NoError(t, err)
+	}
+}
+
+// readAtOnly is a reader whose content can only be read
+// through ReadAt, as a buffered upload would fail.
+type readAtOnly struct {
+	*bytes.Reader
+}
+
+func (r readAtOnly) Read([]byte) (int, error) {
+	return 0, errors.New("read without ReadAt")
+}
+
+func TestTransferProgressPartsReadOnce(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "placeholder", nil, time.Now())
+
+	const partSize = 5 * 1024 * 1024
+	content := bytes.Repeat([]byte("0123456789"), partSize/5)
+
+	// The uploader reads the parts at their offsets, once to sign
+	// them and once to send them, and the bytes are reported once.
+	recorder := &progressRecorder{}
+	_, err := s3utils.PutObject(client, "artifacts", "large.bin", readAtOnly{bytes.NewReader(content)}, s3utils.PutObjectOptions{
+		Progress:    recorder,
+		RateLimiter: s3utils.NewRateLimiter(1 << 30),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), recorder.last()["large.bin"].Done)
+	assert.Contains(t, fake.operations(), "UploadPart")
+	data, _ := fake.object("artifacts", "large.bin")
+	assert.Equal(t, content, data)
+
+	// A part whose body is interrupted is downloaded again.
+	sess, err := session.NewSession(client.Config.Copy().WithMaxRetries(1))
+	require.NoError(t, err)
+	fake.truncateGets(1)
+	recorder = &progressRecorder{}
+	buf := aws.NewWriteAtBuffer(nil)
+	_, err = s3utils.GetObjectAt(s3.New(sess), "artifacts", "large.bin", buf, s3utils.GetObjectOptions{Progress: recorder, PartSize: partSize})
+	require.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+	assert.Len(t, fake.requestsFor("GetObject"), 3)
+	last := recorder.last()["large.bin"]
+	assert.Equal(t, int64(len(content)), last.Done)
+	assert.Equal(t, int64(len(content)), last.AggregateDone)
+}
+
+func TestBucketFileWithOptions(t *testing.T) {
+	client, fake := newFakeS3Client(t, nil)
+	fake.addObject("artifacts", "placeholder", nil, time.Now())
+	sess, err := session.NewSession(&client.Config)
+	require.NoError(t, err)
+
+	uploadFP := filepath.Join(t.TempDir(), "report.txt")
+	require.NoError(t, os.WriteFile(uploadFP, []byte("report"), 0644))
+
+	recorder := &progressRecorder{}
+	require.NoError(t, s3utils.UploadBucketFileWithOptions(sess, "artifacts", uploadFP, s3utils.PutObjectOptions{Progress: recorder}))
+	assert.Equal(t, int64(6), recorder.last()[uploadFP].Done)
+	assert.Equal(t, int64(6), recorder.last()[uploadFP].Total)
+
+	recorder = &progressRecorder{}
+	downloadFP := filepath.Join(t.TempDir(), "report.txt")
+	name, err := s3utils.DownloadBucketFileWithOptions(sess, "artifacts", uploadFP, downloadFP, s3utils.GetObjectOptions{Progress: recorder})
+	require.NoError(t, err)
+	assert.Equal(t, downloadFP, name)
+	assert.Equal(t, int64(6), recorder.last()[uploadFP].Done)
+
+	data, err := os.ReadFile(downloadFP)
+	require.NoError(t, err)
+	assert.Equal(t, "report", string(data))
+}